@@ -0,0 +1,116 @@
+package configman
+
+import (
+        "errors"
+        "time"
+)
+
+var ErrForbidden = errors.New("configman: principal is not allowed to do this")
+var ErrUnknownRole = errors.New("configman: unknown role")
+
+// AllConfigs is the config of a grant that applies to every config.
+const AllConfigs = "*"
+
+// Role is what a principal is allowed to do with a config. Every role
+// includes the roles before it.
+type Role string
+
+const (
+        RoleViewer Role = "viewer" // read configs and settings
+        RoleEditor Role = "editor" // change settings and propose changes
+        RoleAdmin  Role = "admin"  // protect configs, review changes and grant roles
+)
+
+// ParseRole returns the Role whose name is s. ErrUnknownRole is returned
+// if s is not the name of a role.
+func ParseRole(s string) (Role, error) {
+        role := Role(s)
+
+        if role.rank() == 0 {
+                return "", ErrUnknownRole
+        }
+
+        return role, nil
+}
+
+// Includes returns true if this role allows everything other allows.
+// The empty role includes nothing.
+func (role Role) Includes(other Role) bool {
+        return role.rank() > 0 && role.rank() >= other.rank()
+}
+
+// rank orders roles by what they allow. Unknown roles rank zero.
+func (role Role) rank() int {
+        switch role {
+        case RoleViewer:
+                return 1
+        case RoleEditor:
+                return 2
+        case RoleAdmin:
+                return 3
+        default:
+                return 0
+        }
+}
+
+// A Grant gives a principal a role on one config, on every config of a
+// namespace if Config is AllConfigsIn(namespace), or on every config if
+// Config is AllConfigs.
+type Grant struct {
+        Principal string
+        Config    string
+        Role      Role
+}
+
+// RoleOf returns the highest role grants give on config. Only grants on
+// AllConfigs count if config is empty. The empty role is returned if no
+// grant applies.
+func RoleOf(grants []Grant, config string) Role {
+        var role Role
+
+        for _, grant := range grants {
+                applies := grant.Config == AllConfigs ||
+                        config != "" && (grant.Config == config || grant.Config == AllConfigsIn(NamespaceOf(config)))
+
+                if !applies {
+                        continue
+                }
+
+                if grant.Role.rank() > role.rank() {
+                        role = grant.Role
+                }
+        }
+
+        return role
+}
+
+// A Denial records a request that was refused because the principal
+// did not have the required role.
+type Denial struct {
+        Principal string
+        Config    string // empty if the request was not about one config
+        Role      Role   // role that was required
+        Action    string // what was attempted, e.g. "PUT /configs/app/"
+        At        time.Time
+}
+
+// AccessStore is implemented by stores that keep the role based access
+// control model.
+type AccessStore interface {
+        // GrantRole gives principal role on config, replacing any role
+        // principal had on it.
+        GrantRole(principal, config string, role Role) error
+
+        // RevokeRole removes the role principal has on config.
+        RevokeRole(principal, config string) error
+
+        // GetGrants returns the grants of principal, or of every
+        // principal if principal is empty.
+        GetGrants(principal string) ([]Grant, error)
+
+        // RecordDenial stores denial for auditing.
+        RecordDenial(denial Denial) error
+
+        // GetDenials returns the most recent denials, newest first.
+        GetDenials(limit int) ([]Denial, error)
+}
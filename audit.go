@@ -0,0 +1,76 @@
+package configman
+
+import (
+        "crypto/sha256"
+        "encoding/hex"
+        "errors"
+        "fmt"
+        "time"
+)
+
+var ErrAuditTampered = errors.New("configman: audit log has been tampered with")
+
+// An AuditEntry records something a principal did. Entries form a hash
+// chain: the hash of every entry covers its fields and the hash of the
+// entry before it, so changing or removing an entry breaks the chain
+// from there on.
+type AuditEntry struct {
+        ID       int64
+        At       time.Time
+        Actor    string // principal who did it, or the user name of a login
+        Action   string // what was done, e.g. "login" or "PUT /api/v1/grants"
+        Config   string // empty if it was not about one config
+        Setting  string // empty if it was not about one setting
+        Outcome  string // e.g. "ok", "failed" or an HTTP status code
+        PrevHash string
+        Hash     string
+}
+
+// ComputeHash returns the hash entry should have, given its fields and
+// PrevHash. Every field is length prefixed so that no two entries hash
+// the same input.
+func (entry *AuditEntry) ComputeHash() string {
+        h := sha256.New()
+
+        for _, field := range []string{
+                entry.PrevHash,
+                fmt.Sprint(entry.ID),
+                entry.At.UTC().Format(time.RFC3339Nano),
+                entry.Actor,
+                entry.Action,
+                entry.Config,
+                entry.Setting,
+                entry.Outcome,
+        } {
+                fmt.Fprintf(h, "%d:%s", len(field), field)
+        }
+
+        return hex.EncodeToString(h.Sum(nil))
+}
+
+// An AuditQuery selects audit entries. Zero fields match every entry.
+type AuditQuery struct {
+        Actor  string
+        Config string
+        Since  time.Time // entries at or after
+        Until  time.Time // entries before
+        Limit  int       // at most this many, newest first
+}
+
+// AuditStore is implemented by stores that keep a tamper evident audit
+// log.
+type AuditStore interface {
+        // RecordAudit appends entry to the audit log. Its ID and hashes
+        // are set by the store and At if it is zero.
+        RecordAudit(entry AuditEntry) (*AuditEntry, error)
+
+        // QueryAudit returns the entries matching query, newest first.
+        QueryAudit(query AuditQuery) ([]AuditEntry, error)
+
+        // VerifyAudit checks the hash chain of the whole audit log and
+        // returns ErrAuditTampered, naming the first entry that does
+        // not match, if it is broken. Removing the newest entries does
+        // not break the chain; it can only be noticed by comparing the
+        // hash of the newest entry with a copy kept elsewhere.
+        VerifyAudit() error
+}
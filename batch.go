@@ -0,0 +1,141 @@
+package configman
+
+import (
+        "slices"
+        "time"
+
+        "github.com/vlence/gossert"
+)
+
+// OpKind is the kind of change a BatchOp makes to a setting.
+type OpKind string
+
+const (
+        OpCreate OpKind = "create" // create a new setting
+        OpUpdate OpKind = "update" // set the value of an existing setting
+        OpDelete OpKind = "delete" // delete an existing setting
+
+        OpDeprecate OpKind = "deprecate" // deprecate an existing setting
+
+        // OpRename renames a config. It is only recorded in history by
+        // stores that rename configs and cannot be part of a Batch.
+        OpRename OpKind = "rename"
+)
+
+// A BatchOp is a single change to a setting, or to a config for
+// OpRename.
+type BatchOp struct {
+        Kind        OpKind
+        Config      string // new name of the config for OpRename
+        Setting     string // empty for OpRename
+        Value       any    // new value of the setting, only used by OpCreate and OpUpdate
+        Description string // description of the setting for OpCreate, reason for OpDeprecate, old name of the config for OpRename
+
+        // Revision the setting is expected to be at, ignored if zero. If
+        // the setting is at a different revision the batch fails with
+        // ErrConflict. Unused by OpCreate.
+        ExpectedRevision int64
+}
+
+// A Batch is a list of changes to settings of one or more configs.
+// Store.ApplyBatch applies all of them or none of them.
+type Batch struct {
+        Ops []BatchOp
+}
+
+// Create adds an operation that creates a setting to this batch and
+// returns the batch.
+func (batch *Batch) Create(config, setting, desc string, value any) *Batch {
+        gossert.Ok(nil != batch, "configman: cannot add create operation to nil batch")
+        batch.Ops = append(batch.Ops, BatchOp{Kind: OpCreate, Config: config, Setting: setting, Value: value, Description: desc})
+        return batch
+}
+
+// Update adds an operation that sets the value of a setting to this
+// batch and returns the batch.
+func (batch *Batch) Update(config, setting string, value any) *Batch {
+        gossert.Ok(nil != batch, "configman: cannot add update operation to nil batch")
+        batch.Ops = append(batch.Ops, BatchOp{Kind: OpUpdate, Config: config, Setting: setting, Value: value})
+        return batch
+}
+
+// UpdateIf is like Update but the operation fails with ErrConflict
+// unless the setting is at the given revision.
+func (batch *Batch) UpdateIf(config, setting string, value any, revision int64) *Batch {
+        gossert.Ok(nil != batch, "configman: cannot add update operation to nil batch")
+        batch.Ops = append(batch.Ops, BatchOp{Kind: OpUpdate, Config: config, Setting: setting, Value: value, ExpectedRevision: revision})
+        return batch
+}
+
+// Delete adds an operation that deletes a setting to this batch and
+// returns the batch.
+func (batch *Batch) Delete(config, setting string) *Batch {
+        gossert.Ok(nil != batch, "configman: cannot add delete operation to nil batch")
+        batch.Ops = append(batch.Ops, BatchOp{Kind: OpDelete, Config: config, Setting: setting})
+        return batch
+}
+
+// DeleteIf is like Delete but the operation fails with ErrConflict
+// unless the setting is at the given revision.
+func (batch *Batch) DeleteIf(config, setting string, revision int64) *Batch {
+        gossert.Ok(nil != batch, "configman: cannot add delete operation to nil batch")
+        batch.Ops = append(batch.Ops, BatchOp{Kind: OpDelete, Config: config, Setting: setting, ExpectedRevision: revision})
+        return batch
+}
+
+// Deprecate adds an operation that deprecates a setting to this batch
+// and returns the batch.
+func (batch *Batch) Deprecate(config, setting, reason string) *Batch {
+        gossert.Ok(nil != batch, "configman: cannot add deprecate operation to nil batch")
+        batch.Ops = append(batch.Ops, BatchOp{Kind: OpDeprecate, Config: config, Setting: setting, Description: reason})
+        return batch
+}
+
+// Configs returns the names of the configs changed by this batch.
+func (batch *Batch) Configs() []string {
+        gossert.Ok(nil != batch, "configman: cannot return configs of nil batch")
+        return configsOf(batch.Ops)
+}
+
+// A ChangeEvent describes a set of changes that were applied to a store
+// together. Every change event is recorded in the history of the store
+// as a single revision.
+type ChangeEvent struct {
+        Revision int64
+        Ops      []BatchOp
+        By       string
+        At       time.Time
+}
+
+// HistoryStore is implemented by stores that can read back the
+// revisions recorded in their history.
+type HistoryStore interface {
+        // GetHistory returns the most recent revisions that changed
+        // config, newest first. Each change event only holds the
+        // operations on config.
+        GetHistory(config string, limit int) ([]ChangeEvent, error)
+}
+
+// Configs returns the names of the configs changed by this event.
+func (event *ChangeEvent) Configs() []string {
+        gossert.Ok(nil != event, "configman: cannot return configs of nil change event")
+        return configsOf(event.Ops)
+}
+
+// configsOf returns the names of the configs changed by ops in the order
+// they first appear. A renamed config is named by its old and new name.
+func configsOf(ops []BatchOp) []string {
+        configs := make([]string, 0, 1)
+
+        for _, op := range ops {
+                if op.Kind == OpRename && !slices.Contains(configs, op.Description) {
+                        configs = append(configs, op.Description)
+                }
+
+                if !slices.Contains(configs, op.Config) {
+                        configs = append(configs, op.Config)
+                }
+        }
+
+        return configs
+}
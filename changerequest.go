@@ -0,0 +1,74 @@
+package configman
+
+import (
+        "errors"
+        "time"
+
+        "github.com/vlence/gossert"
+)
+
+var ErrProtectedConfig = errors.New("configman: config is protected, changes to it must be approved")
+var ErrSelfReview = errors.New("configman: change cannot be reviewed by the actor who proposed it")
+
+// ChangeStatus is the status of a ChangeRequest.
+type ChangeStatus string
+
+const (
+        StatusPending   ChangeStatus = "pending"   // waiting for review
+        StatusApproved  ChangeStatus = "approved"  // approved and applied
+        StatusRejected  ChangeStatus = "rejected"  // rejected, never applied
+        StatusCancelled ChangeStatus = "cancelled" // its config was deleted
+)
+
+// A ChangeRequest is a proposed change to the value of a setting. It is
+// only applied once another actor approves it.
+type ChangeRequest struct {
+        ID         int64
+        Config     string
+        Setting    string
+        Value      any
+        Status     ChangeStatus
+        ProposedBy string
+        ProposedAt time.Time
+        ReviewedBy string
+        ReviewedAt time.Time // zero while the request is pending
+        Comment    string    // reason given by the reviewer
+}
+
+// Pending returns true if this request has not been reviewed yet.
+func (request *ChangeRequest) Pending() bool {
+        gossert.Ok(nil != request, "configman: cannot return pending status of nil change request")
+        return request.Status == StatusPending
+}
+
+// ChangeRequestStore is implemented by stores that support the approval
+// workflow. Direct writes to a protected config fail with
+// ErrProtectedConfig; its settings can only be changed by approving a
+// change request.
+type ChangeRequestStore interface {
+        // SetProtected marks the given config as protected or not.
+        // ErrNotFound is returned if the config does not exist.
+        SetProtected(config string, protected bool) error
+
+        // Protected returns true if the given config is protected.
+        Protected(config string) (bool, error)
+
+        // ProposeChange stores a pending request to set value on the
+        // given setting. The type of value must match the type of the
+        // setting.
+        ProposeChange(config, setting string, value any, by string) (*ChangeRequest, error)
+
+        // ApproveChange approves the pending change request with the
+        // given id and applies it in the same transaction. ErrSelfReview
+        // is returned if by proposed the change and ErrNotPending if the
+        // request has already been reviewed.
+        ApproveChange(id int64, by string) error
+
+        // RejectChange rejects the pending change request with the given
+        // id. It returns the same errors as ApproveChange.
+        RejectChange(id int64, by, comment string) error
+
+        // GetChangeRequests returns the pending change requests of the
+        // given config, oldest first.
+        GetChangeRequests(config string) ([]*ChangeRequest, error)
+}
@@ -0,0 +1,315 @@
+// Package client implements configman.Store on top of the JSON API of a
+// configman server, so that services can read and change configs
+// without access to the database.
+//
+// Reads that fail because the server cannot be reached are retried and,
+// if they still fail, answered from the last response the server gave
+// for them. Writes are never retried since they may have been applied.
+//
+// New accepts any base URL, so code written against configman.Store can
+// be tested with a Client talking to an httptest.Server running the
+// handler returned by server.New.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// Defaults used for the options that are left zero.
+const (
+        DefaultTimeout      = 10 * time.Second
+        DefaultRetries      = 2
+        DefaultRetryDelay   = 200 * time.Millisecond
+        DefaultPollInterval = 5 * time.Second
+)
+
+// Options configure how a Client talks to the server.
+type Options struct {
+        // Token is sent as a bearer token if set.
+        Token string
+
+        // User and Password are sent with basic authentication if Token
+        // is not set.
+        User     string
+        Password string
+
+        // HTTPClient sends the requests, http.DefaultClient if nil. Its
+        // timeout, if any, also ends the event streams used by Watch,
+        // which then reconnect; use Timeout instead.
+        HTTPClient *http.Client
+
+        // Timeout limits how long each attempt of a request may take.
+        Timeout time.Duration
+
+        // Retries is how many more times a read is attempted if the
+        // server cannot be reached or is unavailable. Negative disables
+        // retries.
+        Retries int
+
+        // RetryDelay is how long to wait before the first retry. It is
+        // doubled before every following retry.
+        RetryDelay time.Duration
+
+        // PollInterval is how often Watch looks for new configs to
+        // watch.
+        PollInterval time.Duration
+}
+
+// A Client is a configman.Store backed by a configman server. Writes are
+// made as the principal the server authenticates, the by argument of
+// ApplyBatch is ignored.
+type Client struct {
+        base string
+        api  string
+        opts Options
+
+        // Last good response body of every read, by path.
+        mu        sync.Mutex
+        lastKnown map[string][]byte
+}
+
+// apiError is the body of every error response of the API.
+type apiError struct {
+        Error struct {
+                Code    string `json:"code"`
+                Message string `json:"message"`
+        } `json:"error"`
+}
+
+// errorCodes maps the error codes of the API to the errors stores
+// return.
+var errorCodes = map[string]error{
+        "not_found":           configman.ErrNotFound,
+        "already_exists":      configman.ErrExists,
+        "revision_mismatch":   configman.ErrConflict,
+        "precondition_failed": configman.ErrNotFound,
+        "protected_config":    configman.ErrProtectedConfig,
+        "type_mismatch":       configman.ErrTypeMismatch,
+        "unsupported_type":    configman.ErrUnsupportedType,
+        "unknown_role":        configman.ErrUnknownRole,
+        "forbidden":           configman.ErrForbidden,
+        "invalid_namespace":   configman.ErrInvalidNamespace,
+        "namespace_not_empty": configman.ErrNamespaceNotEmpty,
+}
+
+// New returns a Client for the server at baseURL, e.g.
+// https://configman.example.com.
+func New(baseURL string, opts Options) (*Client, error) {
+        u, err := url.Parse(baseURL)
+
+        if err != nil {
+                return nil, fmt.Errorf("client: invalid server url: %w", err)
+        }
+
+        if u.Scheme != "http" && u.Scheme != "https" {
+                return nil, fmt.Errorf("client: server url must be http or https, got %q", baseURL)
+        }
+
+        if opts.HTTPClient == nil {
+                opts.HTTPClient = http.DefaultClient
+        }
+
+        if opts.Timeout <= 0 {
+                opts.Timeout = DefaultTimeout
+        }
+
+        if opts.Retries == 0 {
+                opts.Retries = DefaultRetries
+        }
+
+        if opts.RetryDelay <= 0 {
+                opts.RetryDelay = DefaultRetryDelay
+        }
+
+        if opts.PollInterval <= 0 {
+                opts.PollInterval = DefaultPollInterval
+        }
+
+        base := strings.TrimSuffix(u.String(), "/")
+
+        client := &Client{
+                base:      base,
+                api:       base + "/api/v1",
+                opts:      opts,
+                lastKnown: make(map[string][]byte),
+        }
+
+        return client, nil
+}
+
+// do sends a request with in as its JSON body, unless it is nil, and
+// decodes the JSON response into out, unless it is nil. A revision other
+// than zero is sent in the If-Match header. Error responses are returned
+// as the matching configman errors where there is one.
+func (client *Client) do(method, path string, revision int64, in, out any) error {
+        var err error
+        var body, data []byte
+        var status int
+
+        if in != nil {
+                if body, err = json.Marshal(in); err != nil {
+                        return err
+                }
+        }
+
+        delay := client.opts.RetryDelay
+
+        for attempt := 0; ; attempt++ {
+                status, data, err = client.send(method, path, revision, body)
+
+                if method != http.MethodGet || !unavailable(status, err) || attempt >= client.opts.Retries {
+                        break
+                }
+
+                time.Sleep(delay)
+                delay *= 2
+        }
+
+        if method == http.MethodGet {
+                status, data, err = client.remember(path, status, data, err)
+        }
+
+        if err != nil {
+                return err
+        }
+
+        if status >= 400 {
+                return responseError(status, data)
+        }
+
+        if out == nil || len(data) == 0 {
+                return nil
+        }
+
+        return json.Unmarshal(data, out)
+}
+
+// send makes one attempt at a request and returns the status and body
+// of the response.
+func (client *Client) send(method, path string, revision int64, body []byte) (int, []byte, error) {
+        var err error
+        var req *http.Request
+        var resp *http.Response
+
+        ctx, cancel := context.WithTimeout(context.Background(), client.opts.Timeout)
+        defer cancel()
+
+        if req, err = http.NewRequestWithContext(ctx, method, client.api+path, bytes.NewReader(body)); err != nil {
+                return 0, nil, err
+        }
+
+        req.Header.Set("Accept", "application/json")
+
+        if body != nil {
+                req.Header.Set("Content-Type", "application/json")
+        }
+
+        if revision != 0 {
+                req.Header.Set("If-Match", strconv.Quote(strconv.FormatInt(revision, 10)))
+        }
+
+        client.authorize(req)
+
+        if resp, err = client.opts.HTTPClient.Do(req); err != nil {
+                return 0, nil, err
+        }
+
+        defer resp.Body.Close()
+
+        data, err := io.ReadAll(resp.Body)
+
+        return resp.StatusCode, data, err
+}
+
+// authorize adds the credentials of the client to req.
+func (client *Client) authorize(req *http.Request) {
+        if client.opts.Token != "" {
+                req.Header.Set("Authorization", "Bearer "+client.opts.Token)
+        } else if client.opts.User != "" {
+                req.SetBasicAuth(client.opts.User, client.opts.Password)
+        }
+}
+
+// remember keeps the body of successful reads of path and answers reads
+// that failed because the server is unavailable with the last one kept.
+// Reads of things that no longer exist forget them.
+func (client *Client) remember(path string, status int, data []byte, err error) (int, []byte, error) {
+        client.mu.Lock()
+        defer client.mu.Unlock()
+
+        switch {
+        case unavailable(status, err):
+                if known, ok := client.lastKnown[path]; ok {
+                        log.Printf("warn: client: using last known response for %s: %s\n", path, describe(status, err))
+                        return http.StatusOK, known, nil
+                }
+        case status == http.StatusOK:
+                client.lastKnown[path] = data
+        case status == http.StatusNotFound:
+                delete(client.lastKnown, path)
+        }
+
+        return status, data, err
+}
+
+// unavailable reports whether a request failed because the server could
+// not be reached or could not answer, rather than because of the
+// request.
+func unavailable(status int, err error) bool {
+        return err != nil || status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// describe describes why a request failed for logging.
+func describe(status int, err error) string {
+        if err != nil {
+                return err.Error()
+        }
+
+        return http.StatusText(status)
+}
+
+// responseError returns the error reported by an error response.
+func responseError(status int, data []byte) error {
+        var body apiError
+
+        if err := json.Unmarshal(data, &body); err != nil || body.Error.Code == "" {
+                return fmt.Errorf("client: server responded with %d %s", status, http.StatusText(status))
+        }
+
+        if err, ok := errorCodes[body.Error.Code]; ok {
+                return fmt.Errorf("client: %s: %w", body.Error.Message, err)
+        }
+
+        return fmt.Errorf("client: %s (%s)", body.Error.Message, body.Error.Code)
+}
+
+// escape escapes the names of configs and settings for use in paths.
+func escape(names ...string) string {
+        var b strings.Builder
+
+        for _, name := range names {
+                b.WriteString("/")
+                b.WriteString(url.PathEscape(name))
+        }
+
+        return b.String()
+}
+
+// isNotFound reports whether err is configman.ErrNotFound.
+func isNotFound(err error) bool {
+        return errors.Is(err, configman.ErrNotFound)
+}
@@ -0,0 +1,469 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/gossert"
+)
+
+// apiConfig is the JSON representation of a config.
+type apiConfig struct {
+        Name              string        `json:"name"`
+        Description       string        `json:"description"`
+        Revision          int64         `json:"revision"`
+        Deprecated        bool          `json:"deprecated"`
+        DeprecationReason string        `json:"deprecation_reason"`
+        Settings          []*apiSetting `json:"settings"`
+}
+
+// apiSetting is the JSON representation of a setting.
+type apiSetting struct {
+        Name              string          `json:"name"`
+        Type              configman.Type  `json:"type"`
+        Value             json.RawMessage `json:"value"`
+        Description       string          `json:"description"`
+        Revision          int64           `json:"revision"`
+        Deprecated        bool            `json:"deprecated"`
+        DeprecationReason string          `json:"deprecation_reason"`
+        CreatedAt         time.Time       `json:"created_at"`
+        UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+// apiOp is the JSON representation of a batch operation. Type and value
+// are left out for operations that do not set a value.
+type apiOp struct {
+        Kind             configman.OpKind `json:"kind"`
+        Config           string           `json:"config"`
+        Setting          string           `json:"setting"`
+        Type             configman.Type   `json:"type,omitempty"`
+        Value            json.RawMessage  `json:"value,omitempty"`
+        Description      string           `json:"description,omitempty"`
+        ExpectedRevision int64            `json:"expected_revision,omitempty"`
+}
+
+// apiChangeEvent is the JSON representation of a change event.
+type apiChangeEvent struct {
+        Revision int64     `json:"revision"`
+        By       string    `json:"by"`
+        At       time.Time `json:"at"`
+        Ops      []apiOp   `json:"ops"`
+}
+
+// setting returns s as a configman.Setting.
+func (s *apiSetting) setting() (*configman.Setting, error) {
+        value, err := configman.UnmarshalValue(s.Type, s.Value)
+
+        if err != nil {
+                return nil, err
+        }
+
+        return configman.NewSetting(configman.SettingFields{
+                Name:              s.Name,
+                Description:       s.Description,
+                Value:             value,
+                Revision:          s.Revision,
+                Deprecated:        s.Deprecated,
+                DeprecationReason: s.DeprecationReason,
+                CreatedAt:         s.CreatedAt,
+                UpdatedAt:         s.UpdatedAt,
+        })
+}
+
+// changeEvent returns e as a configman.ChangeEvent.
+func (e *apiChangeEvent) changeEvent() (*configman.ChangeEvent, error) {
+        var err error
+
+        event := &configman.ChangeEvent{
+                Revision: e.Revision,
+                By:       e.By,
+                At:       e.At,
+                Ops:      make([]configman.BatchOp, len(e.Ops)),
+        }
+
+        for i, op := range e.Ops {
+                event.Ops[i] = configman.BatchOp{
+                        Kind:             op.Kind,
+                        Config:           op.Config,
+                        Setting:          op.Setting,
+                        Description:      op.Description,
+                        ExpectedRevision: op.ExpectedRevision,
+                }
+
+                if op.Type == configman.Unsupported {
+                        continue
+                }
+
+                if event.Ops[i].Value, err = configman.UnmarshalValue(op.Type, op.Value); err != nil {
+                        return nil, err
+                }
+        }
+
+        return event, nil
+}
+
+// remoteConfig is a configman.Config read from the server.
+type remoteConfig struct {
+        client *Client
+        data   apiConfig
+}
+
+func (config *remoteConfig) Name() string {
+        return config.data.Name
+}
+
+func (config *remoteConfig) Desc() string {
+        return config.data.Description
+}
+
+// Revision returns the revision of this config as of when it was read
+// or last changed through this value.
+func (config *remoteConfig) Revision() int64 {
+        return config.data.Revision
+}
+
+// Deprecated returns true if this config was deprecated when it was
+// read.
+func (config *remoteConfig) Deprecated() bool {
+        return config.data.Deprecated
+}
+
+// DeprecationReason returns why this config was deprecated.
+func (config *remoteConfig) DeprecationReason() string {
+        return config.data.DeprecationReason
+}
+
+func (config *remoteConfig) SetDesc(desc string) (bool, error) {
+        return config.SetDescIf(desc, 0)
+}
+
+// SetDescIf is like SetDesc but fails with configman.ErrConflict unless
+// the config is at the given revision. A revision of zero matches any
+// revision.
+func (config *remoteConfig) SetDescIf(desc string, revision int64) (bool, error) {
+        var data apiConfig
+
+        in := map[string]string{"description": desc}
+
+        if err := config.client.do(http.MethodPatch, "/configs"+escape(config.data.Name), revision, in, &data); err != nil {
+                return false, err
+        }
+
+        config.data.Description = data.Description
+        config.data.Revision = data.Revision
+
+        return true, nil
+}
+
+// CreateConfig creates a new config with the given name and description.
+func (client *Client) CreateConfig(name, desc string) (configman.Config, error) {
+        config := &remoteConfig{client: client}
+        in := apiConfig{Name: name, Description: desc}
+
+        if err := client.do(http.MethodPost, "/configs", 0, in, &config.data); err != nil {
+                return nil, err
+        }
+
+        return config, nil
+}
+
+// GetConfig returns the config with the given name if it exists otherwise
+// nil.
+func (client *Client) GetConfig(name string) (configman.Config, error) {
+        config := &remoteConfig{client: client}
+        err := client.do(http.MethodGet, "/configs"+escape(name), 0, nil, &config.data)
+
+        if isNotFound(err) {
+                return nil, nil
+        }
+
+        if err != nil {
+                return nil, err
+        }
+
+        return config, nil
+}
+
+// GetConfigs returns all configs the principal can view.
+func (client *Client) GetConfigs() ([]configman.Config, error) {
+        var data []apiConfig
+
+        if err := client.do(http.MethodGet, "/configs", 0, nil, &data); err != nil {
+                return nil, err
+        }
+
+        configs := make([]configman.Config, len(data))
+
+        for i := range data {
+                configs[i] = &remoteConfig{client: client, data: data[i]}
+        }
+
+        return configs, nil
+}
+
+// DeleteConfig deletes the config with the given name along with all of
+// its settings. The deletion is recorded as made by the principal the
+// server authenticated, not by.
+func (client *Client) DeleteConfig(name, by string) error {
+        return client.do(http.MethodDelete, "/configs"+escape(name), 0, nil, nil)
+}
+
+// DeprecateConfig marks the config with the given name as deprecated for
+// the given reason.
+func (client *Client) DeprecateConfig(name, reason string) error {
+        return client.DeprecateConfigIf(name, reason, 0)
+}
+
+// DeprecateConfigIf is like DeprecateConfig but fails with
+// configman.ErrConflict unless the config is at the given revision. A
+// revision of zero matches any revision.
+func (client *Client) DeprecateConfigIf(name, reason string, revision int64) error {
+        in := map[string]string{"reason": reason}
+        return client.do(http.MethodPost, "/configs"+escape(name, "deprecation"), revision, in, nil)
+}
+
+// GetSetting returns the setting with the given name in the given config
+// if it exists otherwise nil.
+func (client *Client) GetSetting(config, name string) (*configman.Setting, error) {
+        var data apiSetting
+
+        err := client.do(http.MethodGet, "/configs"+escape(config, "settings", name), 0, nil, &data)
+
+        if isNotFound(err) {
+                return nil, nil
+        }
+
+        if err != nil {
+                return nil, err
+        }
+
+        return data.setting()
+}
+
+// GetSettings returns all settings of the given config.
+func (client *Client) GetSettings(config string) ([]*configman.Setting, error) {
+        var err error
+        var data []*apiSetting
+
+        if err = client.do(http.MethodGet, "/configs"+escape(config, "settings"), 0, nil, &data); err != nil {
+                return nil, err
+        }
+
+        settings := make([]*configman.Setting, len(data))
+
+        for i, s := range data {
+                if settings[i], err = s.setting(); err != nil {
+                        return nil, err
+                }
+        }
+
+        return settings, nil
+}
+
+// ApplyBatch applies every operation of the batch in one transaction on
+// the server. The changes are recorded as made by the principal the
+// server authenticated, not by.
+func (client *Client) ApplyBatch(batch *configman.Batch, by string) (*configman.ChangeEvent, error) {
+        var in struct {
+                Ops []apiOp `json:"ops"`
+        }
+
+        var err error
+        var out apiChangeEvent
+
+        gossert.Ok(batch != nil, "client: cannot apply nil batch")
+
+        in.Ops = make([]apiOp, len(batch.Ops))
+
+        for i, op := range batch.Ops {
+                in.Ops[i] = apiOp{
+                        Kind:             op.Kind,
+                        Config:           op.Config,
+                        Setting:          op.Setting,
+                        Description:      op.Description,
+                        ExpectedRevision: op.ExpectedRevision,
+                }
+
+                if op.Value == nil {
+                        continue
+                }
+
+                in.Ops[i].Type = configman.TypeOf(op.Value)
+
+                if in.Ops[i].Value, err = json.Marshal(op.Value); err != nil {
+                        return nil, err
+                }
+        }
+
+        if err = client.do(http.MethodPost, "/batch", 0, in, &out); err != nil {
+                return nil, err
+        }
+
+        return out.changeEvent()
+}
+
+// GetHistory implements configman.HistoryStore.
+func (client *Client) GetHistory(config string, limit int) ([]configman.ChangeEvent, error) {
+        var data []apiChangeEvent
+
+        path := "/configs" + escape(config, "history") + "?limit=" + strconv.Itoa(limit)
+
+        if err := client.do(http.MethodGet, path, 0, nil, &data); err != nil {
+                return nil, err
+        }
+
+        events := make([]configman.ChangeEvent, len(data))
+
+        for i := range data {
+                event, err := data[i].changeEvent()
+
+                if err != nil {
+                        return nil, err
+                }
+
+                events[i] = *event
+        }
+
+        return events, nil
+}
+
+// apiNamespace is the JSON representation of a namespace.
+type apiNamespace struct {
+        Name        string    `json:"name"`
+        Description string    `json:"description"`
+        CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreateNamespace implements configman.NamespaceStore.
+func (client *Client) CreateNamespace(name, desc string) (*configman.Namespace, error) {
+        var data apiNamespace
+
+        in := apiNamespace{Name: name, Description: desc}
+
+        if err := client.do(http.MethodPost, "/namespaces", 0, in, &data); err != nil {
+                return nil, err
+        }
+
+        namespace := configman.Namespace(data)
+
+        return &namespace, nil
+}
+
+// GetNamespaces implements configman.NamespaceStore. Only the namespaces
+// the principal has a role on are returned.
+func (client *Client) GetNamespaces() ([]configman.Namespace, error) {
+        var data []apiNamespace
+
+        if err := client.do(http.MethodGet, "/namespaces", 0, nil, &data); err != nil {
+                return nil, err
+        }
+
+        namespaces := make([]configman.Namespace, len(data))
+
+        for i := range data {
+                namespaces[i] = configman.Namespace(data[i])
+        }
+
+        return namespaces, nil
+}
+
+// DeleteNamespace implements configman.NamespaceStore.
+func (client *Client) DeleteNamespace(name string) error {
+        return client.do(http.MethodDelete, "/namespaces"+escape(name), 0, nil, nil)
+}
+
+// CloneConfig implements configman.CloneStore. The settings created are
+// recorded as made by the principal the server authenticated, not by.
+func (client *Client) CloneConfig(from, to string, opts configman.CloneOptions, by string) (configman.Config, error) {
+        config := &remoteConfig{client: client}
+        in := map[string]any{"name": to, "reset": opts.Reset}
+
+        if err := client.do(http.MethodPost, "/configs"+escape(from, "clone"), 0, in, &config.data); err != nil {
+                return nil, err
+        }
+
+        return config, nil
+}
+
+// RenameConfig implements configman.CloneStore. The rename is recorded
+// as made by the principal the server authenticated, not by.
+func (client *Client) RenameConfig(from, to, by string) (configman.Config, error) {
+        config := &remoteConfig{client: client}
+        in := map[string]string{"name": to}
+
+        if err := client.do(http.MethodPost, "/configs"+escape(from, "rename"), 0, in, &config.data); err != nil {
+                return nil, err
+        }
+
+        return config, nil
+}
+
+// apiTrashedItem is the JSON representation of a deleted config or
+// setting in the trash.
+type apiTrashedItem struct {
+        Config      string    `json:"config"`
+        Setting     string    `json:"setting"`
+        Description string    `json:"description"`
+        Settings    int       `json:"settings"`
+        DeletedAt   time.Time `json:"deleted_at"`
+        ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// GetTrash implements configman.TrashStore. Only the items in configs
+// the principal can view are returned.
+func (client *Client) GetTrash() ([]configman.TrashedItem, error) {
+        var data []apiTrashedItem
+
+        if err := client.do(http.MethodGet, "/trash", 0, nil, &data); err != nil {
+                return nil, err
+        }
+
+        items := make([]configman.TrashedItem, len(data))
+
+        for i, item := range data {
+                items[i] = configman.TrashedItem(item)
+        }
+
+        return items, nil
+}
+
+// RestoreConfig implements configman.TrashStore. The restored settings
+// are recorded as made by the principal the server authenticated, not
+// by.
+func (client *Client) RestoreConfig(name, by string) (configman.Config, error) {
+        config := &remoteConfig{client: client}
+
+        if err := client.do(http.MethodPost, "/trash/configs"+escape(name, "restore"), 0, nil, &config.data); err != nil {
+                return nil, err
+        }
+
+        return config, nil
+}
+
+// RestoreSetting implements configman.TrashStore. The restored setting
+// is recorded as made by the principal the server authenticated, not by.
+func (client *Client) RestoreSetting(config, name, by string) (*configman.Setting, error) {
+        var data apiSetting
+
+        if err := client.do(http.MethodPost, "/trash/configs"+escape(config, "settings", name, "restore"), 0, nil, &data); err != nil {
+                return nil, err
+        }
+
+        return data.setting()
+}
+
+// PurgeTrash implements configman.TrashStore.
+func (client *Client) PurgeTrash() (int, error) {
+        var data struct {
+                Purged int `json:"purged"`
+        }
+
+        if err := client.do(http.MethodPost, "/trash/purge", 0, nil, &data); err != nil {
+                return 0, err
+        }
+
+        return data.Purged, nil
+}
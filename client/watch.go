@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// watchBuffer is the number of change events a watcher can fall behind
+// by before it is dropped, as with configman.Broadcaster.
+const watchBuffer = 64
+
+// maxStreamDelay caps how long a broken event stream waits before
+// reconnecting.
+const maxStreamDelay = time.Minute
+
+// maxEventSize is the size of the largest event a stream can carry.
+const maxEventSize = 1 << 20
+
+// errReset is returned by readStream if the server could not send the
+// changes missed while disconnected.
+var errReset = errors.New("client: changes were missed, reload")
+
+// Watch implements configman.Watcher with the event streams of the
+// server, one per config the principal can view. Configs created later
+// are picked up within PollInterval. A batch that changed several
+// configs is sent as one change event per config.
+//
+// Broken streams are resumed where they left off. If the server cannot
+// send what was missed, or the subscriber falls behind, the channel is
+// closed.
+func (client *Client) Watch(ctx context.Context) <-chan configman.ChangeEvent {
+        ch := make(chan configman.ChangeEvent, watchBuffer)
+        go client.watch(ctx, ch)
+        return ch
+}
+
+// watch merges the event streams of every config into ch until ctx is
+// done or one of them is reset.
+func (client *Client) watch(ctx context.Context, ch chan configman.ChangeEvent) {
+        defer close(ch)
+
+        ctx, cancel := context.WithCancel(ctx)
+        defer cancel()
+
+        events := make(chan configman.ChangeEvent)
+        reset := make(chan struct{}, 1)
+        ended := make(chan string)
+        streams := make(map[string]bool)
+
+        ticker := time.NewTicker(client.opts.PollInterval)
+        defer ticker.Stop()
+
+        for {
+                if configs, err := client.GetConfigs(); err != nil {
+                        log.Printf("warn: client: failed to list configs to watch: %v\n", err)
+                } else {
+                        for _, config := range configs {
+                                if !streams[config.Name()] {
+                                        streams[config.Name()] = true
+                                        go client.stream(ctx, config.Name(), events, reset, ended)
+                                }
+                        }
+                }
+
+        wait:
+                for {
+                        select {
+                        case <-ctx.Done():
+                                return
+                        case <-reset:
+                                return
+                        case name := <-ended:
+                                delete(streams, name)
+                        case event := <-events:
+                                select {
+                                case ch <- event:
+                                default:
+                                        return
+                                }
+                        case <-ticker.C:
+                                break wait
+                        }
+                }
+        }
+}
+
+// stream sends the change events of config to events until ctx is done,
+// reconnecting whenever the stream breaks. It reports on reset if
+// changes were missed and on ended if the config was deleted.
+func (client *Client) stream(ctx context.Context, config string, events chan<- configman.ChangeEvent, reset chan<- struct{}, ended chan<- string) {
+        var lastID string
+
+        delay := client.opts.RetryDelay
+
+        for {
+                connected, err := client.readStream(ctx, config, &lastID, events)
+
+                if ctx.Err() != nil {
+                        return
+                }
+
+                switch {
+                case errors.Is(err, errReset):
+                        select {
+                        case reset <- struct{}{}:
+                        default:
+                        }
+
+                        return
+                case errors.Is(err, configman.ErrNotFound):
+                        select {
+                        case ended <- config:
+                        case <-ctx.Done():
+                        }
+
+                        return
+                case connected:
+                        delay = client.opts.RetryDelay
+                }
+
+                log.Printf("warn: client: event stream of config %s broke: %v\n", config, err)
+
+                select {
+                case <-ctx.Done():
+                        return
+                case <-time.After(delay):
+                }
+
+                delay = min(delay*2, maxStreamDelay)
+        }
+}
+
+// readStream reads the event stream of config, resuming after lastID,
+// and sends its change events to events until the stream ends. lastID is
+// kept up to date. connected reports whether the server accepted the
+// stream.
+func (client *Client) readStream(ctx context.Context, config string, lastID *string, events chan<- configman.ChangeEvent) (connected bool, err error) {
+        var req *http.Request
+        var resp *http.Response
+
+        if req, err = http.NewRequestWithContext(ctx, http.MethodGet, client.base+"/configs"+escape(config, "events"), nil); err != nil {
+                return false, err
+        }
+
+        req.Header.Set("Accept", "text/event-stream")
+        client.authorize(req)
+
+        if *lastID != "" {
+                req.Header.Set("Last-Event-ID", *lastID)
+        }
+
+        if resp, err = client.opts.HTTPClient.Do(req); err != nil {
+                return false, err
+        }
+
+        defer resp.Body.Close()
+
+        switch {
+        case resp.StatusCode == http.StatusNotFound:
+                return false, fmt.Errorf("client: config %s: %w", config, configman.ErrNotFound)
+        case resp.StatusCode != http.StatusOK:
+                data, _ := io.ReadAll(resp.Body)
+                return false, responseError(resp.StatusCode, data)
+        }
+
+        var kind, data string
+
+        scanner := bufio.NewScanner(resp.Body)
+
+        scanner.Buffer(nil, maxEventSize)
+
+        for scanner.Scan() {
+                line := scanner.Text()
+
+                // lines starting with a colon are comments
+                if strings.HasPrefix(line, ":") {
+                        continue
+                }
+
+                field, value, _ := strings.Cut(line, ":")
+                value = strings.TrimPrefix(value, " ")
+
+                switch field {
+                case "id":
+                        *lastID = value
+                case "event":
+                        kind = value
+                case "data":
+                        data = value
+                case "":
+                        if kind == "reset" {
+                                return true, errReset
+                        }
+
+                        if kind == "change" {
+                                if err = sendChange(ctx, data, events); err != nil {
+                                        return true, err
+                                }
+                        }
+
+                        kind, data = "", ""
+                }
+        }
+
+        if err = scanner.Err(); err == nil {
+                err = io.ErrUnexpectedEOF
+        }
+
+        return true, err
+}
+
+// sendChange decodes the data of a change event and sends it to events.
+func sendChange(ctx context.Context, data string, events chan<- configman.ChangeEvent) error {
+        var body apiChangeEvent
+
+        if err := json.Unmarshal([]byte(data), &body); err != nil {
+                return err
+        }
+
+        event, err := body.changeEvent()
+
+        if err != nil {
+                return err
+        }
+
+        select {
+        case events <- *event:
+        case <-ctx.Done():
+        }
+
+        return nil
+}
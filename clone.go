@@ -0,0 +1,30 @@
+package configman
+
+// CloneOptions are the options of CloneStore.CloneConfig.
+type CloneOptions struct {
+        // Reset makes the clone and its settings new: created now, at
+        // revision 1 and not deprecated. Otherwise they keep the times,
+        // revisions and deprecation of the originals.
+        Reset bool
+}
+
+// CloneStore is implemented by stores that can clone and rename
+// configs.
+type CloneStore interface {
+        // CloneConfig creates the config to as a copy of from, with its
+        // description, settings, flag rules and labels. Creating the
+        // settings is recorded in history as one revision made by by.
+        // Grants and protection are not copied. ErrNotFound is returned
+        // if from does not exist and ErrExists if to does.
+        CloneConfig(from, to string, opts CloneOptions, by string) (Config, error)
+
+        // RenameConfig renames the config from to to in one transaction,
+        // along with everything that refers to it by name, so that its
+        // settings, history, snapshots, grants, labels, scheduled changes
+        // and change requests follow it. The rename is recorded in history
+        // as a revision made by by with one OpRename operation. Records of
+        // what was done, like the audit log, keep the old name.
+        // ErrNotFound is returned if from does not exist, ErrExists if to
+        // does and ErrProtectedConfig if from is protected.
+        RenameConfig(from, to, by string) (Config, error)
+}
@@ -0,0 +1,346 @@
+// Command configman-server serves the configman UI and JSON API.
+//
+// Every option can be given as a flag, as an environment variable named
+// after the flag in upper case with a CONFIGMAN_ prefix (-cache-ttl is
+// CONFIGMAN_CACHE_TTL) or in the file given by -config, one
+// "name = value" pair per line. Flags take precedence over environment
+// variables, which take precedence over the file.
+//
+// Run "configman-server hash-password" to hash a password read from
+// stdin for -users.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	_ "github.com/tursodatabase/go-libsql"
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/metrics"
+	"github.com/vlence/configman/server"
+	"github.com/vlence/configman/stores/cached"
+	"github.com/vlence/configman/stores/metered"
+	sqlstore "github.com/vlence/configman/stores/sql"
+	"github.com/vlence/configman/stores/traced"
+	"github.com/vlence/configman/tracing"
+)
+
+var errNotReady = errors.New("shutting down")
+
+func main() {
+        if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+                printPasswordHash()
+                return
+        }
+
+        if err := run(os.Args[1:]); err != nil {
+                slog.Error("configman-server failed", "err", err)
+                os.Exit(1)
+        }
+}
+
+// run serves with the options given as args until it is told to shut
+// down. It only returns once everything it opened has been closed.
+func run(args []string) error {
+        var err error
+        var db *sql.DB
+        var handler http.Handler
+        var store configman.Store
+        var logger *slog.Logger
+        var reg *metrics.Registry
+        var tracer tracing.Tracer
+
+        flags := flag.NewFlagSet("configman-server", flag.ExitOnError)
+        configFile := flags.String("config", "", "read options from this file")
+        addr := flags.String("addr", ":8080", "address to listen on")
+        dsn := flags.String("db", "file:configman.db", "libsql database to store configs in")
+        tlsCert := flags.String("tls-cert", "", "TLS certificate file, serve plain HTTP if empty")
+        tlsKey := flags.String("tls-key", "", "TLS private key file")
+        logLevel := flags.String("log-level", "info", "least severe messages to log: debug, info, warn or error")
+        logFormat := flags.String("log-format", "text", "log records as text or json")
+        traceOn := flags.Bool("trace", false, "log a span for every request and store operation at debug level")
+        metricsOn := flags.Bool("metrics", true, "serve Prometheus metrics at /metrics")
+        cacheTTL := flags.Duration("cache-ttl", 0, "keep settings in memory for this long, 0 disables the cache")
+        tokens := flags.String("tokens", "", "comma separated principal=token API tokens")
+        users := flags.String("users", "", "comma separated user=hash pairs, see hash-password")
+        admins := flags.String("admins", "", "comma separated principals made admins of every config")
+        sessionTTL := flags.Duration("session-ttl", 12*time.Hour, "how long users stay logged in")
+        scheduleInterval := flags.Duration("schedule-interval", time.Minute, "how often to apply due scheduled changes")
+        trashRetention := flags.Duration("trash-retention", configman.DefaultRetention, "how long deleted configs and settings can be restored")
+        purgeInterval := flags.Duration("purge-interval", time.Hour, "how often to purge expired configs and settings from the trash")
+        drainDelay := flags.Duration("drain-delay", 5*time.Second, "how long to keep serving with failing readiness checks before shutting down")
+        shutdownTimeout := flags.Duration("shutdown-timeout", 30*time.Second, "how long to wait for requests to finish on shutdown")
+
+        flags.Parse(args)
+
+        if err = applyDefaults(flags, *configFile); err != nil {
+                return err
+        }
+
+        if logger, err = newLogger(*logLevel, *logFormat); err != nil {
+                return err
+        }
+
+        slog.SetDefault(logger)
+
+        if (*tlsCert == "") != (*tlsKey == "") {
+                return errors.New("-tls-cert and -tls-key must be given together")
+        }
+
+        if db, err = sql.Open("libsql", *dsn); err != nil {
+                return fmt.Errorf("failed to open database: %w", err)
+        }
+
+        defer db.Close()
+
+        storeOpts := []sqlstore.Option{sqlstore.WithLogger(logger), sqlstore.WithRetention(*trashRetention)}
+
+        if *traceOn {
+                tracer = tracing.NewTracer(tracing.LogExporter{Logger: logger})
+                storeOpts = append(storeOpts, sqlstore.WithTracer(tracer))
+        }
+
+        if store, err = sqlstore.NewSqlStore(db, storeOpts...); err != nil {
+                return fmt.Errorf("failed to open store: %w", err)
+        }
+
+        ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+        defer stop()
+
+        cacheOpts := []cached.Option{cached.WithLogger(logger)}
+
+        if *metricsOn {
+                reg = metrics.NewRegistry()
+                store = metered.NewMeteredStore(store, reg)
+                cacheOpts = append(cacheOpts, cached.WithMetrics(reg))
+        }
+
+        if *cacheTTL > 0 {
+                cache := cached.NewCachedStore(store, *cacheTTL, cacheOpts...)
+                store = cache
+                go cache.Run(ctx)
+        }
+
+        // outermost so that operations served by the cache are traced
+        if tracer != nil {
+                store = traced.NewTracedStore(store, tracer)
+        }
+
+        if scheduleStore, ok := configman.Extension[configman.ScheduleStore](store); ok {
+                go configman.NewScheduler(scheduleStore, *scheduleInterval, logger).Run(ctx)
+        }
+
+        if trashStore, ok := configman.Extension[configman.TrashStore](store); ok {
+                go configman.NewPurger(trashStore, *purgeInterval, logger).Run(ctx)
+        }
+
+        var shuttingDown atomic.Bool
+
+        // event streams only end when the client goes away, so they are
+        // ended once shutdown starts; other requests still get to finish
+        shutdown := make(chan struct{})
+
+        opts := server.Options{
+                Tokens:     make(map[string]string),
+                Users:      server.ParsePairs(*users),
+                Admins:     strings.Split(*admins, ","),
+                SessionTTL: *sessionTTL,
+                Logger:     logger,
+                Metrics:    reg,
+                Tracer:     tracer,
+                Shutdown:   shutdown,
+                Ready: func(ctx context.Context) error {
+                        if shuttingDown.Load() {
+                                return errNotReady
+                        }
+
+                        return db.PingContext(ctx)
+                },
+        }
+
+        for principal, token := range server.ParsePairs(*tokens) {
+                opts.Tokens[token] = principal
+        }
+
+        if handler, err = server.New(store, opts); err != nil {
+                return fmt.Errorf("failed to create server: %w", err)
+        }
+
+        srv := &http.Server{
+                Addr:              *addr,
+                Handler:           handler,
+                ReadHeaderTimeout: 10 * time.Second,
+        }
+
+        srv.RegisterOnShutdown(func() { close(shutdown) })
+
+        errs := make(chan error, 1)
+
+        go func() {
+                logger.Info("listening", "addr", *addr)
+
+                if *tlsCert != "" {
+                        errs <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+                } else {
+                        errs <- srv.ListenAndServe()
+                }
+        }()
+
+        select {
+        case err = <-errs:
+                return fmt.Errorf("failed to serve: %w", err)
+        case <-ctx.Done():
+        }
+
+        // fail readiness checks first, for long enough that load
+        // balancers see it and stop sending requests, then let the ones
+        // in flight finish
+        logger.Info("shutting down", "drain_delay", *drainDelay)
+        shuttingDown.Store(true)
+        time.Sleep(*drainDelay)
+
+        shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+        defer cancel()
+
+        if err = srv.Shutdown(shutdownCtx); err != nil {
+                logger.Warn("requests did not finish in time", "err", err)
+        }
+
+        return nil
+}
+
+// applyDefaults sets every flag that was not given on the command line
+// from the environment or, failing that, from the config file.
+func applyDefaults(flags *flag.FlagSet, configFile string) error {
+        var err error
+
+        given := make(map[string]bool)
+        fromFile := make(map[string]string)
+
+        flags.Visit(func(f *flag.Flag) {
+                given[f.Name] = true
+        })
+
+        if configFile == "" {
+                configFile = os.Getenv("CONFIGMAN_CONFIG")
+        }
+
+        if configFile != "" {
+                if fromFile, err = readConfigFile(configFile); err != nil {
+                        return err
+                }
+        }
+
+        flags.VisitAll(func(f *flag.Flag) {
+                if err != nil || given[f.Name] || f.Name == "config" {
+                        return
+                }
+
+                value, ok := os.LookupEnv("CONFIGMAN_" + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_")))
+
+                if !ok {
+                        value, ok = fromFile[f.Name]
+                }
+
+                if ok {
+                        if setErr := f.Value.Set(value); setErr != nil {
+                                err = fmt.Errorf("invalid value %q for %s: %w", value, f.Name, setErr)
+                        }
+                }
+        })
+
+        return err
+}
+
+// readConfigFile reads "name = value" pairs from the file at path. Blank
+// lines and lines starting with # are ignored.
+func readConfigFile(path string) (map[string]string, error) {
+        file, err := os.Open(path)
+
+        if err != nil {
+                return nil, err
+        }
+
+        defer file.Close()
+
+        values := make(map[string]string)
+        scanner := bufio.NewScanner(file)
+
+        for n := 1; scanner.Scan(); n++ {
+                line := strings.TrimSpace(scanner.Text())
+
+                if line == "" || strings.HasPrefix(line, "#") {
+                        continue
+                }
+
+                name, value, ok := strings.Cut(line, "=")
+
+                if !ok {
+                        return nil, fmt.Errorf("%s:%d: expected name = value", path, n)
+                }
+
+                values[strings.TrimSpace(name)] = strings.TrimSpace(value)
+        }
+
+        return values, scanner.Err()
+}
+
+// logLevels maps the values of -log-level to slog levels.
+var logLevels = map[string]slog.Level{
+        "debug": slog.LevelDebug,
+        "info":  slog.LevelInfo,
+        "warn":  slog.LevelWarn,
+        "error": slog.LevelError,
+}
+
+// newLogger returns a logger writing records at least as severe as
+// level to stderr in the given format.
+func newLogger(level, format string) (*slog.Logger, error) {
+        min, ok := logLevels[level]
+
+        if !ok {
+                return nil, fmt.Errorf("unknown log level %q", level)
+        }
+
+        opts := &slog.HandlerOptions{Level: min}
+
+        switch format {
+        case "text":
+                return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+        case "json":
+                return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+        default:
+                return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+        }
+}
+
+// printPasswordHash reads a password from stdin and prints its hash.
+func printPasswordHash() {
+        password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+
+        if err != nil && err != io.EOF {
+                log.Fatal(err)
+        }
+
+        hash, err := server.HashPassword(strings.TrimRight(password, "\r\n"))
+
+        if err != nil {
+                log.Fatal(err)
+        }
+
+        fmt.Println(hash)
+}
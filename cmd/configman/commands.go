@@ -0,0 +1,611 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// getConfig returns the config with the given name or an error wrapping
+// configman.ErrNotFound if it does not exist.
+func getConfig(store configman.Store, name string) (configman.Config, error) {
+        config, err := store.GetConfig(name)
+
+        if err == nil && config == nil {
+                err = fmt.Errorf("config %s: %w", name, configman.ErrNotFound)
+        }
+
+        return config, err
+}
+
+func listConfigs(store configman.Store, out *output, args []string) error {
+        flags := flag.NewFlagSet("configs list", flag.ContinueOnError)
+        namespace := flags.String("namespace", "", "only list the configs in this namespace")
+
+        if err := flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 0 {
+                return errUsage
+        }
+
+        configs, err := store.GetConfigs()
+
+        if err != nil {
+                return err
+        }
+
+        if isFlagSet(flags, "namespace") {
+                configs = configman.ConfigsIn(configs, *namespace)
+        }
+
+        return out.printConfigs(configs)
+}
+
+func createConfig(store configman.Store, out *output, args []string) error {
+        var err error
+        var config configman.Config
+
+        if len(args) < 1 || len(args) > 2 {
+                return errUsage
+        }
+
+        desc := ""
+
+        if len(args) == 2 {
+                desc = args[1]
+        }
+
+        if config, err = store.GetConfig(args[0]); err != nil {
+                return err
+        }
+
+        if config != nil {
+                return fmt.Errorf("config %s: %w", args[0], configman.ErrExists)
+        }
+
+        if config, err = store.CreateConfig(args[0], desc); err != nil {
+                return err
+        }
+
+        return out.printConfig(config, nil)
+}
+
+func describeConfig(store configman.Store, out *output, args []string) error {
+        var err error
+        var config configman.Config
+        var settings []*configman.Setting
+
+        if len(args) != 1 {
+                return errUsage
+        }
+
+        if config, err = getConfig(store, args[0]); err != nil {
+                return err
+        }
+
+        if settings, err = store.GetSettings(args[0]); err != nil {
+                return err
+        }
+
+        return out.printConfig(config, settings)
+}
+
+func deprecateConfig(store configman.Store, out *output, args []string) error {
+        var err error
+        var config configman.Config
+
+        if len(args) < 1 || len(args) > 2 {
+                return errUsage
+        }
+
+        reason := ""
+
+        if len(args) == 2 {
+                reason = args[1]
+        }
+
+        if err = store.DeprecateConfig(args[0], reason); err != nil {
+                return err
+        }
+
+        if config, err = getConfig(store, args[0]); err != nil {
+                return err
+        }
+
+        return out.printConfig(config, nil)
+}
+
+func cloneConfig(store configman.Store, out *output, args []string) error {
+        var err error
+        var config configman.Config
+        var settings []*configman.Setting
+
+        flags := flag.NewFlagSet("configs clone", flag.ContinueOnError)
+        reset := flags.Bool("reset", false, "make the clone and its settings new instead of keeping their times, revisions and deprecation")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 2 {
+                return errUsage
+        }
+
+        clones, err := cloneStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        if config, err = clones.CloneConfig(flags.Arg(0), flags.Arg(1), configman.CloneOptions{Reset: *reset}, by); err != nil {
+                return err
+        }
+
+        if settings, err = store.GetSettings(flags.Arg(1)); err != nil {
+                return err
+        }
+
+        return out.printConfig(config, settings)
+}
+
+func renameConfig(store configman.Store, out *output, args []string) error {
+        if len(args) != 2 {
+                return errUsage
+        }
+
+        clones, err := cloneStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        config, err := clones.RenameConfig(args[0], args[1], by)
+
+        if err != nil {
+                return err
+        }
+
+        return out.printConfig(config, nil)
+}
+
+func listTrash(store configman.Store, out *output, args []string) error {
+        if len(args) != 0 {
+                return errUsage
+        }
+
+        trash, err := trashStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        items, err := trash.GetTrash()
+
+        if err != nil {
+                return err
+        }
+
+        return out.printTrash(items)
+}
+
+func restoreFromTrash(store configman.Store, out *output, args []string) error {
+        var err error
+        var config configman.Config
+        var setting *configman.Setting
+        var settings []*configman.Setting
+
+        if len(args) < 1 || len(args) > 2 {
+                return errUsage
+        }
+
+        trash, err := trashStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        if len(args) == 2 {
+                if setting, err = trash.RestoreSetting(args[0], args[1], by); err != nil {
+                        return err
+                }
+
+                return out.printSetting(setting)
+        }
+
+        if config, err = trash.RestoreConfig(args[0], by); err != nil {
+                return err
+        }
+
+        if settings, err = store.GetSettings(args[0]); err != nil {
+                return err
+        }
+
+        return out.printConfig(config, settings)
+}
+
+func purgeTrash(store configman.Store, out *output, args []string) error {
+        if len(args) != 0 {
+                return errUsage
+        }
+
+        trash, err := trashStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        purged, err := trash.PurgeTrash()
+
+        if err != nil {
+                return err
+        }
+
+        return out.print(map[string]int{"purged": purged}, func(w io.Writer) {
+                fmt.Fprintf(w, "purged %d configs and settings\n", purged)
+        })
+}
+
+func getSetting(store configman.Store, out *output, args []string) error {
+        if len(args) != 2 {
+                return errUsage
+        }
+
+        setting, err := store.GetSetting(args[0], args[1])
+
+        if err != nil {
+                return err
+        }
+
+        if setting == nil {
+                return fmt.Errorf("setting %s of config %s: %w", args[1], args[0], configman.ErrNotFound)
+        }
+
+        return out.printSetting(setting)
+}
+
+// setSetting sets the value of a setting, creating it if it does not
+// exist. The type is only needed to create a setting.
+func setSetting(store configman.Store, out *output, args []string) error {
+        var err error
+        var typ configman.Type
+        var value any
+        var setting *configman.Setting
+
+        flags := flag.NewFlagSet("settings set", flag.ContinueOnError)
+        typeName := flags.String("type", "", "type of the setting, required to create it")
+        desc := flags.String("description", "", "description of the setting when it is created")
+        revision := flags.Int64("if-revision", 0, "only update the setting if it is at this revision")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 3 {
+                return errUsage
+        }
+
+        config, name, raw := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+        if setting, err = store.GetSetting(config, name); err != nil {
+                return err
+        }
+
+        switch {
+        case *typeName != "":
+                if typ, err = configman.ParseType(*typeName); err != nil {
+                        return err
+                }
+        case setting != nil:
+                typ = setting.Type()
+        default:
+                return fmt.Errorf("setting %s of config %s does not exist, give its -type to create it", name, config)
+        }
+
+        if value, err = configman.ParseValue(typ, raw); err != nil {
+                return fmt.Errorf("%q is not a valid %s: %w", raw, typ, err)
+        }
+
+        batch := new(configman.Batch)
+
+        if setting == nil {
+                batch.Create(config, name, *desc, value)
+        } else {
+                batch.UpdateIf(config, name, value, *revision)
+        }
+
+        if _, err = store.ApplyBatch(batch, by); err != nil {
+                return err
+        }
+
+        if setting, err = store.GetSetting(config, name); err != nil {
+                return err
+        }
+
+        if setting == nil {
+                return errors.New("setting was deleted right after it was set")
+        }
+
+        return out.printSetting(setting)
+}
+
+func deleteSetting(store configman.Store, out *output, args []string) error {
+        var err error
+        var event *configman.ChangeEvent
+
+        flags := flag.NewFlagSet("settings delete", flag.ContinueOnError)
+        revision := flags.Int64("if-revision", 0, "only delete the setting if it is at this revision")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 2 {
+                return errUsage
+        }
+
+        batch := new(configman.Batch).DeleteIf(flags.Arg(0), flags.Arg(1), *revision)
+
+        if event, err = store.ApplyBatch(batch, by); err != nil {
+                return err
+        }
+
+        return out.print(map[string]int64{"revision": event.Revision}, func(w io.Writer) {
+                fmt.Fprintf(w, "deleted %s of config %s\n", flags.Arg(1), flags.Arg(0))
+        })
+}
+
+func showHistory(store configman.Store, out *output, args []string) error {
+        var err error
+        var events []configman.ChangeEvent
+
+        flags := flag.NewFlagSet("history", flag.ContinueOnError)
+        limit := flags.Int("limit", 20, "number of revisions to show")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 1 || *limit < 1 {
+                return errUsage
+        }
+
+        history, ok := configman.Extension[configman.HistoryStore](store)
+
+        if !ok {
+                return errors.New("the store does not keep history")
+        }
+
+        if events, err = history.GetHistory(flags.Arg(0), *limit); err != nil {
+                return err
+        }
+
+        return out.printHistory(events)
+}
+
+func diffConfigs(store configman.Store, out *output, args []string) error {
+        if len(args) != 2 {
+                return errUsage
+        }
+
+        diff, err := configman.NewDiff(store, configman.ParseRef(args[0]), configman.ParseRef(args[1]))
+
+        if err != nil {
+                return err
+        }
+
+        return out.printDiff(diff)
+}
+
+// mergeConfigs prints the merge and only applies it with -apply. Merges
+// with conflicts are never applied.
+func mergeConfigs(store configman.Store, out *output, args []string) error {
+        var err error
+        var merge *configman.Merge
+        var event *configman.ChangeEvent
+
+        flags := flag.NewFlagSet("merge", flag.ContinueOnError)
+        apply := flags.Bool("apply", false, "apply the merge if it has no conflicts")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 3 {
+                return errUsage
+        }
+
+        if merge, err = configman.NewMerge(store, configman.ParseRef(flags.Arg(0)), configman.ParseRef(flags.Arg(1)), flags.Arg(2)); err != nil {
+                return err
+        }
+
+        if *apply && len(merge.Conflicts) == 0 && len(merge.Batch.Ops) > 0 {
+                if event, err = store.ApplyBatch(merge.Batch, by); err != nil {
+                        return err
+                }
+
+                return out.printMerge(merge, event.Revision)
+        }
+
+        if err = out.printMerge(merge, 0); err != nil {
+                return err
+        }
+
+        if len(merge.Conflicts) > 0 {
+                return configman.ErrMergeConflict
+        }
+
+        return nil
+}
+
+// promoteSettings prints what the promotion changes and only applies it
+// with -apply.
+func promoteSettings(store configman.Store, out *output, args []string) error {
+        var err error
+        var plan *configman.PromotionPlan
+        var event *configman.ChangeEvent
+        var promotion configman.Promotion
+
+        flags := flag.NewFlagSet("promote", flag.ContinueOnError)
+        settings := flags.String("settings", "", "comma separated names of the settings to promote, every setting if empty")
+        selector := flags.String("selector", "", "only promote the settings whose labels match this selector")
+        skipSecrets := flags.Bool("skip-secrets", false, "leave out the settings labelled "+configman.SecretLabel+"=true")
+        apply := flags.Bool("apply", false, "apply the promotion")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        if flags.NArg() != 2 {
+                return errUsage
+        }
+
+        if promotion.Selector, err = configman.ParseSelector(*selector); err != nil {
+                return err
+        }
+
+        promotion.From, promotion.To, promotion.SkipSecrets = flags.Arg(0), flags.Arg(1), *skipSecrets
+
+        if *settings != "" {
+                promotion.Settings = strings.Split(*settings, ",")
+        }
+
+        if !*apply {
+                if plan, err = configman.PlanPromotion(store, promotion); err != nil {
+                        return err
+                }
+
+                return out.printPromotion(plan, 0)
+        }
+
+        plan, event, err = configman.Promote(store, promotion, by)
+
+        if errors.Is(err, configman.ErrTypeMismatch) && plan != nil {
+                if printErr := out.printPromotion(plan, 0); printErr != nil {
+                        return printErr
+                }
+        }
+
+        if err != nil {
+                return err
+        }
+
+        if event == nil {
+                return out.printPromotion(plan, 0)
+        }
+
+        return out.printPromotion(plan, event.Revision)
+}
+
+// isFlagSet reports whether the flag called name was given, so that an
+// empty value can be told apart from a missing one.
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+        set := false
+
+        flags.Visit(func(f *flag.Flag) {
+                set = set || f.Name == name
+        })
+
+        return set
+}
+
+// cloneStore returns store as a configman.CloneStore or an error if it
+// cannot clone and rename configs.
+func cloneStore(store configman.Store) (configman.CloneStore, error) {
+        clones, ok := configman.Extension[configman.CloneStore](store)
+
+        if !ok {
+                return nil, errors.New("store does not support cloning and renaming configs")
+        }
+
+        return clones, nil
+}
+
+// trashStore returns store as a configman.TrashStore or an error if it
+// does not keep deleted configs and settings.
+func trashStore(store configman.Store) (configman.TrashStore, error) {
+        trash, ok := configman.Extension[configman.TrashStore](store)
+
+        if !ok {
+                return nil, errors.New("store does not keep deleted configs and settings")
+        }
+
+        return trash, nil
+}
+
+// namespaceStore returns store as a configman.NamespaceStore or an error
+// if it does not keep namespaces.
+func namespaceStore(store configman.Store) (configman.NamespaceStore, error) {
+        namespaces, ok := configman.Extension[configman.NamespaceStore](store)
+
+        if !ok {
+                return nil, errors.New("store does not support namespaces")
+        }
+
+        return namespaces, nil
+}
+
+func listNamespaces(store configman.Store, out *output, args []string) error {
+        if len(args) != 0 {
+                return errUsage
+        }
+
+        namespaces, err := namespaceStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        list, err := namespaces.GetNamespaces()
+
+        if err != nil {
+                return err
+        }
+
+        return out.printNamespaces(list)
+}
+
+func createNamespace(store configman.Store, out *output, args []string) error {
+        if len(args) < 1 || len(args) > 2 {
+                return errUsage
+        }
+
+        desc := ""
+
+        if len(args) == 2 {
+                desc = args[1]
+        }
+
+        namespaces, err := namespaceStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        namespace, err := namespaces.CreateNamespace(args[0], desc)
+
+        if err != nil {
+                return err
+        }
+
+        return out.printNamespaces([]configman.Namespace{*namespace})
+}
+
+func deleteNamespace(store configman.Store, out *output, args []string) error {
+        if len(args) != 1 {
+                return errUsage
+        }
+
+        namespaces, err := namespaceStore(store)
+
+        if err != nil {
+                return err
+        }
+
+        return namespaces.DeleteNamespace(args[0])
+}
@@ -0,0 +1,225 @@
+// Command configman manages configs and settings from the command line.
+// It works either directly on a database, like configman-server does,
+// or against a configman server through its JSON API.
+//
+// Usage:
+//
+//	configman [flags] namespaces list
+//	configman [flags] namespaces create NAME [DESCRIPTION]
+//	configman [flags] namespaces delete NAME
+//	configman [flags] configs list [-namespace NAMESPACE]
+//	configman [flags] configs create NAME [DESCRIPTION]
+//	configman [flags] configs describe NAME
+//	configman [flags] configs deprecate NAME [REASON]
+//	configman [flags] configs clone [-reset] NAME NEW_NAME
+//	configman [flags] configs rename NAME NEW_NAME
+//	configman [flags] settings get CONFIG SETTING
+//	configman [flags] settings set [-type TYPE] [-description TEXT] [-if-revision N] CONFIG SETTING VALUE
+//	configman [flags] settings delete [-if-revision N] CONFIG SETTING
+//	configman [flags] export [-format ini|json] [-namespace NAMESPACE] [CONFIG]
+//	configman [flags] import [-format ini|json] [-prune] [-dry-run] [FILE]
+//	configman [flags] history [-limit N] CONFIG
+//	configman [flags] diff FROM TO
+//	configman [flags] merge [-apply] BASE THEIRS INTO
+//	configman [flags] promote [-settings NAMES] [-selector SELECTOR] [-skip-secrets] [-apply] FROM TO
+//	configman [flags] trash list
+//	configman [flags] trash restore CONFIG [SETTING]
+//	configman [flags] trash purge
+//
+// Export writes INI in the format of template.ini by default. Import
+// creates the configs and settings in the file that do not exist and
+// updates those that differ; with -prune it also deletes the settings
+// that are not in the file. The settings of a config are changed in one
+// batch, so either all of them change or none do.
+//
+// Clone copies a config with its settings, flag rules and labels; the
+// copy keeps their times, revisions and deprecation unless -reset is
+// given. Rename renames a config and everything that refers to it, so
+// its history and snapshots follow it.
+//
+// Diff prints how the settings of TO differ from those of FROM. Merge
+// prints the changes THEIRS made since BASE that it would make to INTO,
+// and the settings both changed differently; with -apply it makes them
+// in one batch unless there are such conflicts. FROM, TO, BASE and
+// THEIRS are configs, or configs at a snapshot written CONFIG@SNAPSHOT,
+// which only works on databases. A merge is usually of a config into
+// another with BASE a snapshot of THEIRS taken when INTO was last in
+// sync with it.
+//
+// Promote prints the settings of FROM it would copy to TO, every setting
+// or those named by -settings and matching -selector, and with -apply
+// copies them in one batch. Settings whose type differs in TO cannot be
+// promoted; nothing is copied while any is picked. Settings labelled
+// secret=true are left out with -skip-secrets.
+//
+// Deleted configs and settings go to the trash, which trash list lists,
+// until they expire. Trash restore restores a config, with the settings
+// deleted along with it, or a setting of a config. Expired items are
+// purged by the server; trash purge purges them right away.
+//
+// Configs in a namespace are named NAMESPACE:NAME. Export writes every
+// config in a namespace if -namespace is given without a config; configs
+// list only lists the configs in the namespace given by -namespace, or
+// in the default namespace if it is empty.
+//
+// Flags that are not given are read from the environment: -db from
+// CONFIGMAN_DB, -server from CONFIGMAN_SERVER, -token from
+// CONFIGMAN_TOKEN, -user from CONFIGMAN_USER and -password from
+// CONFIGMAN_PASSWORD.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	_ "github.com/tursodatabase/go-libsql"
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/client"
+	sqlstore "github.com/vlence/configman/stores/sql"
+)
+
+// A command runs one subcommand with the arguments that follow its name.
+type command func(store configman.Store, out *output, args []string) error
+
+// commands maps the names of the subcommands to their implementations.
+var commands = map[string]command{
+        "namespaces list":   listNamespaces,
+        "namespaces create": createNamespace,
+        "namespaces delete": deleteNamespace,
+        "configs list":      listConfigs,
+        "configs create":    createConfig,
+        "configs describe":  describeConfig,
+        "configs deprecate": deprecateConfig,
+        "configs clone":     cloneConfig,
+        "configs rename":    renameConfig,
+        "settings get":      getSetting,
+        "settings set":      setSetting,
+        "settings delete":   deleteSetting,
+        "export":            exportConfig,
+        "import":            importConfigs,
+        "history":           showHistory,
+        "diff":              diffConfigs,
+        "merge":             mergeConfigs,
+        "promote":           promoteSettings,
+        "trash list":        listTrash,
+        "trash restore":     restoreFromTrash,
+        "trash purge":       purgeTrash,
+}
+
+// errUsage is returned by commands given the wrong arguments.
+var errUsage = errors.New("wrong arguments, run configman -h for usage")
+
+// by is recorded as the author of changes made directly on a database.
+// Servers record the principal they authenticated instead.
+var by string
+
+func main() {
+        var err error
+        var store configman.Store
+
+        flags := flag.NewFlagSet("configman", flag.ExitOnError)
+        dsn := flags.String("db", os.Getenv("CONFIGMAN_DB"), "libsql database to manage directly")
+        server := flags.String("server", os.Getenv("CONFIGMAN_SERVER"), "URL of the configman server to manage instead of a database")
+        token := flags.String("token", os.Getenv("CONFIGMAN_TOKEN"), "API token to authenticate to the server with")
+        user := flags.String("user", os.Getenv("CONFIGMAN_USER"), "user to authenticate to the server as if there is no token")
+        password := flags.String("password", os.Getenv("CONFIGMAN_PASSWORD"), "password of -user")
+        format := flags.String("output", "text", "print results as text or json")
+        flags.StringVar(&by, "as", os.Getenv("USER"), "name recorded in history for changes made directly on a database")
+
+        flags.Usage = func() {
+                fmt.Fprintln(flags.Output(), "usage: configman [flags] <command> [arguments]")
+                fmt.Fprintln(flags.Output())
+                fmt.Fprintln(flags.Output(), "commands:")
+
+                for _, name := range []string{"namespaces list", "namespaces create", "namespaces delete", "configs list", "configs create", "configs describe", "configs deprecate", "configs clone", "configs rename", "settings get", "settings set", "settings delete", "export", "import", "history", "diff", "merge", "promote", "trash list", "trash restore", "trash purge"} {
+                        fmt.Fprintln(flags.Output(), "  "+name)
+                }
+
+                fmt.Fprintln(flags.Output())
+                fmt.Fprintln(flags.Output(), "flags:")
+                flags.PrintDefaults()
+        }
+
+        flags.Parse(os.Args[1:])
+
+        if *format != "text" && *format != "json" {
+                fatal(fmt.Errorf("unknown output %q, use text or json", *format))
+        }
+
+        name, args := commandName(flags.Args())
+        cmd, ok := commands[name]
+
+        if !ok {
+                flags.Usage()
+                os.Exit(2)
+        }
+
+        switch {
+        case *server != "" && *dsn != "":
+                fatal(errors.New("-db and -server cannot be used together"))
+        case *server != "":
+                store, err = client.New(*server, client.Options{Token: *token, User: *user, Password: *password})
+        default:
+                store, err = openDB(*dsn)
+        }
+
+        if err != nil {
+                fatal(err)
+        }
+
+        out := &output{w: os.Stdout, json: *format == "json"}
+
+        if err = cmd(store, out, args); err != nil {
+                fatal(err)
+        }
+}
+
+// commandName splits args into the name of the subcommand and its
+// arguments. The namespaces, configs, settings and trash commands have
+// two words.
+func commandName(args []string) (string, []string) {
+        if len(args) == 0 {
+                return "", nil
+        }
+
+        if (args[0] == "namespaces" || args[0] == "configs" || args[0] == "settings" || args[0] == "trash") && len(args) > 1 {
+                return args[0] + " " + args[1], args[2:]
+        }
+
+        return args[0], args[1:]
+}
+
+// openDB opens the database at dsn, configman.db in the working
+// directory if it is empty.
+func openDB(dsn string) (configman.Store, error) {
+        if dsn == "" {
+                dsn = "file:configman.db"
+        }
+
+        db, err := sql.Open("libsql", dsn)
+
+        if err != nil {
+                return nil, err
+        }
+
+        return sqlstore.NewSqlStore(db)
+}
+
+// fatal prints err and exits. Scripts can tell errors apart by the exit
+// status: 3 if something does not exist, 4 on conflicts and 1 otherwise.
+func fatal(err error) {
+        fmt.Fprintln(os.Stderr, "configman: "+strings.TrimPrefix(err.Error(), "configman: "))
+
+        switch {
+        case errors.Is(err, configman.ErrNotFound):
+                os.Exit(3)
+        case errors.Is(err, configman.ErrConflict), errors.Is(err, configman.ErrExists), errors.Is(err, configman.ErrNamespaceNotEmpty), errors.Is(err, configman.ErrMergeConflict):
+                os.Exit(4)
+        default:
+                os.Exit(1)
+        }
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// jsonConfig is how configs are printed with -output json and how they
+// are exported and imported as JSON.
+type jsonConfig struct {
+        Name              string         `json:"name"`
+        Description       string         `json:"description"`
+        Revision          int64          `json:"revision,omitempty"`
+        Deprecated        bool           `json:"deprecated"`
+        DeprecationReason string         `json:"deprecation_reason,omitempty"`
+        Settings          []*jsonSetting `json:"settings,omitempty"`
+}
+
+// jsonSetting is how settings are printed with -output json and how
+// they are exported and imported as JSON. Value is decoded once the type
+// is known.
+type jsonSetting struct {
+        Name              string          `json:"name"`
+        Type              configman.Type  `json:"type"`
+        Value             json.RawMessage `json:"value"`
+        Description       string          `json:"description"`
+        Revision          int64           `json:"revision,omitempty"`
+        Deprecated        bool            `json:"deprecated"`
+        DeprecationReason string          `json:"deprecation_reason,omitempty"`
+        CreatedAt         *time.Time      `json:"created_at,omitempty"`
+        UpdatedAt         *time.Time      `json:"updated_at,omitempty"`
+}
+
+// jsonChange is how the changes in history are printed with -output
+// json.
+type jsonChange struct {
+        Revision int64            `json:"revision"`
+        By       string           `json:"by"`
+        At       time.Time        `json:"at"`
+        Kind     configman.OpKind `json:"kind"`
+        Setting  string           `json:"setting"`
+        Type     configman.Type   `json:"type,omitempty"`
+        Value    any              `json:"value,omitempty"`
+        Reason   string           `json:"reason,omitempty"`
+        From     string           `json:"from,omitempty"`
+}
+
+// jsonNamespace is how namespaces are printed with -output json.
+type jsonNamespace struct {
+        Name        string    `json:"name"`
+        Description string    `json:"description"`
+        CreatedAt   time.Time `json:"created_at"`
+}
+
+// jsonTrashedItem is how the deleted configs and settings in the trash
+// are printed with -output json.
+type jsonTrashedItem struct {
+        Config      string    `json:"config"`
+        Setting     string    `json:"setting,omitempty"`
+        Description string    `json:"description"`
+        Settings    int       `json:"settings,omitempty"`
+        DeletedAt   time.Time `json:"deleted_at"`
+        ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// jsonSettingDiff is how the settings that differ between two configs
+// are printed with -output json.
+type jsonSettingDiff struct {
+        Setting string               `json:"setting"`
+        Kind    configman.ChangeKind `json:"kind"`
+        From    *jsonSetting         `json:"from,omitempty"`
+        To      *jsonSetting         `json:"to,omitempty"`
+}
+
+// jsonMergeConflict is how merge conflicts are printed with -output
+// json.
+type jsonMergeConflict struct {
+        Setting string       `json:"setting"`
+        Base    *jsonSetting `json:"base,omitempty"`
+        Ours    *jsonSetting `json:"ours,omitempty"`
+        Theirs  *jsonSetting `json:"theirs,omitempty"`
+}
+
+// jsonMergeOp is how the changes a merge makes are printed with -output
+// json.
+type jsonMergeOp struct {
+        Kind    configman.OpKind `json:"kind"`
+        Setting string           `json:"setting"`
+        Type    configman.Type   `json:"type,omitempty"`
+        Value   any              `json:"value,omitempty"`
+}
+
+func newJsonConfig(config configman.Config) *jsonConfig {
+        return &jsonConfig{
+                Name:              config.Name(),
+                Description:       config.Desc(),
+                Revision:          config.Revision(),
+                Deprecated:        config.Deprecated(),
+                DeprecationReason: config.DeprecationReason(),
+        }
+}
+
+func newJsonSetting(setting *configman.Setting) *jsonSetting {
+        createdAt, updatedAt := setting.CreatedAt(), setting.UpdatedAt()
+
+        // values of supported types always marshal
+        value, _ := json.Marshal(setting.Value())
+
+        return &jsonSetting{
+                Name:              setting.Name(),
+                Type:              setting.Type(),
+                Value:             value,
+                Description:       setting.Description(),
+                Revision:          setting.Revision(),
+                Deprecated:        setting.Deprecated(),
+                DeprecationReason: setting.DeprecationReason(),
+                CreatedAt:         &createdAt,
+                UpdatedAt:         &updatedAt,
+        }
+}
+
+// optionalJsonSetting returns newJsonSetting(setting), or nil if setting
+// is nil.
+func optionalJsonSetting(setting *configman.Setting) *jsonSetting {
+        if setting == nil {
+                return nil
+        }
+
+        return newJsonSetting(setting)
+}
+
+// output prints results either as JSON, for scripts, or as text, for
+// people.
+type output struct {
+        w    io.Writer
+        json bool
+}
+
+// print prints v as indented JSON if the output is JSON and calls text
+// with a tabwriter otherwise.
+func (out *output) print(v any, text func(w io.Writer)) error {
+        if out.json {
+                enc := json.NewEncoder(out.w)
+                enc.SetIndent("", "  ")
+                return enc.Encode(v)
+        }
+
+        tw := tabwriter.NewWriter(out.w, 0, 4, 2, ' ', 0)
+        text(tw)
+
+        return tw.Flush()
+}
+
+// printConfigs prints configs, one per line.
+func (out *output) printConfigs(configs []configman.Config) error {
+        body := make([]*jsonConfig, len(configs))
+
+        for i, config := range configs {
+                body[i] = newJsonConfig(config)
+        }
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprintln(w, "NAME\tREVISION\tDESCRIPTION")
+
+                for _, config := range body {
+                        fmt.Fprintf(w, "%s\t%d\t%s%s\n", config.Name, config.Revision, config.Description, deprecationNote(config.Deprecated, config.DeprecationReason))
+                }
+        })
+}
+
+// printNamespaces prints namespaces, one per line.
+func (out *output) printNamespaces(namespaces []configman.Namespace) error {
+        body := make([]jsonNamespace, len(namespaces))
+
+        for i, namespace := range namespaces {
+                body[i] = jsonNamespace(namespace)
+        }
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprintln(w, "NAME\tCREATED\tDESCRIPTION")
+
+                for _, namespace := range body {
+                        fmt.Fprintf(w, "%s\t%s\t%s\n", namespace.Name, namespace.CreatedAt.Format(time.RFC3339), namespace.Description)
+                }
+        })
+}
+
+// printTrash prints the items in the trash, one per line. Configs are
+// printed with the number of settings deleted along with them.
+func (out *output) printTrash(items []configman.TrashedItem) error {
+        body := make([]jsonTrashedItem, len(items))
+
+        for i, item := range items {
+                body[i] = jsonTrashedItem(item)
+        }
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprintln(w, "CONFIG	SETTING	DELETED	EXPIRES	DESCRIPTION")
+
+                for _, item := range body {
+                        setting := item.Setting
+
+                        if setting == "" {
+                                setting = fmt.Sprintf("(%d settings)", item.Settings)
+                        }
+
+                        fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.Config, setting, item.DeletedAt.Format(time.RFC3339), item.ExpiresAt.Format(time.RFC3339), item.Description)
+                }
+        })
+}
+
+// printConfig prints config and its settings.
+func (out *output) printConfig(config configman.Config, settings []*configman.Setting) error {
+        body := newJsonConfig(config)
+
+        for _, setting := range settings {
+                body.Settings = append(body.Settings, newJsonSetting(setting))
+        }
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprintf(w, "Name:\t%s\n", body.Name)
+                fmt.Fprintf(w, "Description:\t%s\n", body.Description)
+                fmt.Fprintf(w, "Revision:\t%d\n", body.Revision)
+
+                if body.Deprecated {
+                        fmt.Fprintf(w, "Deprecated:\t%s\n", body.DeprecationReason)
+                }
+
+                if len(settings) == 0 {
+                        return
+                }
+
+                fmt.Fprintln(w)
+                fmt.Fprintln(w, "SETTING\tTYPE\tVALUE\tREVISION\tDESCRIPTION")
+
+                for _, setting := range settings {
+                        fmt.Fprintf(w, "%s\t%s\t%v\t%d\t%s%s\n", setting.Name(), setting.Type(), setting.Value(), setting.Revision(), setting.Description(), deprecationNote(setting.Deprecated(), setting.DeprecationReason()))
+                }
+        })
+}
+
+// printSetting prints setting.
+func (out *output) printSetting(setting *configman.Setting) error {
+        return out.print(newJsonSetting(setting), func(w io.Writer) {
+                fmt.Fprintf(w, "Name:\t%s\n", setting.Name())
+                fmt.Fprintf(w, "Type:\t%s\n", setting.Type())
+                fmt.Fprintf(w, "Value:\t%v\n", setting.Value())
+                fmt.Fprintf(w, "Description:\t%s\n", setting.Description())
+                fmt.Fprintf(w, "Revision:\t%d\n", setting.Revision())
+                fmt.Fprintf(w, "Updated:\t%s\n", setting.UpdatedAt().Format(time.RFC3339))
+
+                if setting.Deprecated() {
+                        fmt.Fprintf(w, "Deprecated:\t%s\n", setting.DeprecationReason())
+                }
+        })
+}
+
+// printHistory prints every operation of events, newest first.
+func (out *output) printHistory(events []configman.ChangeEvent) error {
+        changes := make([]jsonChange, 0, len(events))
+
+        for _, event := range events {
+                for _, op := range event.Ops {
+                        change := jsonChange{
+                                Revision: event.Revision,
+                                By:       event.By,
+                                At:       event.At,
+                                Kind:     op.Kind,
+                                Setting:  op.Setting,
+                                Type:     configman.TypeOf(op.Value),
+                                Value:    op.Value,
+                        }
+
+                        if op.Kind == configman.OpDeprecate {
+                                change.Reason = op.Description
+                        }
+
+                        if op.Kind == configman.OpRename {
+                                change.From = op.Description
+                        }
+
+                        changes = append(changes, change)
+                }
+        }
+
+        return out.print(changes, func(w io.Writer) {
+                fmt.Fprintln(w, "REVISION\tAT\tBY\tCHANGE")
+
+                for _, change := range changes {
+                        var desc string
+
+                        switch change.Kind {
+                        case configman.OpCreate, configman.OpUpdate:
+                                desc = fmt.Sprintf("%s %s = %v", change.Kind, change.Setting, change.Value)
+                        case configman.OpDeprecate:
+                                desc = fmt.Sprintf("%s %s: %s", change.Kind, change.Setting, change.Reason)
+                        case configman.OpRename:
+                                desc = fmt.Sprintf("%s from %s", change.Kind, change.From)
+                        default:
+                                desc = fmt.Sprintf("%s %s", change.Kind, change.Setting)
+                        }
+
+                        fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", change.Revision, change.At.Format(time.RFC3339), change.By, desc)
+                }
+        })
+}
+
+// printDiff prints diff, one line per setting that differs.
+func (out *output) printDiff(diff *configman.Diff) error {
+        changes := make([]jsonSettingDiff, len(diff.Changes))
+
+        for i, change := range diff.Changes {
+                changes[i] = jsonSettingDiff{
+                        Setting: change.Setting,
+                        Kind:    change.Kind,
+                        From:    optionalJsonSetting(change.From),
+                        To:      optionalJsonSetting(change.To),
+                }
+        }
+
+        body := map[string]any{"from": diff.From.String(), "to": diff.To.String(), "changes": changes}
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprint(w, diff.String())
+        })
+}
+
+// printMerge prints merge, the changes it makes and its conflicts, and
+// the revision it was applied at if it is not 0.
+func (out *output) printMerge(merge *configman.Merge, revision int64) error {
+        ops := make([]jsonMergeOp, len(merge.Batch.Ops))
+        conflicts := make([]jsonMergeConflict, len(merge.Conflicts))
+
+        for i, op := range merge.Batch.Ops {
+                ops[i] = jsonMergeOp{Kind: op.Kind, Setting: op.Setting, Type: configman.TypeOf(op.Value), Value: op.Value}
+        }
+
+        for i, conflict := range merge.Conflicts {
+                conflicts[i] = jsonMergeConflict{
+                        Setting: conflict.Setting,
+                        Base:    optionalJsonSetting(conflict.Base),
+                        Ours:    optionalJsonSetting(conflict.Ours),
+                        Theirs:  optionalJsonSetting(conflict.Theirs),
+                }
+        }
+
+        body := map[string]any{
+                "base":      merge.Base.String(),
+                "theirs":    merge.Theirs.String(),
+                "into":      merge.Into,
+                "ops":       ops,
+                "conflicts": conflicts,
+                "applied":   revision != 0,
+                "revision":  revision,
+        }
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprint(w, merge.String())
+
+                if revision != 0 {
+                        fmt.Fprintf(w, "applied at revision %d\n", revision)
+                }
+        })
+}
+
+// printPromotion prints the plan of a promotion, and the revision it was
+// applied at if it is not 0.
+func (out *output) printPromotion(plan *configman.PromotionPlan, revision int64) error {
+        changes := make([]jsonSettingDiff, len(plan.Changes))
+        incompatible := make([]jsonSettingDiff, len(plan.Incompatible))
+
+        for i, change := range plan.Changes {
+                changes[i] = jsonSettingDiff{Setting: change.Setting, Kind: change.Kind, From: optionalJsonSetting(change.From), To: optionalJsonSetting(change.To)}
+        }
+
+        for i, change := range plan.Incompatible {
+                incompatible[i] = jsonSettingDiff{Setting: change.Setting, Kind: change.Kind, From: optionalJsonSetting(change.From), To: optionalJsonSetting(change.To)}
+        }
+
+        body := map[string]any{
+                "from":         plan.From,
+                "to":           plan.To,
+                "changes":      changes,
+                "incompatible": incompatible,
+                "skipped":      plan.Skipped,
+                "applied":      revision != 0,
+                "revision":     revision,
+        }
+
+        return out.print(body, func(w io.Writer) {
+                fmt.Fprint(w, plan.String())
+
+                if revision != 0 {
+                        fmt.Fprintf(w, "applied at revision %d\n", revision)
+                }
+        })
+}
+
+// deprecationNote returns the note appended to the description of
+// deprecated configs and settings in text output.
+func deprecationNote(deprecated bool, reason string) string {
+        if !deprecated {
+                return ""
+        }
+
+        if reason == "" {
+                return " (deprecated)"
+        }
+
+        return " (deprecated: " + reason + ")"
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// importSummary counts what an import changed in one config.
+type importSummary struct {
+        Config     string `json:"config"`
+        Created    bool   `json:"created"`
+        Added      int    `json:"added"`
+        Updated    int    `json:"updated"`
+        Deleted    int    `json:"deleted"`
+        Deprecated int    `json:"deprecated"`
+}
+
+// exportConfig prints a config and its settings, or every config in a
+// namespace, in a format import reads back.
+func exportConfig(store configman.Store, out *output, args []string) error {
+        var err error
+        var config configman.Config
+        var configs []configman.Config
+        var settings []*configman.Setting
+
+        flags := flag.NewFlagSet("export", flag.ContinueOnError)
+        format := flags.String("format", "ini", "ini or json")
+        namespace := flags.String("namespace", "", "namespace of CONFIG, or of every config to export if CONFIG is not given")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        switch {
+        case flags.NArg() == 1:
+                if config, err = getConfig(store, configman.QualifiedName(*namespace, flags.Arg(0))); err != nil {
+                        return err
+                }
+
+                configs = []configman.Config{config}
+        case flags.NArg() == 0 && *namespace != "":
+                if configs, err = store.GetConfigs(); err != nil {
+                        return err
+                }
+
+                configs = configman.ConfigsIn(configs, *namespace)
+        default:
+                return errUsage
+        }
+
+        if *format != "ini" && *format != "json" {
+                return fmt.Errorf("unknown format %q, use ini or json", *format)
+        }
+
+        body := make([]*jsonConfig, len(configs))
+
+        for i, config := range configs {
+                if settings, err = store.GetSettings(config.Name()); err != nil {
+                        return err
+                }
+
+                if *format == "json" {
+                        body[i] = newJsonConfig(config)
+
+                        for _, setting := range settings {
+                                body[i].Settings = append(body[i].Settings, newJsonSetting(setting))
+                        }
+
+                        continue
+                }
+
+                if i > 0 {
+                        fmt.Fprintln(out.w)
+                }
+
+                if err = writeIni(out.w, config, settings); err != nil {
+                        return err
+                }
+        }
+
+        switch {
+        case *format == "ini":
+                return nil
+        case flags.NArg() == 1:
+                return (&output{w: out.w, json: true}).print(body[0], nil)
+        default:
+                return (&output{w: out.w, json: true}).print(body, nil)
+        }
+}
+
+// importConfigs creates or updates the configs in a file, or stdin, so
+// that they match it. The settings of each config are changed in one
+// batch.
+func importConfigs(store configman.Store, out *output, args []string) error {
+        var err error
+        var data []byte
+        var configs []*jsonConfig
+
+        flags := flag.NewFlagSet("import", flag.ContinueOnError)
+        format := flags.String("format", "", "ini or json, guessed from the file name if not given")
+        prune := flags.Bool("prune", false, "delete settings that are not in the file")
+        dryRun := flags.Bool("dry-run", false, "only print what would change")
+
+        if err = flags.Parse(args); err != nil {
+                return err
+        }
+
+        switch flags.NArg() {
+        case 0:
+                data, err = io.ReadAll(os.Stdin)
+        case 1:
+                data, err = os.ReadFile(flags.Arg(0))
+        default:
+                return errUsage
+        }
+
+        if err != nil {
+                return err
+        }
+
+        if *format == "" {
+                *format = "ini"
+
+                if strings.HasSuffix(flags.Arg(0), ".json") {
+                        *format = "json"
+                }
+        }
+
+        switch *format {
+        case "ini":
+                configs, err = readIni(data)
+        case "json":
+                configs, err = readJson(data)
+        default:
+                return fmt.Errorf("unknown format %q, use ini or json", *format)
+        }
+
+        if err != nil {
+                return err
+        }
+
+        summaries := make([]*importSummary, 0, len(configs))
+
+        for _, config := range configs {
+                if config.Name == "" {
+                        return errors.New("every config needs a name")
+                }
+
+                summary, err := importConfig(store, config, *prune, *dryRun)
+
+                if err != nil {
+                        return fmt.Errorf("config %s: %w", config.Name, err)
+                }
+
+                summaries = append(summaries, summary)
+        }
+
+        return out.print(summaries, func(w io.Writer) {
+                fmt.Fprintln(w, "CONFIG\tCREATED\tADDED\tUPDATED\tDELETED\tDEPRECATED")
+
+                for _, s := range summaries {
+                        fmt.Fprintf(w, "%s\t%t\t%d\t%d\t%d\t%d\n", s.Config, s.Created, s.Added, s.Updated, s.Deleted, s.Deprecated)
+                }
+        })
+}
+
+// importConfig makes the config in the store match the given one.
+func importConfig(store configman.Store, want *jsonConfig, prune, dryRun bool) (*importSummary, error) {
+        var err error
+        var value any
+        var config configman.Config
+        var settings []*configman.Setting
+
+        summary := &importSummary{Config: want.Name}
+        existing := make(map[string]*configman.Setting)
+
+        if config, err = store.GetConfig(want.Name); err != nil {
+                return nil, err
+        }
+
+        if config == nil {
+                summary.Created = true
+        } else if settings, err = store.GetSettings(want.Name); err != nil {
+                return nil, err
+        }
+
+        for _, setting := range settings {
+                existing[setting.Name()] = setting
+        }
+
+        batch := new(configman.Batch)
+
+        for _, s := range want.Settings {
+                if value, err = configman.UnmarshalValue(s.Type, s.Value); err != nil {
+                        return nil, fmt.Errorf("setting %s: %w", s.Name, err)
+                }
+
+                setting, ok := existing[s.Name]
+                delete(existing, s.Name)
+
+                switch {
+                case !ok:
+                        batch.Create(want.Name, s.Name, s.Description, value)
+                        summary.Added++
+                case setting.Type() != s.Type:
+                        return nil, fmt.Errorf("setting %s is a %s, not a %s: %w", s.Name, setting.Type(), s.Type, configman.ErrTypeMismatch)
+                case setting.Value() != value:
+                        batch.UpdateIf(want.Name, s.Name, value, setting.Revision())
+                        summary.Updated++
+                }
+
+                if s.Deprecated && (!ok || !setting.Deprecated() || setting.DeprecationReason() != s.DeprecationReason) {
+                        batch.Deprecate(want.Name, s.Name, s.DeprecationReason)
+                        summary.Deprecated++
+                }
+        }
+
+        if prune {
+                for name, setting := range existing {
+                        batch.DeleteIf(want.Name, name, setting.Revision())
+                        summary.Deleted++
+                }
+        }
+
+        if dryRun {
+                return summary, nil
+        }
+
+        if config == nil {
+                if config, err = store.CreateConfig(want.Name, want.Description); err != nil {
+                        return nil, err
+                }
+        } else if config.Desc() != want.Description {
+                if _, err = config.SetDesc(want.Description); err != nil {
+                        return nil, err
+                }
+        }
+
+        if want.Deprecated && (!config.Deprecated() || config.DeprecationReason() != want.DeprecationReason) {
+                if err = store.DeprecateConfig(want.Name, want.DeprecationReason); err != nil {
+                        return nil, err
+                }
+        }
+
+        if len(batch.Ops) > 0 {
+                if _, err = store.ApplyBatch(batch, by); err != nil {
+                        return nil, err
+                }
+        }
+
+        return summary, nil
+}
+
+// readJson reads one config or a list of configs exported as JSON.
+func readJson(data []byte) ([]*jsonConfig, error) {
+        var configs []*jsonConfig
+
+        data = bytes.TrimSpace(data)
+
+        if len(data) > 0 && data[0] == '{' {
+                configs = make([]*jsonConfig, 1)
+                return configs, json.Unmarshal(data, &configs[0])
+        }
+
+        return configs, json.Unmarshal(data, &configs)
+}
+
+// writeIni writes config and its settings in the format of template.ini:
+// a [config] section followed by a [setting] section per setting. String
+// values that would not read back the same are quoted.
+func writeIni(w io.Writer, config configman.Config, settings []*configman.Setting) error {
+        b := bufio.NewWriter(w)
+
+        fmt.Fprintln(b, "[config]")
+        fmt.Fprintf(b, "name = %s\n", config.Name())
+        fmt.Fprintf(b, "description = %s\n", iniString(config.Desc()))
+        fmt.Fprintf(b, "deprecated = %t\n", config.Deprecated())
+
+        if config.Deprecated() {
+                fmt.Fprintf(b, "deprecation_reason = %s\n", iniString(config.DeprecationReason()))
+        }
+
+        for _, setting := range settings {
+                value := fmt.Sprint(setting.Value())
+
+                if s, ok := setting.Value().(string); ok {
+                        value = iniString(s)
+                }
+
+                fmt.Fprintln(b)
+                fmt.Fprintln(b, "[setting]")
+                fmt.Fprintf(b, "name = %s\n", setting.Name())
+                fmt.Fprintf(b, "type = %s\n", setting.Type())
+                fmt.Fprintf(b, "value = %s\n", value)
+                fmt.Fprintf(b, "description = %s\n", iniString(setting.Description()))
+                fmt.Fprintf(b, "deprecated = %t\n", setting.Deprecated())
+
+                if setting.Deprecated() {
+                        fmt.Fprintf(b, "deprecated_at = %s\n", setting.DeprecatedAt().Format(time.RFC3339))
+                        fmt.Fprintf(b, "deprecation_reason = %s\n", iniString(setting.DeprecationReason()))
+                }
+
+                fmt.Fprintf(b, "created_at = %s\n", setting.CreatedAt().Format(time.RFC3339))
+                fmt.Fprintf(b, "updated_at = %s\n", setting.UpdatedAt().Format(time.RFC3339))
+        }
+
+        return b.Flush()
+}
+
+// iniString returns s quoted if it would not read back the same
+// unquoted.
+func iniString(s string) string {
+        if s != strings.TrimSpace(s) || strings.ContainsAny(s, "\n\r\"") {
+                return strconv.Quote(s)
+        }
+
+        return s
+}
+
+// readIni reads the configs written by writeIni. Settings belong to the
+// [config] section before them. Keys import does not use, like the
+// timestamps, are ignored.
+func readIni(data []byte) ([]*jsonConfig, error) {
+        var configs []*jsonConfig
+        var setting *jsonSetting
+        var section string
+        var typ string
+        var raw string
+
+        // the value of a setting can only be parsed once its type is
+        // known, which may come after it
+        finishSetting := func() error {
+                if setting == nil {
+                        return nil
+                }
+
+                t, err := configman.ParseType(typ)
+
+                if err != nil {
+                        return fmt.Errorf("setting %s: %w", setting.Name, err)
+                }
+
+                value, err := configman.ParseValue(t, raw)
+
+                if err != nil {
+                        return fmt.Errorf("setting %s: %w", setting.Name, err)
+                }
+
+                setting.Type = t
+                setting.Value, err = json.Marshal(value)
+                setting = nil
+
+                return err
+        }
+
+        scanner := bufio.NewScanner(bytes.NewReader(data))
+
+        for n := 1; scanner.Scan(); n++ {
+                line := strings.TrimSpace(scanner.Text())
+
+                if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+                        continue
+                }
+
+                if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+                        if err := finishSetting(); err != nil {
+                                return nil, err
+                        }
+
+                        section = line[1 : len(line)-1]
+
+                        switch section {
+                        case "config":
+                                configs = append(configs, new(jsonConfig))
+                        case "setting":
+                                if len(configs) == 0 {
+                                        return nil, fmt.Errorf("line %d: [setting] before any [config]", n)
+                                }
+
+                                setting = new(jsonSetting)
+                                typ, raw = "", ""
+                                config := configs[len(configs)-1]
+                                config.Settings = append(config.Settings, setting)
+                        default:
+                                return nil, fmt.Errorf("line %d: unknown section [%s]", n, section)
+                        }
+
+                        continue
+                }
+
+                key, value, ok := strings.Cut(line, "=")
+
+                if !ok || section == "" {
+                        return nil, fmt.Errorf("line %d: expected key = value in a section", n)
+                }
+
+                key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+                if strings.HasPrefix(value, `"`) {
+                        unquoted, err := strconv.Unquote(value)
+
+                        if err != nil {
+                                return nil, fmt.Errorf("line %d: %w", n, err)
+                        }
+
+                        value = unquoted
+                }
+
+                if err := setIniKey(configs[len(configs)-1], setting, key, value, &typ, &raw); err != nil {
+                        return nil, fmt.Errorf("line %d: %w", n, err)
+                }
+        }
+
+        if err := finishSetting(); err != nil {
+                return nil, err
+        }
+
+        return configs, scanner.Err()
+}
+
+// setIniKey sets the field named by key of setting or, if setting is
+// nil, of config. The type and value of settings are kept in typ and raw
+// until the whole section has been read.
+func setIniKey(config *jsonConfig, setting *jsonSetting, key, value string, typ, raw *string) error {
+        var err error
+        var deprecated *bool
+        var name, desc, reason *string
+
+        if setting == nil {
+                name, desc, deprecated, reason = &config.Name, &config.Description, &config.Deprecated, &config.DeprecationReason
+        } else {
+                name, desc, deprecated, reason = &setting.Name, &setting.Description, &setting.Deprecated, &setting.DeprecationReason
+        }
+
+        switch {
+        case key == "name":
+                *name = value
+        case key == "description":
+                *desc = value
+        case key == "deprecated":
+                *deprecated, err = strconv.ParseBool(value)
+        case key == "deprecation_reason":
+                *reason = value
+        case key == "type" && setting != nil:
+                *typ = value
+        case key == "value" && setting != nil:
+                *raw = value
+        }
+
+        if err != nil {
+                return errors.New("deprecated must be true or false")
+        }
+
+        return nil
+}
@@ -13,6 +13,7 @@ type Config struct {
         canBeDeprecated
         canBeCreated
         canBeUpdated
+        hasRevision
 
         settings []*Setting
 }
@@ -0,0 +1,331 @@
+package configman
+
+import (
+        "errors"
+        "fmt"
+        "maps"
+        "slices"
+        "strings"
+)
+
+var ErrMergeConflict = errors.New("configman: both sides changed the same settings differently")
+
+// ChangeKind is how a setting differs between two sets of settings.
+type ChangeKind string
+
+const (
+        SettingAdded       ChangeKind = "added"        // only in the new settings
+        SettingRemoved     ChangeKind = "removed"      // only in the old settings
+        SettingChanged     ChangeKind = "changed"      // same type, different value
+        SettingTypeChanged ChangeKind = "type_changed" // different type
+)
+
+// A SettingDiff is a setting that differs between two sets of settings.
+// From is nil if the setting was added and To if it was removed.
+type SettingDiff struct {
+        Setting string
+        Kind    ChangeKind
+        From    *Setting
+        To      *Setting
+}
+
+// A Diff is how the settings of one config, or of a config when a
+// snapshot was taken, differ from those of another. Settings are
+// compared by name, type and value.
+type Diff struct {
+        From    Ref
+        To      Ref
+        Changes []SettingDiff // ordered by setting name
+}
+
+// DiffSettings returns how the settings to differ from the settings
+// from, ordered by setting name. Equal settings are left out.
+func DiffSettings(from, to []*Setting) []SettingDiff {
+        changes := make([]SettingDiff, 0)
+        before, after := byName(from), byName(to)
+
+        for _, name := range unionOfNames(before, after) {
+                a, b := before[name], after[name]
+
+                switch {
+                case a == nil:
+                        changes = append(changes, SettingDiff{Setting: name, Kind: SettingAdded, To: b})
+                case b == nil:
+                        changes = append(changes, SettingDiff{Setting: name, Kind: SettingRemoved, From: a})
+                case a.Type() != b.Type():
+                        changes = append(changes, SettingDiff{Setting: name, Kind: SettingTypeChanged, From: a, To: b})
+                case a.Value() != b.Value():
+                        changes = append(changes, SettingDiff{Setting: name, Kind: SettingChanged, From: a, To: b})
+                }
+        }
+
+        return changes
+}
+
+// NewDiff returns how the settings to names in store differ from those
+// from names.
+func NewDiff(store Store, from, to Ref) (*Diff, error) {
+        a, err := SettingsOf(store, from)
+
+        if err != nil {
+                return nil, err
+        }
+
+        b, err := SettingsOf(store, to)
+
+        if err != nil {
+                return nil, err
+        }
+
+        return &Diff{From: from, To: to, Changes: DiffSettings(a, b)}, nil
+}
+
+// String renders the diff as text, one line per setting: "+" for added
+// settings, "-" for removed ones, "~" for changed values and "!" for
+// changed types, under a header naming both sides.
+func (diff *Diff) String() string {
+        var b strings.Builder
+
+        fmt.Fprintf(&b, "--- %s\n+++ %s\n", diff.From, diff.To)
+
+        for _, change := range diff.Changes {
+                switch change.Kind {
+                case SettingAdded:
+                        fmt.Fprintf(&b, "+ %s = %s\n", change.Setting, formatSetting(change.To))
+                case SettingRemoved:
+                        fmt.Fprintf(&b, "- %s = %s\n", change.Setting, formatSetting(change.From))
+                case SettingChanged:
+                        fmt.Fprintf(&b, "~ %s = %s -> %s\n", change.Setting, formatValue(change.From), formatValue(change.To))
+                case SettingTypeChanged:
+                        fmt.Fprintf(&b, "! %s = %s -> %s\n", change.Setting, formatSetting(change.From), formatSetting(change.To))
+                }
+        }
+
+        return b.String()
+}
+
+// A MergeConflict is a setting that was changed differently on both
+// sides of a merge since their base. A nil setting does not exist on
+// that side.
+type MergeConflict struct {
+        Setting string
+        Base    *Setting
+        Ours    *Setting
+        Theirs  *Setting
+}
+
+// A Merge is the result of merging the changes made to one config since
+// a base into another, see MergeSettings.
+type Merge struct {
+        Base      Ref
+        Theirs    Ref
+        Into      string
+        Batch     *Batch // applies the changes without conflicts to Into
+        Conflicts []MergeConflict
+}
+
+// MergeSettings merges the changes theirs made since base into ours, the
+// settings of the config into. Settings only theirs changed are changed
+// the same way by the returned batch; those changed differently on both
+// sides are returned as conflicts and left alone. The batch only applies
+// if the settings of into are still at the revisions they had in ours.
+func MergeSettings(base, ours, theirs []*Setting, into string) (*Batch, []MergeConflict) {
+        batch := new(Batch)
+        conflicts := make([]MergeConflict, 0)
+        b, o, t := byName(base), byName(ours), byName(theirs)
+
+        for _, name := range unionOfNames(b, o, t) {
+                switch {
+                case sameSetting(b[name], t[name]), sameSetting(o[name], t[name]):
+                        // theirs did not change it, or changed it like ours
+                case !sameSetting(b[name], o[name]):
+                        conflicts = append(conflicts, MergeConflict{Setting: name, Base: b[name], Ours: o[name], Theirs: t[name]})
+                case t[name] == nil:
+                        batch.DeleteIf(into, name, o[name].Revision())
+                case o[name] == nil:
+                        batch.Create(into, name, t[name].Description(), t[name].Value())
+                case o[name].Type() != t[name].Type():
+                        batch.DeleteIf(into, name, o[name].Revision())
+                        batch.Create(into, name, t[name].Description(), t[name].Value())
+                default:
+                        batch.UpdateIf(into, name, t[name].Value(), o[name].Revision())
+                }
+        }
+
+        return batch, conflicts
+}
+
+// NewMerge merges the changes theirs made since base into the current
+// settings of the config into, in store. The merge is not applied; apply
+// its batch with ApplyBatch if it has no conflicts.
+func NewMerge(store Store, base, theirs Ref, into string) (*Merge, error) {
+        var err error
+        var sides [3][]*Setting
+
+        for i, ref := range []Ref{base, theirs, {Config: into}} {
+                if sides[i], err = SettingsOf(store, ref); err != nil {
+                        return nil, err
+                }
+        }
+
+        merge := &Merge{Base: base, Theirs: theirs, Into: into}
+        merge.Batch, merge.Conflicts = MergeSettings(sides[0], sides[2], sides[1], into)
+
+        return merge, nil
+}
+
+// String renders the merge as text: the changes it makes to Into, one
+// line per operation, then the conflicts, one line per setting with its
+// base, our and their value.
+func (merge *Merge) String() string {
+        var b strings.Builder
+
+        fmt.Fprintf(&b, "merge %s into %s since %s\n", merge.Theirs, merge.Into, merge.Base)
+
+        for _, op := range merge.Batch.Ops {
+                switch op.Kind {
+                case OpCreate:
+                        fmt.Fprintf(&b, "create %s = %s (%s)\n", op.Setting, formatAny(op.Value), TypeOf(op.Value))
+                case OpUpdate:
+                        fmt.Fprintf(&b, "update %s = %s\n", op.Setting, formatAny(op.Value))
+                case OpDelete:
+                        fmt.Fprintf(&b, "delete %s\n", op.Setting)
+                }
+        }
+
+        for _, conflict := range merge.Conflicts {
+                fmt.Fprintf(&b, "conflict %s: base %s, ours %s, theirs %s\n", conflict.Setting, formatSetting(conflict.Base), formatSetting(conflict.Ours), formatSetting(conflict.Theirs))
+        }
+
+        if len(merge.Batch.Ops) == 0 && len(merge.Conflicts) == 0 {
+                b.WriteString("nothing to merge\n")
+        }
+
+        return b.String()
+}
+
+// A Ref names the settings of a config, as they are now if Snapshot is
+// empty, or as they were when the snapshot was taken.
+type Ref struct {
+        Config   string
+        Snapshot string
+}
+
+// ParseRef parses a ref written as CONFIG or CONFIG@SNAPSHOT.
+func ParseRef(s string) Ref {
+        if i := strings.LastIndex(s, "@"); i >= 0 {
+                return Ref{Config: s[:i], Snapshot: s[i+1:]}
+        }
+
+        return Ref{Config: s}
+}
+
+// String returns ref as ParseRef reads it.
+func (ref Ref) String() string {
+        if ref.Snapshot == "" {
+                return ref.Config
+        }
+
+        return ref.Config + "@" + ref.Snapshot
+}
+
+// SettingsOf returns the settings ref names in store. Settings at a
+// snapshot can only be read from stores that are a SnapshotStore.
+// ErrNotFound is returned if the config or snapshot does not exist and
+// ErrNotInSnapshot if the snapshot does not include the config.
+func SettingsOf(store Store, ref Ref) ([]*Setting, error) {
+        if ref.Snapshot == "" {
+                config, err := store.GetConfig(ref.Config)
+
+                // GetConfig returns the zero config if there is none
+                if err == nil && config.Name() == "" {
+                        err = fmt.Errorf("config %s: %w", ref.Config, ErrNotFound)
+                }
+
+                if err != nil {
+                        return nil, err
+                }
+
+                return store.GetSettings(ref.Config)
+        }
+
+        snapshots, ok := Extension[SnapshotStore](store)
+
+        if !ok {
+                return nil, errors.New("configman: the store does not support snapshots")
+        }
+
+        snapshot, err := snapshots.GetSnapshot(ref.Snapshot)
+
+        if err == nil && snapshot == nil {
+                err = fmt.Errorf("snapshot %s: %w", ref.Snapshot, ErrNotFound)
+        }
+
+        if err != nil {
+                return nil, err
+        }
+
+        if !snapshot.Includes(ref.Config) {
+                return nil, fmt.Errorf("config %s, snapshot %s: %w", ref.Config, ref.Snapshot, ErrNotInSnapshot)
+        }
+
+        return snapshots.GetSettingsAt(ref.Config, snapshot.Revision)
+}
+
+// byName maps the names of settings to them.
+func byName(settings []*Setting) map[string]*Setting {
+        named := make(map[string]*Setting, len(settings))
+
+        for _, setting := range settings {
+                named[setting.Name()] = setting
+        }
+
+        return named
+}
+
+// unionOfNames returns the names of the settings in any of sets, sorted.
+func unionOfNames(sets ...map[string]*Setting) []string {
+        names := make(map[string]bool)
+
+        for _, set := range sets {
+                for name := range set {
+                        names[name] = true
+                }
+        }
+
+        return slices.Sorted(maps.Keys(names))
+}
+
+// sameSetting reports whether a and b have the same type and value, or
+// are both nil.
+func sameSetting(a, b *Setting) bool {
+        if a == nil || b == nil {
+                return a == b
+        }
+
+        return a.Type() == b.Type() && a.Value() == b.Value()
+}
+
+// formatSetting formats the value and type of setting, or "none" if it
+// is nil.
+func formatSetting(setting *Setting) string {
+        if setting == nil {
+                return "none"
+        }
+
+        return formatValue(setting) + " (" + setting.Type().String() + ")"
+}
+
+// formatValue formats the value of setting, quoting strings.
+func formatValue(setting *Setting) string {
+        return formatAny(setting.Value())
+}
+
+// formatAny formats value, quoting strings.
+func formatAny(value any) string {
+        if s, ok := value.(string); ok {
+                return fmt.Sprintf("%q", s)
+        }
+
+        return fmt.Sprint(value)
+}
@@ -0,0 +1,173 @@
+package configman
+
+import (
+        "fmt"
+        "maps"
+        "slices"
+        "testing"
+)
+
+// newSettings returns settings named by the keys of values, at revision
+// 1, ordered by name.
+func newSettings(t *testing.T, values map[string]any) []*Setting {
+        t.Helper()
+
+        settings := make([]*Setting, 0, len(values))
+
+        for _, name := range slices.Sorted(maps.Keys(values)) {
+                setting, err := NewSetting(SettingFields{Name: name, Value: values[name], Revision: 1})
+
+                if err != nil {
+                        t.Fatalf("failed to create setting %s: %v", name, err)
+                }
+
+                settings = append(settings, setting)
+        }
+
+        return settings
+}
+
+func TestDiffSettings(t *testing.T) {
+        from := newSettings(t, map[string]any{"same": int64(1), "changed": "x", "retyped": true, "removed": int64(2)})
+        to := newSettings(t, map[string]any{"same": int64(1), "changed": "y", "retyped": "true", "added": int64(3)})
+
+        var got []string
+
+        for _, change := range DiffSettings(from, to) {
+                got = append(got, change.Setting+" "+string(change.Kind))
+        }
+
+        want := []string{"added added", "changed changed", "removed removed", "retyped type_changed"}
+
+        if !slices.Equal(got, want) {
+                t.Errorf("got changes %v, want %v", got, want)
+        }
+}
+
+func TestMergeSettings(t *testing.T) {
+        tests := []struct {
+                name      string
+                base      map[string]any
+                ours      map[string]any
+                theirs    map[string]any
+                ops       []string
+                conflicts []string
+        }{
+                {
+                        name:   "unchanged by theirs",
+                        base:   map[string]any{"timeout": int64(30)},
+                        ours:   map[string]any{"timeout": int64(60)},
+                        theirs: map[string]any{"timeout": int64(30)},
+                },
+                {
+                        name:   "changed by theirs",
+                        base:   map[string]any{"timeout": int64(30)},
+                        ours:   map[string]any{"timeout": int64(30)},
+                        theirs: map[string]any{"timeout": int64(60)},
+                        ops:    []string{"update timeout=60"},
+                },
+                {
+                        name:   "changed alike on both sides",
+                        base:   map[string]any{"timeout": int64(30)},
+                        ours:   map[string]any{"timeout": int64(60)},
+                        theirs: map[string]any{"timeout": int64(60)},
+                },
+                {
+                        name:      "changed differently on both sides",
+                        base:      map[string]any{"timeout": int64(30)},
+                        ours:      map[string]any{"timeout": int64(45)},
+                        theirs:    map[string]any{"timeout": int64(60)},
+                        conflicts: []string{"timeout"},
+                },
+                {
+                        name:   "deleted by theirs",
+                        base:   map[string]any{"timeout": int64(30)},
+                        ours:   map[string]any{"timeout": int64(30)},
+                        theirs: map[string]any{},
+                        ops:    []string{"delete timeout"},
+                },
+                {
+                        name:      "deleted by theirs and changed by ours",
+                        base:      map[string]any{"timeout": int64(30)},
+                        ours:      map[string]any{"timeout": int64(45)},
+                        theirs:    map[string]any{},
+                        conflicts: []string{"timeout"},
+                },
+                {
+                        name:      "deleted by ours and changed by theirs",
+                        base:      map[string]any{"timeout": int64(30)},
+                        ours:      map[string]any{},
+                        theirs:    map[string]any{"timeout": int64(60)},
+                        conflicts: []string{"timeout"},
+                },
+                {
+                        name:   "added by theirs",
+                        base:   map[string]any{},
+                        ours:   map[string]any{},
+                        theirs: map[string]any{"retries": int64(3)},
+                        ops:    []string{"create retries=3"},
+                },
+                {
+                        name:      "added differently on both sides",
+                        base:      map[string]any{},
+                        ours:      map[string]any{"retries": int64(5)},
+                        theirs:    map[string]any{"retries": int64(3)},
+                        conflicts: []string{"retries"},
+                },
+                {
+                        name:   "type changed by theirs",
+                        base:   map[string]any{"timeout": int64(30)},
+                        ours:   map[string]any{"timeout": int64(30)},
+                        theirs: map[string]any{"timeout": "30s"},
+                        ops:    []string{"delete timeout", "create timeout=30s"},
+                },
+                {
+                        name:      "several settings",
+                        base:      map[string]any{"timeout": int64(30), "retries": int64(3)},
+                        ours:      map[string]any{"timeout": int64(45), "retries": int64(3)},
+                        theirs:    map[string]any{"timeout": int64(60), "retries": int64(5), "limit": int64(10)},
+                        ops:       []string{"create limit=10", "update retries=5"},
+                        conflicts: []string{"timeout"},
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        var ops, conflicts []string
+
+                        batch, merged := MergeSettings(newSettings(t, test.base), newSettings(t, test.ours), newSettings(t, test.theirs), "app")
+
+                        for _, op := range batch.Ops {
+                                switch {
+                                case op.Config != "app":
+                                        t.Errorf("got op on config %s, want app", op.Config)
+                                case op.Kind == OpDelete:
+                                        ops = append(ops, fmt.Sprintf("%s %s", op.Kind, op.Setting))
+                                default:
+                                        ops = append(ops, fmt.Sprintf("%s %s=%v", op.Kind, op.Setting, op.Value))
+                                }
+                        }
+
+                        for _, conflict := range merged {
+                                conflicts = append(conflicts, conflict.Setting)
+                        }
+
+                        if !slices.Equal(ops, test.ops) {
+                                t.Errorf("got ops %v, want %v", ops, test.ops)
+                        }
+
+                        if !slices.Equal(conflicts, test.conflicts) {
+                                t.Errorf("got conflicts %v, want %v", conflicts, test.conflicts)
+                        }
+                })
+        }
+}
+
+func TestMergeOnlyAppliesToUnchangedSettings(t *testing.T) {
+        base := newSettings(t, map[string]any{"timeout": int64(30)})
+        batch, _ := MergeSettings(base, base, newSettings(t, map[string]any{"timeout": int64(60)}), "app")
+
+        if len(batch.Ops) != 1 || batch.Ops[0].ExpectedRevision != 1 {
+                t.Errorf("got ops %+v, want one update of timeout at revision 1", batch.Ops)
+        }
+}
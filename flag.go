@@ -0,0 +1,186 @@
+package configman
+
+import (
+        "errors"
+        "hash/fnv"
+        "slices"
+)
+
+// An Operator decides how a Rule compares an attribute of an EvalContext
+// with the values of the rule.
+type Operator string
+
+const (
+        OpIn    Operator = "in"     // attribute is one of the rule values
+        OpNotIn Operator = "not_in" // attribute is none of the rule values
+)
+
+// Reason explains why an Evaluation returned the value it did.
+type Reason string
+
+const (
+        ReasonDefault   Reason = "default"    // no rule matched, the setting value was returned
+        ReasonRuleMatch Reason = "rule_match" // a rule matched the evaluation context
+        ReasonRollout   Reason = "rollout"    // a rule matched and the context fell inside its rollout percentage
+)
+
+// Attributes of an EvalContext that rules can match on without going
+// through EvalContext.Attributes.
+const (
+        AttrUserID = "user_id"
+        AttrTenant = "tenant"
+        AttrRegion = "region"
+)
+
+var ErrInvalidRule = errors.New("configman: invalid flag rule")
+
+// FlagStore is implemented by stores that can persist the targeting
+// rules of feature flags. A feature flag is a Bool setting; its value is
+// returned when none of its rules match.
+type FlagStore interface {
+        // GetFlagRules returns the rules of the given setting in the order
+        // they are evaluated.
+        GetFlagRules(config, setting string) ([]Rule, error)
+
+        // SetFlagRules replaces the rules of the given setting.
+        SetFlagRules(config, setting string, rules []Rule) error
+}
+
+// An EvalContext describes who or what a feature flag is being
+// evaluated for.
+type EvalContext struct {
+        UserID     string
+        Tenant     string
+        Region     string
+        Attributes map[string]string // any other attributes rules can match on
+}
+
+// Get returns the value of the given attribute and whether it is set.
+func (ctx EvalContext) Get(attr string) (string, bool) {
+        var v string
+
+        switch attr {
+        case AttrUserID:
+                v = ctx.UserID
+        case AttrTenant:
+                v = ctx.Tenant
+        case AttrRegion:
+                v = ctx.Region
+        default:
+                v = ctx.Attributes[attr]
+        }
+
+        return v, v != ""
+}
+
+// A Rule returns Value for every evaluation context that it matches. A
+// rule with an empty Attribute matches every context. Percentage limits
+// the rule to that percentage of the matching contexts, bucketed by the
+// BucketBy attribute, which defaults to AttrUserID. A nil Percentage,
+// like a Percentage of 100, applies the rule to every matching context;
+// a Percentage of 0 never applies it.
+type Rule struct {
+        Attribute  string
+        Operator   Operator
+        Values     []string
+        Percentage *uint8
+        BucketBy   string
+        Value      bool
+}
+
+// Rollout returns the percentage of the matching contexts this rule
+// applies to, 100 if Percentage is nil.
+func (rule Rule) Rollout() uint8 {
+        if rule.Percentage == nil {
+                return 100
+        }
+
+        return *rule.Percentage
+}
+
+// Validate returns ErrInvalidRule if this rule cannot be evaluated.
+func (rule Rule) Validate() error {
+        if rule.Rollout() > 100 {
+                return ErrInvalidRule
+        }
+
+        if rule.Attribute == "" {
+                return nil
+        }
+
+        if rule.Operator != OpIn && rule.Operator != OpNotIn {
+                return ErrInvalidRule
+        }
+
+        return nil
+}
+
+// matches returns true if ctx matches the attribute condition of this
+// rule. The rollout percentage is not taken into account.
+func (rule Rule) matches(ctx EvalContext) bool {
+        if rule.Attribute == "" {
+                return true
+        }
+
+        v, _ := ctx.Get(rule.Attribute)
+        in := slices.Contains(rule.Values, v)
+
+        if rule.Operator == OpNotIn {
+                return !in
+        }
+
+        return in
+}
+
+// An Evaluation is the result of evaluating a feature flag.
+type Evaluation struct {
+        Value  bool
+        Reason Reason
+        Rule   int // index of the rule that decided the value, -1 if none did
+}
+
+// Evaluate evaluates the feature flag setting against ctx. Rules are
+// tried in order and the first one that applies decides the value. If no
+// rule applies the value of the setting is returned. ErrTypeMismatch is
+// returned if the setting is not a Bool.
+func Evaluate(setting *Setting, rules []Rule, ctx EvalContext) (Evaluation, error) {
+        if setting.Type() != Bool {
+                return Evaluation{}, ErrTypeMismatch
+        }
+
+        for i, rule := range rules {
+                if !rule.matches(ctx) {
+                        continue
+                }
+
+                if rule.Rollout() >= 100 {
+                        return Evaluation{rule.Value, ReasonRuleMatch, i}, nil
+                }
+
+                bucketBy := rule.BucketBy
+
+                if bucketBy == "" {
+                        bucketBy = AttrUserID
+                }
+
+                key, ok := ctx.Get(bucketBy)
+
+                if ok && bucket(setting.Name(), key) < uint32(rule.Rollout()) {
+                        return Evaluation{rule.Value, ReasonRollout, i}, nil
+                }
+        }
+
+        return Evaluation{setting.Value().(bool), ReasonDefault, -1}, nil
+}
+
+// bucket hashes key into one of 100 buckets. The flag name is part of
+// the hash so that the same key does not land in the same bucket for
+// every flag.
+func bucket(flag, key string) uint32 {
+        h := fnv.New32a()
+        h.Write([]byte(flag))
+        h.Write([]byte{0})
+        h.Write([]byte(key))
+
+        return h.Sum32() % 100
+}
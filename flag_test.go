@@ -0,0 +1,168 @@
+package configman
+
+import (
+        "fmt"
+        "testing"
+)
+
+// percent returns a pointer to p, for Rule.Percentage.
+func percent(p uint8) *uint8 {
+        return &p
+}
+
+func TestEvaluate(t *testing.T) {
+        flag, err := NewSetting(SettingFields{Name: "beta", Value: false})
+
+        if err != nil {
+                t.Fatalf("failed to create setting: %v", err)
+        }
+
+        // user 7 is in the first 50 buckets of beta, user 1 is not
+        inRollout, outOfRollout := EvalContext{UserID: "7", Tenant: "acme"}, EvalContext{UserID: "1", Tenant: "acme"}
+
+        if bucket("beta", "7") >= 50 || bucket("beta", "1") < 50 {
+                t.Fatalf("users 7 and 1 are in buckets %d and %d of beta", bucket("beta", "7"), bucket("beta", "1"))
+        }
+
+        tests := []struct {
+                name  string
+                rules []Rule
+                ctx   EvalContext
+                want  Evaluation
+        }{
+                {
+                        name: "no rules",
+                        ctx:  inRollout,
+                        want: Evaluation{false, ReasonDefault, -1},
+                },
+                {
+                        name:  "percentage omitted",
+                        rules: []Rule{{Value: true}},
+                        ctx:   outOfRollout,
+                        want:  Evaluation{true, ReasonRuleMatch, 0},
+                },
+                {
+                        name:  "percentage 100",
+                        rules: []Rule{{Percentage: percent(100), Value: true}},
+                        ctx:   outOfRollout,
+                        want:  Evaluation{true, ReasonRuleMatch, 0},
+                },
+                {
+                        name:  "percentage 0",
+                        rules: []Rule{{Percentage: percent(0), Value: true}},
+                        ctx:   inRollout,
+                        want:  Evaluation{false, ReasonDefault, -1},
+                },
+                {
+                        name:  "in rollout",
+                        rules: []Rule{{Percentage: percent(50), Value: true}},
+                        ctx:   inRollout,
+                        want:  Evaluation{true, ReasonRollout, 0},
+                },
+                {
+                        name:  "out of rollout",
+                        rules: []Rule{{Percentage: percent(50), Value: true}},
+                        ctx:   outOfRollout,
+                        want:  Evaluation{false, ReasonDefault, -1},
+                },
+                {
+                        name:  "bucketed by missing attribute",
+                        rules: []Rule{{Percentage: percent(99), BucketBy: "device", Value: true}},
+                        ctx:   inRollout,
+                        want:  Evaluation{false, ReasonDefault, -1},
+                },
+                {
+                        name:  "in",
+                        rules: []Rule{{Attribute: AttrTenant, Operator: OpIn, Values: []string{"acme"}, Value: true}},
+                        ctx:   inRollout,
+                        want:  Evaluation{true, ReasonRuleMatch, 0},
+                },
+                {
+                        name:  "not in",
+                        rules: []Rule{{Attribute: AttrTenant, Operator: OpNotIn, Values: []string{"acme"}, Value: true}},
+                        ctx:   inRollout,
+                        want:  Evaluation{false, ReasonDefault, -1},
+                },
+                {
+                        name: "first applying rule decides",
+                        rules: []Rule{
+                                {Percentage: percent(50), Value: true},
+                                {Attribute: AttrTenant, Operator: OpIn, Values: []string{"acme"}, Value: false},
+                                {Value: true},
+                        },
+                        ctx:  outOfRollout,
+                        want: Evaluation{false, ReasonRuleMatch, 1},
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        got, err := Evaluate(flag, test.rules, test.ctx)
+
+                        if err != nil {
+                                t.Fatalf("Evaluate returned %v", err)
+                        }
+
+                        if got != test.want {
+                                t.Errorf("Evaluate returned %+v, want %+v", got, test.want)
+                        }
+                })
+        }
+}
+
+func TestBucket(t *testing.T) {
+        const users = 10000
+
+        counts := make([]int, 100)
+
+        for i := 0; i < users; i++ {
+                b := bucket("beta", fmt.Sprint(i))
+
+                if b >= 100 {
+                        t.Fatalf("user %d is in bucket %d", i, b)
+                }
+
+                if b != bucket("beta", fmt.Sprint(i)) {
+                        t.Fatalf("user %d is not always in the same bucket", i)
+                }
+
+                counts[b]++
+        }
+
+        for b, count := range counts {
+                if count < users/100/2 || count > users/100*2 {
+                        t.Errorf("bucket %d has %d of %d users", b, count, users)
+                }
+        }
+
+        same := 0
+
+        for i := 0; i < users; i++ {
+                if bucket("beta", fmt.Sprint(i)) == bucket("gamma", fmt.Sprint(i)) {
+                        same++
+                }
+        }
+
+        if same > users/100*2 {
+                t.Errorf("%d of %d users are in the same bucket of two flags", same, users)
+        }
+}
+
+func TestRuleValidate(t *testing.T) {
+        tests := []struct {
+                rule  Rule
+                valid bool
+        }{
+                {Rule{}, true},
+                {Rule{Percentage: percent(100)}, true},
+                {Rule{Percentage: percent(101)}, false},
+                {Rule{Attribute: AttrRegion, Operator: OpIn}, true},
+                {Rule{Attribute: AttrRegion, Operator: "like"}, false},
+        }
+
+        for _, test := range tests {
+                if err := test.rule.Validate(); (err == nil) != test.valid {
+                        t.Errorf("validating %+v returned %v, want valid %t", test.rule, err, test.valid)
+                }
+        }
+}
@@ -92,4 +92,15 @@ func (thing *canBeDeprecated) DeprecatedAt() time.Time {
 func (thing *canBeDeprecated) DeprecationReason() bool {
 	gossert.Ok(nil != thing, "configman: cannot return deprecation reason of nil")
 	return thing.deprecationReason
-}
\ No newline at end of file
+}
+// Embed this struct if your thing has a revision number. The revision
+// starts at 1 and is incremented every time the thing is changed.
+type hasRevision struct {
+	revision int64
+}
+
+// Revision returns this thing's revision number.
+func (thing *hasRevision) Revision() int64 {
+	gossert.Ok(nil != thing, "configman: cannot return revision of nil")
+	return thing.revision
+}
@@ -0,0 +1,273 @@
+package configman
+
+import (
+        "errors"
+        "fmt"
+        "maps"
+        "regexp"
+        "slices"
+        "strings"
+)
+
+var ErrInvalidLabel = errors.New("configman: label keys and values must be at most 63 letters, digits, '-', '_' or '.', starting and ending with a letter or digit; keys may also contain '/'")
+var ErrInvalidSelector = errors.New("configman: invalid label selector")
+
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]{0,61}[A-Za-z0-9])?$`)
+var labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?)?$`)
+
+// Labels are key/value pairs attached to configs and settings, like
+// team=payments or tier=critical, by which they can be selected.
+type Labels map[string]string
+
+// Validate returns ErrInvalidLabel if a key or value of labels is not
+// valid. Values may be empty, keys may not.
+func (labels Labels) Validate() error {
+        for key, value := range labels {
+                if !labelKeyPattern.MatchString(key) || !labelValuePattern.MatchString(value) {
+                        return fmt.Errorf("label %s=%s: %w", key, value, ErrInvalidLabel)
+                }
+        }
+
+        return nil
+}
+
+// String returns labels as comma separated key=value pairs ordered by
+// key, the format ParseLabels reads.
+func (labels Labels) String() string {
+        pairs := make([]string, 0, len(labels))
+
+        for _, key := range slices.Sorted(maps.Keys(labels)) {
+                pairs = append(pairs, key+"="+labels[key])
+        }
+
+        return strings.Join(pairs, ",")
+}
+
+// ParseLabels parses comma separated key=value pairs, e.g.
+// "team=payments,tier=critical". The empty string has no labels.
+func ParseLabels(s string) (Labels, error) {
+        labels := make(Labels)
+
+        for _, pair := range strings.Split(s, ",") {
+                if pair = strings.TrimSpace(pair); pair == "" {
+                        continue
+                }
+
+                key, value, found := strings.Cut(pair, "=")
+
+                if !found {
+                        return nil, fmt.Errorf("label %s has no value: %w", pair, ErrInvalidLabel)
+                }
+
+                labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+        }
+
+        return labels, labels.Validate()
+}
+
+// SelectorOp is how a Requirement compares the value of a label.
+type SelectorOp string
+
+const (
+        SelectEquals    SelectorOp = "="      // key=value or key==value
+        SelectNotEquals SelectorOp = "!="     // key!=value, also matches if key is missing
+        SelectIn        SelectorOp = "in"     // key in (a,b)
+        SelectNotIn     SelectorOp = "notin"  // key notin (a,b), also matches if key is missing
+        SelectExists    SelectorOp = "exists" // key
+        SelectNotExists SelectorOp = "!"      // !key
+)
+
+// A Requirement is one condition of a Selector on the label Key.
+// Equality operators have exactly one value, set operators at least
+// one and existence operators none.
+type Requirement struct {
+        Key    string
+        Op     SelectorOp
+        Values []string
+}
+
+// Matches reports whether labels meet the requirement.
+func (req Requirement) Matches(labels Labels) bool {
+        value, ok := labels[req.Key]
+
+        switch req.Op {
+        case SelectEquals, SelectIn:
+                return ok && slices.Contains(req.Values, value)
+        case SelectNotEquals, SelectNotIn:
+                return !ok || !slices.Contains(req.Values, value)
+        case SelectExists:
+                return ok
+        case SelectNotExists:
+                return !ok
+        default:
+                return false
+        }
+}
+
+// String returns the requirement in the syntax of ParseSelector.
+func (req Requirement) String() string {
+        switch req.Op {
+        case SelectEquals, SelectNotEquals:
+                return req.Key + string(req.Op) + req.Values[0]
+        case SelectIn, SelectNotIn:
+                return req.Key + " " + string(req.Op) + " (" + strings.Join(req.Values, ",") + ")"
+        case SelectNotExists:
+                return "!" + req.Key
+        default:
+                return req.Key
+        }
+}
+
+// A Selector selects labeled configs or settings, in the syntax of
+// Kubernetes label selectors: comma separated requirements that must
+// all be met, e.g. "team=payments,tier in (critical,high),!legacy". The
+// empty selector selects everything.
+type Selector []Requirement
+
+// Matches reports whether labels meet every requirement of selector.
+func (selector Selector) Matches(labels Labels) bool {
+        for _, req := range selector {
+                if !req.Matches(labels) {
+                        return false
+                }
+        }
+
+        return true
+}
+
+// String returns selector in the syntax of ParseSelector.
+func (selector Selector) String() string {
+        reqs := make([]string, len(selector))
+
+        for i, req := range selector {
+                reqs[i] = req.String()
+        }
+
+        return strings.Join(reqs, ",")
+}
+
+// setPattern matches the set based requirements of a selector.
+var setPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\(([^()]*)\)$`)
+
+// ParseSelector parses a label selector, see Selector.
+// ErrInvalidSelector is returned if s is not valid.
+func ParseSelector(s string) (Selector, error) {
+        var selector Selector
+        var part strings.Builder
+
+        depth := 0
+        parts := make([]string, 0)
+
+        for _, r := range s + "," {
+                switch {
+                case r == '(':
+                        depth++
+                case r == ')':
+                        depth--
+                case r == ',' && depth == 0:
+                        parts = append(parts, part.String())
+                        part.Reset()
+                        continue
+                }
+
+                part.WriteRune(r)
+        }
+
+        if depth != 0 {
+                return nil, fmt.Errorf("%w: unbalanced parentheses in %q", ErrInvalidSelector, s)
+        }
+
+        for _, p := range parts {
+                if p = strings.TrimSpace(p); p == "" {
+                        if strings.TrimSpace(s) == "" {
+                                continue
+                        }
+
+                        return nil, fmt.Errorf("%w: empty requirement in %q", ErrInvalidSelector, s)
+                }
+
+                req, err := parseRequirement(p)
+
+                if err != nil {
+                        return nil, err
+                }
+
+                selector = append(selector, req)
+        }
+
+        return selector, nil
+}
+
+// parseRequirement parses one requirement of a selector.
+func parseRequirement(s string) (Requirement, error) {
+        var req Requirement
+
+        switch m := setPattern.FindStringSubmatch(s); {
+        case m != nil:
+                req = Requirement{Key: m[1], Op: SelectorOp(m[2])}
+
+                for _, value := range strings.Split(m[3], ",") {
+                        req.Values = append(req.Values, strings.TrimSpace(value))
+                }
+        case strings.Contains(s, "!="):
+                key, value, _ := strings.Cut(s, "!=")
+                req = Requirement{Key: strings.TrimSpace(key), Op: SelectNotEquals, Values: []string{strings.TrimSpace(value)}}
+        case strings.Contains(s, "=="):
+                key, value, _ := strings.Cut(s, "==")
+                req = Requirement{Key: strings.TrimSpace(key), Op: SelectEquals, Values: []string{strings.TrimSpace(value)}}
+        case strings.Contains(s, "="):
+                key, value, _ := strings.Cut(s, "=")
+                req = Requirement{Key: strings.TrimSpace(key), Op: SelectEquals, Values: []string{strings.TrimSpace(value)}}
+        case strings.HasPrefix(s, "!"):
+                req = Requirement{Key: strings.TrimSpace(s[1:]), Op: SelectNotExists}
+        default:
+                req = Requirement{Key: s, Op: SelectExists}
+        }
+
+        if !labelKeyPattern.MatchString(req.Key) {
+                return req, fmt.Errorf("%w: bad key in %q", ErrInvalidSelector, s)
+        }
+
+        for _, value := range req.Values {
+                if !labelValuePattern.MatchString(value) {
+                        return req, fmt.Errorf("%w: bad value in %q", ErrInvalidSelector, s)
+                }
+        }
+
+        return req, nil
+}
+
+// A Query selects configs, or the settings of a config, by their labels
+// and names. Zero fields match everything.
+type Query struct {
+        Selector   Selector
+        Prefix     string  // only those whose names start with Prefix
+        Deprecated *bool   // only those that are, or are not, deprecated
+        Namespace  *string // only configs in the namespace, "" being the default one
+}
+
+// LabelStore is implemented by stores that can label configs and
+// settings and query them by label.
+type LabelStore interface {
+        // SetConfigLabels replaces the labels of config with labels.
+        // ErrNotFound is returned if the config does not exist.
+        SetConfigLabels(config string, labels Labels) error
+
+        // GetConfigLabels returns the labels of config.
+        GetConfigLabels(config string) (Labels, error)
+
+        // SetSettingLabels replaces the labels of a setting with labels.
+        // ErrNotFound is returned if the setting does not exist.
+        SetSettingLabels(config, setting string, labels Labels) error
+
+        // GetSettingLabels returns the labels of a setting.
+        GetSettingLabels(config, setting string) (Labels, error)
+
+        // QueryConfigs returns the configs matching query ordered by
+        // name.
+        QueryConfigs(query Query) ([]Config, error)
+
+        // QuerySettings returns the settings of config matching query
+        // ordered by name.
+        QuerySettings(config string, query Query) ([]*Setting, error)
+}
@@ -0,0 +1,91 @@
+package configman
+
+import (
+        "errors"
+        "testing"
+)
+
+func TestParseSelector(t *testing.T) {
+        tests := []struct {
+                name     string
+                selector string
+                want     string // the parsed selector in the syntax of ParseSelector
+                err      error
+        }{
+                {name: "empty", selector: "", want: ""},
+                {name: "blank", selector: "  ", want: ""},
+                {name: "equals", selector: "team=payments", want: "team=payments"},
+                {name: "double equals", selector: "team==payments", want: "team=payments"},
+                {name: "not equals", selector: "team!=payments", want: "team!=payments"},
+                {name: "empty value", selector: "team=", want: "team="},
+                {name: "in", selector: "tier in (critical, high)", want: "tier in (critical,high)"},
+                {name: "notin", selector: "tier notin (low)", want: "tier notin (low)"},
+                {name: "in without space", selector: "tier in(critical)", want: "tier in (critical)"},
+                {name: "exists", selector: "legacy", want: "legacy"},
+                {name: "not exists", selector: "!legacy", want: "!legacy"},
+                {name: "prefixed key", selector: "example.com/team=payments", want: "example.com/team=payments"},
+                {name: "several", selector: " team=payments , tier in (critical,high),!legacy ", want: "team=payments,tier in (critical,high),!legacy"},
+                {name: "empty requirement", selector: "team=payments,,tier=high", err: ErrInvalidSelector},
+                {name: "trailing comma", selector: "team=payments,", err: ErrInvalidSelector},
+                {name: "unbalanced parentheses", selector: "tier in (critical,high", err: ErrInvalidSelector},
+                {name: "closed too early", selector: "tier in critical)", err: ErrInvalidSelector},
+                {name: "bad key", selector: "-team=payments", err: ErrInvalidSelector},
+                {name: "bad value", selector: "team=pay ments", err: ErrInvalidSelector},
+                {name: "bad value in set", selector: "tier in (critical,-high)", err: ErrInvalidSelector},
+                {name: "unknown operator", selector: "tier within (critical)", err: ErrInvalidSelector},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        selector, err := ParseSelector(test.selector)
+
+                        if !errors.Is(err, test.err) {
+                                t.Fatalf("ParseSelector(%q) returned %v, want %v", test.selector, err, test.err)
+                        }
+
+                        if err == nil && selector.String() != test.want {
+                                t.Errorf("ParseSelector(%q) is %q, want %q", test.selector, selector, test.want)
+                        }
+                })
+        }
+}
+
+func TestSelectorMatches(t *testing.T) {
+        labels := Labels{"team": "payments", "tier": "critical"}
+
+        tests := []struct {
+                selector string
+                want     bool
+        }{
+                {selector: "", want: true},
+                {selector: "team=payments", want: true},
+                {selector: "team=search", want: false},
+                {selector: "team!=search", want: true},
+                {selector: "owner!=alice", want: true},
+                {selector: "tier in (critical,high)", want: true},
+                {selector: "tier in (low)", want: false},
+                {selector: "owner in (alice)", want: false},
+                {selector: "tier notin (critical)", want: false},
+                {selector: "owner notin (alice)", want: true},
+                {selector: "team", want: true},
+                {selector: "owner", want: false},
+                {selector: "!owner", want: true},
+                {selector: "!team", want: false},
+                {selector: "team=payments,!owner,tier in (critical)", want: true},
+                {selector: "team=payments,owner", want: false},
+        }
+
+        for _, test := range tests {
+                t.Run(test.selector, func(t *testing.T) {
+                        selector, err := ParseSelector(test.selector)
+
+                        if err != nil {
+                                t.Fatalf("failed to parse selector: %v", err)
+                        }
+
+                        if got := selector.Matches(labels); got != test.want {
+                                t.Errorf("%q matches %v: %t, want %t", test.selector, labels, got, test.want)
+                        }
+                })
+        }
+}
@@ -0,0 +1,329 @@
+// Package metrics keeps counters and histograms and exposes them in the
+// Prometheus text format, so that configman can be scraped without
+// depending on a metrics library.
+//
+// Every metric has a fixed list of label names given when it is
+// registered; values are recorded for one combination of label values at
+// a time. Nil metrics ignore what is recorded, which lets code be
+// instrumented unconditionally.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vlence/gossert"
+)
+
+// DefaultBuckets are the upper bounds of the buckets of latency
+// histograms, in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// A Registry holds metrics and writes them out in the order they were
+// registered.
+type Registry struct {
+        mu      sync.Mutex
+        metrics []metric
+}
+
+// metric is implemented by every kind of metric a Registry holds.
+type metric interface {
+        write(w *bufio.Writer)
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+        return new(Registry)
+}
+
+// Counter registers and returns a counter with the given label names.
+func (reg *Registry) Counter(name, help string, labels ...string) *Counter {
+        counter := &Counter{
+                desc:   desc{name, help, labels},
+                values: make(map[string]*counterValue),
+        }
+
+        reg.register(counter)
+
+        return counter
+}
+
+// Histogram registers and returns a histogram with the given bucket
+// upper bounds, DefaultBuckets if nil, and label names.
+func (reg *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+        if buckets == nil {
+                buckets = DefaultBuckets
+        }
+
+        gossert.Ok(slices.IsSorted(buckets), "metrics: histogram buckets must be sorted")
+
+        histogram := &Histogram{
+                desc:    desc{name, help, labels},
+                buckets: buckets,
+                values:  make(map[string]*histogramValue),
+        }
+
+        reg.register(histogram)
+
+        return histogram
+}
+
+// register adds m to the metrics of reg.
+func (reg *Registry) register(m metric) {
+        reg.mu.Lock()
+        defer reg.mu.Unlock()
+
+        reg.metrics = append(reg.metrics, m)
+}
+
+// WriteTo writes every metric to w in the Prometheus text format.
+func (reg *Registry) WriteTo(w io.Writer) (int64, error) {
+        reg.mu.Lock()
+        metrics := slices.Clone(reg.metrics)
+        reg.mu.Unlock()
+
+        counted := &countingWriter{w: w}
+        b := bufio.NewWriter(counted)
+
+        for _, m := range metrics {
+                m.write(b)
+        }
+
+        err := b.Flush()
+
+        return counted.n, err
+}
+
+// ServeHTTP writes every metric as the response, for Prometheus to
+// scrape.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+        w.WriteHeader(http.StatusOK)
+        reg.WriteTo(w)
+}
+
+// desc is what every metric has: a name, a help text and label names.
+type desc struct {
+        name   string
+        help   string
+        labels []string
+}
+
+// key returns the key of the series with the given label values.
+func (d *desc) key(values []string) string {
+        gossert.Ok(len(values) == len(d.labels), fmt.Sprintf("metrics: %s takes %d label values, got %d", d.name, len(d.labels), len(values)))
+        return strings.Join(values, "\xff")
+}
+
+// writeHeader writes the HELP and TYPE lines of the metric.
+func (d *desc) writeHeader(w *bufio.Writer, typ string) {
+        help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+
+        fmt.Fprintf(w, "# HELP %s %s\n", d.name, help)
+        fmt.Fprintf(w, "# TYPE %s %s\n", d.name, typ)
+}
+
+// writeSample writes one sample of the metric. The label values are
+// those of the series with the given key, followed by the extra name and
+// value pairs.
+func (d *desc) writeSample(w *bufio.Writer, suffix, key string, value float64, extra ...string) {
+        var pairs []string
+
+        if len(d.labels) > 0 {
+                for i, v := range strings.Split(key, "\xff") {
+                        pairs = append(pairs, d.labels[i], v)
+                }
+        }
+
+        pairs = append(pairs, extra...)
+
+        w.WriteString(d.name + suffix)
+
+        if len(pairs) > 0 {
+                w.WriteString("{")
+
+                for i := 0; i < len(pairs); i += 2 {
+                        if i > 0 {
+                                w.WriteString(",")
+                        }
+
+                        w.WriteString(pairs[i] + `="` + escapeLabel(pairs[i+1]) + `"`)
+                }
+
+                w.WriteString("}")
+        }
+
+        w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// A Counter counts things that only ever increase, like requests.
+type Counter struct {
+        desc
+
+        mu     sync.Mutex
+        values map[string]*counterValue
+}
+
+// counterValue is the value of one series of a counter.
+type counterValue struct {
+        value float64
+}
+
+// Inc adds one to the series with the given label values.
+func (counter *Counter) Inc(labels ...string) {
+        counter.Add(1, labels...)
+}
+
+// Add adds v, which must not be negative, to the series with the given
+// label values.
+func (counter *Counter) Add(v float64, labels ...string) {
+        if counter == nil {
+                return
+        }
+
+        gossert.Ok(v >= 0, "metrics: counters cannot decrease")
+
+        key := counter.key(labels)
+
+        counter.mu.Lock()
+        defer counter.mu.Unlock()
+
+        value, ok := counter.values[key]
+
+        if !ok {
+                value = new(counterValue)
+                counter.values[key] = value
+        }
+
+        value.value += v
+}
+
+// write implements metric.
+func (counter *Counter) write(w *bufio.Writer) {
+        counter.mu.Lock()
+        defer counter.mu.Unlock()
+
+        counter.writeHeader(w, "counter")
+
+        for _, key := range sortedKeys(counter.values) {
+                counter.writeSample(w, "", key, counter.values[key].value)
+        }
+}
+
+// A Histogram counts observations, like latencies, in buckets.
+type Histogram struct {
+        desc
+
+        buckets []float64
+
+        mu     sync.Mutex
+        values map[string]*histogramValue
+}
+
+// histogramValue is the value of one series of a histogram. counts has
+// one count per bucket, each only counting the observations that did
+// not fit the previous bucket.
+type histogramValue struct {
+        counts []uint64
+        count  uint64
+        sum    float64
+}
+
+// Observe records v in the series with the given label values.
+func (histogram *Histogram) Observe(v float64, labels ...string) {
+        if histogram == nil {
+                return
+        }
+
+        key := histogram.key(labels)
+
+        histogram.mu.Lock()
+        defer histogram.mu.Unlock()
+
+        value, ok := histogram.values[key]
+
+        if !ok {
+                value = &histogramValue{counts: make([]uint64, len(histogram.buckets))}
+                histogram.values[key] = value
+        }
+
+        if i, _ := slices.BinarySearch(histogram.buckets, v); i < len(histogram.buckets) {
+                value.counts[i]++
+        }
+
+        value.count++
+        value.sum += v
+}
+
+// write implements metric.
+func (histogram *Histogram) write(w *bufio.Writer) {
+        histogram.mu.Lock()
+        defer histogram.mu.Unlock()
+
+        histogram.writeHeader(w, "histogram")
+
+        for _, key := range sortedKeys(histogram.values) {
+                value := histogram.values[key]
+                cumulative := uint64(0)
+
+                for i, bound := range histogram.buckets {
+                        cumulative += value.counts[i]
+                        histogram.writeSample(w, "_bucket", key, float64(cumulative), "le", formatFloat(bound))
+                }
+
+                histogram.writeSample(w, "_bucket", key, float64(value.count), "le", "+Inf")
+                histogram.writeSample(w, "_sum", key, value.sum)
+                histogram.writeSample(w, "_count", key, float64(value.count))
+        }
+}
+
+// sortedKeys returns the keys of values in order so that the output
+// does not change between scrapes.
+func sortedKeys[V any](values map[string]V) []string {
+        keys := make([]string, 0, len(values))
+
+        for key := range values {
+                keys = append(keys, key)
+        }
+
+        slices.Sort(keys)
+
+        return keys
+}
+
+// escapeLabel escapes a label value for the text format.
+func escapeLabel(v string) string {
+        return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// formatFloat formats v the way Prometheus does.
+func formatFloat(v float64) string {
+        switch {
+        case math.IsInf(v, 1):
+                return "+Inf"
+        case math.IsInf(v, -1):
+                return "-Inf"
+        default:
+                return strconv.FormatFloat(v, 'g', -1, 64)
+        }
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+        w io.Writer
+        n int64
+}
+
+// Write implements io.Writer.
+func (cw *countingWriter) Write(p []byte) (int, error) {
+        n, err := cw.w.Write(p)
+        cw.n += int64(n)
+        return n, err
+}
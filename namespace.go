@@ -0,0 +1,98 @@
+package configman
+
+import (
+        "errors"
+        "strings"
+        "time"
+)
+
+var ErrInvalidNamespace = errors.New("configman: namespace names must not be empty or contain ':' or '*'")
+var ErrNamespaceNotEmpty = errors.New("configman: namespace still has configs")
+
+// NamespaceSeparator separates the namespace of a config from its name
+// in the qualified name of the config, e.g. "payments:checkout". Configs
+// whose names have no separator are in the default namespace, "".
+const NamespaceSeparator = ":"
+
+// A Namespace groups the configs of one team or project. Config names
+// only have to be unique within a namespace and roles can be granted on
+// every config of a namespace at once, see AllConfigsIn.
+type Namespace struct {
+        Name        string
+        Description string
+        CreatedAt   time.Time
+}
+
+// QualifiedName returns the name of config in namespace as it is known
+// to stores. Configs in the default namespace keep their name.
+func QualifiedName(namespace, config string) string {
+        if namespace == "" {
+                return config
+        }
+
+        return namespace + NamespaceSeparator + config
+}
+
+// SplitName splits the qualified name of a config into its namespace
+// and its name within the namespace.
+func SplitName(qualified string) (namespace, config string) {
+        namespace, config, found := strings.Cut(qualified, NamespaceSeparator)
+
+        if !found {
+                return "", qualified
+        }
+
+        return namespace, config
+}
+
+// NamespaceOf returns the namespace of the config with the qualified
+// name config.
+func NamespaceOf(config string) string {
+        namespace, _ := SplitName(config)
+        return namespace
+}
+
+// AllConfigsIn is the config of a grant that applies to every config in
+// namespace, e.g. "payments:*".
+func AllConfigsIn(namespace string) string {
+        return QualifiedName(namespace, AllConfigs)
+}
+
+// ValidNamespace returns ErrInvalidNamespace if name cannot be the name
+// of a namespace.
+func ValidNamespace(name string) error {
+        if name == "" || strings.ContainsAny(name, NamespaceSeparator+AllConfigs) {
+                return ErrInvalidNamespace
+        }
+
+        return nil
+}
+
+// ConfigsIn returns the configs in configs that are in namespace.
+func ConfigsIn(configs []Config, namespace string) []Config {
+        in := make([]Config, 0, len(configs))
+
+        for _, config := range configs {
+                if NamespaceOf(config.Name()) == namespace {
+                        in = append(in, config)
+                }
+        }
+
+        return in
+}
+
+// NamespaceStore is implemented by stores that keep namespaces. Configs
+// can only be created in a namespace that exists.
+type NamespaceStore interface {
+        // CreateNamespace creates a namespace. ErrExists is returned if
+        // it already exists.
+        CreateNamespace(name, desc string) (*Namespace, error)
+
+        // GetNamespaces returns every namespace ordered by name.
+        GetNamespaces() ([]Namespace, error)
+
+        // DeleteNamespace deletes a namespace and the grants on all of
+        // its configs. ErrNamespaceNotEmpty is returned if it still has
+        // configs and ErrNotFound if it does not exist.
+        DeleteNamespace(name string) error
+}
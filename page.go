@@ -0,0 +1,102 @@
+package configman
+
+import (
+        "encoding/base64"
+        "encoding/json"
+        "errors"
+)
+
+var ErrInvalidPage = errors.New("configman: invalid sort, limit or cursor")
+
+// DefaultPageSize is the number of items in a page if the request has
+// no limit, MaxPageSize the most a page can have.
+const (
+        DefaultPageSize = 100
+        MaxPageSize     = 1000
+)
+
+// SortField is what listed configs or settings are ordered by.
+type SortField string
+
+const (
+        SortByName    SortField = "name"
+        SortByCreated SortField = "created"
+        SortByUpdated SortField = "updated"
+)
+
+// ParseSortField returns the SortField named s, SortByName if s is
+// empty. ErrInvalidPage is returned if s does not name one.
+func ParseSortField(s string) (SortField, error) {
+        switch field := SortField(s); field {
+        case "":
+                return SortByName, nil
+        case SortByName, SortByCreated, SortByUpdated:
+                return field, nil
+        default:
+                return "", ErrInvalidPage
+        }
+}
+
+// A PageRequest asks for one page of a listing. The first page has no
+// Cursor; the next ones have the NextCursor of the page before, and the
+// same Sort and Descending.
+type PageRequest struct {
+        Sort       SortField
+        Descending bool
+        Limit      int    // DefaultPageSize if zero
+        Cursor     string // where the page starts
+        CountTotal bool   // set Total of the page, which costs a query
+}
+
+// A Page is one page of a listing.
+type Page[T any] struct {
+        Items      []T
+        NextCursor string // empty if this is the last page
+        Total      int    // items on every page, -1 unless counted
+}
+
+// PageCursor is the position after the last item of a page. Stores
+// encode it with EncodeCursor so that clients treat it as opaque.
+type PageCursor struct {
+        Sort       SortField `json:"s"`
+        Descending bool      `json:"d,omitempty"`
+        Name       string    `json:"n,omitempty"` // sort value of name sorts
+        Time       int64     `json:"t,omitempty"` // sort value of time sorts
+        Key        string    `json:"k"`           // tiebreaker, unique within the listing
+}
+
+// EncodeCursor returns cursor as a string for NextCursor.
+func EncodeCursor(cursor PageCursor) string {
+        data, _ := json.Marshal(cursor)
+        return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor returns the cursor of page. ErrInvalidPage is returned if
+// it was not made by EncodeCursor or for a different order.
+func DecodeCursor(page PageRequest) (PageCursor, error) {
+        var cursor PageCursor
+
+        data, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+
+        if err != nil || json.Unmarshal(data, &cursor) != nil {
+                return cursor, ErrInvalidPage
+        }
+
+        if cursor.Sort != page.Sort || cursor.Descending != page.Descending {
+                return cursor, ErrInvalidPage
+        }
+
+        return cursor, nil
+}
+
+// PagedStore is implemented by stores that can list configs and
+// settings a page at a time, for when there are too many to load at
+// once.
+type PagedStore interface {
+        // ListConfigs returns a page of the configs matching query.
+        ListConfigs(query Query, page PageRequest) (*Page[Config], error)
+
+        // ListSettings returns a page of the settings of config matching
+        // query.
+        ListSettings(config string, query Query, page PageRequest) (*Page[*Setting], error)
+}
@@ -0,0 +1,216 @@
+package configman
+
+import (
+        "errors"
+        "fmt"
+        "slices"
+        "strings"
+)
+
+// SecretLabel is the label of settings that hold secrets, like passwords
+// or API keys, when its value is "true". Promotions can leave them out.
+const SecretLabel = "secret"
+
+// A Promotion copies settings from one config to another, usually from
+// the config of one environment to that of the next, like staging to
+// prod. Settings only in To are left alone.
+type Promotion struct {
+        From        string
+        To          string
+        Settings    []string // names of the settings to copy, every setting if empty
+        Selector    Selector // only copy the settings whose labels match
+        SkipSecrets bool     // leave out the settings labelled secret=true
+}
+
+// A PromotionPlan is what a promotion changes in its target config. In
+// the changes From is the setting in the target, nil if it is added, and
+// To the one copied over it.
+type PromotionPlan struct {
+        Promotion
+        Changes      []SettingDiff // settings added to or changed in To
+        Incompatible []SettingDiff // settings whose type differs in To
+        Skipped      []string      // secrets left out
+        Batch        *Batch        // applies the changes to To
+}
+
+// PlanPromotion returns what promotion would change in store without
+// changing anything. ErrNotFound is returned if either config or one of
+// the settings named by the promotion does not exist.
+func PlanPromotion(store Store, promotion Promotion) (*PromotionPlan, error) {
+        var err error
+        var source, target []*Setting
+
+        if source, err = SettingsOf(store, Ref{Config: promotion.From}); err != nil {
+                return nil, err
+        }
+
+        if target, err = SettingsOf(store, Ref{Config: promotion.To}); err != nil {
+                return nil, err
+        }
+
+        plan := &PromotionPlan{Promotion: promotion, Skipped: make([]string, 0), Batch: new(Batch)}
+
+        if source, err = selectSettings(store, source, promotion); err != nil {
+                return nil, err
+        }
+
+        if promotion.SkipSecrets {
+                if source, plan.Skipped, err = withoutSecrets(store, promotion.From, source); err != nil {
+                        return nil, err
+                }
+        }
+
+        names := byName(source)
+        plan.Changes = make([]SettingDiff, 0)
+        plan.Incompatible = make([]SettingDiff, 0)
+
+        for _, change := range DiffSettings(target, source) {
+                switch {
+                case names[change.Setting] == nil:
+                        // not promoted, only in the target
+                case change.Kind == SettingTypeChanged:
+                        plan.Incompatible = append(plan.Incompatible, change)
+                case change.Kind == SettingAdded:
+                        plan.Changes = append(plan.Changes, change)
+                        plan.Batch.Create(promotion.To, change.Setting, change.To.Description(), change.To.Value())
+                default:
+                        plan.Changes = append(plan.Changes, change)
+                        plan.Batch.UpdateIf(promotion.To, change.Setting, change.To.Value(), change.From.Revision())
+                }
+        }
+
+        return plan, nil
+}
+
+// Promote applies promotion to store as one batch, recorded in history
+// as one change made by by. Nothing is changed if a promoted setting has
+// a different type in the target; ErrTypeMismatch is returned then. The
+// change event is nil if there was nothing to change.
+func Promote(store Store, promotion Promotion, by string) (*PromotionPlan, *ChangeEvent, error) {
+        plan, err := PlanPromotion(store, promotion)
+
+        if err != nil {
+                return nil, nil, err
+        }
+
+        if len(plan.Incompatible) > 0 {
+                names := make([]string, len(plan.Incompatible))
+
+                for i, change := range plan.Incompatible {
+                        names[i] = change.Setting
+                }
+
+                return plan, nil, fmt.Errorf("settings %s of %s have a different type in %s: %w", strings.Join(names, ", "), promotion.From, promotion.To, ErrTypeMismatch)
+        }
+
+        if len(plan.Batch.Ops) == 0 {
+                return plan, nil, nil
+        }
+
+        event, err := store.ApplyBatch(plan.Batch, by)
+
+        if err != nil {
+                return plan, nil, err
+        }
+
+        return plan, event, nil
+}
+
+// String renders the plan as text: one line per setting it creates or
+// updates, then the settings it cannot copy and the secrets it skips.
+func (plan *PromotionPlan) String() string {
+        var b strings.Builder
+
+        fmt.Fprintf(&b, "promote %s to %s\n", plan.From, plan.To)
+
+        for _, change := range plan.Changes {
+                if change.From == nil {
+                        fmt.Fprintf(&b, "create %s = %s\n", change.Setting, formatSetting(change.To))
+                } else {
+                        fmt.Fprintf(&b, "update %s = %s -> %s\n", change.Setting, formatValue(change.From), formatValue(change.To))
+                }
+        }
+
+        for _, change := range plan.Incompatible {
+                fmt.Fprintf(&b, "incompatible %s: %s in %s, %s in %s\n", change.Setting, change.To.Type(), plan.From, change.From.Type(), plan.To)
+        }
+
+        for _, name := range plan.Skipped {
+                fmt.Fprintf(&b, "skip secret %s\n", name)
+        }
+
+        if len(plan.Changes) == 0 && len(plan.Incompatible) == 0 {
+                b.WriteString("nothing to promote\n")
+        }
+
+        return b.String()
+}
+
+// selectSettings returns the settings of the source config of promotion
+// it selects by name and label.
+func selectSettings(store Store, settings []*Setting, promotion Promotion) ([]*Setting, error) {
+        if len(promotion.Settings) > 0 {
+                named := byName(settings)
+                settings = make([]*Setting, 0, len(promotion.Settings))
+
+                for _, name := range promotion.Settings {
+                        if named[name] == nil {
+                                return nil, fmt.Errorf("setting %s of config %s: %w", name, promotion.From, ErrNotFound)
+                        }
+
+                        settings = append(settings, named[name])
+                }
+        }
+
+        if len(promotion.Selector) == 0 {
+                return settings, nil
+        }
+
+        labels, ok := Extension[LabelStore](store)
+
+        if !ok {
+                return nil, errors.New("configman: the store does not support labels")
+        }
+
+        matching, err := labels.QuerySettings(promotion.From, Query{Selector: promotion.Selector})
+
+        if err != nil {
+                return nil, err
+        }
+
+        matches := byName(matching)
+
+        return slices.DeleteFunc(settings, func(setting *Setting) bool {
+                return matches[setting.Name()] == nil
+        }), nil
+}
+
+// withoutSecrets returns settings without the secrets of config, and
+// the names of the secrets. Stores without labels have no secrets.
+func withoutSecrets(store Store, config string, settings []*Setting) ([]*Setting, []string, error) {
+        skipped := make([]string, 0)
+        labels, ok := Extension[LabelStore](store)
+
+        if !ok {
+                return settings, skipped, nil
+        }
+
+        secrets, err := labels.QuerySettings(config, Query{Selector: Selector{{Key: SecretLabel, Op: SelectEquals, Values: []string{"true"}}}})
+
+        if err != nil {
+                return nil, nil, err
+        }
+
+        secret := byName(secrets)
+        kept := make([]*Setting, 0, len(settings))
+
+        for _, setting := range settings {
+                if secret[setting.Name()] != nil {
+                        skipped = append(skipped, setting.Name())
+                } else {
+                        kept = append(kept, setting)
+                }
+        }
+
+        return kept, skipped, nil
+}
@@ -0,0 +1,106 @@
+package configman
+
+import (
+        "context"
+        "errors"
+        "log/slog"
+        "time"
+
+        "github.com/vlence/gossert"
+)
+
+var ErrNotPending = errors.New("configman: change is not pending")
+
+// A ScheduledChange is a change to the value of a setting that takes
+// effect at a future time.
+type ScheduledChange struct {
+        ID          int64
+        Config      string
+        Setting     string
+        Value       any
+        EffectiveAt time.Time
+        CreatedAt   time.Time
+        CreatedBy   string
+        AppliedAt   time.Time // zero until the change has been applied or failed to
+        Error       string    // why the change could not be applied, empty unless it failed
+        Cancelled   bool
+}
+
+// Pending returns true if this change has neither been applied, failed
+// nor been cancelled.
+func (change *ScheduledChange) Pending() bool {
+        gossert.Ok(nil != change, "configman: cannot return pending status of nil scheduled change")
+        return change.AppliedAt.IsZero() && !change.Cancelled
+}
+
+// Failed returns true if this change was due but could not be applied,
+// because its setting had been deleted or had changed type.
+func (change *ScheduledChange) Failed() bool {
+        gossert.Ok(nil != change, "configman: cannot return failed status of nil scheduled change")
+        return change.Error != ""
+}
+
+// ScheduleStore is implemented by stores that can persist scheduled
+// changes. Applying changes must be safe when several processes share
+// the same storage; every change is applied exactly once.
+type ScheduleStore interface {
+        // ScheduleChange schedules value to be set on the given setting at
+        // the given time. The type of value must match the type of the
+        // setting.
+        ScheduleChange(config, setting string, value any, at time.Time, by string) (*ScheduledChange, error)
+
+        // CancelScheduledChange cancels the scheduled change with the
+        // given id, or dismisses it if it failed. ErrNotPending is
+        // returned if the change has already been applied or cancelled.
+        CancelScheduledChange(id int64) error
+
+        // GetScheduledChanges returns the pending changes of the given
+        // config and those that failed and have not been dismissed,
+        // earliest first.
+        GetScheduledChanges(config string) ([]*ScheduledChange, error)
+
+        // ApplyScheduledChanges applies every pending change whose
+        // effective time is at or before now and returns how many changes
+        // were applied by this call. A change whose config has been
+        // protected, or whose setting has been deleted or has changed
+        // type, is marked as failed with the reason instead.
+        ApplyScheduledChanges(now time.Time) (int, error)
+}
+
+// A Scheduler periodically applies the scheduled changes of a
+// ScheduleStore that are due.
+type Scheduler struct {
+        store    ScheduleStore
+        interval time.Duration
+        logger   *slog.Logger
+}
+
+// NewScheduler returns a scheduler that checks store for due changes
+// every interval and logs its failures to logger.
+func NewScheduler(store ScheduleStore, interval time.Duration, logger *slog.Logger) *Scheduler {
+        gossert.Ok(store != nil, "configman: cannot create scheduler for nil store")
+        gossert.Ok(interval > 0, "configman: scheduler interval must be positive")
+        gossert.Ok(logger != nil, "configman: cannot create scheduler for nil logger")
+
+        return &Scheduler{store, interval, logger}
+}
+
+// Run applies due changes every interval until ctx is done. Failures to
+// apply changes are logged and retried on the next tick. Run is meant to
+// be run in its own goroutine.
+func (scheduler *Scheduler) Run(ctx context.Context) {
+        ticker := time.NewTicker(scheduler.interval)
+        defer ticker.Stop()
+
+        for {
+                if _, err := scheduler.store.ApplyScheduledChanges(time.Now()); err != nil {
+                        scheduler.logger.Warn("configman: failed to apply scheduled changes", "err", err)
+                }
+
+                select {
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                }
+        }
+}
@@ -0,0 +1,150 @@
+package configman
+
+import (
+        "errors"
+        "slices"
+        "strings"
+)
+
+var ErrInvalidLimit = errors.New("configman: limit of search results must be positive")
+
+// A SearchResult is a config, or a setting of one, whose name,
+// description or string value matched a search.
+type SearchResult struct {
+        Config  string
+        Setting string     // empty if the config itself matched
+        Snippet []Fragment // the text that matched, in parts
+}
+
+// A Fragment is part of the snippet of a search result. Match is true
+// for the parts that matched a search term.
+type Fragment struct {
+        Text  string
+        Match bool
+}
+
+// SearchStore is implemented by stores that index configs and settings
+// for full text search.
+type SearchStore interface {
+        // Search returns at most limit configs and settings whose names,
+        // descriptions and string values together contain every term of
+        // query, best matches first. Terms match the words they start.
+        // ErrInvalidLimit is returned unless limit is positive.
+        Search(query string, limit int) ([]SearchResult, error)
+}
+
+// Search searches store with its SearchStore. Stores without one are
+// searched by reading every config and setting, which is slow but finds
+// the same things, except that terms may match anywhere in a word.
+func Search(store Store, query string, limit int) ([]SearchResult, error) {
+        var err error
+        var configs []Config
+        var settings []*Setting
+
+        if limit <= 0 {
+                return nil, ErrInvalidLimit
+        }
+
+        if search, ok := Extension[SearchStore](store); ok {
+                return search.Search(query, limit)
+        }
+
+        results := make([]SearchResult, 0)
+        terms := strings.Fields(strings.ToLower(query))
+
+        if len(terms) == 0 {
+                return results, nil
+        }
+
+        if configs, err = store.GetConfigs(); err != nil {
+                return nil, err
+        }
+
+        for _, config := range configs {
+                if snippet := match(terms, config.Name(), config.Description()); snippet != nil {
+                        results = append(results, SearchResult{Config: config.Name(), Snippet: snippet})
+                }
+
+                if settings, err = store.GetSettings(config.Name()); err != nil {
+                        return nil, err
+                }
+
+                for _, setting := range settings {
+                        value, _ := setting.Value().(string)
+
+                        if snippet := match(terms, setting.Name(), setting.Description(), value); snippet != nil {
+                                results = append(results, SearchResult{Config: config.Name(), Setting: setting.Name(), Snippet: snippet})
+                        }
+                }
+
+                if len(results) >= limit {
+                        return results[:limit], nil
+                }
+        }
+
+        return results, nil
+}
+
+// match returns the first of fields that contains a term, highlighted,
+// if fields together contain every term, otherwise nil. Terms must be
+// lower case.
+func match(terms []string, fields ...string) []Fragment {
+        all := strings.ToLower(strings.Join(fields, "\n"))
+
+        for _, term := range terms {
+                if !strings.Contains(all, term) {
+                        return nil
+                }
+        }
+
+        for _, field := range fields {
+                if snippet := Highlight(field, terms); slices.ContainsFunc(snippet, func(f Fragment) bool { return f.Match }) {
+                        return snippet
+                }
+        }
+
+        return nil
+}
+
+// Highlight splits text into fragments, those that are one of terms
+// matching. Terms must be lower case; text is matched ignoring case.
+func Highlight(text string, terms []string) []Fragment {
+        var start int
+
+        fragments := make([]Fragment, 0)
+        lower := strings.ToLower(text)
+
+        // lowering may change the length of some letters, in which case
+        // the offsets in lower are not those in text
+        if len(lower) != len(text) {
+                return append(fragments, Fragment{Text: text})
+        }
+
+        for i := 0; i < len(text); {
+                end := 0
+
+                for _, term := range terms {
+                        if strings.HasPrefix(lower[i:], term) {
+                                end = max(end, i+len(term))
+                        }
+                }
+
+                if end == 0 {
+                        i++
+                        continue
+                }
+
+                if start < i {
+                        fragments = append(fragments, Fragment{Text: text[start:i]})
+                }
+
+                fragments = append(fragments, Fragment{Text: text[i:end], Match: true})
+                start, i = end, end
+        }
+
+        if start < len(text) {
+                fragments = append(fragments, Fragment{Text: text[start:]})
+        }
+
+        return fragments
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// apiGrant is the JSON representation of a grant.
+type apiGrant struct {
+        Principal string         `json:"principal"`
+        Config    string         `json:"config"`
+        Role      configman.Role `json:"role"`
+}
+
+// apiDenial is the JSON representation of a denial.
+type apiDenial struct {
+        Principal string         `json:"principal"`
+        Config    string         `json:"config"`
+        Role      configman.Role `json:"role"`
+        Action    string         `json:"action"`
+        At        time.Time      `json:"at"`
+}
+
+// authorize only lets requests through to next if the principal has
+// role on the config in the request path. Requests that are not about
+// one config need role on every config. Denied requests are recorded in
+// the access store.
+func authorize(store configman.Store, role configman.Role, next http.HandlerFunc) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                if _, ok := configman.Extension[configman.AccessStore](store); !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                ok, err := allowed(store, r, r.PathValue("name"), role)
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if ok {
+                        next(w, r)
+                        return
+                }
+
+                if strings.HasPrefix(r.URL.Path, "/api/") {
+                        writeApiError(w, r, configman.ErrForbidden)
+                        return
+                }
+
+                w.WriteHeader(http.StatusForbidden)
+
+                if err = indexTmpl.ExecuteTemplate(w, "forbidden", role); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// allowed reports whether the principal of r has role on config, or on
+// every config if config is empty. If not, the denial is recorded in
+// the access store. Stores without access control allow nothing.
+func allowed(store configman.Store, r *http.Request, config string, role configman.Role) (bool, error) {
+        var err error
+        var grants []configman.Grant
+
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return false, nil
+        }
+
+        if grants, err = grantsOf(access, r); err != nil {
+                return false, err
+        }
+
+        if configman.RoleOf(grants, config).Includes(role) {
+                return true, nil
+        }
+
+        denial := configman.Denial{
+                Principal: principal(r),
+                Config:    config,
+                Role:      role,
+                Action:    r.Method + " " + r.URL.Path,
+                At:        time.Now(),
+        }
+
+        requestLogger(r).Warn("server: access denied", "action", denial.Action, "role", role)
+
+        if err = access.RecordDenial(denial); err != nil {
+                logError(r, err)
+        }
+
+        return false, nil
+}
+
+// grantsOf returns the grants of the principal of r. Requests that were
+// not authenticated have none, rather than those of every principal
+// that access.GetGrants returns for the empty principal.
+func grantsOf(access configman.AccessStore, r *http.Request) ([]configman.Grant, error) {
+        if principal(r) == "" {
+                return nil, nil
+        }
+
+        return access.GetGrants(principal(r))
+}
+
+// viewableConfigs returns the configs the principal of r can view.
+func viewableConfigs(store configman.Store, r *http.Request, configs []configman.Config) ([]configman.Config, error) {
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return nil, configman.ErrForbidden
+        }
+
+        grants, err := grantsOf(access, r)
+
+        if err != nil {
+                return nil, err
+        }
+
+        viewable := make([]configman.Config, 0, len(configs))
+
+        for _, config := range configs {
+                if configman.RoleOf(grants, config.Name()).Includes(configman.RoleViewer) {
+                        viewable = append(viewable, config)
+                }
+        }
+
+        return viewable, nil
+}
+
+// registerAccessAPI registers the handlers used to manage grants and
+// read denials. Only admins of every config may read them; admins of a
+// config or namespace may grant and revoke roles on it.
+func registerAccessAPI(mux *http.ServeMux, store configman.Store, logger *slog.Logger) {
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                logger.Warn("server: store does not support access control, every request will be refused")
+                return
+        }
+
+        mux.HandleFunc("GET /api/v1/grants", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                grants, err := access.GetGrants(r.FormValue("principal"))
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]apiGrant, len(grants))
+
+                for i, grant := range grants {
+                        body[i] = apiGrant(grant)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        }))
+
+        // Admins of a config or namespace may grant roles on it, so the
+        // role is checked once the config of the grant is known.
+        mux.HandleFunc("PUT /api/v1/grants", func(w http.ResponseWriter, r *http.Request) {
+                var grant apiGrant
+
+                store := requestStore(store, r)
+
+                if err := json.NewDecoder(r.Body).Decode(&grant); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if grant.Principal == "" || grant.Config == "" {
+                        writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_grant", `principal and config are required, use "*" for every config or "namespace:*" for every config in a namespace`)
+                        return
+                }
+
+                if !allowedToGrant(w, r, store, grant.Config) {
+                        return
+                }
+
+                if err := access.GrantRole(grant.Principal, grant.Config, grant.Role); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, grant)
+        })
+
+        mux.HandleFunc("DELETE /api/v1/grants", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                if !allowedToGrant(w, r, store, r.FormValue("config")) {
+                        return
+                }
+
+                if err := access.RevokeRole(r.FormValue("principal"), r.FormValue("config")); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                w.WriteHeader(http.StatusNoContent)
+        })
+
+        mux.HandleFunc("GET /api/v1/denials", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                limit, err := strconv.Atoi(r.FormValue("limit"))
+
+                if err != nil || limit <= 0 {
+                        limit = 100
+                }
+
+                denials, err := access.GetDenials(limit)
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]apiDenial, len(denials))
+
+                for i, denial := range denials {
+                        body[i] = apiDenial(denial)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        }))
+}
+
+// allowedToGrant reports whether the principal of r is an admin of
+// config, the config of a grant, and so may grant roles on it. If not,
+// the error response is written.
+func allowedToGrant(w http.ResponseWriter, r *http.Request, store configman.Store, config string) bool {
+        ok, err := allowed(store, r, config, configman.RoleAdmin)
+
+        if err != nil {
+                writeApiError(w, r, err)
+                return false
+        }
+
+        if !ok {
+                writeApiError(w, r, configman.ErrForbidden)
+        }
+
+        return ok
+}
+
+// grantAdmins gives every principal in admins the admin role on every
+// config, so that there is someone to grant roles to everyone else.
+func grantAdmins(store configman.Store, admins []string) error {
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return errors.New("store does not support access control")
+        }
+
+        for _, admin := range admins {
+                if admin = strings.TrimSpace(admin); admin == "" {
+                        continue
+                }
+
+                if err := access.GrantRole(admin, configman.AllConfigs, configman.RoleAdmin); err != nil {
+                        return err
+                }
+        }
+
+        return nil
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestAllowed(t *testing.T) {
+        store := newTestStore(t)
+
+        if _, err := store.CreateConfig("app", ""); err != nil {
+                t.Fatalf("failed to create config: %v", err)
+        }
+
+        if err := store.GrantRole("alice", "app", configman.RoleAdmin); err != nil {
+                t.Fatalf("failed to grant role: %v", err)
+        }
+
+        tests := []struct {
+                principal string
+                config    string
+                role      configman.Role
+                allowed   bool
+        }{
+                {principal: "alice", config: "app", role: configman.RoleAdmin, allowed: true},
+                {principal: "alice", config: "app", role: configman.RoleViewer, allowed: true},
+                {principal: "alice", config: "web", role: configman.RoleViewer, allowed: false},
+                {principal: "alice", config: "", role: configman.RoleViewer, allowed: false},
+                {principal: "bob", config: "app", role: configman.RoleViewer, allowed: false},
+
+                // the grants of every principal must not be used
+                {principal: "", config: "app", role: configman.RoleViewer, allowed: false},
+        }
+
+        for _, test := range tests {
+                r := httptest.NewRequest("GET", "/configs/"+test.config+"/", nil)
+
+                if test.principal != "" {
+                        r = withPrincipal(r, test.principal)
+                }
+
+                allowed, err := allowed(store, r, test.config, test.role)
+
+                if err != nil {
+                        t.Fatalf("allowed returned %v", err)
+                }
+
+                if allowed != test.allowed {
+                        t.Errorf("%q allowed %s on %q is %t, want %t", test.principal, test.role, test.config, allowed, test.allowed)
+                }
+        }
+}
@@ -0,0 +1,783 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/gossert"
+)
+
+//go:embed api/openapi.yaml
+var apiDocs embed.FS
+
+// apiConfig is the JSON representation of a config.
+type apiConfig struct {
+        Name              string        `json:"name"`
+        Description       string        `json:"description"`
+        Revision          int64         `json:"revision"`
+        Deprecated        bool          `json:"deprecated"`
+        DeprecationReason string        `json:"deprecation_reason,omitempty"`
+        Settings          []*apiSetting `json:"settings,omitempty"`
+}
+
+// apiSetting is the JSON representation of a setting.
+type apiSetting struct {
+        Name              string         `json:"name"`
+        Type              configman.Type `json:"type"`
+        Value             any            `json:"value"`
+        Description       string         `json:"description"`
+        Revision          int64          `json:"revision"`
+        Deprecated        bool           `json:"deprecated"`
+        DeprecationReason string         `json:"deprecation_reason,omitempty"`
+        CreatedAt         time.Time      `json:"created_at"`
+        UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// apiSettingInput is the body of a request that creates or updates a
+// setting. Value is decoded once the type of the setting is known.
+type apiSettingInput struct {
+        Type        configman.Type  `json:"type"`
+        Value       json.RawMessage `json:"value"`
+        Description string          `json:"description"`
+}
+
+// apiOp is the JSON representation of a batch operation. Type and value
+// are left out for operations that do not set a value.
+type apiOp struct {
+        Kind             configman.OpKind `json:"kind"`
+        Config           string           `json:"config"`
+        Setting          string           `json:"setting"`
+        Type             configman.Type   `json:"type,omitempty"`
+        Value            any              `json:"value,omitempty"`
+        Description      string           `json:"description,omitempty"`
+        ExpectedRevision int64            `json:"expected_revision,omitempty"`
+}
+
+// apiOpInput is a batch operation in the body of a request. Value is
+// decoded once the type is known.
+type apiOpInput struct {
+        Kind             configman.OpKind `json:"kind"`
+        Config           string           `json:"config"`
+        Setting          string           `json:"setting"`
+        Type             configman.Type   `json:"type"`
+        Value            json.RawMessage  `json:"value"`
+        Description      string           `json:"description"`
+        ExpectedRevision int64            `json:"expected_revision"`
+}
+
+// apiChangeEvent is the JSON representation of a change event.
+type apiChangeEvent struct {
+        Revision int64     `json:"revision"`
+        By       string    `json:"by"`
+        At       time.Time `json:"at"`
+        Ops      []apiOp   `json:"ops"`
+}
+
+// apiError is the body of every error response of the API.
+type apiError struct {
+        Error struct {
+                Code    string `json:"code"`
+                Message string `json:"message"`
+        } `json:"error"`
+}
+
+func newApiConfig(config configman.Config) *apiConfig {
+        return &apiConfig{
+                Name:              config.Name(),
+                Description:       config.Desc(),
+                Revision:          config.Revision(),
+                Deprecated:        config.Deprecated(),
+                DeprecationReason: config.DeprecationReason(),
+        }
+}
+
+func newApiSetting(setting *configman.Setting) *apiSetting {
+        return &apiSetting{
+                Name:              setting.Name(),
+                Type:              setting.Type(),
+                Value:             setting.Value(),
+                Description:       setting.Description(),
+                Revision:          setting.Revision(),
+                Deprecated:        setting.Deprecated(),
+                DeprecationReason: setting.DeprecationReason(),
+                CreatedAt:         setting.CreatedAt(),
+                UpdatedAt:         setting.UpdatedAt(),
+        }
+}
+
+func newApiSettings(settings []*configman.Setting) []*apiSetting {
+        body := make([]*apiSetting, len(settings))
+
+        for i, setting := range settings {
+                body[i] = newApiSetting(setting)
+        }
+
+        return body
+}
+
+func newApiChangeEvent(event *configman.ChangeEvent) *apiChangeEvent {
+        body := &apiChangeEvent{
+                Revision: event.Revision,
+                By:       event.By,
+                At:       event.At,
+                Ops:      make([]apiOp, len(event.Ops)),
+        }
+
+        for i, op := range event.Ops {
+                body.Ops[i] = apiOp{
+                        Kind:             op.Kind,
+                        Config:           op.Config,
+                        Setting:          op.Setting,
+                        Type:             configman.TypeOf(op.Value),
+                        Value:            op.Value,
+                        Description:      op.Description,
+                        ExpectedRevision: op.ExpectedRevision,
+                }
+        }
+
+        return body
+}
+
+// registerAPI registers the handlers of the JSON API under /api/v1/.
+func registerAPI(mux *http.ServeMux, store configman.Store) {
+        mux.HandleFunc("GET /api/v1/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+                doc, err := apiDocs.ReadFile("api/openapi.yaml")
+                gossert.Ok(err == nil, "api: openapi document is not embedded")
+
+                w.Header().Set("Content-Type", "application/yaml")
+                w.WriteHeader(http.StatusOK)
+                w.Write(doc)
+        })
+
+        // Configs are listed a page at a time if a page parameter is
+        // given, every config at once otherwise.
+        mux.HandleFunc("GET /api/v1/configs", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var namespace *string
+                var query *configman.Query
+                var page *configman.PageRequest
+                var result *configman.Page[configman.Config]
+                var configs []configman.Config
+
+                store := requestStore(store, r)
+
+                if r.URL.Query().Has("namespace") {
+                        ns := r.FormValue("namespace")
+                        namespace = &ns
+                }
+
+                if query, err = parseQuery(r); err == nil {
+                        page, err = parsePage(r)
+                }
+
+                switch {
+                case err != nil:
+                case page != nil:
+                        if result, err = pageConfigs(store, r, query, namespace, *page); err == nil {
+                                configs = result.Items
+                                writePageHeaders(w, r, result.NextCursor, result.Total)
+                        }
+                default:
+                        if configs, err = queryConfigs(store, query); err == nil {
+                                configs, err = viewableConfigs(store, r, configs)
+                        }
+
+                        if err == nil && namespace != nil {
+                                configs = configman.ConfigsIn(configs, *namespace)
+                        }
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]*apiConfig, len(configs))
+
+                for i, config := range configs {
+                        body[i] = newApiConfig(config)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        // Admins of a namespace may create configs in it, so the role is
+        // checked once the name is known.
+        mux.HandleFunc("POST /api/v1/configs", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var ok bool
+                var input apiConfig
+                var config configman.Config
+
+                store := requestStore(store, r)
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if input.Name = strings.TrimSpace(input.Name); input.Name == "" {
+                        writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_name", "name is required")
+                        return
+                }
+
+                if ok, err = allowed(store, r, input.Name, configman.RoleAdmin); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if !ok {
+                        writeApiError(w, r, configman.ErrForbidden)
+                        return
+                }
+
+                if config, err = store.GetConfig(input.Name); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if config != nil {
+                        writeApiErrorCode(w, r, http.StatusConflict, "already_exists", "config "+input.Name+" already exists")
+                        return
+                }
+
+                // another request may have created it since
+                if config, err = store.CreateConfig(input.Name, input.Description); errors.Is(err, configman.ErrExists) {
+                        writeApiErrorCode(w, r, http.StatusConflict, "already_exists", "config "+input.Name+" already exists")
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                writeJSON(w, r, http.StatusCreated, newApiConfig(config))
+        })
+
+        mux.HandleFunc("GET /api/v1/configs/{name}", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var config configman.Config
+                var query *configman.Query
+                var page *configman.PageRequest
+                var result *configman.Page[*configman.Setting]
+                var settings []*configman.Setting
+
+                store := requestStore(store, r)
+
+                name := r.PathValue("name")
+
+                if query, err = parseQuery(r); err == nil {
+                        page, err = parsePage(r)
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if config, err = store.GetConfig(name); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if config == nil {
+                        writeApiError(w, r, configman.ErrNotFound)
+                        return
+                }
+
+                if page == nil {
+                        settings, err = querySettings(store, name, query)
+                } else if result, err = pageSettings(store, name, query, *page); err == nil {
+                        settings = result.Items
+                        writePageHeaders(w, r, result.NextCursor, result.Total)
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := newApiConfig(config)
+                body.Settings = make([]*apiSetting, len(settings))
+
+                for i, setting := range settings {
+                        body.Settings[i] = newApiSetting(setting)
+                }
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                writeJSON(w, r, http.StatusOK, body)
+        }))
+
+        mux.HandleFunc("PATCH /api/v1/configs/{name}", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var revision int64
+                var input apiConfig
+                var config configman.Config
+
+                store := requestStore(store, r)
+
+                if revision, err = ifMatch(r); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_if_match", "If-Match must be a revision returned in an ETag")
+                        return
+                }
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if config, err = store.GetConfig(r.PathValue("name")); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if config == nil {
+                        writeNotFound(w, r)
+                        return
+                }
+
+                if _, err = config.SetDescIf(input.Description, revision); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                writeJSON(w, r, http.StatusOK, newApiConfig(config))
+        }))
+
+        mux.HandleFunc("DELETE /api/v1/configs/{name}", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                if err := store.DeleteConfig(r.PathValue("name"), principal(r)); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                w.WriteHeader(http.StatusNoContent)
+        }))
+
+        mux.HandleFunc("POST /api/v1/configs/{name}/deprecation", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var revision int64
+                var config configman.Config
+                var input struct {
+                        Reason string `json:"reason"`
+                }
+
+                store := requestStore(store, r)
+
+                name := r.PathValue("name")
+
+                if revision, err = ifMatch(r); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_if_match", "If-Match must be a revision returned in an ETag")
+                        return
+                }
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                err = store.DeprecateConfigIf(name, input.Reason, revision)
+
+                if errors.Is(err, configman.ErrNotFound) {
+                        writeNotFound(w, r)
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if config, err = store.GetConfig(name); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                gossert.Ok(config != nil, "api: config not found right after it was deprecated")
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                writeJSON(w, r, http.StatusOK, newApiConfig(config))
+        }))
+
+        mux.HandleFunc("GET /api/v1/configs/{name}/history", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var events []configman.ChangeEvent
+
+                store := requestStore(store, r)
+
+                history, ok := configman.Extension[configman.HistoryStore](store)
+
+                if !ok {
+                        writeApiErrorCode(w, r, http.StatusNotImplemented, "not_implemented", "the store does not keep history")
+                        return
+                }
+
+                limit := 50
+
+                if s := r.URL.Query().Get("limit"); s != "" {
+                        if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+                                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_limit", "limit must be a positive number")
+                                return
+                        }
+                }
+
+                if events, err = history.GetHistory(r.PathValue("name"), limit); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                auditEventReads(store, r, events...)
+
+                body := make([]*apiChangeEvent, len(events))
+
+                for i := range events {
+                        body[i] = newApiChangeEvent(&events[i])
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        }))
+
+        // The settings can be read as they were at a snapshot or time,
+        // also those of configs deleted since.
+        mux.HandleFunc("GET /api/v1/configs/{name}/settings", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var asOf bool
+                var revision int64
+                var config configman.Config
+                var query *configman.Query
+                var page *configman.PageRequest
+                var result *configman.Page[*configman.Setting]
+                var settings []*configman.Setting
+
+                store := requestStore(store, r)
+
+                name := r.PathValue("name")
+
+                if query, err = parseQuery(r); err == nil {
+                        page, err = parsePage(r)
+                }
+
+                if err == nil {
+                        revision, asOf, err = revisionOf(store, r, name)
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if asOf {
+                        if query != nil || page != nil {
+                                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_as_of", "snapshot and as_of cannot be combined with filters or pages")
+                                return
+                        }
+
+                        snapshots, _ := configman.Extension[configman.SnapshotStore](store)
+
+                        if settings, err = snapshots.GetSettingsAt(name, revision); err != nil {
+                                writeApiError(w, r, err)
+                                return
+                        }
+
+                        auditSettingReads(store, r, name, settings)
+                        writeJSON(w, r, http.StatusOK, newApiSettings(settings))
+                        return
+                }
+
+                if config, err = store.GetConfig(name); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if config == nil {
+                        writeApiError(w, r, configman.ErrNotFound)
+                        return
+                }
+
+                if page == nil {
+                        settings, err = querySettings(store, name, query)
+                } else if result, err = pageSettings(store, name, query, *page); err == nil {
+                        settings = result.Items
+                        writePageHeaders(w, r, result.NextCursor, result.Total)
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                auditSettingReads(store, r, name, settings)
+                writeJSON(w, r, http.StatusOK, newApiSettings(settings))
+        }))
+
+        mux.HandleFunc("GET /api/v1/configs/{name}/settings/{setting}", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                setting, err := store.GetSetting(r.PathValue("name"), r.PathValue("setting"))
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if setting == nil {
+                        writeApiError(w, r, configman.ErrNotFound)
+                        return
+                }
+
+                auditSecretReads(store, r, r.PathValue("name"), setting.Name())
+                w.Header().Set("ETag", etag(setting.Revision()))
+                writeJSON(w, r, http.StatusOK, newApiSetting(setting))
+        }))
+
+        // PUT creates the setting if it does not exist and otherwise sets
+        // its value. The type of an existing setting cannot be changed. A
+        // setting is never created by a PUT with If-Match.
+        mux.HandleFunc("PUT /api/v1/configs/{name}/settings/{setting}", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var value any
+                var revision int64
+                var input apiSettingInput
+                var setting *configman.Setting
+
+                store := requestStore(store, r)
+
+                config, name := r.PathValue("name"), r.PathValue("setting")
+
+                if revision, err = ifMatch(r); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_if_match", "If-Match must be a revision returned in an ETag")
+                        return
+                }
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if setting, err = store.GetSetting(config, name); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                // only an existing setting can match If-Match
+                if setting == nil && r.Header.Get("If-Match") != "" {
+                        writeNotFound(w, r)
+                        return
+                }
+
+                // The type can be left out when updating a setting.
+                if setting != nil && input.Type == configman.Unsupported {
+                        input.Type = setting.Type()
+                }
+
+                if value, err = configman.UnmarshalValue(input.Type, input.Value); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                status := http.StatusOK
+                batch := new(configman.Batch)
+
+                if setting == nil {
+                        status = http.StatusCreated
+                        batch.Create(config, name, input.Description, value)
+                } else {
+                        batch.UpdateIf(config, name, value, revision)
+                }
+
+                if _, err = store.ApplyBatch(batch, principal(r)); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if setting, err = store.GetSetting(config, name); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                gossert.Ok(setting != nil, "api: setting not found right after it was written")
+
+                w.Header().Set("ETag", etag(setting.Revision()))
+                writeJSON(w, r, status, newApiSetting(setting))
+        }))
+
+        mux.HandleFunc("DELETE /api/v1/configs/{name}/settings/{setting}", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                revision, err := ifMatch(r)
+
+                if err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_if_match", "If-Match must be a revision returned in an ETag")
+                        return
+                }
+
+                batch := new(configman.Batch).DeleteIf(r.PathValue("name"), r.PathValue("setting"), revision)
+                _, err = store.ApplyBatch(batch, principal(r))
+
+                if errors.Is(err, configman.ErrNotFound) {
+                        writeNotFound(w, r)
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                w.WriteHeader(http.StatusNoContent)
+        }))
+
+        // A batch needs the editor role on every config it changes.
+        mux.HandleFunc("POST /api/v1/batch", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var ok bool
+                var event *configman.ChangeEvent
+                var input struct {
+                        Ops []apiOpInput `json:"ops"`
+                }
+
+                store := requestStore(store, r)
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if len(input.Ops) == 0 {
+                        writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_batch", "a batch needs at least one operation")
+                        return
+                }
+
+                batch := new(configman.Batch)
+
+                for _, in := range input.Ops {
+                        op := configman.BatchOp{
+                                Kind:             in.Kind,
+                                Config:           in.Config,
+                                Setting:          in.Setting,
+                                Description:      in.Description,
+                                ExpectedRevision: in.ExpectedRevision,
+                        }
+
+                        switch in.Kind {
+                        case configman.OpCreate, configman.OpUpdate:
+                                if op.Value, err = configman.UnmarshalValue(in.Type, in.Value); err != nil {
+                                        writeApiError(w, r, err)
+                                        return
+                                }
+                        case configman.OpDelete, configman.OpDeprecate:
+                        default:
+                                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_batch", "kind must be create, update, delete or deprecate")
+                                return
+                        }
+
+                        batch.Ops = append(batch.Ops, op)
+                }
+
+                for _, config := range batch.Configs() {
+                        if ok, err = allowed(store, r, config, configman.RoleEditor); err != nil {
+                                writeApiError(w, r, err)
+                                return
+                        }
+
+                        if !ok {
+                                writeApiError(w, r, configman.ErrForbidden)
+                                return
+                        }
+                }
+
+                if event, err = store.ApplyBatch(batch, principal(r)); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, newApiChangeEvent(event))
+        })
+}
+
+// writeJSON writes body as the JSON response with the given status.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, body any) {
+        w.Header().Set("Content-Type", "application/json")
+        w.WriteHeader(status)
+
+        if err := json.NewEncoder(w).Encode(body); err != nil {
+                logError(r, err)
+        }
+}
+
+// writeApiError writes the error response matching err. Errors that are
+// not configman errors are logged and reported as internal errors.
+func writeApiError(w http.ResponseWriter, r *http.Request, err error) {
+        switch {
+        case errors.Is(err, configman.ErrNotFound):
+                writeApiErrorCode(w, r, http.StatusNotFound, "not_found", "config or setting does not exist")
+        case errors.Is(err, configman.ErrExists):
+                writeApiErrorCode(w, r, http.StatusConflict, "already_exists", "setting already exists")
+        case errors.Is(err, configman.ErrConflict):
+                writeApiErrorCode(w, r, http.StatusPreconditionFailed, "revision_mismatch", "it was changed by someone else, fetch it again and retry")
+        case errors.Is(err, configman.ErrProtectedConfig):
+                writeApiErrorCode(w, r, http.StatusForbidden, "protected_config", "config is protected, propose a change request instead")
+        case errors.Is(err, configman.ErrTypeMismatch):
+                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "type_mismatch", "value does not match the type of the setting")
+        case errors.Is(err, configman.ErrUnsupportedType):
+                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "unsupported_type", "type is not supported")
+        case errors.Is(err, configman.ErrUnknownRole):
+                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "unknown_role", "role must be viewer, editor or admin")
+        case errors.Is(err, configman.ErrInvalidNamespace):
+                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_namespace", "namespace names must not be empty or contain ':' or '*'")
+        case errors.Is(err, configman.ErrNamespaceNotEmpty):
+                writeApiErrorCode(w, r, http.StatusConflict, "namespace_not_empty", "delete the configs of the namespace first")
+        case errors.Is(err, configman.ErrInvalidLabel):
+                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_label", "label keys and values must be at most 63 letters, digits, '-', '_' or '.', starting and ending with a letter or digit; keys may also contain '/'")
+        case errors.Is(err, configman.ErrInvalidSelector):
+                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_selector", err.Error())
+        case errors.Is(err, errNoLabels):
+                writeApiErrorCode(w, r, http.StatusNotImplemented, "not_implemented", "the store does not support labels")
+        case errors.Is(err, configman.ErrInvalidLimit):
+                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_limit", "limit must be a positive number")
+        case errors.Is(err, configman.ErrInvalidPage):
+                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_page", "invalid sort, order, limit or cursor")
+        case errors.Is(err, errNoPaging):
+                writeApiErrorCode(w, r, http.StatusNotImplemented, "not_implemented", "the store does not support pagination")
+        case errors.Is(err, configman.ErrInvalidSnapshot):
+                writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_snapshot", "snapshot names must be at most 63 letters, digits, '-', '_' or '.', starting with a letter or digit")
+        case errors.Is(err, configman.ErrNotInSnapshot):
+                writeApiErrorCode(w, r, http.StatusNotFound, "not_in_snapshot", "the snapshot does not include the config")
+        case errors.Is(err, errInvalidAsOf):
+                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_as_of", "as_of must be an RFC 3339 time")
+        case errors.Is(err, errNoSnapshots):
+                writeApiErrorCode(w, r, http.StatusNotImplemented, "not_implemented", "the store does not support snapshots")
+        case errors.Is(err, errNoClone):
+                writeApiErrorCode(w, r, http.StatusNotImplemented, "not_implemented", "the store does not support cloning and renaming configs")
+        case errors.Is(err, errNoTrash):
+                writeApiErrorCode(w, r, http.StatusNotImplemented, "not_implemented", "the store does not keep deleted configs and settings")
+        case errors.Is(err, errInvalidRef):
+                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_ref", "refs must be CONFIG or CONFIG@SNAPSHOT")
+        case errors.Is(err, configman.ErrForbidden):
+                writeApiErrorCode(w, r, http.StatusForbidden, "forbidden", "you do not have the role needed to do this")
+        default:
+                logError(r, err)
+                writeApiErrorCode(w, r, http.StatusInternalServerError, "internal", "internal server error")
+        }
+}
+
+// writeApiErrorCode writes an error response with the given status, code
+// and message.
+func writeApiErrorCode(w http.ResponseWriter, r *http.Request, status int, code, msg string) {
+        var body apiError
+
+        body.Error.Code = code
+        body.Error.Message = msg
+
+        writeJSON(w, r, status, body)
+}
@@ -0,0 +1,349 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// apiAuditEntry is the JSON representation of an audit entry.
+type apiAuditEntry struct {
+        ID       int64     `json:"id"`
+        At       time.Time `json:"at"`
+        Actor    string    `json:"actor"`
+        Action   string    `json:"action"`
+        Config   string    `json:"config,omitempty"`
+        Setting  string    `json:"setting,omitempty"`
+        Outcome  string    `json:"outcome"`
+        PrevHash string    `json:"prev_hash"`
+        Hash     string    `json:"hash"`
+}
+
+// auditPage is the data of the audit-log template.
+type auditPage struct {
+        Query    configman.AuditQuery
+        Entries  []configman.AuditEntry
+        Tampered error
+        Error    string
+}
+
+// auditWrites records every request handled by next that is not a
+// read, i.e. every change, in the audit log of the store, with the route
+// it matched as its action and its status as its outcome. Reads are
+// recorded by auditSecretReads if they return values of secrets; for
+// successful reads of routes naming a setting whose handler did not call
+// it, it is called with that setting. Requests that were not
+// authenticated, like logins, are recorded by their handlers. It must
+// wrap the mux so that the route is known once next returns.
+func auditWrites(store configman.Store, next http.Handler) http.Handler {
+        audit, ok := configman.Extension[configman.AuditStore](store)
+
+        if !ok {
+                return next
+        }
+
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                if principal(r) == "" {
+                        next.ServeHTTP(w, r)
+                        return
+                }
+
+                audited := new(bool)
+                r = r.WithContext(context.WithValue(r.Context(), secretReadsKey{}, audited))
+
+                ww := &customResponseWriter{w, http.StatusOK}
+                next.ServeHTTP(ww, r)
+
+                if r.Method == http.MethodGet || r.Method == http.MethodHead {
+                        if !*audited && ww.statusCode < http.StatusMultipleChoices && r.PathValue("setting") != "" {
+                                auditSecretReads(store, r, r.PathValue("name"), r.PathValue("setting"))
+                        }
+
+                        return
+                }
+
+                entry := configman.AuditEntry{
+                        Actor:   principal(r),
+                        Action:  auditAction(r),
+                        Config:  r.PathValue("name"),
+                        Setting: r.PathValue("setting"),
+                        Outcome: strconv.Itoa(ww.statusCode),
+                }
+
+                if _, err := audit.RecordAudit(entry); err != nil {
+                        logError(r, err)
+                }
+        })
+}
+
+// auditAction returns the action of the request r in the audit log, the
+// route it matched.
+func auditAction(r *http.Request) string {
+        if r.Pattern == "" {
+                return r.Method + " " + r.URL.Path
+        }
+
+        return r.Pattern
+}
+
+// secretReadsKey is the context key of whether the handler of a request
+// called auditSecretReads.
+type secretReadsKey struct{}
+
+// auditSecretReads records in the audit log of the store that the
+// request r read the values of the named settings of config which are
+// secrets, those labelled configman.SecretLabel=true, once per setting.
+// Every handler that responds with values of settings, current or past,
+// calls it before writing them. Failing to read the labels of a setting
+// counts as a secret, so that reads are recorded rather than missed.
+func auditSecretReads(store configman.Store, r *http.Request, config string, names ...string) {
+        if audited, ok := r.Context().Value(secretReadsKey{}).(*bool); ok {
+                *audited = true
+        }
+
+        audit, ok := configman.Extension[configman.AuditStore](store)
+
+        if !ok || principal(r) == "" {
+                return
+        }
+
+        labels, ok := configman.Extension[configman.LabelStore](store)
+
+        if !ok {
+                return
+        }
+
+        seen := make(map[string]bool, len(names))
+
+        for _, name := range names {
+                if seen[name] {
+                        continue
+                }
+
+                seen[name] = true
+
+                set, err := labels.GetSettingLabels(config, name)
+
+                if err != nil {
+                        logError(r, err)
+                } else if set[configman.SecretLabel] != "true" {
+                        continue
+                }
+
+                entry := configman.AuditEntry{
+                        Actor:   principal(r),
+                        Action:  auditAction(r),
+                        Config:  config,
+                        Setting: name,
+                        Outcome: strconv.Itoa(http.StatusOK),
+                }
+
+                if _, err = audit.RecordAudit(entry); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// auditSettingReads calls auditSecretReads with the names of settings.
+func auditSettingReads(store configman.Store, r *http.Request, config string, settings []*configman.Setting) {
+        names := make([]string, len(settings))
+
+        for i, setting := range settings {
+                names[i] = setting.Name()
+        }
+
+        auditSecretReads(store, r, config, names...)
+}
+
+// settingReads collects the settings of several configs a request
+// reads, so that auditSecretReads is called once per config.
+type settingReads struct {
+        configs []string
+        names   map[string][]string
+}
+
+// add adds a setting of config, unless setting is empty.
+func (reads *settingReads) add(config, setting string) {
+        if setting == "" {
+                return
+        }
+
+        if reads.names == nil {
+                reads.names = make(map[string][]string)
+        }
+
+        if reads.names[config] == nil {
+                reads.configs = append(reads.configs, config)
+        }
+
+        reads.names[config] = append(reads.names[config], setting)
+}
+
+// audit calls auditSecretReads with the settings added, by config.
+func (reads *settingReads) audit(store configman.Store, r *http.Request) {
+        for _, config := range reads.configs {
+                auditSecretReads(store, r, config, reads.names[config]...)
+        }
+}
+
+// auditEventReads calls auditSecretReads with the settings changed by
+// events, which carry their values. Renames change no setting.
+func auditEventReads(store configman.Store, r *http.Request, events ...configman.ChangeEvent) {
+        var reads settingReads
+
+        for _, event := range events {
+                for _, op := range event.Ops {
+                        reads.add(op.Config, op.Setting)
+                }
+        }
+
+        reads.audit(store, r)
+}
+
+// auditLogin records a login attempt of user in the audit log of the
+// store, if it keeps one.
+func auditLogin(store configman.Store, r *http.Request, user string, ok bool) {
+        audit, found := configman.Extension[configman.AuditStore](store)
+
+        if !found {
+                return
+        }
+
+        entry := configman.AuditEntry{Actor: user, Action: "login", Outcome: "ok"}
+
+        if !ok {
+                entry.Outcome = "failed"
+        }
+
+        if _, err := audit.RecordAudit(entry); err != nil {
+                logError(r, err)
+        }
+}
+
+// parseAuditQuery reads an audit query from the actor, config, since,
+// until and limit parameters of r. Times are RFC 3339 or, as sent by
+// datetime-local inputs, without seconds and zone, in UTC.
+func parseAuditQuery(r *http.Request) (configman.AuditQuery, error) {
+        var err error
+
+        query := configman.AuditQuery{
+                Actor:  r.FormValue("actor"),
+                Config: r.FormValue("config"),
+                Limit:  100,
+        }
+
+        if query.Since, err = parseAuditTime(r.FormValue("since")); err != nil {
+                return query, errors.New("since must be a time like 2006-01-02T15:04:05Z")
+        }
+
+        if query.Until, err = parseAuditTime(r.FormValue("until")); err != nil {
+                return query, errors.New("until must be a time like 2006-01-02T15:04:05Z")
+        }
+
+        if s := r.FormValue("limit"); s != "" {
+                if query.Limit, err = strconv.Atoi(s); err != nil || query.Limit < 1 {
+                        return query, errors.New("limit must be a positive number")
+                }
+        }
+
+        return query, nil
+}
+
+// parseAuditTime parses a time given to parseAuditQuery. The empty
+// string is the zero time.
+func parseAuditTime(s string) (time.Time, error) {
+        if s == "" {
+                return time.Time{}, nil
+        }
+
+        if t, err := time.Parse(time.RFC3339, s); err == nil {
+                return t, nil
+        }
+
+        return time.Parse("2006-01-02T15:04", s)
+}
+
+// registerAuditAPI registers the handlers used to query and verify the
+// audit log and the audit viewer of the UI. Only admins of every config
+// may use them.
+func registerAuditAPI(mux *http.ServeMux, store configman.Store) {
+        audit, ok := configman.Extension[configman.AuditStore](store)
+
+        if !ok {
+                return
+        }
+
+        mux.HandleFunc("GET /api/v1/audit", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                query, err := parseAuditQuery(r)
+
+                if err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_query", err.Error())
+                        return
+                }
+
+                entries, err := audit.QueryAudit(query)
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]apiAuditEntry, len(entries))
+
+                for i, entry := range entries {
+                        body[i] = apiAuditEntry(entry)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        }))
+
+        mux.HandleFunc("GET /api/v1/audit/verify", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                err := audit.VerifyAudit()
+
+                if errors.Is(err, configman.ErrAuditTampered) {
+                        writeApiErrorCode(w, r, http.StatusConflict, "audit_tampered", err.Error())
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, map[string]bool{"intact": true})
+        }))
+
+        mux.HandleFunc("GET /audit/", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+
+                page := new(auditPage)
+
+                if page.Query, err = parseAuditQuery(r); err != nil {
+                        page.Error = err.Error()
+                } else if page.Entries, err = audit.QueryAudit(page.Query); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if err = audit.VerifyAudit(); errors.Is(err, configman.ErrAuditTampered) {
+                        page.Tampered = err
+                } else if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "audit-log", page); err != nil {
+                        logError(r, err)
+                }
+        }))
+}
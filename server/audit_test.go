@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+func TestAuditSecretReads(t *testing.T) {
+        asOf := time.Now().Add(time.Second).UTC().Format(time.RFC3339)
+
+        tests := []struct {
+                method string
+                target string
+                body   string
+                action string
+                reads  int // of the password settings
+        }{
+                {"GET", "/api/v1/configs/app/settings/password", "", "GET /api/v1/configs/{name}/settings/{setting}", 1},
+                {"GET", "/api/v1/configs/app/settings/timeout", "", "", 0},
+                {"GET", "/api/v1/configs/app/settings", "", "GET /api/v1/configs/{name}/settings", 1},
+                {"GET", "/api/v1/configs/app/settings?limit=10", "", "GET /api/v1/configs/{name}/settings", 1},
+                {"GET", "/api/v1/configs/app/settings?as_of=" + asOf, "", "GET /api/v1/configs/{name}/settings", 1},
+                {"GET", "/api/v1/configs/app/settings?snapshot=before", "", "GET /api/v1/configs/{name}/settings", 1},
+                {"GET", "/api/v1/configs/app/history", "", "GET /api/v1/configs/{name}/history", 1},
+                {"GET", "/api/v1/search?q=hunter2", "", "GET /api/v1/search", 1},
+                {"GET", "/api/v1/diff?from=app&to=web", "", "GET /api/v1/diff", 2},
+                {"POST", "/api/v1/merge", `{"base": "app@before", "theirs": "app", "into": "web"}`, "POST /api/v1/merge", 2},
+                {"POST", "/api/v1/promote", `{"from": "app", "to": "web"}`, "POST /api/v1/promote", 2},
+                {"GET", "/configs/app/", "", "GET /configs/{name}/", 1},
+                {"GET", "/configs/app/settings/", "", "GET /configs/{name}/settings/", 1},
+                {"GET", "/configs/app/settings/password/", "", "GET /configs/{name}/settings/{setting}/", 1},
+                {"GET", "/configs/app/settings/as-of?snapshot=before", "", "GET /configs/{name}/settings/as-of", 1},
+                {"GET", "/configs/app/events", "", "GET /configs/{name}/events", 1},
+                {"GET", "/search/?q=hunter2", "", "GET /search/{$}", 1},
+                {"GET", "/diff/?from=app@before&to=app", "", "GET /diff/", 1},
+                {"GET", "/configs/app/promote?to=web&settings=password", "", "GET /configs/{name}/promote", 2},
+        }
+
+        for _, test := range tests {
+                t.Run(test.method+" "+test.target, func(t *testing.T) {
+                        store := newTestStore(t)
+
+                        for _, config := range []string{"app", "web"} {
+                                if _, err := store.CreateConfig(config, ""); err != nil {
+                                        t.Fatalf("failed to create config: %v", err)
+                                }
+                        }
+
+                        batch := new(configman.Batch).
+                                Create("app", "password", "", "hunter1").
+                                Create("app", "timeout", "", int64(30)).
+                                Create("web", "password", "", "swordfish")
+
+                        if _, err := store.ApplyBatch(batch, "test"); err != nil {
+                                t.Fatalf("failed to create settings: %v", err)
+                        }
+
+                        for _, config := range []string{"app", "web"} {
+                                if err := store.SetSettingLabels(config, "password", configman.Labels{configman.SecretLabel: "true"}); err != nil {
+                                        t.Fatalf("failed to label setting: %v", err)
+                                }
+                        }
+
+                        if _, err := store.CreateSnapshot("before", "", "app", "test"); err != nil {
+                                t.Fatalf("failed to create snapshot: %v", err)
+                        }
+
+                        event, err := store.ApplyBatch(new(configman.Batch).Update("app", "password", "hunter2"), "test")
+
+                        if err != nil {
+                                t.Fatalf("failed to update setting: %v", err)
+                        }
+
+                        shutdown := make(chan struct{})
+                        close(shutdown)
+
+                        handler := newTestServer(t, store, Options{Shutdown: shutdown})
+                        r := newTestRequest("root", test.method, test.target, test.body)
+
+                        // the event stream replays the update
+                        r.Header.Set("Last-Event-ID", strconv.FormatInt(event.Revision-1, 10))
+
+                        w := httptest.NewRecorder()
+                        handler.ServeHTTP(w, r)
+
+                        if w.Code >= http.StatusMultipleChoices {
+                                t.Fatalf("got status %d: %s", w.Code, w.Body)
+                        }
+
+                        entries, err := store.QueryAudit(configman.AuditQuery{Actor: "root", Limit: 100})
+
+                        if err != nil {
+                                t.Fatalf("failed to query audit log: %v", err)
+                        }
+
+                        reads := 0
+
+                        for _, entry := range entries {
+                                if entry.Setting == "password" && entry.Action == test.action {
+                                        reads++
+                                }
+                        }
+
+                        if reads != test.reads {
+                                t.Errorf("recorded %d reads of secrets, want %d: %+v", reads, test.reads, entries)
+                        }
+                })
+        }
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// sessionCookie is the name of the cookie holding the session id.
+const sessionCookie = "configman_session"
+
+// passwordIterations is the number of PBKDF2 iterations used to hash
+// new passwords.
+const passwordIterations = 600000
+
+// dummyPasswordHash is checked against when a user does not exist so
+// that timing does not reveal which users exist.
+const dummyPasswordHash = "pbkdf2-sha256$600000$AAAAAAAAAAAAAAAAAAAAAA$AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+
+// An Authenticator finds out who is making a request. It returns false
+// if the request carries no credentials it understands or they are not
+// valid.
+type Authenticator interface {
+        Authenticate(r *http.Request) (principal string, ok bool)
+}
+
+type principalKey struct{}
+
+// withPrincipal returns a copy of r made by principal.
+func withPrincipal(r *http.Request, principal string) *http.Request {
+        return r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+}
+
+// principal returns who is making the request. It is empty for requests
+// that were let through without authentication.
+func principal(r *http.Request) string {
+        p, _ := r.Context().Value(principalKey{}).(string)
+        return p
+}
+
+// tokenAuth authenticates requests carrying a static API token in the
+// Authorization header as "Bearer <token>". It maps tokens to
+// principals.
+type tokenAuth map[string]string
+
+// Authenticate implements Authenticator.
+func (tokens tokenAuth) Authenticate(r *http.Request) (string, bool) {
+        token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+        if !ok {
+                return "", false
+        }
+
+        for known, principal := range tokens {
+                if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+                        return principal, true
+                }
+        }
+
+        return "", false
+}
+
+// passwordAuth authenticates requests using HTTP basic authentication.
+// It maps user names to password hashes made by HashPassword.
+type passwordAuth map[string]string
+
+// Authenticate implements Authenticator.
+func (users passwordAuth) Authenticate(r *http.Request) (string, bool) {
+        user, password, ok := r.BasicAuth()
+
+        if !ok || !users.Check(user, password) {
+                return "", false
+        }
+
+        return user, true
+}
+
+// Check returns true if password is the password of user.
+func (users passwordAuth) Check(user, password string) bool {
+        hash, ok := users[user]
+
+        if !ok {
+                hash = dummyPasswordHash
+        }
+
+        return checkPassword(hash, password) && ok
+}
+
+// HashPassword returns the hash of password in the form
+// pbkdf2-sha256$<iterations>$<salt>$<key>, as expected in
+// Options.Users.
+func HashPassword(password string) (string, error) {
+        salt := make([]byte, 16)
+
+        if _, err := rand.Read(salt); err != nil {
+                return "", err
+        }
+
+        key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, sha256.Size)
+
+        if err != nil {
+                return "", err
+        }
+
+        return strings.Join([]string{
+                "pbkdf2-sha256",
+                strconv.Itoa(passwordIterations),
+                base64.RawStdEncoding.EncodeToString(salt),
+                base64.RawStdEncoding.EncodeToString(key),
+        }, "$"), nil
+}
+
+// validPasswordHash reports whether hash is in the format made by
+// HashPassword.
+func validPasswordHash(hash string) bool {
+        parts := strings.Split(hash, "$")
+        return len(parts) == 4 && parts[0] == "pbkdf2-sha256"
+}
+
+// checkPassword returns true if password matches hash, which must have
+// been made by HashPassword.
+func checkPassword(hash, password string) bool {
+        parts := strings.Split(hash, "$")
+
+        if !validPasswordHash(hash) {
+                return false
+        }
+
+        iterations, err := strconv.Atoi(parts[1])
+
+        if err != nil {
+                return false
+        }
+
+        salt, saltErr := base64.RawStdEncoding.DecodeString(parts[2])
+        want, keyErr := base64.RawStdEncoding.DecodeString(parts[3])
+
+        if saltErr != nil || keyErr != nil {
+                return false
+        }
+
+        got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+
+        return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// session is a logged in principal.
+type session struct {
+        principal string
+        expiresAt time.Time
+}
+
+// sessionAuth authenticates requests carrying the cookie of a session
+// created when a user logged in. Sessions are kept in memory and are
+// lost when the server restarts.
+type sessionAuth struct {
+        mu       sync.Mutex
+        ttl      time.Duration
+        sessions map[string]session
+}
+
+// newSessionAuth returns a sessionAuth whose sessions last for ttl.
+func newSessionAuth(ttl time.Duration) *sessionAuth {
+        return &sessionAuth{ttl: ttl, sessions: make(map[string]session)}
+}
+
+// Authenticate implements Authenticator.
+func (auth *sessionAuth) Authenticate(r *http.Request) (string, bool) {
+        cookie, err := r.Cookie(sessionCookie)
+
+        if err != nil {
+                return "", false
+        }
+
+        auth.mu.Lock()
+        defer auth.mu.Unlock()
+
+        s, ok := auth.sessions[cookie.Value]
+
+        if !ok {
+                return "", false
+        }
+
+        if time.Now().After(s.expiresAt) {
+                delete(auth.sessions, cookie.Value)
+                return "", false
+        }
+
+        return s.principal, true
+}
+
+// Start creates a session for principal and sets its cookie on w.
+func (auth *sessionAuth) Start(w http.ResponseWriter, r *http.Request, principal string) error {
+        id := make([]byte, 32)
+
+        if _, err := rand.Read(id); err != nil {
+                return err
+        }
+
+        s := session{principal: principal, expiresAt: time.Now().Add(auth.ttl)}
+        value := base64.RawURLEncoding.EncodeToString(id)
+
+        auth.mu.Lock()
+
+        // forget expired sessions while we are at it
+        for key, old := range auth.sessions {
+                if time.Now().After(old.expiresAt) {
+                        delete(auth.sessions, key)
+                }
+        }
+
+        auth.sessions[value] = s
+        auth.mu.Unlock()
+
+        http.SetCookie(w, &http.Cookie{
+                Name:     sessionCookie,
+                Value:    value,
+                Path:     "/",
+                Expires:  s.expiresAt,
+                HttpOnly: true,
+                Secure:   r.TLS != nil,
+                SameSite: http.SameSiteLaxMode,
+        })
+
+        return nil
+}
+
+// End ends the session of r, if any, and clears its cookie.
+func (auth *sessionAuth) End(w http.ResponseWriter, r *http.Request) {
+        if cookie, err := r.Cookie(sessionCookie); err == nil {
+                auth.mu.Lock()
+                delete(auth.sessions, cookie.Value)
+                auth.mu.Unlock()
+        }
+
+        http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+}
+
+// ParsePairs parses a comma separated list of key=value pairs, the
+// format tokens and users are given in on the command line. Pairs
+// without a key or value are ignored.
+func ParsePairs(s string) map[string]string {
+        pairs := make(map[string]string)
+
+        for _, pair := range strings.Split(s, ",") {
+                key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+
+                if key != "" && value != "" {
+                        pairs[key] = value
+                }
+        }
+
+        return pairs
+}
+
+// getLogin renders the login page.
+func getLogin(w http.ResponseWriter, r *http.Request) {
+        renderLogin(w, r, http.StatusOK, "")
+}
+
+// postLogin starts a session if the user name and password in the form
+// are valid. Every attempt is recorded in the audit log.
+func postLogin(store configman.Store, users passwordAuth, sessions *sessionAuth) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                user := strings.TrimSpace(r.FormValue("user"))
+                ok := users.Check(user, r.FormValue("password"))
+
+                auditLogin(store, r, user, ok)
+
+                if !ok {
+                        requestLogger(r).Warn("server: failed login", "user", user)
+                        renderLogin(w, r, http.StatusUnauthorized, "user name or password is wrong")
+                        return
+                }
+
+                if err := sessions.Start(w, r, user); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                http.Redirect(w, r, "/", http.StatusSeeOther)
+        }
+}
+
+// postLogout ends the session of the request.
+func postLogout(sessions *sessionAuth) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                sessions.End(w, r)
+                http.Redirect(w, r, "/login", http.StatusSeeOther)
+        }
+}
+
+// renderLogin renders the login template.
+func renderLogin(w http.ResponseWriter, r *http.Request, status int, msg string) {
+        w.WriteHeader(status)
+
+        if err := indexTmpl.ExecuteTemplate(w, "login", msg); err != nil {
+                logError(r, err)
+        }
+}
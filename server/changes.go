@@ -0,0 +1,234 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// changeRequestsPage is the data used to render the change-requests
+// template.
+type changeRequestsPage struct {
+        Config    string
+        Protected bool
+        Requests  []*configman.ChangeRequest
+        Error     string
+}
+
+// putProtected marks a config as protected or unprotected.
+func putProtected(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                requests, ok := configman.Extension[configman.ChangeRequestStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                protected := r.FormValue("protected") == "true"
+
+                err := requests.SetProtected(r.PathValue("name"), protected)
+
+                if errors.Is(err, configman.ErrNotFound) {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                renderChangeRequests(store, w, r, http.StatusOK, "")
+        }
+}
+
+// getChangeRequests renders the review screen of a config.
+func getChangeRequests(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                renderChangeRequests(store, w, r, http.StatusOK, "")
+        }
+}
+
+// getProposeChange renders the form used to propose a change to a
+// setting.
+func getProposeChange(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var setting *configman.Setting
+
+                store := requestStore(store, r)
+
+                config := r.PathValue("name")
+
+                if setting, err = store.GetSetting(config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                pageData := make(map[string]any)
+                pageData["Config"] = config
+                pageData["Setting"] = setting
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "propose-change", pageData); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// postProposeChange proposes a change to the value of a setting.
+func postProposeChange(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var value any
+                var setting *configman.Setting
+
+                store := requestStore(store, r)
+
+                requests, ok := configman.Extension[configman.ChangeRequestStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                config := r.PathValue("name")
+
+                if setting, err = store.GetSetting(config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if value, err = configman.ParseValue(setting.Type(), r.FormValue("value")); err != nil {
+                        renderChangeRequests(store, w, r, http.StatusUnprocessableEntity, "value must be a valid "+setting.Type().String())
+                        return
+                }
+
+                if _, err = requests.ProposeChange(config, setting.Name(), value, principal(r)); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                renderChangeRequests(store, w, r, http.StatusCreated, "")
+        }
+}
+
+// postReviewChange approves or rejects a change request depending on the
+// decision in the request path.
+func postReviewChange(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                requests, ok := configman.Extension[configman.ChangeRequestStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+
+                if err != nil {
+                        w.WriteHeader(http.StatusBadRequest)
+                        return
+                }
+
+                // the role of the principal was only checked on the
+                // config in the path, the request must belong to it
+                if pending, err := requests.GetChangeRequests(r.PathValue("name")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                } else if !slices.ContainsFunc(pending, func(request *configman.ChangeRequest) bool { return request.ID == id }) {
+                        renderChangeRequests(store, w, r, http.StatusConflict, "change has already been reviewed")
+                        return
+                }
+
+                switch r.PathValue("decision") {
+                case "approve":
+                        err = requests.ApproveChange(id, principal(r))
+                case "reject":
+                        err = requests.RejectChange(id, principal(r), strings.TrimSpace(r.FormValue("comment")))
+                default:
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                switch {
+                case errors.Is(err, configman.ErrSelfReview):
+                        renderChangeRequests(store, w, r, http.StatusForbidden, "you cannot review a change you proposed")
+                case errors.Is(err, configman.ErrNotPending):
+                        renderChangeRequests(store, w, r, http.StatusConflict, "change has already been reviewed")
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                default:
+                        renderChangeRequests(store, w, r, http.StatusOK, "")
+                }
+        }
+}
+
+// renderChangeRequests renders the change-requests template for the
+// config in the request path.
+func renderChangeRequests(store configman.Store, w http.ResponseWriter, r *http.Request, status int, msg string) {
+        var err error
+
+        requests, ok := configman.Extension[configman.ChangeRequestStore](store)
+
+        if !ok {
+                w.WriteHeader(http.StatusNotImplemented)
+                return
+        }
+
+        page := changeRequestsPage{Config: r.PathValue("name"), Error: msg}
+
+        if page.Protected, err = requests.Protected(page.Config); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        if page.Requests, err = requests.GetChangeRequests(page.Config); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        names := make([]string, len(page.Requests))
+
+        for i, request := range page.Requests {
+                names[i] = request.Setting
+        }
+
+        auditSecretReads(store, r, page.Config, names...)
+
+        w.WriteHeader(status)
+
+        if err = indexTmpl.ExecuteTemplate(w, "change-requests", page); err != nil {
+                logError(r, err)
+        }
+}
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// errNoClone is returned when a config is cloned or renamed but the
+// store cannot do either.
+var errNoClone = errors.New("server: the store does not support cloning and renaming configs")
+
+// apiCloneInput is the body of a request that clones or renames a
+// config. Reset only applies to clones, see configman.CloneOptions.
+type apiCloneInput struct {
+        Name  string `json:"name"`
+        Reset bool   `json:"reset"`
+}
+
+// cloneOrRename clones the config in the path of r to name, or renames
+// it to name if rename is set. Creating a config needs the admin role on
+// its name; the role needed on the config in the path is checked by the
+// handler.
+func cloneOrRename(store configman.Store, r *http.Request, name string, reset, rename bool) (configman.Config, error) {
+        clones, ok := configman.Extension[configman.CloneStore](store)
+
+        if !ok {
+                return nil, errNoClone
+        }
+
+        if ok, err := allowed(store, r, name, configman.RoleAdmin); err != nil || !ok {
+                if err == nil {
+                        err = configman.ErrForbidden
+                }
+
+                return nil, err
+        }
+
+        if rename {
+                return clones.RenameConfig(r.PathValue("name"), name, principal(r))
+        }
+
+        return clones.CloneConfig(r.PathValue("name"), name, configman.CloneOptions{Reset: reset}, principal(r))
+}
+
+// registerCloneAPI registers the handlers used to clone and rename
+// configs. Cloning needs the viewer role on the config and renaming the
+// admin role.
+func registerCloneAPI(mux *http.ServeMux, store configman.Store) {
+        mux.HandleFunc("POST /api/v1/configs/{name}/clone", authorize(store, configman.RoleViewer, postCloneAPI(store, false)))
+        mux.HandleFunc("POST /api/v1/configs/{name}/rename", authorize(store, configman.RoleAdmin, postCloneAPI(store, true)))
+        mux.HandleFunc("POST /configs/{name}/clone", authorize(store, configman.RoleViewer, postClone(store, false)))
+        mux.HandleFunc("POST /configs/{name}/rename", authorize(store, configman.RoleAdmin, postClone(store, true)))
+}
+
+// postCloneAPI returns the API handler that clones the config in the
+// path, or renames it if rename is set.
+func postCloneAPI(store configman.Store, rename bool) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var input apiCloneInput
+                var config configman.Config
+
+                store := requestStore(store, r)
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if input.Name = strings.TrimSpace(input.Name); input.Name == "" {
+                        writeApiErrorCode(w, r, http.StatusUnprocessableEntity, "invalid_name", "name is required")
+                        return
+                }
+
+                config, err = cloneOrRename(store, r, input.Name, input.Reset, rename)
+
+                if errors.Is(err, configman.ErrExists) {
+                        writeApiErrorCode(w, r, http.StatusConflict, "already_exists", "config "+input.Name+" already exists")
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                status := http.StatusCreated
+
+                if rename {
+                        status = http.StatusOK
+                }
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                writeJSON(w, r, status, newApiConfig(config))
+        }
+}
+
+// postClone returns the UI handler that clones the config in the path,
+// or renames it if rename is set, and lists the configs again.
+func postClone(store configman.Store, rename bool) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var message string
+                var configs map[string]any
+
+                store := requestStore(store, r)
+
+                name := strings.TrimSpace(r.FormValue("name"))
+                status := http.StatusCreated
+
+                if rename {
+                        status = http.StatusOK
+                }
+
+                if name == "" {
+                        status, message = http.StatusUnprocessableEntity, "name is required"
+                } else {
+                        _, err = cloneOrRename(store, r, name, r.FormValue("reset") != "", rename)
+                }
+
+                switch {
+                case errors.Is(err, configman.ErrForbidden):
+                        status, message = http.StatusForbidden, "you need the admin role on "+name
+                case errors.Is(err, configman.ErrExists):
+                        status, message = http.StatusConflict, "config "+name+" already exists"
+                case errors.Is(err, configman.ErrNotFound):
+                        status, message = http.StatusNotFound, "the config or the namespace of "+name+" does not exist"
+                case errors.Is(err, configman.ErrProtectedConfig):
+                        status, message = http.StatusForbidden, "protected configs cannot be renamed"
+                case errors.Is(err, errNoClone):
+                        status, message = http.StatusNotImplemented, "the store does not support cloning and renaming configs"
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if message != "" {
+                        w.WriteHeader(status)
+
+                        if err = indexTmpl.ExecuteTemplate(w, "configs-error", message); err != nil {
+                                logError(r, err)
+                        }
+
+                        return
+                }
+
+                // the open config page still has the old name
+                if rename {
+                        w.Header().Set("HX-Refresh", "true")
+                }
+
+                if configs, err = configsPage(store, r, nil, configman.PageRequest{}); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(status)
+
+                if err = indexTmpl.ExecuteTemplate(w, "configs", configs); err != nil {
+                        logError(r, err)
+                }
+        }
+}
@@ -0,0 +1,358 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// errInvalidRef is returned when a ref is not CONFIG or CONFIG@SNAPSHOT.
+var errInvalidRef = errors.New("server: refs must be CONFIG or CONFIG@SNAPSHOT")
+
+// apiSettingDiff is the JSON representation of a setting that differs
+// between two refs. From is left out if the setting was added and to if
+// it was removed.
+type apiSettingDiff struct {
+        Setting string               `json:"setting"`
+        Kind    configman.ChangeKind `json:"kind"`
+        From    *apiSetting          `json:"from,omitempty"`
+        To      *apiSetting          `json:"to,omitempty"`
+}
+
+// apiDiff is the JSON representation of a diff.
+type apiDiff struct {
+        From    string           `json:"from"`
+        To      string           `json:"to"`
+        Changes []apiSettingDiff `json:"changes"`
+}
+
+// apiMergeConflict is the JSON representation of a merge conflict. A
+// side is left out if the setting does not exist on it.
+type apiMergeConflict struct {
+        Setting string      `json:"setting"`
+        Base    *apiSetting `json:"base,omitempty"`
+        Ours    *apiSetting `json:"ours,omitempty"`
+        Theirs  *apiSetting `json:"theirs,omitempty"`
+}
+
+// apiMerge is the JSON representation of a merge, and the body of a
+// request that merges. Revision is the revision of history the merge was
+// applied at, if it was.
+type apiMerge struct {
+        Base      string             `json:"base"`
+        Theirs    string             `json:"theirs"`
+        Into      string             `json:"into"`
+        Apply     bool               `json:"apply,omitempty"`
+        Ops       []apiOp            `json:"ops"`
+        Conflicts []apiMergeConflict `json:"conflicts"`
+        Applied   bool               `json:"applied"`
+        Revision  int64              `json:"revision,omitempty"`
+}
+
+func newApiDiff(diff *configman.Diff) *apiDiff {
+        body := &apiDiff{
+                From:    diff.From.String(),
+                To:      diff.To.String(),
+                Changes: make([]apiSettingDiff, len(diff.Changes)),
+        }
+
+        for i, change := range diff.Changes {
+                body.Changes[i] = apiSettingDiff{
+                        Setting: change.Setting,
+                        Kind:    change.Kind,
+                        From:    optionalApiSetting(change.From),
+                        To:      optionalApiSetting(change.To),
+                }
+        }
+
+        return body
+}
+
+func newApiMerge(merge *configman.Merge) *apiMerge {
+        body := &apiMerge{
+                Base:      merge.Base.String(),
+                Theirs:    merge.Theirs.String(),
+                Into:      merge.Into,
+                Ops:       make([]apiOp, len(merge.Batch.Ops)),
+                Conflicts: make([]apiMergeConflict, len(merge.Conflicts)),
+        }
+
+        for i, op := range merge.Batch.Ops {
+                body.Ops[i] = apiOp{
+                        Kind:             op.Kind,
+                        Config:           op.Config,
+                        Setting:          op.Setting,
+                        Type:             configman.TypeOf(op.Value),
+                        Value:            op.Value,
+                        Description:      op.Description,
+                        ExpectedRevision: op.ExpectedRevision,
+                }
+        }
+
+        for i, conflict := range merge.Conflicts {
+                body.Conflicts[i] = apiMergeConflict{
+                        Setting: conflict.Setting,
+                        Base:    optionalApiSetting(conflict.Base),
+                        Ours:    optionalApiSetting(conflict.Ours),
+                        Theirs:  optionalApiSetting(conflict.Theirs),
+                }
+        }
+
+        return body
+}
+
+// optionalApiSetting returns the JSON representation of setting, or nil
+// if setting is nil.
+func optionalApiSetting(setting *configman.Setting) *apiSetting {
+        if setting == nil {
+                return nil
+        }
+
+        return newApiSetting(setting)
+}
+
+// viewRefs returns configman.ErrForbidden unless the principal of r can
+// view the configs of refs, and errNoSnapshots if a ref names a snapshot
+// but the store cannot read past revisions.
+func viewRefs(store configman.Store, r *http.Request, refs ...configman.Ref) error {
+        for _, ref := range refs {
+                if _, ok := configman.Extension[configman.SnapshotStore](store); ref.Snapshot != "" && !ok {
+                        return errNoSnapshots
+                }
+
+                ok, err := allowed(store, r, ref.Config, configman.RoleViewer)
+
+                if err != nil {
+                        return err
+                }
+
+                if !ok {
+                        return configman.ErrForbidden
+                }
+        }
+
+        return nil
+}
+
+// writeText writes s as the plain text response with the given status.
+func writeText(w http.ResponseWriter, r *http.Request, status int, s string) {
+        w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+        w.WriteHeader(status)
+
+        if _, err := w.Write([]byte(s)); err != nil {
+                logError(r, err)
+        }
+}
+
+// auditDiffReads calls auditSecretReads with the settings diff shows the
+// values of, in both configs.
+func auditDiffReads(store configman.Store, r *http.Request, diff *configman.Diff) {
+        var reads settingReads
+
+        for _, change := range diff.Changes {
+                if change.From != nil {
+                        reads.add(diff.From.Config, change.Setting)
+                }
+
+                if change.To != nil {
+                        reads.add(diff.To.Config, change.Setting)
+                }
+        }
+
+        reads.audit(store, r)
+}
+
+// auditMergeReads calls auditSecretReads with the settings merge shows
+// the values of, those it changes and those in conflict, in every config
+// merged.
+func auditMergeReads(store configman.Store, r *http.Request, merge *configman.Merge) {
+        var reads settingReads
+
+        for _, config := range []string{merge.Base.Config, merge.Theirs.Config, merge.Into} {
+                for _, op := range merge.Batch.Ops {
+                        reads.add(config, op.Setting)
+                }
+
+                for _, conflict := range merge.Conflicts {
+                        reads.add(config, conflict.Setting)
+                }
+        }
+
+        reads.audit(store, r)
+}
+
+// registerDiffAPI registers the handlers used to compare configs, or a
+// config and a snapshot, and to merge the changes made to one config
+// into another. Comparing needs the viewer role on both configs; merging
+// also needs the editor role on the config merged into.
+func registerDiffAPI(mux *http.ServeMux, store configman.Store) {
+        mux.HandleFunc("GET /api/v1/diff", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var diff *configman.Diff
+
+                store := requestStore(store, r)
+
+                from, to := configman.ParseRef(r.FormValue("from")), configman.ParseRef(r.FormValue("to"))
+
+                if from.Config == "" || to.Config == "" {
+                        err = errInvalidRef
+                }
+
+                if err == nil {
+                        err = viewRefs(store, r, from, to)
+                }
+
+                if err == nil {
+                        diff, err = configman.NewDiff(store, from, to)
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                auditDiffReads(store, r, diff)
+
+                if r.FormValue("format") == "text" {
+                        writeText(w, r, http.StatusOK, diff.String())
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, newApiDiff(diff))
+        })
+
+        // The merge is only applied if apply is set; otherwise it is
+        // returned so that it can be reviewed first.
+        mux.HandleFunc("POST /api/v1/merge", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var ok bool
+                var input apiMerge
+                var merge *configman.Merge
+                var event *configman.ChangeEvent
+
+                store := requestStore(store, r)
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                base, theirs := configman.ParseRef(input.Base), configman.ParseRef(input.Theirs)
+
+                if base.Config == "" || theirs.Config == "" || input.Into == "" {
+                        err = errInvalidRef
+                }
+
+                if err == nil {
+                        err = viewRefs(store, r, base, theirs)
+                }
+
+                if err == nil {
+                        ok, err = allowed(store, r, input.Into, configman.RoleEditor)
+                }
+
+                if err == nil && !ok {
+                        err = configman.ErrForbidden
+                }
+
+                if err == nil {
+                        merge, err = configman.NewMerge(store, base, theirs, input.Into)
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if input.Apply && len(merge.Conflicts) > 0 {
+                        names := make([]string, len(merge.Conflicts))
+
+                        for i, conflict := range merge.Conflicts {
+                                names[i] = conflict.Setting
+                        }
+
+                        writeApiErrorCode(w, r, http.StatusConflict, "merge_conflict", "both sides changed "+strings.Join(names, ", ")+", merge without applying to see how")
+                        return
+                }
+
+                auditMergeReads(store, r, merge)
+
+                body := newApiMerge(merge)
+
+                if input.Apply && len(merge.Batch.Ops) > 0 {
+                        if event, err = store.ApplyBatch(merge.Batch, principal(r)); err != nil {
+                                writeApiError(w, r, err)
+                                return
+                        }
+
+                        body.Applied, body.Revision = true, event.Revision
+                }
+
+                if r.FormValue("format") == "text" {
+                        writeText(w, r, http.StatusOK, merge.String())
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        mux.HandleFunc("GET /diff/", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var diff *configman.Diff
+
+                store := requestStore(store, r)
+
+                from, to := configman.ParseRef(r.FormValue("from")), configman.ParseRef(r.FormValue("to"))
+                data := map[string]any{"From": from, "To": to}
+                status := http.StatusOK
+
+                if from.Config == "" || to.Config == "" {
+                        err = errInvalidRef
+                }
+
+                if err == nil {
+                        err = viewRefs(store, r, from, to)
+                }
+
+                if err == nil {
+                        diff, err = configman.NewDiff(store, from, to)
+                }
+
+                switch {
+                case errors.Is(err, errInvalidRef):
+                        status = http.StatusUnprocessableEntity
+                        data["Error"] = "compare with CONFIG or CONFIG@SNAPSHOT"
+                case errors.Is(err, configman.ErrForbidden):
+                        status = http.StatusForbidden
+                        data["Error"] = "you need the viewer role on both configs"
+                case errors.Is(err, configman.ErrNotFound):
+                        status = http.StatusNotFound
+                        data["Error"] = "the config or snapshot does not exist"
+                case errors.Is(err, configman.ErrNotInSnapshot):
+                        status = http.StatusNotFound
+                        data["Error"] = "the snapshot does not include the config"
+                case errors.Is(err, errNoSnapshots):
+                        status = http.StatusNotImplemented
+                        data["Error"] = "the store does not support snapshots"
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if diff != nil {
+                        auditDiffReads(store, r, diff)
+                }
+
+                data["Diff"] = diff
+
+                w.WriteHeader(status)
+
+                if err = indexTmpl.ExecuteTemplate(w, "diff", data); err != nil {
+                        logError(r, err)
+                }
+        })
+}
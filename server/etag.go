@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// etag returns the entity tag of a config or setting at the given
+// revision.
+func etag(revision int64) string {
+        return strconv.Quote(strconv.FormatInt(revision, 10))
+}
+
+// ifMatch returns the revision in the If-Match header of r. Zero is
+// returned if the header is missing or is "*", which means the write
+// should happen whatever the current revision is, so a tag of zero, which
+// no ETag has, is invalid rather than taken to match any revision.
+func ifMatch(r *http.Request) (int64, error) {
+        var revision int64
+
+        tag := strings.TrimSpace(r.Header.Get("If-Match"))
+
+        if tag == "" || tag == "*" {
+                return 0, nil
+        }
+
+        tag, err := strconv.Unquote(strings.TrimPrefix(tag, "W/"))
+
+        if err != nil {
+                return 0, err
+        }
+
+        if revision, err = strconv.ParseInt(tag, 10, 64); err != nil {
+                return 0, err
+        }
+
+        if revision < 1 {
+                return 0, fmt.Errorf("server: no ETag has revision %d", revision)
+        }
+
+        return revision, nil
+}
+
+// writeNotFound writes the error response for a config or setting that
+// does not exist. Any If-Match header fails to match it, as a write with
+// one is only meant to change what the client has seen.
+func writeNotFound(w http.ResponseWriter, r *http.Request) {
+        if r.Header.Get("If-Match") != "" {
+                writeApiErrorCode(w, r, http.StatusPreconditionFailed, "precondition_failed", "If-Match was given but it does not exist")
+                return
+        }
+
+        writeApiError(w, r, configman.ErrNotFound)
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestIfMatch(t *testing.T) {
+        tests := []struct {
+                name    string
+                method  string
+                target  string
+                body    string
+                ifMatch string
+                status  int
+        }{
+                {name: "update at its revision", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, ifMatch: `"1"`, status: http.StatusOK},
+                {name: "update at a weak tag", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, ifMatch: `W/"1"`, status: http.StatusOK},
+                {name: "update at any revision", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, ifMatch: "*", status: http.StatusOK},
+                {name: "update without If-Match", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, status: http.StatusOK},
+                {name: "update at a stale revision", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+                {name: "update at an invalid tag", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, ifMatch: "1", status: http.StatusBadRequest},
+                {name: "create with If-Match", method: http.MethodPut, target: "/api/v1/configs/app/settings/retries", body: `{"type":"int64","value":3}`, ifMatch: `"1"`, status: http.StatusPreconditionFailed},
+                {name: "create without If-Match", method: http.MethodPut, target: "/api/v1/configs/app/settings/retries", body: `{"type":"int64","value":3}`, status: http.StatusCreated},
+                {name: "delete at its revision", method: http.MethodDelete, target: "/api/v1/configs/app/settings/timeout", ifMatch: `"1"`, status: http.StatusNoContent},
+                {name: "delete at a stale revision", method: http.MethodDelete, target: "/api/v1/configs/app/settings/timeout", ifMatch: `"2"`, status: http.StatusPreconditionFailed},
+                {name: "delete a missing setting", method: http.MethodDelete, target: "/api/v1/configs/app/settings/retries", ifMatch: `"1"`, status: http.StatusPreconditionFailed},
+                {name: "update at revision zero", method: http.MethodPut, target: "/api/v1/configs/app/settings/timeout", body: `{"value":60}`, ifMatch: `"0"`, status: http.StatusBadRequest},
+                {name: "describe at a stale revision", method: http.MethodPatch, target: "/api/v1/configs/app", body: `{"description":"changed"}`, ifMatch: `"9"`, status: http.StatusPreconditionFailed},
+                {name: "describe a missing config", method: http.MethodPatch, target: "/api/v1/configs/web", body: `{"description":"changed"}`, ifMatch: `"1"`, status: http.StatusPreconditionFailed},
+                {name: "deprecate at a stale revision", method: http.MethodPost, target: "/api/v1/configs/app/deprecation", body: `{"reason":"unused"}`, ifMatch: `"9"`, status: http.StatusPreconditionFailed},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+
+                        if _, err := store.CreateConfig("app", ""); err != nil {
+                                t.Fatalf("failed to create config: %v", err)
+                        }
+
+                        if _, err := store.ApplyBatch(new(configman.Batch).Create("app", "timeout", "", int64(30)), "root"); err != nil {
+                                t.Fatalf("failed to create setting: %v", err)
+                        }
+
+                        handler := newTestServer(t, store, Options{})
+                        r := newTestRequest("root", test.method, test.target, test.body)
+
+                        if test.ifMatch != "" {
+                                r.Header.Set("If-Match", test.ifMatch)
+                        }
+
+                        w := httptest.NewRecorder()
+                        handler.ServeHTTP(w, r)
+
+                        if w.Code != test.status {
+                                t.Fatalf("got status %d, want %d: %s", w.Code, test.status, w.Body)
+                        }
+
+                        if w.Code != http.StatusOK || test.method != http.MethodPut {
+                                return
+                        }
+
+                        if tag := w.Header().Get("ETag"); tag != strconv.Quote("2") {
+                                t.Errorf("got ETag %s after the update, want %q", tag, "2")
+                        }
+                })
+        }
+}
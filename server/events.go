@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// replayLimit is the number of revisions a reconnecting event stream can
+// have missed and still be resumed.
+const replayLimit = 100
+
+// keepAliveInterval is how often idle event streams are sent a comment,
+// so that proxies do not close them.
+const keepAliveInterval = 30 * time.Second
+
+// getEvents streams the changes to the settings of a config as
+// server-sent events. Every change is sent as a "change" event whose
+// data is the change event as returned by the JSON API and whose id is
+// its revision. A client that reconnects with the Last-Event-ID header
+// is first sent the changes it missed; if there are too many it is sent
+// a "reset" event instead and should reload the config. The stream ends
+// when shutdown is closed, and the client reconnects to another server.
+func getEvents(store configman.Store, shutdown <-chan struct{}) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var config configman.Config
+                var missed []configman.ChangeEvent
+
+                store := requestStore(store, r)
+
+                watcher, ok := configman.Extension[configman.Watcher](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                flusher, ok := w.(http.Flusher)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                name := r.PathValue("name")
+
+                if config, err = store.GetConfig(name); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if config == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                // watch before reading history so that no change falls
+                // in between
+                events := watcher.Watch(r.Context())
+
+                lastID, _ := strconv.ParseInt(r.Header.Get("Last-Event-ID"), 10, 64)
+                sent, reset := lastID, false
+
+                if history, ok := configman.Extension[configman.HistoryStore](store); ok {
+                        if missed, err = history.GetHistory(name, replayLimit); err != nil {
+                                logError(r, err)
+                                w.WriteHeader(http.StatusInternalServerError)
+                                return
+                        }
+
+                        if len(missed) > 0 {
+                                sent = max(sent, missed[0].Revision)
+                        }
+
+                        // without Last-Event-ID the stream starts now
+                        if lastID == 0 {
+                                missed = nil
+                        }
+
+                        if len(missed) == replayLimit && missed[len(missed)-1].Revision > lastID {
+                                missed, reset = nil, true
+                        }
+                }
+
+                w.Header().Set("Content-Type", "text/event-stream")
+                w.Header().Set("Cache-Control", "no-cache")
+                w.WriteHeader(http.StatusOK)
+
+                // tell the client where the stream starts in case it
+                // reconnects before the first change
+                fmt.Fprintf(w, "id: %d\n\n", sent)
+
+                if reset {
+                        fmt.Fprintf(w, "event: reset\ndata: {}\n\n")
+                }
+
+                auditEventReads(store, r, missed...)
+
+                for i := len(missed) - 1; i >= 0; i-- {
+                        if missed[i].Revision > lastID {
+                                writeChangeEvent(w, r, &missed[i])
+                        }
+                }
+
+                flusher.Flush()
+
+                keepAlive := time.NewTicker(keepAliveInterval)
+                defer keepAlive.Stop()
+
+                for {
+                        select {
+                        case <-r.Context().Done():
+                                return
+                        case <-shutdown:
+                                return
+                        case <-keepAlive.C:
+                                fmt.Fprintf(w, ": keep-alive\n\n")
+                        case event, ok := <-events:
+                                // the stream fell behind, the client
+                                // reconnects and is sent what it missed
+                                if !ok {
+                                        return
+                                }
+
+                                event = onlyConfig(event, name)
+
+                                if event.Revision <= sent || len(event.Ops) == 0 {
+                                        continue
+                                }
+
+                                auditEventReads(store, r, event)
+                                writeChangeEvent(w, r, &event)
+                                sent = event.Revision
+                        }
+
+                        flusher.Flush()
+                }
+        }
+}
+
+// writeChangeEvent writes event as a "change" server-sent event.
+func writeChangeEvent(w http.ResponseWriter, r *http.Request, event *configman.ChangeEvent) {
+        data, err := json.Marshal(newApiChangeEvent(event))
+
+        if err != nil {
+                logError(r, err)
+                return
+        }
+
+        fmt.Fprintf(w, "id: %d\nevent: change\ndata: %s\n\n", event.Revision, data)
+}
+
+// onlyConfig returns event with only the operations on config, or that
+// renamed it.
+func onlyConfig(event configman.ChangeEvent, config string) configman.ChangeEvent {
+        ops := make([]configman.BatchOp, 0, len(event.Ops))
+
+        for _, op := range event.Ops {
+                if op.Config == config || op.Kind == configman.OpRename && op.Description == config {
+                        ops = append(ops, op)
+                }
+        }
+
+        event.Ops = ops
+
+        return event
+}
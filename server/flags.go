@@ -0,0 +1,259 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// flagRulesPage is the data used to render the flag-rules template.
+type flagRulesPage struct {
+        Config  string
+        Setting *configman.Setting
+        Rules   []configman.Rule
+        Error   string
+}
+
+// flagRuleRow is the data used to render one rule of the rule editor.
+type flagRuleRow struct {
+        Index int
+        Rule  configman.Rule
+}
+
+// Rows returns the rules of the page along with their index in the
+// rule editor.
+func (page flagRulesPage) Rows() []flagRuleRow {
+        rows := make([]flagRuleRow, len(page.Rules))
+
+        for i, rule := range page.Rules {
+                rows[i] = flagRuleRow{i, rule}
+        }
+
+        return rows
+}
+
+// getFlagRules renders the rule editor of a feature flag setting.
+func getFlagRules(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var page flagRulesPage
+
+                store := requestStore(store, r)
+
+                flags, ok := configman.Extension[configman.FlagStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                page.Config = r.PathValue("name")
+
+                if page.Setting, err = store.GetSetting(page.Config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if page.Setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if page.Rules, err = flags.GetFlagRules(page.Config, page.Setting.Name()); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "flag-rules", page); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// putFlagRules replaces the rules of a feature flag setting with the
+// rules submitted by the rule editor.
+func putFlagRules(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var page flagRulesPage
+
+                store := requestStore(store, r)
+
+                flags, ok := configman.Extension[configman.FlagStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                page.Config = r.PathValue("name")
+
+                if page.Setting, err = store.GetSetting(page.Config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if page.Setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                status := http.StatusOK
+                page.Rules, err = parseFlagRules(r)
+
+                if err == nil {
+                        err = flags.SetFlagRules(page.Config, page.Setting.Name(), page.Rules)
+                }
+
+                if errors.Is(err, configman.ErrProtectedConfig) {
+                        status = http.StatusForbidden
+                        page.Error = "config is protected, rules cannot be changed directly"
+                } else if err != nil {
+                        logError(r, err)
+                        status = http.StatusUnprocessableEntity
+                        page.Error = err.Error()
+                }
+
+                w.WriteHeader(status)
+
+                if err = indexTmpl.ExecuteTemplate(w, "flag-rules", page); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// newFlagRule renders an empty rule for the rule editor. The index query
+// parameter is the position of the rule in the editor.
+func newFlagRule(w http.ResponseWriter, r *http.Request) {
+        index, err := strconv.Atoi(r.FormValue("index"))
+
+        if err != nil || index < 0 {
+                w.WriteHeader(http.StatusBadRequest)
+                return
+        }
+
+        w.WriteHeader(http.StatusOK)
+
+        row := flagRuleRow{index, configman.Rule{Operator: configman.OpIn, Value: true}}
+
+        if err = indexTmpl.ExecuteTemplate(w, "flag-rule", row); err != nil {
+                logError(r, err)
+        }
+}
+
+// evaluateFlag evaluates a feature flag setting for the evaluation
+// context given in the query string and renders the result.
+func evaluateFlag(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var rules []configman.Rule
+                var setting *configman.Setting
+                var evaluation configman.Evaluation
+
+                store := requestStore(store, r)
+
+                flags, ok := configman.Extension[configman.FlagStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                config := r.PathValue("name")
+
+                if setting, err = store.GetSetting(config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if rules, err = flags.GetFlagRules(config, setting.Name()); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                ctx := configman.EvalContext{
+                        UserID: r.FormValue(configman.AttrUserID),
+                        Tenant: r.FormValue(configman.AttrTenant),
+                        Region: r.FormValue(configman.AttrRegion),
+                }
+
+                if evaluation, err = configman.Evaluate(setting, rules, ctx); err != nil {
+                        w.WriteHeader(http.StatusUnprocessableEntity)
+                        return
+                }
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "flag-evaluation", evaluation); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// parseFlagRules reads the rules submitted by the rule editor. The
+// fields of the i-th rule are named rules.<i>.<field>. Rules whose
+// remove field is set are left out.
+func parseFlagRules(r *http.Request) ([]configman.Rule, error) {
+        if err := r.ParseForm(); err != nil {
+                return nil, err
+        }
+
+        rules := make([]configman.Rule, 0)
+
+        for i := 0; ; i++ {
+                field := func(name string) string {
+                        return strings.TrimSpace(r.PostForm.Get(fmt.Sprintf("rules.%d.%s", i, name)))
+                }
+
+                if !r.PostForm.Has(fmt.Sprintf("rules.%d.percentage", i)) {
+                        break
+                }
+
+                if field("remove") != "" {
+                        continue
+                }
+
+                percentage, err := strconv.ParseUint(field("percentage"), 10, 8)
+
+                if err != nil {
+                        return nil, fmt.Errorf("rule %d: percentage must be a number between 0 and 100", i+1)
+                }
+
+                rollout := uint8(percentage)
+
+                rule := configman.Rule{
+                        Attribute:  field("attribute"),
+                        Operator:   configman.Operator(field("operator")),
+                        Values:     make([]string, 0),
+                        Percentage: &rollout,
+                        BucketBy:   field("bucket_by"),
+                        Value:      field("value") == "true",
+                }
+
+                for _, v := range strings.Split(field("values"), ",") {
+                        if v = strings.TrimSpace(v); v != "" {
+                                rule.Values = append(rule.Values, v)
+                        }
+                }
+
+                rules = append(rules, rule)
+        }
+
+        return rules, nil
+}
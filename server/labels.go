@@ -0,0 +1,200 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/vlence/configman"
+)
+
+// errNoLabels is returned when configs or settings are queried by
+// label but the store does not support labels.
+var errNoLabels = errors.New("server: the store does not support labels")
+
+// parseQuery reads a query from the selector, prefix and deprecated
+// parameters of r. It returns nil if none of them is given.
+func parseQuery(r *http.Request) (*configman.Query, error) {
+        var err error
+
+        params := r.URL.Query()
+
+        if !params.Has("selector") && !params.Has("prefix") && params.Get("deprecated") == "" {
+                return nil, nil
+        }
+
+        query := &configman.Query{Prefix: params.Get("prefix")}
+
+        if query.Selector, err = configman.ParseSelector(params.Get("selector")); err != nil {
+                return nil, err
+        }
+
+        if s := params.Get("deprecated"); s != "" {
+                deprecated, err := strconv.ParseBool(s)
+
+                if err != nil {
+                        return nil, fmt.Errorf("%w: deprecated must be true or false", configman.ErrInvalidSelector)
+                }
+
+                query.Deprecated = &deprecated
+        }
+
+        return query, nil
+}
+
+// queryConfigs returns the configs matching query, or every config if
+// query is nil.
+func queryConfigs(store configman.Store, query *configman.Query) ([]configman.Config, error) {
+        if query == nil {
+                return store.GetConfigs()
+        }
+
+        labels, ok := configman.Extension[configman.LabelStore](store)
+
+        if !ok {
+                return nil, errNoLabels
+        }
+
+        return labels.QueryConfigs(*query)
+}
+
+// querySettings returns the settings of config matching query, or every
+// setting of config if query is nil.
+func querySettings(store configman.Store, config string, query *configman.Query) ([]*configman.Setting, error) {
+        if query == nil {
+                return store.GetSettings(config)
+        }
+
+        labels, ok := configman.Extension[configman.LabelStore](store)
+
+        if !ok {
+                return nil, errNoLabels
+        }
+
+        return labels.QuerySettings(config, *query)
+}
+
+// registerLabelAPI registers the handlers used to read and replace the
+// labels of configs and settings.
+func registerLabelAPI(mux *http.ServeMux, store configman.Store) {
+        labels, ok := configman.Extension[configman.LabelStore](store)
+
+        if !ok {
+                return
+        }
+
+        mux.HandleFunc("GET /api/v1/configs/{name}/labels", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var config configman.Config
+                var found configman.Labels
+
+                store := requestStore(store, r)
+
+                if config, err = store.GetConfig(r.PathValue("name")); err == nil && config == nil {
+                        err = configman.ErrNotFound
+                }
+
+                if err == nil {
+                        found, err = labels.GetConfigLabels(r.PathValue("name"))
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, found)
+        }))
+
+        mux.HandleFunc("PUT /api/v1/configs/{name}/labels", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var input configman.Labels
+
+                if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if err := labels.SetConfigLabels(r.PathValue("name"), input); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, input)
+        }))
+
+        mux.HandleFunc("GET /api/v1/configs/{name}/settings/{setting}/labels", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var setting *configman.Setting
+                var found configman.Labels
+
+                store := requestStore(store, r)
+
+                if setting, err = store.GetSetting(r.PathValue("name"), r.PathValue("setting")); err == nil && setting == nil {
+                        err = configman.ErrNotFound
+                }
+
+                if err == nil {
+                        found, err = labels.GetSettingLabels(r.PathValue("name"), r.PathValue("setting"))
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, found)
+        }))
+
+        mux.HandleFunc("PUT /api/v1/configs/{name}/settings/{setting}/labels", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var input configman.Labels
+
+                if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                if err := labels.SetSettingLabels(r.PathValue("name"), r.PathValue("setting"), input); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, input)
+        }))
+
+        mux.HandleFunc("PUT /configs/{name}/labels", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var input configman.Labels
+
+                name := r.PathValue("name")
+                status := http.StatusOK
+                data := map[string]any{"Name": name}
+
+                if input, err = configman.ParseLabels(r.FormValue("labels")); err == nil {
+                        err = labels.SetConfigLabels(name, input)
+                }
+
+                switch {
+                case errors.Is(err, configman.ErrInvalidLabel):
+                        status = http.StatusUnprocessableEntity
+                        data["Error"] = err.Error()
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if data["Labels"], err = labels.GetConfigLabels(name); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(status)
+
+                if err = indexTmpl.ExecuteTemplate(w, "config-labels", data); err != nil {
+                        logError(r, err)
+                }
+        }))
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/metrics"
+	"github.com/vlence/configman/tracing"
+	"github.com/vlence/gossert"
+)
+
+type customResponseWriter struct {
+        http.ResponseWriter
+        statusCode int
+}
+
+func (w *customResponseWriter) WriteHeader(statusCode int) {
+        w.statusCode = statusCode
+        w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *customResponseWriter) Flush() {
+        flusher, ok := w.ResponseWriter.(http.Flusher)
+
+        if ok {
+                flusher.Flush()
+        }
+}
+
+// loggerKey is the context key of the logger of a request.
+type loggerKey struct{}
+
+// logger gives every request an ID and a logger that includes it in
+// every record, see requestLogger, then logs how long the request took
+// and its status. The ID is taken from the X-Request-ID header if the
+// client sent a usable one and is sent back in the same header.
+func logger(base *slog.Logger, next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                id := requestID(r)
+                w.Header().Set("X-Request-ID", id)
+
+                logger := base.With("request_id", id)
+                r = r.WithContext(context.WithValue(r.Context(), loggerKey{}, logger))
+
+                start := time.Now()
+                ww := &customResponseWriter{w, -1}
+                next.ServeHTTP(ww, r)
+                gossert.Ok(ww.statusCode != -1, "logger: response status code is -1")
+                logger.Info("server: request", "method", r.Method, "path", r.URL.Path, "status", ww.statusCode, "duration", time.Since(start))
+        })
+}
+
+// requestID returns the X-Request-ID header of r if it is a short
+// printable string, otherwise a new random ID.
+func requestID(r *http.Request) string {
+        id := r.Header.Get("X-Request-ID")
+
+        if id != "" && len(id) <= 64 && strings.IndexFunc(id, func(c rune) bool { return c <= ' ' || c > '~' }) == -1 {
+                return id
+        }
+
+        b := make([]byte, 8)
+        rand.Read(b)
+
+        return hex.EncodeToString(b)
+}
+
+// requestLogger returns the logger of r, which includes the request ID
+// as well as the principal, route, config and setting of r where known.
+func requestLogger(r *http.Request) *slog.Logger {
+        logger, ok := r.Context().Value(loggerKey{}).(*slog.Logger)
+
+        if !ok {
+                logger = slog.Default()
+        }
+
+        if p := principal(r); p != "" {
+                logger = logger.With("principal", p)
+        }
+
+        if r.Pattern != "" {
+                logger = logger.With("route", r.Pattern)
+        }
+
+        if config := r.PathValue("name"); config != "" {
+                logger = logger.With("config", config)
+        }
+
+        if setting := r.PathValue("setting"); setting != "" {
+                logger = logger.With("setting", setting)
+        }
+
+        return logger
+}
+
+// logError logs err, which made the request r fail.
+func logError(r *http.Request, err error) {
+        requestLogger(r).Error("server: request failed", "err", err)
+}
+
+// measure counts the requests handled by next and records how long they
+// took in reg, by method, route and status. Routes are the patterns of
+// mux the requests match.
+func measure(reg *metrics.Registry, mux *http.ServeMux, next http.Handler) http.Handler {
+        requests := reg.Counter("configman_http_requests_total", "HTTP requests handled.", "method", "route", "status")
+        durations := reg.Histogram("configman_http_request_duration_seconds", "How long HTTP requests took.", nil, "method", "route")
+
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                _, route := mux.Handler(r)
+
+                if route == "" {
+                        route = "unmatched"
+                }
+
+                start := time.Now()
+                ww := &customResponseWriter{w, http.StatusOK}
+                next.ServeHTTP(ww, r)
+
+                requests.Inc(r.Method, route, strconv.Itoa(ww.statusCode))
+                durations.Observe(time.Since(start).Seconds(), r.Method, route)
+        })
+}
+
+// trace starts a span for every request handled by next, named after
+// the pattern of mux the request matches. A span in the traceparent
+// header of the request becomes its parent; handlers find the span in
+// the context of the request.
+func trace(tracer tracing.Tracer, mux *http.ServeMux, next http.Handler) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                _, route := mux.Handler(r)
+
+                if route == "" {
+                        route = r.Method
+                }
+
+                ctx := r.Context()
+
+                if parent, ok := tracing.ParseTraceparent(r.Header.Get("traceparent")); ok {
+                        ctx = tracing.ContextWithRemoteParent(ctx, parent)
+                }
+
+                ctx, span := tracer.Start(ctx, route)
+                defer span.End()
+
+                span.SetAttributes("http.request.method", r.Method, "http.route", route, "url.path", r.URL.Path)
+
+                ww := &customResponseWriter{w, http.StatusOK}
+                next.ServeHTTP(ww, r.WithContext(ctx))
+
+                span.SetAttributes("http.response.status_code", ww.statusCode)
+        })
+}
+
+// requestStore returns store bound to the context of r if it is a
+// configman.Binder, like a traced.TracedStore, so that the spans of its
+// operations are children of the span of r. Handlers call it before
+// using the store they were made with.
+func requestStore(store configman.Store, r *http.Request) configman.Store {
+        return configman.Bind(r.Context(), store)
+}
+
+// publicPaths are the path prefixes that can be requested without
+// authenticating.
+var publicPaths = []string{"/login", "/styles/", "/scripts/", "/healthz", "/readyz", "/metrics"}
+
+// authenticate only lets requests through to next if one of auths knows
+// who made them. The principal can then be read with principal(r).
+// Unauthenticated API requests get a 401, browsers are sent to the login
+// page.
+func authenticate(next http.Handler, auths ...Authenticator) http.Handler {
+        return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                for _, prefix := range publicPaths {
+                        if strings.HasPrefix(r.URL.Path, prefix) {
+                                next.ServeHTTP(w, r)
+                                return
+                        }
+                }
+
+                for _, auth := range auths {
+                        if p, ok := auth.Authenticate(r); ok {
+                                next.ServeHTTP(w, withPrincipal(r, p))
+                                return
+                        }
+                }
+
+                if strings.HasPrefix(r.URL.Path, "/api/") {
+                        w.Header().Set("WWW-Authenticate", `Basic realm="configman", Bearer realm="configman"`)
+                        writeApiErrorCode(w, r, http.StatusUnauthorized, "unauthenticated", "send an API token or a user name and password")
+                        return
+                }
+
+                if r.Header.Get("HX-Request") == "true" {
+                        w.Header().Set("HX-Redirect", "/login")
+                        w.WriteHeader(http.StatusUnauthorized)
+                        return
+                }
+
+                http.Redirect(w, r, "/login", http.StatusSeeOther)
+        })
+}
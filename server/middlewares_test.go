@@ -0,0 +1,170 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vlence/configman"
+	sqlstore "github.com/vlence/configman/stores/sql"
+	"github.com/vlence/configman/stores/traced"
+	"github.com/vlence/configman/tracing"
+)
+
+// fakeStore only implements the operations the tests call.
+type fakeStore struct {
+        configman.Store
+}
+
+func (fakeStore) GetConfig(name string) (configman.Config, error) {
+        var config configman.Config
+        return config, nil
+}
+
+// tracedServer returns a handler that traces requests like New and
+// serves GET /configs/{name}/ with the store bound to each request.
+func tracedServer(exporter *tracing.InMemoryExporter) http.Handler {
+        tracer := tracing.NewTracer(exporter)
+        store := configman.Store(traced.NewTracedStore(fakeStore{}, tracer))
+        mux := http.NewServeMux()
+
+        mux.HandleFunc("GET /configs/{name}/", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                if _, err := store.GetConfig(r.PathValue("name")); err != nil {
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(http.StatusNotFound)
+        })
+
+        return trace(tracer, mux, mux)
+}
+
+// spanNamed returns the span named name among spans.
+func spanNamed(t *testing.T, spans []*tracing.SpanData, name string) *tracing.SpanData {
+        t.Helper()
+
+        for _, span := range spans {
+                if span.Name == name {
+                        return span
+                }
+        }
+
+        t.Fatalf("no span named %q", name)
+        return nil
+}
+
+func TestTraceStartsRequestSpan(t *testing.T) {
+        exporter := new(tracing.InMemoryExporter)
+        w := httptest.NewRecorder()
+
+        tracedServer(exporter).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/configs/app/", nil))
+
+        spans := exporter.Spans()
+
+        if len(spans) != 2 {
+                t.Fatalf("got %d spans, want 2", len(spans))
+        }
+
+        request := spanNamed(t, spans, "GET /configs/{name}/")
+
+        for key, want := range map[string]any{
+                "http.request.method":       http.MethodGet,
+                "http.route":                "GET /configs/{name}/",
+                "url.path":                  "/configs/app/",
+                "http.response.status_code": http.StatusNotFound,
+        } {
+                if got := request.Attributes[key]; got != want {
+                        t.Errorf("attribute %s is %v, want %v", key, got, want)
+                }
+        }
+
+        operation := spanNamed(t, spans, "configman.Store/GetConfig")
+
+        if operation.Parent != request.Context {
+                t.Errorf("store span has parent %s, want the request span %s", operation.Parent.Traceparent(), request.Context.Traceparent())
+        }
+
+        if got := operation.Attributes["configman.config"]; got != "app" {
+                t.Errorf("attribute configman.config is %v, want app", got)
+        }
+}
+
+func TestTraceContinuesTraceparent(t *testing.T) {
+        const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+        exporter := new(tracing.InMemoryExporter)
+        w := httptest.NewRecorder()
+        r := httptest.NewRequest(http.MethodGet, "/configs/app/", nil)
+        r.Header.Set("traceparent", traceparent)
+
+        tracedServer(exporter).ServeHTTP(w, r)
+
+        parent, _ := tracing.ParseTraceparent(traceparent)
+        request := spanNamed(t, exporter.Spans(), "GET /configs/{name}/")
+
+        if request.Parent != parent {
+                t.Errorf("request span has parent %s, want %s", request.Parent.Traceparent(), traceparent)
+        }
+
+        if request.Context.TraceID != parent.TraceID {
+                t.Error("request span is not in the trace of the traceparent header")
+        }
+}
+
+func TestTraceNamesUnmatchedRequestsAfterMethod(t *testing.T) {
+        exporter := new(tracing.InMemoryExporter)
+        w := httptest.NewRecorder()
+
+        tracedServer(exporter).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/nowhere", nil))
+
+        spans := exporter.Spans()
+
+        if len(spans) != 1 {
+                t.Fatalf("got %d spans, want 1", len(spans))
+        }
+
+        if spans[0].Name != http.MethodPost {
+                t.Errorf("span is named %q, want %q", spans[0].Name, http.MethodPost)
+        }
+
+        if got := spans[0].Attributes["http.response.status_code"]; got != http.StatusNotFound {
+                t.Errorf("attribute http.response.status_code is %v, want %d", got, http.StatusNotFound)
+        }
+}
+
+func TestTraceIncludesStatements(t *testing.T) {
+        exporter := new(tracing.InMemoryExporter)
+        tracer := tracing.NewTracer(exporter)
+        store := newTestStore(t, sqlstore.WithTracer(tracer))
+
+        if _, err := store.CreateConfig("app", ""); err != nil {
+                t.Fatalf("failed to create config: %v", err)
+        }
+
+        exporter.Reset()
+
+        w := httptest.NewRecorder()
+        newTestServer(t, traced.NewTracedStore(store, tracer), Options{Tracer: tracer}).ServeHTTP(w, newTestRequest("root", http.MethodGet, "/api/v1/configs/app", ""))
+
+        if w.Code != http.StatusOK {
+                t.Fatalf("got status %d: %s", w.Code, w.Body)
+        }
+
+        spans := exporter.Spans()
+        request := spanNamed(t, spans, "GET /api/v1/configs/{name}")
+        operation := spanNamed(t, spans, "sqlstore: get config")
+        statement := spanNamed(t, spans, "sqlstore: getConfig")
+
+        if operation.Parent.SpanID != spanNamed(t, spans, "configman.Store/GetConfig").Context.SpanID {
+                t.Errorf("sqlstore span has parent %s, want the span of the traced store", operation.Parent.Traceparent())
+        }
+
+        for _, span := range []*tracing.SpanData{operation, statement} {
+                if span.Context.TraceID != request.Context.TraceID {
+                        t.Errorf("span %q is not in the trace of the request", span.Name)
+                }
+        }
+}
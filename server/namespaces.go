@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// apiNamespace is the JSON representation of a namespace.
+type apiNamespace struct {
+        Name        string    `json:"name"`
+        Description string    `json:"description"`
+        CreatedAt   time.Time `json:"created_at"`
+}
+
+// visibleNamespaces returns the namespaces of the store the principal of
+// r has a role on, through a grant on the namespace or on every config.
+// Stores without namespaces have none.
+func visibleNamespaces(store configman.Store, r *http.Request) ([]configman.Namespace, error) {
+        namespaces, ok := configman.Extension[configman.NamespaceStore](store)
+
+        if !ok {
+                return nil, nil
+        }
+
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return nil, configman.ErrForbidden
+        }
+
+        grants, err := grantsOf(access, r)
+
+        if err != nil {
+                return nil, err
+        }
+
+        all, err := namespaces.GetNamespaces()
+
+        if err != nil {
+                return nil, err
+        }
+
+        visible := make([]configman.Namespace, 0, len(all))
+
+        for _, namespace := range all {
+                if configman.RoleOf(grants, configman.AllConfigsIn(namespace.Name)).Includes(configman.RoleViewer) {
+                        visible = append(visible, namespace)
+                }
+        }
+
+        return visible, nil
+}
+
+// registerNamespaceAPI registers the handlers used to manage namespaces.
+// Only admins of every config may create and delete them; roles on the
+// configs of a namespace are granted on configman.AllConfigsIn.
+func registerNamespaceAPI(mux *http.ServeMux, store configman.Store) {
+        namespaces, ok := configman.Extension[configman.NamespaceStore](store)
+
+        if !ok {
+                return
+        }
+
+        mux.HandleFunc("GET /api/v1/namespaces", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                visible, err := visibleNamespaces(store, r)
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]apiNamespace, len(visible))
+
+                for i, namespace := range visible {
+                        body[i] = apiNamespace(namespace)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        mux.HandleFunc("POST /api/v1/namespaces", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                var input apiNamespace
+
+                if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                namespace, err := namespaces.CreateNamespace(strings.TrimSpace(input.Name), input.Description)
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusCreated, apiNamespace(*namespace))
+        }))
+
+        mux.HandleFunc("DELETE /api/v1/namespaces/{namespace}", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                if err := namespaces.DeleteNamespace(r.PathValue("namespace")); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                w.WriteHeader(http.StatusNoContent)
+        }))
+}
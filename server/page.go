@@ -0,0 +1,188 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/vlence/configman"
+)
+
+// errNoPaging is returned when a page of configs or settings is asked
+// for but the store does not support pagination.
+var errNoPaging = errors.New("server: the store does not support pagination")
+
+// uiPageSize is the number of configs the UI lists before it offers to
+// load more.
+const uiPageSize = 50
+
+// parsePage reads a page request from the limit, cursor, sort, order and
+// total parameters of r. It returns nil if none of them is given.
+func parsePage(r *http.Request) (*configman.PageRequest, error) {
+        var err error
+
+        params := r.URL.Query()
+
+        if !params.Has("limit") && !params.Has("cursor") && !params.Has("sort") && !params.Has("order") && !params.Has("total") {
+                return nil, nil
+        }
+
+        page := &configman.PageRequest{Cursor: params.Get("cursor")}
+
+        if page.Sort, err = configman.ParseSortField(params.Get("sort")); err != nil {
+                return nil, err
+        }
+
+        switch params.Get("order") {
+        case "", "asc":
+        case "desc":
+                page.Descending = true
+        default:
+                return nil, configman.ErrInvalidPage
+        }
+
+        if s := params.Get("limit"); s != "" {
+                if page.Limit, err = strconv.Atoi(s); err != nil || page.Limit < 1 {
+                        return nil, configman.ErrInvalidPage
+                }
+        }
+
+        if s := params.Get("total"); s != "" {
+                if page.CountTotal, err = strconv.ParseBool(s); err != nil {
+                        return nil, configman.ErrInvalidPage
+                }
+        }
+
+        return page, nil
+}
+
+// pageConfigs returns a page of the configs in namespace, or in every
+// namespace if it is nil, matching query that the principal of r can
+// view. Configs the principal cannot view are dropped from the page
+// after it is read, so pages may be shorter than asked for, and the
+// total is only counted for principals that can view every config.
+func pageConfigs(store configman.Store, r *http.Request, query *configman.Query, namespace *string, page configman.PageRequest) (*configman.Page[configman.Config], error) {
+        var err error
+        var result *configman.Page[configman.Config]
+
+        paged, ok := configman.Extension[configman.PagedStore](store)
+
+        if !ok {
+                return nil, errNoPaging
+        }
+
+        if query == nil {
+                query = new(configman.Query)
+        }
+
+        query.Namespace = namespace
+
+        if page.CountTotal {
+                if page.CountTotal, err = viewsEveryConfig(store, r); err != nil {
+                        return nil, err
+                }
+        }
+
+        if result, err = paged.ListConfigs(*query, page); err != nil {
+                return nil, err
+        }
+
+        if result.Items, err = viewableConfigs(store, r, result.Items); err != nil {
+                return nil, err
+        }
+
+        return result, nil
+}
+
+// pageSettings returns a page of the settings of config matching query.
+func pageSettings(store configman.Store, config string, query *configman.Query, page configman.PageRequest) (*configman.Page[*configman.Setting], error) {
+        paged, ok := configman.Extension[configman.PagedStore](store)
+
+        if !ok {
+                return nil, errNoPaging
+        }
+
+        if query == nil {
+                query = new(configman.Query)
+        }
+
+        return paged.ListSettings(config, *query, page)
+}
+
+// viewsEveryConfig reports whether the principal of r can view every
+// config. Unlike allowed, a denial is not recorded.
+func viewsEveryConfig(store configman.Store, r *http.Request) (bool, error) {
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return false, nil
+        }
+
+        grants, err := grantsOf(access, r)
+
+        if err != nil {
+                return false, err
+        }
+
+        return configman.RoleOf(grants, "").Includes(configman.RoleViewer), nil
+}
+
+// writePageHeaders links the response to the next page of a listing, if
+// there is one, and sets the X-Total-Count header if the total was
+// counted. The link is the request URL with the next cursor.
+func writePageHeaders(w http.ResponseWriter, r *http.Request, next string, total int) {
+        if next != "" {
+                url := *r.URL
+                params := url.Query()
+                params.Set("cursor", next)
+                url.RawQuery = params.Encode()
+
+                w.Header().Set("Link", "<"+url.RequestURI()+`>; rel="next"`)
+        }
+
+        if total >= 0 {
+                w.Header().Set("X-Total-Count", strconv.Itoa(total))
+        }
+}
+
+// configsPage returns the data of the configs template: the first page
+// of the configs in the namespace of r matching query that the principal
+// can view, and the URL of the next page if there is one. Stores that
+// cannot list configs a page at a time have every config on one page.
+func configsPage(store configman.Store, r *http.Request, query *configman.Query, page configman.PageRequest) (map[string]any, error) {
+        var err error
+        var configs []configman.Config
+        var result *configman.Page[configman.Config]
+
+        data := make(map[string]any)
+        namespace := r.FormValue("namespace")
+
+        if _, ok := configman.Extension[configman.PagedStore](store); !ok {
+                if configs, err = queryConfigs(store, query); err == nil {
+                        configs, err = viewableConfigs(store, r, configs)
+                }
+
+                data["Configs"] = configman.ConfigsIn(configs, namespace)
+
+                return data, err
+        }
+
+        if page.Limit == 0 {
+                page.Limit = uiPageSize
+        }
+
+        if result, err = pageConfigs(store, r, query, &namespace, page); err != nil {
+                return nil, err
+        }
+
+        data["Configs"] = result.Items
+
+        if result.NextCursor != "" {
+                params := r.URL.Query()
+                params.Set("namespace", namespace)
+                params.Set("cursor", result.NextCursor)
+                data["More"] = "configs/?" + params.Encode()
+        }
+
+        return data, nil
+}
@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vlence/configman"
+)
+
+// errNoSettingsPicked is returned when a promotion is applied from the
+// UI without any setting picked.
+var errNoSettingsPicked = errors.New("server: pick the settings to promote")
+
+// apiPromotion is the JSON representation of a promotion plan, and the
+// body of a request that promotes. Revision is the revision of history
+// the promotion was applied at, if it was.
+type apiPromotion struct {
+        From         string           `json:"from"`
+        To           string           `json:"to"`
+        Settings     []string         `json:"settings,omitempty"`
+        Selector     string           `json:"selector,omitempty"`
+        SkipSecrets  bool             `json:"skip_secrets,omitempty"`
+        Apply        bool             `json:"apply,omitempty"`
+        Changes      []apiSettingDiff `json:"changes"`
+        Incompatible []apiSettingDiff `json:"incompatible"`
+        Skipped      []string         `json:"skipped"`
+        Applied      bool             `json:"applied"`
+        Revision     int64            `json:"revision,omitempty"`
+}
+
+func newApiPromotion(plan *configman.PromotionPlan) *apiPromotion {
+        body := &apiPromotion{
+                From:         plan.From,
+                To:           plan.To,
+                Settings:     plan.Settings,
+                Selector:     plan.Selector.String(),
+                SkipSecrets:  plan.SkipSecrets,
+                Changes:      make([]apiSettingDiff, len(plan.Changes)),
+                Incompatible: make([]apiSettingDiff, len(plan.Incompatible)),
+                Skipped:      plan.Skipped,
+        }
+
+        for i, change := range plan.Changes {
+                body.Changes[i] = apiSettingDiff{Setting: change.Setting, Kind: change.Kind, From: optionalApiSetting(change.From), To: optionalApiSetting(change.To)}
+        }
+
+        for i, change := range plan.Incompatible {
+                body.Incompatible[i] = apiSettingDiff{Setting: change.Setting, Kind: change.Kind, From: optionalApiSetting(change.From), To: optionalApiSetting(change.To)}
+        }
+
+        return body
+}
+
+// allowedToPromote returns configman.ErrForbidden unless the principal
+// of r can view from and edit to.
+func allowedToPromote(store configman.Store, r *http.Request, from, to string) error {
+        ok, err := allowed(store, r, from, configman.RoleViewer)
+
+        if err == nil && ok {
+                ok, err = allowed(store, r, to, configman.RoleEditor)
+        }
+
+        if err == nil && !ok {
+                err = configman.ErrForbidden
+        }
+
+        return err
+}
+
+// auditPromotionReads calls auditSecretReads with the settings plan
+// shows the values of, in both configs.
+func auditPromotionReads(store configman.Store, r *http.Request, plan *configman.PromotionPlan) {
+        diff := &configman.Diff{
+                From:    configman.Ref{Config: plan.From},
+                To:      configman.Ref{Config: plan.To},
+                Changes: append(append([]configman.SettingDiff{}, plan.Changes...), plan.Incompatible...),
+        }
+
+        auditDiffReads(store, r, diff)
+}
+
+// promotionOf returns the promotion of the config in the path of r to
+// the config in its to parameter, of the settings picked in its settings
+// parameters. FormValue parses the form, so it is read before r.Form.
+func promotionOf(r *http.Request) configman.Promotion {
+        promotion := configman.Promotion{
+                From:        r.PathValue("name"),
+                To:          r.FormValue("to"),
+                SkipSecrets: r.FormValue("skip_secrets") != "",
+        }
+
+        promotion.Settings = r.Form["settings"]
+
+        return promotion
+}
+
+// registerPromoteAPI registers the handlers used to promote settings
+// from one config to another. Promoting needs the viewer role on the
+// source config and the editor role on the target config.
+func registerPromoteAPI(mux *http.ServeMux, store configman.Store) {
+        // The promotion is only applied if apply is set; otherwise the
+        // plan is returned so that it can be previewed.
+        mux.HandleFunc("POST /api/v1/promote", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var input apiPromotion
+                var plan *configman.PromotionPlan
+                var event *configman.ChangeEvent
+
+                store := requestStore(store, r)
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                promotion := configman.Promotion{From: input.From, To: input.To, Settings: input.Settings, SkipSecrets: input.SkipSecrets}
+
+                if promotion.Selector, err = configman.ParseSelector(input.Selector); err == nil {
+                        err = allowedToPromote(store, r, input.From, input.To)
+                }
+
+                if _, ok := configman.Extension[configman.LabelStore](store); err == nil && len(promotion.Selector) > 0 && !ok {
+                        err = errNoLabels
+                }
+
+                switch {
+                case err != nil:
+                case input.Apply:
+                        plan, event, err = configman.Promote(store, promotion, principal(r))
+                default:
+                        plan, err = configman.PlanPromotion(store, promotion)
+                }
+
+                if errors.Is(err, configman.ErrTypeMismatch) && plan != nil {
+                        writeApiErrorCode(w, r, http.StatusConflict, "incompatible_types", err.Error())
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                auditPromotionReads(store, r, plan)
+
+                body := newApiPromotion(plan)
+
+                if event != nil {
+                        body.Applied, body.Revision = true, event.Revision
+                }
+
+                if r.FormValue("format") == "text" {
+                        writeText(w, r, http.StatusOK, plan.String())
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        mux.HandleFunc("GET /configs/{name}/promote", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                writePromotion(w, r, store, false)
+        }))
+
+        mux.HandleFunc("POST /configs/{name}/promote", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                writePromotion(w, r, store, true)
+        }))
+}
+
+// writePromotion previews the promotion of r, or applies it if apply is
+// set, and writes the promotion template.
+func writePromotion(w http.ResponseWriter, r *http.Request, store configman.Store, apply bool) {
+        var err error
+        var plan *configman.PromotionPlan
+        var event *configman.ChangeEvent
+
+        promotion := promotionOf(r)
+        data := map[string]any{"Promotion": promotion}
+        status := http.StatusOK
+
+        if err = allowedToPromote(store, r, promotion.From, promotion.To); err == nil && apply && len(promotion.Settings) == 0 {
+                err = errNoSettingsPicked
+        }
+
+        switch {
+        case err != nil:
+        case apply:
+                plan, event, err = configman.Promote(store, promotion, principal(r))
+        default:
+                plan, err = configman.PlanPromotion(store, promotion)
+        }
+
+        switch {
+        case errors.Is(err, errNoSettingsPicked):
+                status = http.StatusUnprocessableEntity
+                data["Error"] = "pick the settings to promote"
+        case errors.Is(err, configman.ErrForbidden):
+                status = http.StatusForbidden
+                data["Error"] = "you need the editor role on " + promotion.To
+        case errors.Is(err, configman.ErrNotFound):
+                status = http.StatusNotFound
+                data["Error"] = "config " + promotion.To + " or a picked setting does not exist"
+        case errors.Is(err, configman.ErrTypeMismatch):
+                status = http.StatusConflict
+                data["Error"] = "some settings have a different type in " + promotion.To + ", leave them out"
+        case errors.Is(err, configman.ErrConflict), errors.Is(err, configman.ErrExists):
+                status = http.StatusConflict
+                data["Error"] = promotion.To + " changed since the preview, preview again"
+        case errors.Is(err, configman.ErrProtectedConfig):
+                status = http.StatusForbidden
+                data["Error"] = promotion.To + " is protected, propose the changes instead"
+        case err != nil:
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        if plan != nil {
+                auditPromotionReads(store, r, plan)
+        }
+
+        data["Plan"] = plan
+
+        if event != nil {
+                data["Revision"] = event.Revision
+        }
+
+        w.WriteHeader(status)
+
+        if err = indexTmpl.ExecuteTemplate(w, "promotion", data); err != nil {
+                logError(r, err)
+        }
+}
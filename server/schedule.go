@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// effectiveAtLayout is the layout of the value of a datetime-local input.
+const effectiveAtLayout = "2006-01-02T15:04"
+
+// scheduledChangesPage is the data used to render the
+// scheduled-changes template.
+type scheduledChangesPage struct {
+        Config  string
+        Setting *configman.Setting
+        Changes []*configman.ScheduledChange
+        Error   string
+}
+
+// getScheduledChanges renders the pending changes of a setting along
+// with a form to schedule another one.
+func getScheduledChanges(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                renderScheduledChanges(store, w, r, http.StatusOK, "")
+        }
+}
+
+// postScheduledChange schedules a change to the value of a setting.
+func postScheduledChange(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var value any
+                var at time.Time
+                var setting *configman.Setting
+
+                store := requestStore(store, r)
+
+                scheduler, ok := configman.Extension[configman.ScheduleStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                config := r.PathValue("name")
+
+                if setting, err = store.GetSetting(config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if value, err = configman.ParseValue(setting.Type(), r.FormValue("value")); err != nil {
+                        renderScheduledChanges(store, w, r, http.StatusUnprocessableEntity, "value must be a valid "+setting.Type().String())
+                        return
+                }
+
+                if at, err = time.ParseInLocation(effectiveAtLayout, r.FormValue("effective_at"), time.Local); err != nil {
+                        renderScheduledChanges(store, w, r, http.StatusUnprocessableEntity, "effective time is not valid")
+                        return
+                }
+
+                _, err = scheduler.ScheduleChange(config, setting.Name(), value, at, principal(r))
+
+                if errors.Is(err, configman.ErrProtectedConfig) {
+                        renderScheduledChanges(store, w, r, http.StatusForbidden, "config is protected, propose the change for review instead")
+                        return
+                }
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                renderScheduledChanges(store, w, r, http.StatusCreated, "")
+        }
+}
+
+// deleteScheduledChange cancels a pending change, or dismisses a failed
+// one.
+func deleteScheduledChange(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                scheduler, ok := configman.Extension[configman.ScheduleStore](store)
+
+                if !ok {
+                        w.WriteHeader(http.StatusNotImplemented)
+                        return
+                }
+
+                id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+
+                if err != nil {
+                        w.WriteHeader(http.StatusBadRequest)
+                        return
+                }
+
+                // the role of the principal was only checked on the
+                // config in the path, the change must belong to it
+                if changes, err := scheduler.GetScheduledChanges(r.PathValue("name")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                } else if !slices.ContainsFunc(changes, func(change *configman.ScheduledChange) bool { return change.ID == id }) {
+                        renderScheduledChanges(store, w, r, http.StatusConflict, "change has already been applied or cancelled")
+                        return
+                }
+
+                err = scheduler.CancelScheduledChange(id)
+
+                if errors.Is(err, configman.ErrNotPending) {
+                        renderScheduledChanges(store, w, r, http.StatusConflict, "change has already been applied or cancelled")
+                        return
+                }
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                renderScheduledChanges(store, w, r, http.StatusOK, "")
+        }
+}
+
+// renderScheduledChanges renders the scheduled-changes template for the
+// setting in the request path.
+func renderScheduledChanges(store configman.Store, w http.ResponseWriter, r *http.Request, status int, msg string) {
+        var err error
+        var changes []*configman.ScheduledChange
+
+        scheduler, ok := configman.Extension[configman.ScheduleStore](store)
+
+        if !ok {
+                w.WriteHeader(http.StatusNotImplemented)
+                return
+        }
+
+        page := scheduledChangesPage{Config: r.PathValue("name"), Error: msg}
+
+        if page.Setting, err = store.GetSetting(page.Config, r.PathValue("setting")); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        if page.Setting == nil {
+                w.WriteHeader(http.StatusNotFound)
+                return
+        }
+
+        if changes, err = scheduler.GetScheduledChanges(page.Config); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        page.Changes = scheduledChangesOf(changes)[page.Setting.Name()]
+
+        w.WriteHeader(status)
+
+        if err = indexTmpl.ExecuteTemplate(w, "scheduled-changes", page); err != nil {
+                logError(r, err)
+        }
+}
+
+// scheduledChangesOf groups changes by the name of their setting.
+func scheduledChangesOf(changes []*configman.ScheduledChange) map[string][]*configman.ScheduledChange {
+        bySetting := make(map[string][]*configman.ScheduledChange)
+
+        for _, change := range changes {
+                bySetting[change.Setting] = append(bySetting[change.Setting], change)
+        }
+
+        return bySetting
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/vlence/configman"
+)
+
+// apiSearchResult is the JSON representation of a search result. The
+// snippet is split into fragments so that clients can highlight the
+// matches without parsing markup.
+type apiSearchResult struct {
+        Config  string        `json:"config"`
+        Setting string        `json:"setting,omitempty"`
+        Snippet []apiFragment `json:"snippet"`
+}
+
+// apiFragment is the JSON representation of a fragment of a snippet.
+type apiFragment struct {
+        Text  string `json:"text"`
+        Match bool   `json:"match,omitempty"`
+}
+
+func newApiSearchResult(result configman.SearchResult) *apiSearchResult {
+        snippet := make([]apiFragment, len(result.Snippet))
+
+        for i, fragment := range result.Snippet {
+                snippet[i] = apiFragment{Text: fragment.Text, Match: fragment.Match}
+        }
+
+        return &apiSearchResult{Config: result.Config, Setting: result.Setting, Snippet: snippet}
+}
+
+// search returns at most limit results of searching store for the q
+// parameter of r, in the configs the principal of r can view. Results in
+// other configs are dropped after searching, so there may be fewer.
+// Reads of secrets among the results are audited.
+func search(store configman.Store, r *http.Request, limit int) ([]configman.SearchResult, error) {
+        var err error
+        var grants []configman.Grant
+        var results []configman.SearchResult
+
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return nil, configman.ErrForbidden
+        }
+
+        if grants, err = grantsOf(access, r); err != nil {
+                return nil, err
+        }
+
+        if results, err = configman.Search(store, r.FormValue("q"), limit); err != nil {
+                return nil, err
+        }
+
+        viewable := make([]configman.SearchResult, 0, len(results))
+
+        for _, result := range results {
+                if configman.RoleOf(grants, result.Config).Includes(configman.RoleViewer) {
+                        viewable = append(viewable, result)
+
+                        // snippets of settings may hold their values
+                        if result.Setting != "" {
+                                auditSecretReads(store, r, result.Config, result.Setting)
+                        }
+                }
+        }
+
+        return viewable, nil
+}
+
+// registerSearchAPI registers the handlers used to search configs and
+// settings by their names, descriptions and string values.
+func registerSearchAPI(mux *http.ServeMux, store configman.Store) {
+        mux.HandleFunc("GET /api/v1/search", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var results []configman.SearchResult
+
+                store := requestStore(store, r)
+
+                limit := 20
+
+                if s := r.URL.Query().Get("limit"); s != "" {
+                        if limit, err = strconv.Atoi(s); err != nil || limit < 1 {
+                                writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_limit", "limit must be a positive number")
+                                return
+                        }
+                }
+
+                if results, err = search(store, r, min(limit, 100)); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]*apiSearchResult, len(results))
+
+                for i, result := range results {
+                        body[i] = newApiSearchResult(result)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        mux.HandleFunc("GET /search/{$}", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                results, err := search(store, r, 20)
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "search-results", results); err != nil {
+                        logError(r, err)
+                }
+        })
+}
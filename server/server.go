@@ -0,0 +1,474 @@
+package server
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/metrics"
+	"github.com/vlence/configman/tracing"
+	"github.com/vlence/gossert"
+)
+
+//go:embed templates/base.html templates/index.html templates/flags.html templates/schedule.html templates/changes.html templates/settings.html templates/login.html templates/audit.html templates/trash.html
+var indexTemplates embed.FS
+
+//go:embed scripts
+var scriptsDir embed.FS
+
+//go:embed styles
+var stylesDir embed.FS
+
+var indexTmpl = template.Must(template.ParseFS(indexTemplates, "templates/*.html"))
+
+// Options configures the handler returned by New.
+type Options struct {
+        // Tokens maps static API tokens to the principals they
+        // authenticate.
+        Tokens map[string]string
+
+        // Users maps user names to password hashes made by HashPassword.
+        // Users can log in to the UI or use HTTP basic authentication.
+        Users map[string]string
+
+        // Admins are given the admin role on every config by New.
+        Admins []string
+
+        // SessionTTL is how long a user stays logged in. It defaults to
+        // 12 hours.
+        SessionTTL time.Duration
+
+        // Logger receives the records of every request, which include
+        // its request ID. It defaults to slog.Default().
+        Logger *slog.Logger
+
+        // Metrics, if set, receives metrics of every request and is
+        // served at /metrics without authentication.
+        Metrics *metrics.Registry
+
+        // Tracer, if set, starts a span for every request. If store is
+        // a traced.TracedStore, the spans of its operations are children
+        // of the span of the request they serve.
+        Tracer tracing.Tracer
+
+        // Shutdown, if set, ends every event stream once it is closed.
+        // Event streams otherwise only end when the client goes away, so
+        // it should be closed when the server starts shutting down.
+        Shutdown <-chan struct{}
+
+        // Ready reports whether the server can serve requests, e.g. by
+        // pinging the database. It is called by the readiness endpoint;
+        // if nil the server is always ready.
+        Ready func(ctx context.Context) error
+}
+
+// New returns the handler of the configman UI and JSON API backed by
+// store.
+func New(store configman.Store, opts Options) (http.Handler, error) {
+        gossert.Ok(store != nil, "server: received nil instead of store")
+
+        if opts.SessionTTL == 0 {
+                opts.SessionTTL = 12 * time.Hour
+        }
+
+        if opts.Logger == nil {
+                opts.Logger = slog.Default()
+        }
+
+        for user, hash := range opts.Users {
+                if !validPasswordHash(hash) {
+                        opts.Logger.Warn("server: password hash is not in the pbkdf2-sha256 format, the user cannot log in", "user", user)
+                }
+        }
+
+        if err := grantAdmins(store, opts.Admins); err != nil {
+                return nil, err
+        }
+
+        tokens := make(tokenAuth)
+        users := passwordAuth(opts.Users)
+        sessions := newSessionAuth(opts.SessionTTL)
+        mux := http.NewServeMux()
+
+        for token, principal := range opts.Tokens {
+                tokens[token] = principal
+        }
+
+        mux.Handle("GET /styles/", http.FileServer(http.FS(stylesDir)))
+        mux.Handle("GET /scripts/", http.FileServer(http.FS(scriptsDir)))
+
+        mux.HandleFunc("GET /healthz", getHealth)
+        mux.HandleFunc("GET /readyz", getReady(opts.Ready))
+
+        mux.HandleFunc("GET /login", getLogin)
+        mux.HandleFunc("POST /login", postLogin(store, users, sessions))
+        mux.HandleFunc("POST /logout", postLogout(sessions))
+
+        mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var configs map[string]any
+                var namespaces []configman.Namespace
+
+                store := requestStore(store, r)
+
+                namespace := r.FormValue("namespace")
+
+                if configs, err = configsPage(store, r, nil, configman.PageRequest{}); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if namespaces, err = visibleNamespaces(store, r); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                pageData := make(map[string]any)
+                pageData["Title"] = "Configman"
+                pageData["Configs"] = configs
+                pageData["Namespace"] = namespace
+                pageData["Namespaces"] = namespaces
+                pageData["Principal"] = principal(r)
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "base", pageData); err != nil {
+                        logError(r, err)
+                }
+        })
+
+        // Admins of a namespace may create configs in it, so the role is
+        // checked once the name is known.
+        mux.HandleFunc("POST /configs/", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var ok bool
+                var name string
+                var config configman.Config
+                var configs map[string]any
+
+                store := requestStore(store, r)
+
+                namespace := r.FormValue("namespace")
+                name = configman.QualifiedName(namespace, strings.TrimSpace(r.FormValue("name")))
+
+                if ok, err = allowed(store, r, name, configman.RoleAdmin); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if !ok {
+                        w.WriteHeader(http.StatusForbidden)
+
+                        if err = indexTmpl.ExecuteTemplate(w, "forbidden", configman.RoleAdmin); err != nil {
+                                logError(r, err)
+                        }
+
+                        return
+                }
+
+                if config, err = store.GetConfig(name); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if config == nil {
+                        // create a new config if one doesn't already exist with the same name
+                        if config, err = store.CreateConfig(name, ""); err != nil {
+                                logError(r, err)
+                                w.WriteHeader(http.StatusInternalServerError)
+                                return
+                        }
+                }
+
+                gossert.Ok(config != nil, "config created without error but got nil")
+
+                if configs, err = configsPage(store, r, nil, configman.PageRequest{}); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                w.WriteHeader(http.StatusCreated)
+
+                if err = indexTmpl.ExecuteTemplate(w, "configs", configs); err != nil {
+                        logError(r, err)
+                }
+        })
+
+        // The configs list is filtered and sorted by the parameters of
+        // the request. Later pages are appended to the list, so only
+        // their items are rendered.
+        mux.HandleFunc("GET /configs/{$}", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var query *configman.Query
+                var page *configman.PageRequest
+                var configs map[string]any
+                var message string
+
+                store := requestStore(store, r)
+
+                if query, err = parseQuery(r); err == nil {
+                        page, err = parsePage(r)
+                }
+
+                if err == nil {
+                        if page == nil {
+                                page = new(configman.PageRequest)
+                        }
+
+                        configs, err = configsPage(store, r, query, *page)
+                }
+
+                switch {
+                case errors.Is(err, configman.ErrInvalidSelector), errors.Is(err, errNoLabels):
+                        message = err.Error()
+                case errors.Is(err, configman.ErrInvalidPage):
+                        message = "invalid sort, order or cursor"
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if message != "" {
+                        w.WriteHeader(http.StatusBadRequest)
+
+                        if err = indexTmpl.ExecuteTemplate(w, "configs-error", message); err != nil {
+                                logError(r, err)
+                        }
+
+                        return
+                }
+
+                tmpl := "configs"
+
+                if page.Cursor != "" {
+                        tmpl = "configs-page"
+                }
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, tmpl, configs); err != nil {
+                        logError(r, err)
+                }
+        })
+
+        mux.HandleFunc("GET /configs/{name}/", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var config configman.Config
+                var page *settingsPage
+
+                store := requestStore(store, r)
+
+                name := r.PathValue("name")
+
+                if config, err = store.GetConfig(name); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if config == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if page, err = loadSettingsPage(store, config); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                auditSettingReads(store, r, name, page.Settings)
+
+                pageData := make(map[string]any)
+                pageData["Config"] = config
+                pageData["Protected"] = page.Protected
+                pageData["SettingsPane"] = page
+
+                if labels, ok := configman.Extension[configman.LabelStore](store); ok {
+                        pane := map[string]any{"Name": name}
+
+                        if pane["Labels"], err = labels.GetConfigLabels(name); err != nil {
+                                logError(r, err)
+                                w.WriteHeader(http.StatusInternalServerError)
+                                return
+                        }
+
+                        pageData["LabelsPane"] = pane
+                }
+
+                if snapshots, ok := configman.Extension[configman.SnapshotStore](store); ok {
+                        if pageData["SnapshotsPane"], err = snapshotsPane(snapshots, name); err != nil {
+                                logError(r, err)
+                                w.WriteHeader(http.StatusInternalServerError)
+                                return
+                        }
+                }
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "config", pageData); err != nil {
+                        logError(r, err)
+                }
+        }))
+
+        mux.HandleFunc("PATCH /configs/{name}/", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var done bool
+                var revision int64
+                var name, desc string
+                var config configman.Config
+
+                store := requestStore(store, r)
+
+                name = r.PathValue("name")
+                desc = r.FormValue("desc")
+
+                if revision, err = ifMatch(r); err != nil {
+                        w.WriteHeader(http.StatusBadRequest)
+                        return
+                }
+
+                if config, err = store.GetConfig(name); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if config == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                pageData := make(map[string]any)
+                pageData["Config"] = config
+
+                done, err = config.SetDescIf(desc, revision)
+
+                if errors.Is(err, configman.ErrProtectedConfig) {
+                        w.WriteHeader(http.StatusForbidden)
+                        return
+                }
+
+                if errors.Is(err, configman.ErrConflict) {
+                        // show what the description was changed to so
+                        // that the user can decide what to do
+                        pageData["Error"] = "Someone else changed the description, this is their version."
+                        w.Header().Set("ETag", etag(config.Revision()))
+                        w.WriteHeader(http.StatusPreconditionFailed)
+
+                        if err = indexTmpl.ExecuteTemplate(w, "config-desc-form", pageData); err != nil {
+                                logError(r, err)
+                        }
+
+                        return
+                }
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if done {
+                        gossert.Ok(config.Desc() == desc, "config desc not updated correctly")
+                }
+
+                if !done {
+                        requestLogger(r).Warn("server: config description not updated")
+                }
+
+                w.Header().Set("ETag", etag(config.Revision()))
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "config-desc-form", pageData); err != nil {
+                        logError(r, err)
+                }
+        }))
+
+        mux.HandleFunc("GET /configs/{name}/events", authorize(store, configman.RoleViewer, getEvents(store, opts.Shutdown)))
+
+        mux.HandleFunc("GET /configs/{name}/settings/", authorize(store, configman.RoleViewer, getSettings(store)))
+        mux.HandleFunc("POST /configs/{name}/settings/", authorize(store, configman.RoleEditor, postSetting(store)))
+        mux.HandleFunc("GET /configs/{name}/settings/value-input", authorize(store, configman.RoleViewer, getValueInput))
+        mux.HandleFunc("GET /configs/{name}/settings/{setting}/", authorize(store, configman.RoleViewer, getSetting(store)))
+        mux.HandleFunc("PUT /configs/{name}/settings/{setting}/", authorize(store, configman.RoleEditor, putSetting(store)))
+        mux.HandleFunc("DELETE /configs/{name}/settings/{setting}/", authorize(store, configman.RoleEditor, deleteSetting(store)))
+        mux.HandleFunc("POST /configs/{name}/settings/{setting}/deprecation", authorize(store, configman.RoleEditor, postDeprecation(store)))
+
+        mux.HandleFunc("GET /configs/{name}/settings/{setting}/rules/", authorize(store, configman.RoleViewer, getFlagRules(store)))
+        mux.HandleFunc("PUT /configs/{name}/settings/{setting}/rules/", authorize(store, configman.RoleEditor, putFlagRules(store)))
+        mux.HandleFunc("GET /configs/{name}/settings/{setting}/rules/new", authorize(store, configman.RoleEditor, newFlagRule))
+        mux.HandleFunc("GET /configs/{name}/settings/{setting}/evaluate", authorize(store, configman.RoleViewer, evaluateFlag(store)))
+
+        mux.HandleFunc("GET /configs/{name}/settings/{setting}/scheduled/", authorize(store, configman.RoleViewer, getScheduledChanges(store)))
+        mux.HandleFunc("POST /configs/{name}/settings/{setting}/scheduled/", authorize(store, configman.RoleEditor, postScheduledChange(store)))
+        mux.HandleFunc("DELETE /configs/{name}/settings/{setting}/scheduled/{id}", authorize(store, configman.RoleEditor, deleteScheduledChange(store)))
+
+        mux.HandleFunc("PUT /configs/{name}/protected", authorize(store, configman.RoleAdmin, putProtected(store)))
+        mux.HandleFunc("GET /configs/{name}/changes/", authorize(store, configman.RoleViewer, getChangeRequests(store)))
+        mux.HandleFunc("POST /configs/{name}/changes/{id}/{decision}", authorize(store, configman.RoleAdmin, postReviewChange(store)))
+        mux.HandleFunc("GET /configs/{name}/settings/{setting}/changes/new", authorize(store, configman.RoleEditor, getProposeChange(store)))
+        mux.HandleFunc("POST /configs/{name}/settings/{setting}/changes/", authorize(store, configman.RoleEditor, postProposeChange(store)))
+
+        registerAPI(mux, store)
+        registerAccessAPI(mux, store, opts.Logger)
+        registerAuditAPI(mux, store)
+        registerNamespaceAPI(mux, store)
+        registerLabelAPI(mux, store)
+        registerSearchAPI(mux, store)
+        registerSnapshotAPI(mux, store)
+        registerDiffAPI(mux, store)
+        registerPromoteAPI(mux, store)
+        registerCloneAPI(mux, store)
+        registerTrashAPI(mux, store)
+
+        handler := authenticate(auditWrites(store, mux), tokens, users, sessions)
+
+        if opts.Metrics != nil {
+                mux.Handle("GET /metrics", opts.Metrics)
+                handler = measure(opts.Metrics, mux, handler)
+        }
+
+        if opts.Tracer != nil {
+                handler = trace(opts.Tracer, mux, handler)
+        }
+
+        return logger(opts.Logger, handler), nil
+}
+
+// getHealth reports that the process is up.
+func getHealth(w http.ResponseWriter, r *http.Request) {
+        w.WriteHeader(http.StatusOK)
+        w.Write([]byte("ok\n"))
+}
+
+// getReady reports whether the server can serve requests according to
+// ready.
+func getReady(ready func(ctx context.Context) error) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                if ready != nil {
+                        if err := ready(r.Context()); err != nil {
+                                requestLogger(r).Warn("server: not ready", "err", err)
+                                w.WriteHeader(http.StatusServiceUnavailable)
+                                w.Write([]byte("not ready\n"))
+                                return
+                        }
+                }
+
+                w.WriteHeader(http.StatusOK)
+                w.Write([]byte("ok\n"))
+        }
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/tursodatabase/go-libsql"
+	"github.com/vlence/configman"
+	sqlstore "github.com/vlence/configman/stores/sql"
+)
+
+// testLogger discards what it is given.
+var testLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// newTestStore returns a store backed by a new database in a temporary
+// directory of t.
+func newTestStore(t *testing.T, opts ...sqlstore.Option) *sqlstore.SqlStore {
+        t.Helper()
+
+        db, err := sql.Open("libsql", "file:"+filepath.Join(t.TempDir(), "configman.db"))
+
+        if err != nil {
+                t.Fatalf("failed to open database: %v", err)
+        }
+
+        t.Cleanup(func() { db.Close() })
+
+        store, err := sqlstore.NewSqlStore(db, append([]sqlstore.Option{sqlstore.WithLogger(testLogger)}, opts...)...)
+
+        if err != nil {
+                t.Fatalf("failed to create store: %v", err)
+        }
+
+        return store
+}
+
+// newTestServer returns the handler New makes for store with opts,
+// where the token of root, an admin of every config, is "root".
+func newTestServer(t *testing.T, store configman.Store, opts Options) http.Handler {
+        t.Helper()
+
+        opts.Tokens, opts.Admins, opts.Logger = map[string]string{"root": "root"}, []string{"root"}, testLogger
+
+        handler, err := New(store, opts)
+
+        if err != nil {
+                t.Fatalf("failed to create server: %v", err)
+        }
+
+        return handler
+}
+
+// newTestRequest returns a request made by principal, with body as
+// JSON if it is not empty.
+func newTestRequest(principal, method, target, body string) *http.Request {
+        r := httptest.NewRequest(method, target, strings.NewReader(body))
+        r.Header.Set("Authorization", "Bearer "+principal)
+
+        if body != "" {
+                r.Header.Set("Content-Type", "application/json")
+        }
+
+        return r
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+// settingTypes are the types offered when creating a setting, in the
+// order they are listed.
+var settingTypes = []configman.Type{
+        configman.String,
+        configman.Bool,
+        configman.Int32,
+        configman.Int64,
+        configman.Float32,
+        configman.Float64,
+}
+
+// settingForm holds what was entered in the new setting form so that it
+// can be shown again along with a validation error.
+type settingForm struct {
+        Name  string
+        Type  configman.Type
+        Value string
+        Desc  string
+}
+
+// Input returns the value input of the form.
+func (form settingForm) Input() valueInput {
+        return valueInput{Type: form.Type, Value: form.Value}
+}
+
+// valueInput is the data used to render the value-input template.
+type valueInput struct {
+        Type  configman.Type
+        Value string
+}
+
+// settingsPage is the data used to render the settings-pane template.
+type settingsPage struct {
+        Config    configman.Config
+        Settings  []*configman.Setting
+        Scheduled map[string][]*configman.ScheduledChange
+        Protected bool
+        Types     []configman.Type
+        Form      settingForm
+        Error     string
+}
+
+// settingPage is the data used to render the setting template.
+type settingPage struct {
+        Config  string
+        Setting *configman.Setting
+        Input   valueInput
+        Error   string
+}
+
+// loadSettingsPage loads the settings of config along with their
+// scheduled changes and whether config is protected.
+func loadSettingsPage(store configman.Store, config configman.Config) (*settingsPage, error) {
+        var err error
+        var changes []*configman.ScheduledChange
+
+        page := &settingsPage{Config: config, Types: settingTypes}
+        page.Form.Type = configman.String
+
+        if page.Settings, err = store.GetSettings(config.Name()); err != nil {
+                return nil, err
+        }
+
+        if requests, ok := configman.Extension[configman.ChangeRequestStore](store); ok {
+                if page.Protected, err = requests.Protected(config.Name()); err != nil {
+                        return nil, err
+                }
+        }
+
+        if scheduler, ok := configman.Extension[configman.ScheduleStore](store); ok {
+                if changes, err = scheduler.GetScheduledChanges(config.Name()); err != nil {
+                        return nil, err
+                }
+        }
+
+        page.Scheduled = scheduledChangesOf(changes)
+
+        return page, nil
+}
+
+// getSettings renders the settings of a config along with the form to
+// create another one.
+func getSettings(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                renderSettingsPane(store, w, r, http.StatusOK, nil, "")
+        }
+}
+
+// postSetting creates a setting. Invalid input is reported inline in
+// the new setting form.
+func postSetting(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var value any
+
+                store := requestStore(store, r)
+
+                config := r.PathValue("name")
+                form := &settingForm{
+                        Name:  strings.TrimSpace(r.FormValue("name")),
+                        Value: r.FormValue("value"),
+                        Desc:  strings.TrimSpace(r.FormValue("desc")),
+                }
+
+                if form.Type, err = configman.ParseType(r.FormValue("type")); err != nil {
+                        form.Type = configman.String
+                        renderSettingsPane(store, w, r, http.StatusUnprocessableEntity, form, "pick a type for the setting")
+                        return
+                }
+
+                if form.Name == "" {
+                        renderSettingsPane(store, w, r, http.StatusUnprocessableEntity, form, "name is required")
+                        return
+                }
+
+                if strings.ContainsAny(form.Name, "/?#") {
+                        renderSettingsPane(store, w, r, http.StatusUnprocessableEntity, form, "name cannot contain /, ? or #")
+                        return
+                }
+
+                if value, err = configman.ParseValue(form.Type, form.Value); err != nil {
+                        renderSettingsPane(store, w, r, http.StatusUnprocessableEntity, form, "value must be a valid "+form.Type.String())
+                        return
+                }
+
+                batch := new(configman.Batch).Create(config, form.Name, form.Desc, value)
+                _, err = store.ApplyBatch(batch, principal(r))
+
+                if errors.Is(err, configman.ErrExists) {
+                        renderSettingsPane(store, w, r, http.StatusConflict, form, "a setting named "+form.Name+" already exists")
+                        return
+                }
+
+                if errors.Is(err, configman.ErrProtectedConfig) {
+                        renderSettingsPane(store, w, r, http.StatusForbidden, form, "config is protected, settings cannot be added to it")
+                        return
+                }
+
+                if errors.Is(err, configman.ErrNotFound) {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                renderSettingsPane(store, w, r, http.StatusCreated, nil, "")
+        }
+}
+
+// getValueInput renders the value input matching the type in the query
+// string. The new setting form swaps it in when another type is picked.
+func getValueInput(w http.ResponseWriter, r *http.Request) {
+        var err error
+        var input valueInput
+
+        if input.Type, err = configman.ParseType(r.FormValue("type")); err != nil {
+                w.WriteHeader(http.StatusBadRequest)
+                return
+        }
+
+        w.WriteHeader(http.StatusOK)
+
+        if err = indexTmpl.ExecuteTemplate(w, "value-input", input); err != nil {
+                logError(r, err)
+        }
+}
+
+// getSetting renders a setting with forms to change its value,
+// deprecate it and delete it.
+func getSetting(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                renderSetting(store, w, r, http.StatusOK, "")
+        }
+}
+
+// putSetting sets the value of a setting. The If-Match header must carry
+// the revision the value was read at.
+func putSetting(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var value any
+                var revision int64
+                var setting *configman.Setting
+
+                store := requestStore(store, r)
+
+                config := r.PathValue("name")
+
+                if revision, err = ifMatch(r); err != nil {
+                        w.WriteHeader(http.StatusBadRequest)
+                        return
+                }
+
+                if setting, err = store.GetSetting(config, r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if setting == nil {
+                        w.WriteHeader(http.StatusNotFound)
+                        return
+                }
+
+                if value, err = configman.ParseValue(setting.Type(), r.FormValue("value")); err != nil {
+                        renderSetting(store, w, r, http.StatusUnprocessableEntity, "value must be a valid "+setting.Type().String())
+                        return
+                }
+
+                batch := new(configman.Batch).UpdateIf(config, setting.Name(), value, revision)
+
+                if !writeSetting(store, w, r, batch) {
+                        return
+                }
+
+                renderSetting(store, w, r, http.StatusOK, "")
+        }
+}
+
+// postDeprecation deprecates a setting.
+func postDeprecation(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                reason := strings.TrimSpace(r.FormValue("reason"))
+
+                if reason == "" {
+                        renderSetting(store, w, r, http.StatusUnprocessableEntity, "tell users why the setting is deprecated and what to use instead")
+                        return
+                }
+
+                batch := new(configman.Batch).Deprecate(r.PathValue("name"), r.PathValue("setting"), reason)
+
+                if !writeSetting(store, w, r, batch) {
+                        return
+                }
+
+                renderSetting(store, w, r, http.StatusOK, "")
+        }
+}
+
+// deleteSetting deletes a setting. The If-Match header must carry the
+// revision the setting was read at.
+func deleteSetting(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                revision, err := ifMatch(r)
+
+                if err != nil {
+                        w.WriteHeader(http.StatusBadRequest)
+                        return
+                }
+
+                batch := new(configman.Batch).DeleteIf(r.PathValue("name"), r.PathValue("setting"), revision)
+
+                if !writeSetting(store, w, r, batch) {
+                        return
+                }
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "setting-deleted", r.PathValue("setting")); err != nil {
+                        logError(r, err)
+                }
+        }
+}
+
+// writeSetting applies batch, which changes the setting in the request
+// path. Errors the user can act on are rendered inline. It returns true
+// if batch was applied, in which case the settings pane is told to
+// reload.
+func writeSetting(store configman.Store, w http.ResponseWriter, r *http.Request, batch *configman.Batch) bool {
+        _, err := store.ApplyBatch(batch, principal(r))
+
+        if errors.Is(err, configman.ErrConflict) {
+                renderSetting(store, w, r, http.StatusPreconditionFailed, "someone else changed this setting, check its current value and try again")
+                return false
+        }
+
+        if errors.Is(err, configman.ErrProtectedConfig) {
+                renderSetting(store, w, r, http.StatusForbidden, "config is protected, propose the change for review instead")
+                return false
+        }
+
+        if errors.Is(err, configman.ErrNotFound) {
+                w.WriteHeader(http.StatusNotFound)
+                return false
+        }
+
+        if err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return false
+        }
+
+        w.Header().Set("HX-Trigger", "settings-changed")
+
+        return true
+}
+
+// renderSettingsPane renders the settings-pane template for the config
+// in the request path. If form is not nil it is shown again in the new
+// setting form.
+func renderSettingsPane(store configman.Store, w http.ResponseWriter, r *http.Request, status int, form *settingForm, msg string) {
+        var err error
+        var page *settingsPage
+        var config configman.Config
+
+        if config, err = store.GetConfig(r.PathValue("name")); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        if config == nil {
+                w.WriteHeader(http.StatusNotFound)
+                return
+        }
+
+        if page, err = loadSettingsPage(store, config); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        auditSettingReads(store, r, config.Name(), page.Settings)
+
+        if form != nil {
+                page.Form = *form
+        }
+
+        page.Error = msg
+
+        w.WriteHeader(status)
+
+        if err = indexTmpl.ExecuteTemplate(w, "settings-pane", page); err != nil {
+                logError(r, err)
+        }
+}
+
+// renderSetting renders the setting template for the setting in the
+// request path.
+func renderSetting(store configman.Store, w http.ResponseWriter, r *http.Request, status int, msg string) {
+        var err error
+
+        page := settingPage{Config: r.PathValue("name"), Error: msg}
+
+        if page.Setting, err = store.GetSetting(page.Config, r.PathValue("setting")); err != nil {
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        if page.Setting == nil {
+                w.WriteHeader(http.StatusNotFound)
+                return
+        }
+
+        auditSecretReads(store, r, page.Config, page.Setting.Name())
+        page.Input = valueInput{Type: page.Setting.Type(), Value: fmt.Sprint(page.Setting.Value())}
+
+        w.Header().Set("ETag", etag(page.Setting.Revision()))
+        w.WriteHeader(status)
+
+        if err = indexTmpl.ExecuteTemplate(w, "setting", page); err != nil {
+                logError(r, err)
+        }
+}
@@ -0,0 +1,310 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// errNoSnapshots is returned when a config is read as of a snapshot or
+// time but the store cannot read past revisions.
+var errNoSnapshots = errors.New("server: the store does not support snapshots")
+
+// errInvalidAsOf is returned when the as_of parameter is not a time.
+var errInvalidAsOf = errors.New("server: as_of must be an RFC 3339 time")
+
+// apiSnapshot is the JSON representation of a snapshot.
+type apiSnapshot struct {
+        Name        string    `json:"name"`
+        Description string    `json:"description"`
+        Config      string    `json:"config,omitempty"`
+        Revision    int64     `json:"revision"`
+        CreatedAt   time.Time `json:"created_at"`
+        CreatedBy   string    `json:"created_by"`
+}
+
+// revisionOf returns the revision of history config is read at, from
+// the snapshot or as_of parameter of r, and whether either was given.
+// A time is the last revision made at or before it. The UI sends the
+// times of datetime-local inputs, which are read as UTC.
+func revisionOf(store configman.Store, r *http.Request, config string) (int64, bool, error) {
+        var err error
+        var at time.Time
+        var snapshot *configman.Snapshot
+
+        name, asOf := r.FormValue("snapshot"), r.FormValue("as_of")
+
+        if name == "" && asOf == "" {
+                return 0, false, nil
+        }
+
+        snapshots, ok := configman.Extension[configman.SnapshotStore](store)
+
+        if !ok {
+                return 0, true, errNoSnapshots
+        }
+
+        if name != "" {
+                if snapshot, err = snapshots.GetSnapshot(name); err != nil {
+                        return 0, true, err
+                }
+
+                if snapshot == nil {
+                        return 0, true, configman.ErrNotFound
+                }
+
+                if !snapshot.Includes(config) {
+                        return 0, true, configman.ErrNotInSnapshot
+                }
+
+                return snapshot.Revision, true, nil
+        }
+
+        if at, err = time.Parse(time.RFC3339, asOf); err != nil {
+                if at, err = time.Parse("2006-01-02T15:04", asOf); err != nil {
+                        return 0, true, errInvalidAsOf
+                }
+        }
+
+        revision, err := snapshots.RevisionAt(at)
+
+        return revision, true, err
+}
+
+// visibleSnapshots returns the snapshots of the store the principal of r
+// can view: those of configs they can view, and those of every config if
+// they can view every config.
+func visibleSnapshots(store configman.Store, r *http.Request) ([]configman.Snapshot, error) {
+        snapshots, ok := configman.Extension[configman.SnapshotStore](store)
+
+        if !ok {
+                return nil, nil
+        }
+
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return nil, configman.ErrForbidden
+        }
+
+        grants, err := grantsOf(access, r)
+
+        if err != nil {
+                return nil, err
+        }
+
+        all, err := snapshots.GetSnapshots()
+
+        if err != nil {
+                return nil, err
+        }
+
+        visible := make([]configman.Snapshot, 0, len(all))
+
+        for _, snapshot := range all {
+                if configman.RoleOf(grants, snapshot.Config).Includes(configman.RoleViewer) {
+                        visible = append(visible, snapshot)
+                }
+        }
+
+        return visible, nil
+}
+
+// snapshotsPane returns the data of the config-snapshots template: the
+// snapshots that include config, which its settings can be read at.
+func snapshotsPane(snapshots configman.SnapshotStore, config string) (map[string]any, error) {
+        all, err := snapshots.GetSnapshots()
+
+        if err != nil {
+                return nil, err
+        }
+
+        included := make([]configman.Snapshot, 0, len(all))
+
+        for _, snapshot := range all {
+                if snapshot.Includes(config) {
+                        included = append(included, snapshot)
+                }
+        }
+
+        return map[string]any{"Name": config, "Snapshots": included}, nil
+}
+
+// registerSnapshotAPI registers the handlers used to take and read
+// snapshots. Editors of a config may snapshot it; snapshots of every
+// config need the editor role on every config.
+func registerSnapshotAPI(mux *http.ServeMux, store configman.Store) {
+        snapshots, ok := configman.Extension[configman.SnapshotStore](store)
+
+        if !ok {
+                return
+        }
+
+        mux.HandleFunc("GET /api/v1/snapshots", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                visible, err := visibleSnapshots(store, r)
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]apiSnapshot, len(visible))
+
+                for i, snapshot := range visible {
+                        body[i] = apiSnapshot(snapshot)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        mux.HandleFunc("POST /api/v1/snapshots", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var ok bool
+                var input apiSnapshot
+                var snapshot *configman.Snapshot
+
+                store := requestStore(store, r)
+
+                if err = json.NewDecoder(r.Body).Decode(&input); err != nil {
+                        writeApiErrorCode(w, r, http.StatusBadRequest, "invalid_body", err.Error())
+                        return
+                }
+
+                input.Name = strings.TrimSpace(input.Name)
+
+                if ok, err = allowed(store, r, input.Config, configman.RoleEditor); err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                if !ok {
+                        writeApiError(w, r, configman.ErrForbidden)
+                        return
+                }
+
+                snapshot, err = snapshots.CreateSnapshot(input.Name, input.Description, input.Config, principal(r))
+
+                if errors.Is(err, configman.ErrExists) {
+                        writeApiErrorCode(w, r, http.StatusConflict, "already_exists", "snapshot "+input.Name+" already exists")
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusCreated, apiSnapshot(*snapshot))
+        })
+
+        mux.HandleFunc("GET /api/v1/snapshots/{snapshot}", func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var ok bool
+                var snapshot *configman.Snapshot
+
+                store := requestStore(store, r)
+
+                if snapshot, err = snapshots.GetSnapshot(r.PathValue("snapshot")); err == nil && snapshot == nil {
+                        err = configman.ErrNotFound
+                }
+
+                if err == nil {
+                        ok, err = allowed(store, r, snapshot.Config, configman.RoleViewer)
+                }
+
+                if err == nil && !ok {
+                        err = configman.ErrForbidden
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, apiSnapshot(*snapshot))
+        })
+
+        mux.HandleFunc("POST /configs/{name}/snapshots", authorize(store, configman.RoleEditor, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var message string
+                var pane map[string]any
+
+                name := r.PathValue("name")
+                status := http.StatusOK
+                _, err = snapshots.CreateSnapshot(strings.TrimSpace(r.FormValue("snapshot")), r.FormValue("desc"), name, principal(r))
+
+                switch {
+                case errors.Is(err, configman.ErrInvalidSnapshot):
+                        status = http.StatusUnprocessableEntity
+                        message = "snapshot names must be at most 63 letters, digits, '-', '_' or '.'"
+                case errors.Is(err, configman.ErrExists):
+                        status = http.StatusConflict
+                        message = "a snapshot with this name already exists"
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                if pane, err = snapshotsPane(snapshots, name); err != nil {
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                pane["Error"] = message
+
+                w.WriteHeader(status)
+
+                if err = indexTmpl.ExecuteTemplate(w, "config-snapshots", pane); err != nil {
+                        logError(r, err)
+                }
+        }))
+
+        mux.HandleFunc("GET /configs/{name}/settings/as-of", authorize(store, configman.RoleViewer, func(w http.ResponseWriter, r *http.Request) {
+                var err error
+                var given bool
+                var revision int64
+                var settings []*configman.Setting
+
+                store := requestStore(store, r)
+
+                data := map[string]any{"Config": r.PathValue("name")}
+
+                if revision, given, err = revisionOf(store, r, r.PathValue("name")); err == nil && !given {
+                        err = errInvalidAsOf
+                }
+
+                if err == nil {
+                        settings, err = snapshots.GetSettingsAt(r.PathValue("name"), revision)
+                }
+
+                switch {
+                case errors.Is(err, errInvalidAsOf):
+                        data["Error"] = "pick a snapshot or a time"
+                case errors.Is(err, configman.ErrNotFound), errors.Is(err, configman.ErrNotInSnapshot):
+                        data["Error"] = "the snapshot does not include this config"
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                auditSettingReads(store, r, r.PathValue("name"), settings)
+
+                data["Revision"] = revision
+                data["Settings"] = settings
+
+                w.WriteHeader(http.StatusOK)
+
+                if err = indexTmpl.ExecuteTemplate(w, "settings-as-of", data); err != nil {
+                        logError(r, err)
+                }
+        }))
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// errNoTrash is returned when the trash is read or restored from but
+// the store has none.
+var errNoTrash = errors.New("server: the store does not keep deleted configs and settings")
+
+// apiTrashedItem is the JSON representation of a deleted config or
+// setting in the trash.
+type apiTrashedItem struct {
+        Config      string    `json:"config"`
+        Setting     string    `json:"setting,omitempty"`
+        Description string    `json:"description"`
+        Settings    int       `json:"settings,omitempty"`
+        DeletedAt   time.Time `json:"deleted_at"`
+        ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func newApiTrashedItem(item configman.TrashedItem) *apiTrashedItem {
+        return &apiTrashedItem{
+                Config:      item.Config,
+                Setting:     item.Setting,
+                Description: item.Description,
+                Settings:    item.Settings,
+                DeletedAt:   item.DeletedAt,
+                ExpiresAt:   item.ExpiresAt,
+        }
+}
+
+// trashOf returns the items in the trash of store that are in configs
+// the principal of r can view.
+func trashOf(store configman.Store, r *http.Request) ([]configman.TrashedItem, error) {
+        var err error
+        var grants []configman.Grant
+        var items []configman.TrashedItem
+
+        trash, ok := configman.Extension[configman.TrashStore](store)
+
+        if !ok {
+                return nil, errNoTrash
+        }
+
+        access, ok := configman.Extension[configman.AccessStore](store)
+
+        if !ok {
+                return nil, configman.ErrForbidden
+        }
+
+        if grants, err = grantsOf(access, r); err != nil {
+                return nil, err
+        }
+
+        if items, err = trash.GetTrash(); err != nil {
+                return nil, err
+        }
+
+        viewable := make([]configman.TrashedItem, 0, len(items))
+
+        for _, item := range items {
+                if configman.RoleOf(grants, item.Config).Includes(configman.RoleViewer) {
+                        viewable = append(viewable, item)
+                }
+        }
+
+        return viewable, nil
+}
+
+// restore restores the config in the path of r, or its setting if the
+// path has one.
+func restore(store configman.Store, r *http.Request) (any, error) {
+        trash, ok := configman.Extension[configman.TrashStore](store)
+
+        if !ok {
+                return nil, errNoTrash
+        }
+
+        if setting := r.PathValue("setting"); setting != "" {
+                return trash.RestoreSetting(r.PathValue("name"), setting, principal(r))
+        }
+
+        return trash.RestoreConfig(r.PathValue("name"), principal(r))
+}
+
+// registerTrashAPI registers the handlers used to list, restore and
+// purge deleted configs and settings. Restoring a config needs the admin
+// role on it, restoring a setting the editor role on its config and
+// purging the admin role on every config.
+func registerTrashAPI(mux *http.ServeMux, store configman.Store) {
+        mux.HandleFunc("GET /api/v1/trash", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                items, err := trashOf(store, r)
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                body := make([]*apiTrashedItem, len(items))
+
+                for i, item := range items {
+                        body[i] = newApiTrashedItem(item)
+                }
+
+                writeJSON(w, r, http.StatusOK, body)
+        })
+
+        mux.HandleFunc("POST /api/v1/trash/configs/{name}/restore", authorize(store, configman.RoleAdmin, postRestoreAPI(store)))
+        mux.HandleFunc("POST /api/v1/trash/configs/{name}/settings/{setting}/restore", authorize(store, configman.RoleEditor, postRestoreAPI(store)))
+
+        // Expired items are purged in the background too; this purges
+        // them right away.
+        mux.HandleFunc("POST /api/v1/trash/purge", authorize(store, configman.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                trash, ok := configman.Extension[configman.TrashStore](store)
+
+                if !ok {
+                        writeApiError(w, r, errNoTrash)
+                        return
+                }
+
+                purged, err := trash.PurgeTrash()
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                writeJSON(w, r, http.StatusOK, map[string]int{"purged": purged})
+        }))
+
+        mux.HandleFunc("GET /trash/{$}", func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                writeTrash(w, r, store, http.StatusOK, "")
+        })
+
+        mux.HandleFunc("POST /trash/configs/{name}/restore", authorize(store, configman.RoleAdmin, postRestore(store)))
+        mux.HandleFunc("POST /trash/configs/{name}/settings/{setting}/restore", authorize(store, configman.RoleEditor, postRestore(store)))
+}
+
+// postRestoreAPI returns the API handler that restores the config or
+// setting in the path.
+func postRestoreAPI(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                store := requestStore(store, r)
+
+                restored, err := restore(store, r)
+
+                if errors.Is(err, configman.ErrExists) {
+                        writeApiErrorCode(w, r, http.StatusConflict, "already_exists", "a config or setting with the same name exists")
+                        return
+                }
+
+                if err != nil {
+                        writeApiError(w, r, err)
+                        return
+                }
+
+                switch restored := restored.(type) {
+                case *configman.Setting:
+                        w.Header().Set("ETag", etag(restored.Revision()))
+                        writeJSON(w, r, http.StatusOK, newApiSetting(restored))
+                case configman.Config:
+                        w.Header().Set("ETag", etag(restored.Revision()))
+                        writeJSON(w, r, http.StatusOK, newApiConfig(restored))
+                }
+        }
+}
+
+// postRestore returns the UI handler that restores the config or
+// setting in the path and shows the trash again.
+func postRestore(store configman.Store) http.HandlerFunc {
+        return func(w http.ResponseWriter, r *http.Request) {
+                var message string
+
+                store := requestStore(store, r)
+
+                _, err := restore(store, r)
+                status := http.StatusOK
+
+                switch {
+                case errors.Is(err, configman.ErrExists):
+                        status, message = http.StatusConflict, "a config or setting with the same name exists"
+                case errors.Is(err, configman.ErrNotFound):
+                        status, message = http.StatusNotFound, "it has been purged, or its config or namespace no longer exists"
+                case errors.Is(err, configman.ErrProtectedConfig):
+                        status, message = http.StatusForbidden, "the config is protected"
+                case errors.Is(err, errNoTrash):
+                        status, message = http.StatusNotImplemented, "the store does not keep deleted configs and settings"
+                case err != nil:
+                        logError(r, err)
+                        w.WriteHeader(http.StatusInternalServerError)
+                        return
+                }
+
+                // a restored config is missing from the list of configs
+                if err == nil && r.PathValue("setting") == "" {
+                        w.Header().Set("HX-Refresh", "true")
+                }
+
+                writeTrash(w, r, store, status, message)
+        }
+}
+
+// writeTrash writes the trash template with the items the principal of r
+// can view, and the error message if it is not empty.
+func writeTrash(w http.ResponseWriter, r *http.Request, store configman.Store, status int, message string) {
+        items, err := trashOf(store, r)
+
+        switch {
+        case errors.Is(err, errNoTrash):
+                status, message = http.StatusNotImplemented, "the store does not keep deleted configs and settings"
+        case err != nil:
+                logError(r, err)
+                w.WriteHeader(http.StatusInternalServerError)
+                return
+        }
+
+        w.WriteHeader(status)
+
+        if err = indexTmpl.ExecuteTemplate(w, "trash", map[string]any{"Items": items, "Error": message}); err != nil {
+                logError(r, err)
+        }
+}
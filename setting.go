@@ -13,11 +13,55 @@ type Setting struct {
         canBeDeprecated
         canBeCreated
         canBeUpdated
+        hasRevision
 
         typ Type
         value any
 }
 
+// SettingFields holds everything needed to build a Setting. Stores use
+// it to hand back the settings they read from storage.
+type SettingFields struct {
+        Name              string
+        Description       string
+        Value             any
+        Revision          int64
+        Deprecated        bool
+        DeprecatedAt      time.Time
+        DeprecationReason string
+        CreatedAt         time.Time
+        CreatedBy         string
+        UpdatedAt         time.Time
+        UpdatedBy         string
+}
+
+// NewSetting returns a new setting built from the given fields. The type
+// of the setting is inferred from the value. ErrUnsupportedType is
+// returned if the type of the value is not supported.
+func NewSetting(fields SettingFields) (*Setting, error) {
+        typ := TypeOf(fields.Value)
+
+        if typ == Unsupported {
+                return nil, ErrUnsupportedType
+        }
+
+        setting := new(Setting)
+        setting.name = fields.Name
+        setting.description = fields.Description
+        setting.revision = fields.Revision
+        setting.deprecated = fields.Deprecated
+        setting.deprecatedAt = fields.DeprecatedAt
+        setting.deprecationReason = fields.DeprecationReason
+        setting.createdAt = fields.CreatedAt
+        setting.createdBy = fields.CreatedBy
+        setting.updatedAt = fields.UpdatedAt
+        setting.updatedBy = fields.UpdatedBy
+        setting.typ = typ
+        setting.value = fields.Value
+
+        return setting, nil
+}
+
 func (setting *Setting) Type() Type {
         gossert.Ok(nil != setting, "setting: cannot return type of nil setting")
         return setting.typ
@@ -33,4 +77,4 @@ func (setting *Setting) String() string {
 func (setting *Setting) Value() any {
         gossert.Ok(nil != setting, "setting: cannot return value of nil setting")
         return setting.value
-}
\ No newline at end of file
+}
@@ -0,0 +1,67 @@
+package configman
+
+import (
+        "errors"
+        "regexp"
+        "time"
+)
+
+var ErrInvalidSnapshot = errors.New("configman: snapshot names must be at most 63 letters, digits, '-', '_' or '.', starting with a letter or digit")
+var ErrNotInSnapshot = errors.New("configman: config is not in the snapshot")
+
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// ValidSnapshotName returns ErrInvalidSnapshot if name cannot be the
+// name of a snapshot.
+func ValidSnapshotName(name string) error {
+        if !snapshotNamePattern.MatchString(name) {
+                return ErrInvalidSnapshot
+        }
+
+        return nil
+}
+
+// A Snapshot is a named point in the history of a store, of one config
+// or of every config. It only records the revision it was taken at; the
+// settings are read back from history, which is only appended to, so a
+// snapshot cannot change. Renaming a config renames it in history and
+// its snapshots alike.
+type Snapshot struct {
+        Name        string
+        Description string
+        Config      string // empty if the snapshot is of every config
+        Revision    int64  // last revision of history in the snapshot
+        CreatedAt   time.Time
+        CreatedBy   string
+}
+
+// Includes reports whether config is in the snapshot.
+func (snapshot *Snapshot) Includes(config string) bool {
+        return snapshot.Config == "" || snapshot.Config == config
+}
+
+// SnapshotStore is implemented by stores that can read configs as they
+// were at a past revision of their history, and name revisions with
+// snapshots.
+type SnapshotStore interface {
+        // CreateSnapshot takes a snapshot named name of config, or of
+        // every config if config is empty, at the latest revision.
+        // ErrExists is returned if the name is taken and ErrNotFound if
+        // config does not exist.
+        CreateSnapshot(name, desc, config, by string) (*Snapshot, error)
+
+        // GetSnapshot returns the snapshot named name if it exists,
+        // otherwise nil.
+        GetSnapshot(name string) (*Snapshot, error)
+
+        // GetSnapshots returns every snapshot, newest first.
+        GetSnapshots() ([]Snapshot, error)
+
+        // RevisionAt returns the last revision of history made at or
+        // before t, 0 if there is none.
+        RevisionAt(t time.Time) (int64, error)
+
+        // GetSettingsAt returns the settings config had once revision
+        // was applied, ordered by name.
+        GetSettingsAt(config string, revision int64) ([]*Setting, error)
+}
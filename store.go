@@ -1,9 +1,19 @@
 package configman
 
+import (
+        "context"
+        "errors"
+)
+
+var ErrNotFound = errors.New("configman: config or setting does not exist")
+var ErrExists = errors.New("configman: setting already exists")
+var ErrConflict = errors.New("configman: revision does not match, it was changed by someone else")
+
 // A Store implements how configs and settings are stored in disk and
 // later retrieved.
 type Store interface {
         // CreateConfig creates a new config with the given name and description.
+        // ErrExists is returned if a config with the same name exists.
         CreateConfig(name, desc string) (Config, error)
 
         // GetConfig returns the config with the given name if it exists otherwise
@@ -12,4 +22,74 @@ type Store interface {
 
         // GetConfigs returns all configs.
         GetConfigs() (configs []Config, err error)
+
+        // DeleteConfig deletes the config with the given name along with
+        // all of its settings, as the actor by. ErrNotFound is returned if
+        // the config does not exist. Stores that are TrashStores keep it
+        // in their trash.
+        DeleteConfig(name, by string) error
+
+        // DeprecateConfig marks the config with the given name as
+        // deprecated for the given reason. Deprecating it again only
+        // changes the reason. ErrNotFound is returned if the config does
+        // not exist.
+        DeprecateConfig(name, reason string) error
+
+        // DeprecateConfigIf is like DeprecateConfig but fails with
+        // ErrConflict unless the config is at the given revision. A
+        // revision of zero matches any revision.
+        DeprecateConfigIf(name, reason string, revision int64) error
+
+        // GetSetting returns the setting with the given name in the given
+        // config if it exists otherwise nil.
+        GetSetting(config, name string) (*Setting, error)
+
+        // GetSettings returns all settings of the given config.
+        GetSettings(config string) (settings []*Setting, err error)
+
+        // ApplyBatch applies every operation of the batch in one
+        // transaction. Either all operations are applied or none are. The
+        // batch is recorded as a single revision in the history of the
+        // store and the returned change event describes it.
+        ApplyBatch(batch *Batch, by string) (*ChangeEvent, error)
+}
+
+// Extension returns store as T if it implements T, e.g. a FlagStore.
+// Stores that wrap another store, like a cache, return it from an
+// Unwrap method; Extension then looks for T in the wrapped store too.
+func Extension[T any](store Store) (T, bool) {
+        var none T
+
+        for store != nil {
+                if ext, ok := store.(T); ok {
+                        return ext, true
+                }
+
+                wrapper, ok := store.(interface{ Unwrap() Store })
+
+                if !ok {
+                        break
+                }
+
+                store = wrapper.Unwrap()
+        }
+
+        return none, false
+}
+
+// A Binder is a store that can be bound to a context, so that what it
+// does for a request, like starting spans, is part of that request.
+// Binders that wrap another store bind it too.
+type Binder interface {
+        // Bind returns a copy of the store bound to ctx.
+        Bind(ctx context.Context) Store
+}
+
+// Bind returns store bound to ctx if it is a Binder, otherwise store.
+func Bind(ctx context.Context, store Store) Store {
+        if binder, ok := store.(Binder); ok {
+                return binder.Bind(ctx)
+        }
+
+        return store
 }
@@ -1,9 +1,204 @@
 package cached
 
-import "github.com/vlence/configman"
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/metrics"
+	"github.com/vlence/gossert"
+)
+
+// CachedStore keeps the settings of configs in memory so that reading
+// them does not hit the wrapped store every time. Settings are read
+// again once they are older than the TTL of the cache or, if the wrapped
+// store is a configman.Watcher and Run is running, as soon as they
+// change.
 type CachedStore struct {
         configman.Store
-        configs map[string]*configman.Config
-        settings map[*configman.Config][]*configman.Setting
+
+        ttl      time.Duration
+        mu       sync.Mutex
+        settings map[string]cachedSettings
+
+        // Incremented whenever settings are forgotten so that settings
+        // read before a change are not cached after it.
+        generation uint64
+
+        logger *slog.Logger
+
+        // Count reads of settings answered from memory and from the
+        // wrapped store. Nil unless WithMetrics is given.
+        hits   *metrics.Counter
+        misses *metrics.Counter
+}
+
+// An Option configures a CachedStore made by NewCachedStore.
+type Option func(store *CachedStore)
+
+// WithLogger makes the cache log to logger instead of slog.Default().
+// Hits, misses and forgotten settings are logged at debug level.
+func WithLogger(logger *slog.Logger) Option {
+        return func(store *CachedStore) {
+                store.logger = logger
+        }
+}
+
+// cachedSettings are the settings of a config and when they were read.
+type cachedSettings struct {
+        settings []*configman.Setting
+        readAt   time.Time
+}
+
+// WithMetrics makes the cache count its hits and misses in reg.
+func WithMetrics(reg *metrics.Registry) Option {
+        return func(store *CachedStore) {
+                store.hits = reg.Counter("configman_cache_hits_total", "Reads of settings answered by the cache.")
+                store.misses = reg.Counter("configman_cache_misses_total", "Reads of settings the cache passed on to the store.")
+        }
+}
+
+// NewCachedStore returns a CachedStore that wraps store and keeps
+// settings for at most ttl.
+func NewCachedStore(store configman.Store, ttl time.Duration, opts ...Option) *CachedStore {
+        gossert.Ok(store != nil, "cached: received nil instead of store")
+        gossert.Ok(ttl > 0, "cached: ttl must be positive")
+
+        cache := &CachedStore{
+                Store:    store,
+                ttl:      ttl,
+                settings: make(map[string]cachedSettings),
+                logger:   slog.Default(),
+        }
+
+        for _, opt := range opts {
+                opt(cache)
+        }
+
+        gossert.Ok(cache.logger != nil, "cached: received nil instead of logger")
+
+        return cache
+}
+
+// Unwrap returns the wrapped store. See configman.Extension.
+func (store *CachedStore) Unwrap() configman.Store {
+        return store.Store
+}
+
+// Run forgets the settings of configs as soon as the wrapped store
+// reports they changed, until ctx is done. It returns right away if the
+// wrapped store is not a configman.Watcher.
+func (store *CachedStore) Run(ctx context.Context) {
+        watcher, ok := configman.Extension[configman.Watcher](store.Store)
+
+        if !ok {
+                return
+        }
+
+        for ctx.Err() == nil {
+                for event := range watcher.Watch(ctx) {
+                        store.forget(event.Configs()...)
+                }
+
+                // the channel is also closed if we fell behind, in which
+                // case changes may have been missed
+                if ctx.Err() == nil {
+                        store.logger.Warn("cached: fell behind the changes of the store, forgetting every setting")
+                }
+
+                store.forgetAll()
+        }
+}
+
+// GetSettings returns all settings of the given config.
+func (store *CachedStore) GetSettings(config string) ([]*configman.Setting, error) {
+        store.mu.Lock()
+        cached, ok := store.settings[config]
+        generation := store.generation
+        store.mu.Unlock()
+
+        if ok && time.Since(cached.readAt) < store.ttl {
+                store.logger.Debug("cached: hit", "config", config, "age", time.Since(cached.readAt))
+                store.hits.Inc()
+                return slices.Clone(cached.settings), nil
+        }
+
+        store.misses.Inc()
+
+        readAt := time.Now()
+        settings, err := store.Store.GetSettings(config)
+
+        if err != nil {
+                return settings, err
+        }
+
+        store.logger.Debug("cached: miss", "config", config, "duration", time.Since(readAt))
+
+        store.mu.Lock()
+
+        if generation == store.generation {
+                store.settings[config] = cachedSettings{settings: slices.Clone(settings), readAt: readAt}
+        }
+
+        store.mu.Unlock()
+
+        return settings, nil
+}
+
+// GetSetting returns the setting with the given name in the given config
+// if it exists otherwise nil.
+func (store *CachedStore) GetSetting(config, name string) (*configman.Setting, error) {
+        settings, err := store.GetSettings(config)
+
+        if err != nil {
+                return nil, err
+        }
+
+        for _, setting := range settings {
+                if setting.Name() == name {
+                        return setting, nil
+                }
+        }
+
+        return nil, nil
+}
+
+// ApplyBatch applies batch to the wrapped store and forgets the settings
+// of the configs it changed.
+func (store *CachedStore) ApplyBatch(batch *configman.Batch, by string) (*configman.ChangeEvent, error) {
+        defer store.forget(batch.Configs()...)
+        return store.Store.ApplyBatch(batch, by)
+}
+
+// DeleteConfig deletes the config from the wrapped store and forgets its
+// settings.
+func (store *CachedStore) DeleteConfig(name, by string) error {
+        defer store.forget(name)
+        return store.Store.DeleteConfig(name, by)
+}
+
+// forget drops the cached settings of configs.
+func (store *CachedStore) forget(configs ...string) {
+        store.mu.Lock()
+        defer store.mu.Unlock()
+
+        store.generation++
+
+        for _, config := range configs {
+                delete(store.settings, config)
+        }
+
+        store.logger.Debug("cached: forgot settings", "configs", configs)
+}
+
+// forgetAll drops every cached setting.
+func (store *CachedStore) forgetAll() {
+        store.mu.Lock()
+        defer store.mu.Unlock()
+
+        store.generation++
+        clear(store.settings)
 }
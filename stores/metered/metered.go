@@ -0,0 +1,116 @@
+// Package metered records metrics of the operations of any
+// configman.Store.
+package metered
+
+import (
+	"context"
+	"time"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/metrics"
+	"github.com/vlence/gossert"
+)
+
+// MeteredStore counts the operations of the store it wraps, how many of
+// them failed and how long they took. Only the methods of
+// configman.Store are measured; extensions, which configman.Extension
+// finds through Unwrap, are not.
+type MeteredStore struct {
+        configman.Store
+
+        operations *metrics.Counter
+        errors     *metrics.Counter
+        durations  *metrics.Histogram
+}
+
+// NewMeteredStore returns a MeteredStore that wraps store and records
+// its metrics in reg, labelled by operation.
+func NewMeteredStore(store configman.Store, reg *metrics.Registry) *MeteredStore {
+        gossert.Ok(store != nil, "metered: received nil instead of store")
+        gossert.Ok(reg != nil, "metered: received nil instead of registry")
+
+        return &MeteredStore{
+                Store:      store,
+                operations: reg.Counter("configman_store_operations_total", "Store operations performed.", "operation"),
+                errors:     reg.Counter("configman_store_operation_errors_total", "Store operations that returned an error.", "operation"),
+                durations:  reg.Histogram("configman_store_operation_duration_seconds", "How long store operations took.", nil, "operation"),
+        }
+}
+
+// Bind implements configman.Binder. The wrapped store is bound to ctx.
+func (store *MeteredStore) Bind(ctx context.Context) configman.Store {
+        bound := *store
+        bound.Store = configman.Bind(ctx, store.Store)
+
+        return &bound
+}
+
+// Unwrap returns the wrapped store. See configman.Extension.
+func (store *MeteredStore) Unwrap() configman.Store {
+        return store.Store
+}
+
+// measure records an operation that started at start and failed if *err
+// is not nil. Call it deferred with a pointer to the named error result.
+func (store *MeteredStore) measure(operation string, start time.Time, err *error) {
+        store.operations.Inc(operation)
+        store.durations.Observe(time.Since(start).Seconds(), operation)
+
+        if *err != nil {
+                store.errors.Inc(operation)
+        }
+}
+
+// CreateConfig implements configman.Store.
+func (store *MeteredStore) CreateConfig(name, desc string) (_ configman.Config, err error) {
+        defer store.measure("create_config", time.Now(), &err)
+        return store.Store.CreateConfig(name, desc)
+}
+
+// GetConfig implements configman.Store.
+func (store *MeteredStore) GetConfig(name string) (_ configman.Config, err error) {
+        defer store.measure("get_config", time.Now(), &err)
+        return store.Store.GetConfig(name)
+}
+
+// GetConfigs implements configman.Store.
+func (store *MeteredStore) GetConfigs() (_ []configman.Config, err error) {
+        defer store.measure("get_configs", time.Now(), &err)
+        return store.Store.GetConfigs()
+}
+
+// DeleteConfig implements configman.Store.
+func (store *MeteredStore) DeleteConfig(name, by string) (err error) {
+        defer store.measure("delete_config", time.Now(), &err)
+        return store.Store.DeleteConfig(name, by)
+}
+
+// DeprecateConfig implements configman.Store.
+func (store *MeteredStore) DeprecateConfig(name, reason string) (err error) {
+        defer store.measure("deprecate_config", time.Now(), &err)
+        return store.Store.DeprecateConfig(name, reason)
+}
+
+// DeprecateConfigIf implements configman.Store.
+func (store *MeteredStore) DeprecateConfigIf(name, reason string, revision int64) (err error) {
+        defer store.measure("deprecate_config", time.Now(), &err)
+        return store.Store.DeprecateConfigIf(name, reason, revision)
+}
+
+// GetSetting implements configman.Store.
+func (store *MeteredStore) GetSetting(config, name string) (_ *configman.Setting, err error) {
+        defer store.measure("get_setting", time.Now(), &err)
+        return store.Store.GetSetting(config, name)
+}
+
+// GetSettings implements configman.Store.
+func (store *MeteredStore) GetSettings(config string) (_ []*configman.Setting, err error) {
+        defer store.measure("get_settings", time.Now(), &err)
+        return store.Store.GetSettings(config)
+}
+
+// ApplyBatch implements configman.Store.
+func (store *MeteredStore) ApplyBatch(batch *configman.Batch, by string) (_ *configman.ChangeEvent, err error) {
+        defer store.measure("apply_batch", time.Now(), &err)
+        return store.Store.ApplyBatch(batch, by)
+}
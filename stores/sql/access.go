@@ -0,0 +1,214 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errAccessTables = fmt.Errorf("sqlstore: failed to create access control tables")
+var errGrantRole = fmt.Errorf("sqlstore: failed to grant role")
+var errRevokeRole = fmt.Errorf("sqlstore: failed to revoke role")
+var errGetGrants = fmt.Errorf("sqlstore: failed to get grants")
+var errRecordDenial = fmt.Errorf("sqlstore: failed to record denial")
+var errGetDenials = fmt.Errorf("sqlstore: failed to get denials")
+
+// initAccessTables creates the grants and access_denials tables. A
+// principal has at most one role per config.
+func (store *SqlStore) initAccessTables() error {
+        var tx *sql.Tx
+        var txErr, commitErr, execErr error
+
+        if tx, txErr = store.db.Begin(); txErr != nil {
+                return errors.Join(errAccessTables, txErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS grants (
+                        principal TEXT NOT NULL,
+                        config_name TEXT NOT NULL,
+                        role TEXT NOT NULL,
+                        created_at INTEGER NOT NULL,
+                        PRIMARY KEY (principal, config_name)
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errAccessTables, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS access_denials (
+                        id INTEGER PRIMARY KEY,
+                        principal TEXT NOT NULL,
+                        config_name TEXT NOT NULL,
+                        role TEXT NOT NULL,
+                        action TEXT NOT NULL,
+                        created_at INTEGER NOT NULL
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errAccessTables, execErr)
+        }
+
+        if commitErr = tx.Commit(); commitErr != nil {
+                return errors.Join(errAccessTables, commitErr)
+        }
+
+        return nil
+}
+
+// prepAccessStmts prepares the SQL statements used for access control.
+func (store *SqlStore) prepAccessStmts() error {
+        var err error
+
+        store.grantRoleStmt, err = store.prepare("grantRole", 1, `
+                INSERT INTO grants (principal, config_name, role, created_at)
+                VALUES (?, ?, ?, ?)
+                ON CONFLICT (principal, config_name) DO UPDATE SET role = excluded.role
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.revokeRoleStmt, err = store.prepare("revokeRole", 1, "DELETE FROM grants WHERE principal = ? AND config_name = ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.getGrantsStmt, err = store.prepare("getGrants", noConfig, `
+                SELECT principal, config_name, role
+                FROM grants
+                WHERE ? = '' OR principal = ?
+                ORDER BY principal, config_name
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.recordDenialStmt, err = store.prepare("recordDenial", 1, `
+                INSERT INTO access_denials (principal, config_name, role, action, created_at)
+                VALUES (?, ?, ?, ?, ?)
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getDenialsStmt, err = store.prepare("getDenials", noConfig, `
+                SELECT principal, config_name, role, action, created_at
+                FROM access_denials
+                ORDER BY id DESC
+                LIMIT ?
+        `)
+
+        return err
+}
+
+// GrantRole gives principal role on config, replacing any role
+// principal had on it.
+func (store *SqlStore) GrantRole(principal, config string, role configman.Role) (err error) {
+        defer store.observe("grant role", "principal", principal, "config", config, "role", role)(&err)
+
+        if _, err := configman.ParseRole(string(role)); err != nil {
+                return errors.Join(errGrantRole, err)
+        }
+
+        if _, err := store.grantRoleStmt.Exec(principal, config, role, time.Now().Unix()); err != nil {
+                return errors.Join(errGrantRole, err)
+        }
+
+        return nil
+}
+
+// RevokeRole removes the role principal has on config.
+func (store *SqlStore) RevokeRole(principal, config string) (err error) {
+        defer store.observe("revoke role", "principal", principal, "config", config)(&err)
+
+        if _, err := store.revokeRoleStmt.Exec(principal, config); err != nil {
+                return errors.Join(errRevokeRole, err)
+        }
+
+        return nil
+}
+
+// GetGrants returns the grants of principal, or of every principal if
+// principal is empty.
+func (store *SqlStore) GetGrants(principal string) ([]configman.Grant, error) {
+        var rows *sql.Rows
+        var err error
+
+        grants := make([]configman.Grant, 0)
+
+        if rows, err = store.getGrantsStmt.Query(principal, principal); err != nil {
+                return grants, errors.Join(errGetGrants, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var grant configman.Grant
+
+                if err = rows.Scan(&grant.Principal, &grant.Config, &grant.Role); err != nil {
+                        return grants, errors.Join(errGetGrants, err)
+                }
+
+                grants = append(grants, grant)
+        }
+
+        if err = rows.Err(); err != nil {
+                return grants, errors.Join(errGetGrants, err)
+        }
+
+        return grants, nil
+}
+
+// RecordDenial stores denial for auditing.
+func (store *SqlStore) RecordDenial(denial configman.Denial) error {
+        _, err := store.recordDenialStmt.Exec(denial.Principal, denial.Config, denial.Role, denial.Action, denial.At.Unix())
+
+        if err != nil {
+                return errors.Join(errRecordDenial, err)
+        }
+
+        return nil
+}
+
+// GetDenials returns the most recent denials, newest first.
+func (store *SqlStore) GetDenials(limit int) ([]configman.Denial, error) {
+        var rows *sql.Rows
+        var err error
+
+        denials := make([]configman.Denial, 0)
+
+        if rows, err = store.getDenialsStmt.Query(limit); err != nil {
+                return denials, errors.Join(errGetDenials, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var at int64
+                var denial configman.Denial
+
+                if err = rows.Scan(&denial.Principal, &denial.Config, &denial.Role, &denial.Action, &at); err != nil {
+                        return denials, errors.Join(errGetDenials, err)
+                }
+
+                denial.At = time.Unix(at, 0)
+                denials = append(denials, denial)
+        }
+
+        if err = rows.Err(); err != nil {
+                return denials, errors.Join(errGetDenials, err)
+        }
+
+        return denials, nil
+}
@@ -0,0 +1,281 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errAuditTable = fmt.Errorf("sqlstore: failed to create audit log table")
+var errRecordAudit = fmt.Errorf("sqlstore: failed to record audit entry")
+var errQueryAudit = fmt.Errorf("sqlstore: failed to query audit log")
+var errVerifyAudit = fmt.Errorf("sqlstore: failed to verify audit log")
+
+// auditAttempts is how many times RecordAudit tries to append an entry
+// while other processes append theirs, waiting up to maxAuditBackoff in
+// between.
+const auditAttempts = 20
+const maxAuditBackoff = 100 * time.Millisecond
+
+// auditColumns are the columns selected by every query that reads audit
+// entries. Use scanAuditEntry to scan rows selected with these columns.
+const auditColumns = `
+        id,
+        created_at,
+        actor,
+        action,
+        config_name,
+        setting_name,
+        outcome,
+        prev_hash,
+        hash
+`
+
+// initAuditTable creates the audit_log table. Entries are only ever
+// appended; prev_hash is unique so that two processes appending at the
+// same time cannot fork the chain.
+func (store *SqlStore) initAuditTable() error {
+        _, err := store.db.Exec(`
+                CREATE TABLE IF NOT EXISTS audit_log (
+                        id INTEGER PRIMARY KEY,
+                        created_at INTEGER NOT NULL,
+                        actor TEXT NOT NULL,
+                        action TEXT NOT NULL,
+                        config_name TEXT NOT NULL,
+                        setting_name TEXT NOT NULL,
+                        outcome TEXT NOT NULL,
+                        prev_hash TEXT NOT NULL UNIQUE,
+                        hash TEXT NOT NULL
+                )
+        `)
+
+        if err != nil {
+                return errors.Join(errAuditTable, err)
+        }
+
+        return nil
+}
+
+// prepAuditStmts prepares the SQL statements used for the audit log.
+func (store *SqlStore) prepAuditStmts() error {
+        var err error
+
+        store.getLastAuditStmt, err = store.prepare("getLastAudit", noConfig, "SELECT id, hash FROM audit_log ORDER BY id DESC LIMIT 1")
+
+        if err != nil {
+                return err
+        }
+
+        store.insertAuditStmt, err = store.prepare("insertAudit", 4, `
+                INSERT INTO audit_log (id, created_at, actor, action, config_name, setting_name, outcome, prev_hash, hash)
+                VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.queryAuditStmt, err = store.prepare("queryAudit", 3, `
+                SELECT ` + auditColumns + `
+                FROM audit_log
+                WHERE (? = '' OR actor = ?)
+                        AND (? = '' OR config_name = ?)
+                        AND created_at >= ?
+                        AND created_at < ?
+                ORDER BY id DESC
+                LIMIT ?
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getAuditStmt, err = store.prepare("getAudit", noConfig, "SELECT " + auditColumns + " FROM audit_log ORDER BY id")
+
+        return err
+}
+
+// RecordAudit implements configman.AuditStore. The entry is chained to
+// the last one and inserted by a single statement, outside of any
+// transaction, so that a failed attempt never holds a lock. Another
+// process appending at the same time takes the ID and previous hash of
+// the entry first, which are unique, or locks the database; the entry is
+// then chained again after a short wait, so that it is never lost or
+// chained to the same entry twice.
+func (store *SqlStore) RecordAudit(entry configman.AuditEntry) (_ *configman.AuditEntry, err error) {
+        var recorded *configman.AuditEntry
+
+        defer store.observe("record audit", "actor", entry.Actor, "action", entry.Action)(&err)
+
+        store.auditMu.Lock()
+        defer store.auditMu.Unlock()
+
+        if entry.At.IsZero() {
+                entry.At = time.Now()
+        }
+
+        for attempt := 1; ; attempt++ {
+                if recorded, err = store.appendAudit(entry); err == nil || attempt == auditAttempts || !appendRaced(err) {
+                        return recorded, err
+                }
+
+                backoff := min(time.Millisecond<<attempt, maxAuditBackoff)
+                time.Sleep(backoff/2 + rand.N(backoff/2))
+        }
+}
+
+// appendAudit chains entry to the last entry of the audit log and
+// appends it.
+func (store *SqlStore) appendAudit(entry configman.AuditEntry) (*configman.AuditEntry, error) {
+        var lastID int64
+        var lastHash string
+
+        err := store.getLastAuditStmt.QueryRow().Scan(&lastID, &lastHash)
+
+        if err != nil && err != sql.ErrNoRows {
+                return nil, errors.Join(errRecordAudit, err)
+        }
+
+        entry.ID = lastID + 1
+        entry.PrevHash = lastHash
+        entry.Hash = entry.ComputeHash()
+
+        _, err = store.insertAuditStmt.Exec(
+                entry.ID,
+                entry.At.UnixNano(),
+                entry.Actor,
+                entry.Action,
+                entry.Config,
+                entry.Setting,
+                entry.Outcome,
+                entry.PrevHash,
+                entry.Hash,
+        )
+
+        if err != nil {
+                return nil, errors.Join(errRecordAudit, err)
+        }
+
+        return &entry, nil
+}
+
+// appendRaced returns true if appending an audit entry failed with err
+// because another process was appending one at the same time: the
+// database was locked, or the ID or previous hash of the entry was
+// taken.
+func appendRaced(err error) bool {
+        msg := strings.ToLower(err.Error())
+
+        return strings.Contains(msg, "database is locked") || strings.Contains(msg, "sqlite_busy") || strings.Contains(msg, "unique constraint")
+}
+
+// QueryAudit implements configman.AuditStore.
+func (store *SqlStore) QueryAudit(query configman.AuditQuery) (_ []configman.AuditEntry, err error) {
+        var rows *sql.Rows
+        var entry *configman.AuditEntry
+
+        defer store.observe("query audit", "actor", query.Actor, "config", query.Config)(&err)
+
+        entries := make([]configman.AuditEntry, 0)
+        since, until := int64(0), int64(1<<63-1)
+        limit := query.Limit
+
+        if !query.Since.IsZero() {
+                since = query.Since.UnixNano()
+        }
+
+        if !query.Until.IsZero() {
+                until = query.Until.UnixNano()
+        }
+
+        if limit <= 0 {
+                limit = -1
+        }
+
+        rows, err = store.queryAuditStmt.Query(query.Actor, query.Actor, query.Config, query.Config, since, until, limit)
+
+        if err != nil {
+                return entries, errors.Join(errQueryAudit, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if entry, err = scanAuditEntry(rows); err != nil {
+                        return entries, errors.Join(errQueryAudit, err)
+                }
+
+                entries = append(entries, *entry)
+        }
+
+        if err = rows.Err(); err != nil {
+                return entries, errors.Join(errQueryAudit, err)
+        }
+
+        return entries, nil
+}
+
+// VerifyAudit implements configman.AuditStore.
+func (store *SqlStore) VerifyAudit() (err error) {
+        var rows *sql.Rows
+        var entry *configman.AuditEntry
+
+        defer store.observe("verify audit")(&err)
+
+        if rows, err = store.getAuditStmt.Query(); err != nil {
+                return errors.Join(errVerifyAudit, err)
+        }
+
+        defer rows.Close()
+
+        prevID, prevHash := int64(0), ""
+
+        for rows.Next() {
+                if entry, err = scanAuditEntry(rows); err != nil {
+                        return errors.Join(errVerifyAudit, err)
+                }
+
+                if entry.ID != prevID+1 || entry.PrevHash != prevHash || entry.Hash != entry.ComputeHash() {
+                        return fmt.Errorf("sqlstore: audit entry %d: %w", entry.ID, configman.ErrAuditTampered)
+                }
+
+                prevID, prevHash = entry.ID, entry.Hash
+        }
+
+        if err = rows.Err(); err != nil {
+                return errors.Join(errVerifyAudit, err)
+        }
+
+        return nil
+}
+
+// scanAuditEntry scans a row selected with auditColumns.
+func scanAuditEntry(row RowScanner) (*configman.AuditEntry, error) {
+        var at int64
+        var entry configman.AuditEntry
+
+        err := row.Scan(
+                &entry.ID,
+                &at,
+                &entry.Actor,
+                &entry.Action,
+                &entry.Config,
+                &entry.Setting,
+                &entry.Outcome,
+                &entry.PrevHash,
+                &entry.Hash,
+        )
+
+        if err != nil {
+                return nil, err
+        }
+
+        entry.At = time.Unix(0, at)
+
+        return &entry, nil
+}
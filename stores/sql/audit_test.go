@@ -0,0 +1,62 @@
+package sqlstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestRecordAuditConcurrently(t *testing.T) {
+        const processes, entries = 4, 25
+
+        file := filepath.Join(t.TempDir(), "configman.db")
+        stores := make([]*SqlStore, processes)
+
+        for i := range stores {
+                stores[i] = openTestStore(t, file)
+        }
+
+        var wg sync.WaitGroup
+
+        errs := make(chan error, processes*entries)
+
+        for i, store := range stores {
+                wg.Add(1)
+
+                go func() {
+                        defer wg.Done()
+
+                        for j := 0; j < entries; j++ {
+                                entry := configman.AuditEntry{Actor: fmt.Sprintf("process-%d", i), Action: fmt.Sprintf("entry %d", j), Outcome: "200"}
+
+                                if _, err := store.RecordAudit(entry); err != nil {
+                                        errs <- err
+                                }
+                        }
+                }()
+        }
+
+        wg.Wait()
+        close(errs)
+
+        for err := range errs {
+                t.Errorf("RecordAudit returned %v", err)
+        }
+
+        recorded, err := stores[0].QueryAudit(configman.AuditQuery{Limit: processes * entries * 2})
+
+        if err != nil {
+                t.Fatalf("failed to query audit log: %v", err)
+        }
+
+        if len(recorded) != processes*entries {
+                t.Errorf("recorded %d entries, want %d", len(recorded), processes*entries)
+        }
+
+        if err = stores[0].VerifyAudit(); err != nil {
+                t.Errorf("VerifyAudit returned %v", err)
+        }
+}
@@ -0,0 +1,401 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errChangeRequestsTable = fmt.Errorf("sqlstore: failed to create change requests table")
+var errSetProtected = fmt.Errorf("sqlstore: failed to set protection of config")
+var errGetProtected = fmt.Errorf("sqlstore: failed to get protection of config")
+var errProposeChange = fmt.Errorf("sqlstore: failed to propose change")
+var errReviewChange = fmt.Errorf("sqlstore: failed to review change")
+var errGetChangeRequests = fmt.Errorf("sqlstore: failed to get change requests")
+
+// changeRequestColumns are the columns selected by every query that
+// reads change requests. Use scanChangeRequest to scan rows selected
+// with these columns.
+const changeRequestColumns = `
+        id,
+        config_name,
+        setting_name,` + valueColumns + `,
+        status,
+        proposed_by,
+        proposed_at,
+        reviewed_by,
+        reviewed_at,
+        comment
+`
+
+// initChangeRequestsTable creates the change_requests table and its
+// indices. reviewed_at is NULL while a request is pending.
+func (store *SqlStore) initChangeRequestsTable() error {
+        var tx *sql.Tx
+        var txErr, commitErr, execErr error
+
+        if tx, txErr = store.db.Begin(); txErr != nil {
+                return errors.Join(errChangeRequestsTable, txErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS change_requests (
+                        id INTEGER PRIMARY KEY,
+                        config_name TEXT NOT NULL,
+                        setting_name TEXT NOT NULL,
+                        value_type INTEGER NOT NULL,
+                        int32_value INTEGER,
+                        int64_value INTEGER,
+                        float32_value REAL,
+                        float64_value REAL,
+                        bool_value BOOLEAN,
+                        string_value TEXT,
+                        status TEXT NOT NULL,
+                        proposed_by TEXT NOT NULL,
+                        proposed_at INTEGER NOT NULL,
+                        reviewed_by TEXT NOT NULL DEFAULT '',
+                        reviewed_at INTEGER,
+                        comment TEXT NOT NULL DEFAULT ''
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errChangeRequestsTable, execErr)
+        }
+
+        // Requests cancelled because their config was deleted record when,
+        // so that restoring the config makes them pending again.
+        if execErr = addColumn(tx, "change_requests", "deleted_at", "INTEGER NOT NULL DEFAULT 0"); execErr != nil {
+                return rollback(tx, errChangeRequestsTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE INDEX IF NOT EXISTS change_requests_configname_status_index ON change_requests (
+                        config_name,
+                        status
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errChangeRequestsTable, execErr)
+        }
+
+        if commitErr = tx.Commit(); commitErr != nil {
+                return errors.Join(errChangeRequestsTable, commitErr)
+        }
+
+        return nil
+}
+
+// prepChangeRequestStmts prepares the SQL statements used by the
+// approval workflow.
+func (store *SqlStore) prepChangeRequestStmts() error {
+        var err error
+
+        store.getProtectedStmt, err = store.prepare("getProtected", 0, "SELECT protected FROM configs WHERE name = ? AND deleted_at = 0")
+
+        if err != nil {
+                return err
+        }
+
+        store.setProtectedStmt, err = store.prepare("setProtected", 2, `
+                UPDATE configs
+                SET protected = ?,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE name = ? AND deleted_at = 0
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.proposeChangeStmt, err = store.prepare("proposeChange", 0, `
+                INSERT INTO change_requests (
+                        config_name,
+                        setting_name,` + valueColumns + `,
+                        status,
+                        proposed_by,
+                        proposed_at
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getChangeRequestStmt, err = store.prepare("getChangeRequest", noConfig, "SELECT" + changeRequestColumns + "FROM change_requests WHERE id = ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.getChangeRequestsStmt, err = store.prepare("getChangeRequests", 0, `
+                SELECT` + changeRequestColumns + `
+                FROM change_requests
+                WHERE config_name = ? AND status = ?
+                ORDER BY proposed_at, id
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        // Only pending requests can be reviewed. Checking the status in
+        // the update makes sure a request is reviewed at most once even
+        // when two reviewers race.
+        store.reviewChangeRequestStmt, err = store.prepare("reviewChangeRequest", noConfig, `
+                UPDATE change_requests
+                SET status = ?,
+                    reviewed_by = ?,
+                    reviewed_at = ?,
+                    comment = ?
+                WHERE id = ? AND status = 'pending'
+        `)
+
+        return err
+}
+
+// SetProtected marks the given config as protected or not.
+func (store *SqlStore) SetProtected(config string, protected bool) (err error) {
+        var affected int64
+
+        defer store.observe("set protected", "config", config, "protected", protected)(&err)
+
+        if affected, err = execAffected(store.setProtectedStmt, protected, time.Now().Unix(), config); err != nil {
+                return errors.Join(errSetProtected, err)
+        }
+
+        if affected == 0 {
+                return fmt.Errorf("sqlstore: config %s: %w", config, configman.ErrNotFound)
+        }
+
+        return nil
+}
+
+// Protected returns true if the given config is protected. A config
+// that does not exist is not protected.
+func (store *SqlStore) Protected(config string) (bool, error) {
+        var protected bool
+
+        err := store.getProtectedStmt.QueryRow(config).Scan(&protected)
+
+        if err == sql.ErrNoRows {
+                return false, nil
+        }
+
+        if err != nil {
+                return false, errors.Join(errGetProtected, err)
+        }
+
+        return protected, nil
+}
+
+// checkProtected returns configman.ErrProtectedConfig if the given
+// config is protected. Every direct write to a config or its settings
+// must call it within its transaction, so that the config cannot become
+// protected between the check and the write.
+func (store *SqlStore) checkProtected(tx *sql.Tx, config string) error {
+        var protected bool
+
+        err := store.getProtectedStmt.in(tx).QueryRow(config).Scan(&protected)
+
+        if err != nil && err != sql.ErrNoRows {
+                return errors.Join(errGetProtected, err)
+        }
+
+        if protected {
+                return configman.ErrProtectedConfig
+        }
+
+        return nil
+}
+
+// ProposeChange stores a pending request to set value on the given
+// setting. The setting must exist and value must be of the same type as
+// the setting.
+func (store *SqlStore) ProposeChange(config, setting string, value any, by string) (_ *configman.ChangeRequest, err error) {
+        var result sql.Result
+        var target *configman.Setting
+
+        defer store.observe("propose change", "config", config, "setting", setting, "by", by)(&err)
+
+        if target, err = store.GetSetting(config, setting); err != nil {
+                return nil, errors.Join(errProposeChange, err)
+        }
+
+        if target == nil {
+                return nil, errors.Join(errProposeChange, errSettingNotFound(config, setting))
+        }
+
+        if configman.TypeOf(value) != target.Type() {
+                return nil, errors.Join(errProposeChange, configman.ErrTypeMismatch)
+        }
+
+        v := newSqlValue(value)
+        now := time.Now()
+
+        args := []any{config, setting}
+        args = append(args, v.args()...)
+        args = append(args, configman.StatusPending, by, now.Unix())
+
+        if result, err = store.proposeChangeStmt.Exec(args...); err != nil {
+                return nil, errors.Join(errProposeChange, err)
+        }
+
+        request := &configman.ChangeRequest{
+                Config:     config,
+                Setting:    setting,
+                Value:      value,
+                Status:     configman.StatusPending,
+                ProposedBy: by,
+                ProposedAt: time.Unix(now.Unix(), 0),
+        }
+
+        if request.ID, err = result.LastInsertId(); err != nil {
+                return request, errors.Join(errProposeChange, err)
+        }
+
+        return request, nil
+}
+
+// ApproveChange approves the pending change request with the given id
+// and sets the value of its setting in the same transaction.
+func (store *SqlStore) ApproveChange(id int64, by string) error {
+        return store.reviewChange(id, by, configman.StatusApproved, "")
+}
+
+// RejectChange rejects the pending change request with the given id.
+func (store *SqlStore) RejectChange(id int64, by, comment string) error {
+        return store.reviewChange(id, by, configman.StatusRejected, comment)
+}
+
+// reviewChange sets the status of a pending change request and, if it
+// was approved, applies it.
+func (store *SqlStore) reviewChange(id int64, by string, status configman.ChangeStatus, comment string) (err error) {
+        var tx *sql.Tx
+        var affected int64
+        var result sql.Result
+        var request *configman.ChangeRequest
+        var event *configman.ChangeEvent
+
+        defer store.observe("review change", "id", id, "status", status, "by", by)(&err)
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errReviewChange, err)
+        }
+
+        request, err = scanChangeRequest(store.getChangeRequestStmt.in(tx).QueryRow(id))
+
+        if err == sql.ErrNoRows {
+                return rollback(tx, configman.ErrNotPending)
+        }
+
+        if err != nil {
+                return rollback(tx, errReviewChange, err)
+        }
+
+        if !request.Pending() {
+                return rollback(tx, configman.ErrNotPending)
+        }
+
+        if request.ProposedBy == by {
+                return rollback(tx, configman.ErrSelfReview)
+        }
+
+        now := time.Now()
+        result, err = store.reviewChangeRequestStmt.in(tx).about(request.Config).Exec(status, by, now.Unix(), comment, id)
+
+        if err != nil {
+                return rollback(tx, errReviewChange, err)
+        }
+
+        if affected, err = result.RowsAffected(); err != nil {
+                return rollback(tx, errReviewChange, err)
+        }
+
+        if affected == 0 {
+                return rollback(tx, configman.ErrNotPending)
+        }
+
+        if status == configman.StatusApproved {
+                ops := []configman.BatchOp{{Kind: configman.OpUpdate, Config: request.Config, Setting: request.Setting, Value: request.Value}}
+
+                if event, err = store.applyOps(tx, ops, request.ProposedBy, now); err != nil {
+                        return rollback(tx, errReviewChange, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errReviewChange, err)
+        }
+
+        if event != nil {
+                store.events.Publish(*event)
+        }
+
+        return nil
+}
+
+// GetChangeRequests returns the pending change requests of the given
+// config, oldest first.
+func (store *SqlStore) GetChangeRequests(config string) ([]*configman.ChangeRequest, error) {
+        var rows *sql.Rows
+        var err error
+        var request *configman.ChangeRequest
+
+        requests := make([]*configman.ChangeRequest, 0)
+
+        if rows, err = store.getChangeRequestsStmt.Query(config, configman.StatusPending); err != nil {
+                return requests, errors.Join(errGetChangeRequests, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if request, err = scanChangeRequest(rows); err != nil {
+                        return requests, errors.Join(errGetChangeRequests, err)
+                }
+
+                requests = append(requests, request)
+        }
+
+        if err = rows.Err(); err != nil {
+                return requests, errors.Join(errGetChangeRequests, err)
+        }
+
+        return requests, nil
+}
+
+// scanChangeRequest scans a row selected with changeRequestColumns.
+func scanChangeRequest(row RowScanner) (*configman.ChangeRequest, error) {
+        var v sqlValue
+        var err error
+        var proposedAt int64
+        var reviewedAt sql.NullInt64
+
+        request := new(configman.ChangeRequest)
+
+        dest := []any{&request.ID, &request.Config, &request.Setting}
+        dest = append(dest, v.dest()...)
+        dest = append(dest, &request.Status, &request.ProposedBy, &proposedAt, &request.ReviewedBy, &reviewedAt, &request.Comment)
+
+        if err = row.Scan(dest...); err != nil {
+                return nil, err
+        }
+
+        if request.Value, err = v.value(); err != nil {
+                return nil, err
+        }
+
+        request.ProposedAt = time.Unix(proposedAt, 0)
+
+        if reviewedAt.Valid {
+                request.ReviewedAt = time.Unix(reviewedAt.Int64, 0)
+        }
+
+        return request, nil
+}
@@ -0,0 +1,114 @@
+package sqlstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestReviewChange(t *testing.T) {
+        tests := []struct {
+                name   string
+                review func(store *SqlStore, id int64) error
+                err    error
+                value  any
+        }{
+                {
+                        name:   "approved by another actor",
+                        review: func(store *SqlStore, id int64) error { return store.ApproveChange(id, "bob") },
+                        value:  int64(60),
+                },
+                {
+                        name:   "rejected by another actor",
+                        review: func(store *SqlStore, id int64) error { return store.RejectChange(id, "bob", "too slow") },
+                        value:  int64(30),
+                },
+                {
+                        name:   "approved by its proposer",
+                        review: func(store *SqlStore, id int64) error { return store.ApproveChange(id, "alice") },
+                        err:    configman.ErrSelfReview,
+                        value:  int64(30),
+                },
+                {
+                        name:   "rejected by its proposer",
+                        review: func(store *SqlStore, id int64) error { return store.RejectChange(id, "alice", "") },
+                        err:    configman.ErrSelfReview,
+                        value:  int64(30),
+                },
+                {
+                        name: "approved after it was rejected",
+                        review: func(store *SqlStore, id int64) error {
+                                if err := store.RejectChange(id, "bob", ""); err != nil {
+                                        return err
+                                }
+
+                                return store.ApproveChange(id, "carol")
+                        },
+                        err:   configman.ErrNotPending,
+                        value: int64(30),
+                },
+                {
+                        name:   "unknown request",
+                        review: func(store *SqlStore, id int64) error { return store.ApproveChange(id+1, "bob") },
+                        err:    configman.ErrNotPending,
+                        value:  int64(30),
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateConfigs(t, store, "app")
+                        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)))
+
+                        if err := store.SetProtected("app", true); err != nil {
+                                t.Fatalf("failed to protect config: %v", err)
+                        }
+
+                        request, err := store.ProposeChange("app", "timeout", int64(60), "alice")
+
+                        if err != nil {
+                                t.Fatalf("failed to propose change: %v", err)
+                        }
+
+                        if err = test.review(store, request.ID); !errors.Is(err, test.err) {
+                                t.Fatalf("review returned %v, want %v", err, test.err)
+                        }
+
+                        if value := valueOf(t, store, "app", "timeout"); value != test.value {
+                                t.Errorf("timeout is %v after the review, want %v", value, test.value)
+                        }
+                })
+        }
+}
+
+func TestApprovedChangeIsMadeByItsProposer(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)))
+
+        request, err := store.ProposeChange("app", "timeout", int64(60), "alice")
+
+        if err != nil {
+                t.Fatalf("failed to propose change: %v", err)
+        }
+
+        if err = store.ApproveChange(request.ID, "bob"); err != nil {
+                t.Fatalf("failed to approve change: %v", err)
+        }
+
+        history, err := store.GetHistory("app", 1)
+
+        if err != nil {
+                t.Fatalf("failed to get history: %v", err)
+        }
+
+        if len(history) != 1 || history[0].By != "alice" {
+                t.Errorf("got history %v, want the change made by alice last", history)
+        }
+
+        if requests, _ := store.GetChangeRequests("app"); len(requests) != 0 {
+                t.Errorf("got %d pending change requests after approval, want 0", len(requests))
+        }
+}
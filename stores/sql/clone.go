@@ -0,0 +1,288 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errCloneConfig = fmt.Errorf("sqlstore: failed to clone config")
+var errRenameConfig = fmt.Errorf("sqlstore: failed to rename config")
+
+// renamedTables are the tables other than configs that refer to configs
+// by name, in their config_name column. The access_denials and audit_log
+// tables are records of what was done and keep the names configs had.
+var renamedTables = []string{
+        "settings",
+        "flag_rules",
+        "scheduled_changes",
+        "change_requests",
+        "history_ops",
+        "grants",
+        "config_labels",
+        "setting_labels",
+        "snapshots",
+}
+
+// prepCloneStmts prepares the SQL statements used to clone and rename
+// configs.
+func (store *SqlStore) prepCloneStmts() error {
+        var err error
+
+        store.cloneConfigStmt, err = store.prepare("cloneConfig", 0, `
+                INSERT INTO configs (name, desc, created_at, updated_at, revision, deprecated, deprecation_reason, deprecated_at)
+                SELECT ?, desc, created_at, updated_at, revision, deprecated, deprecation_reason, deprecated_at
+                FROM configs
+                WHERE id = ?
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.resetConfigStmt, err = store.prepare("resetConfig", noConfig, `
+                UPDATE configs
+                SET created_at = ?,
+                    updated_at = ?,
+                    revision = 1,
+                    deprecated = FALSE,
+                    deprecation_reason = '',
+                    deprecated_at = 0
+                WHERE id = ?
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        // Cloned settings are created by a batch, so they start out new
+        // and only take the times and revisions of the originals after.
+        store.copySettingStatesStmt, err = store.prepare("copySettingStates", 0, `
+                UPDATE settings
+                SET created_at = original.created_at,
+                    updated_at = original.updated_at,
+                    deprecated_at = original.deprecated_at,
+                    revision = original.revision
+                FROM settings AS original
+                WHERE settings.config_name = ? AND original.config_name = ? AND original.name = settings.name AND original.deleted_at = 0
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.renameConfigStmt, err = store.prepare("renameConfig", 0, `
+                UPDATE configs
+                SET name = ?,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE id = ?
+        `)
+
+        return err
+}
+
+// CloneConfig implements configman.CloneStore. The namespace of to must
+// exist.
+func (store *SqlStore) CloneConfig(from, to string, opts configman.CloneOptions, by string) (_ configman.Config, err error) {
+        var tx *sql.Tx
+        var fromId, toId int64
+        var result sql.Result
+        var settings []*configman.Setting
+        var config configman.Config
+
+        event := new(configman.ChangeEvent)
+
+        defer store.observe("clone config", "config", from, "to", to, "by", by)(&err)
+
+        if err = store.checkNamespace(to); err != nil {
+                return nil, errors.Join(errCloneConfig, err)
+        }
+
+        if settings, err = store.GetSettings(from); err != nil {
+                return nil, errors.Join(errCloneConfig, err)
+        }
+
+        batch := new(configman.Batch)
+
+        for _, setting := range settings {
+                batch.Create(to, setting.Name(), setting.Description(), setting.Value())
+
+                if setting.Deprecated() && !opts.Reset {
+                        batch.Deprecate(to, setting.Name(), setting.DeprecationReason())
+                }
+        }
+
+        now := time.Now()
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errCloneConfig, err)
+        }
+
+        if fromId, err = store.configIdIn(tx, from); err != nil {
+                return nil, rollback(tx, errCloneConfig, err)
+        }
+
+        if err = store.checkFreeName(tx, to); err != nil {
+                return nil, rollback(tx, errCloneConfig, err)
+        }
+
+        if _, err = store.purgeConfigs(tx, "name = ? AND deleted_at != 0", to); err != nil {
+                return nil, rollback(tx, errCloneConfig, err)
+        }
+
+        if result, err = store.cloneConfigStmt.in(tx).Exec(to, fromId); err != nil {
+                return nil, rollback(tx, errCloneConfig, err)
+        }
+
+        if toId, err = result.LastInsertId(); err != nil {
+                return nil, rollback(tx, errCloneConfig, err)
+        }
+
+        if opts.Reset {
+                if _, err = store.resetConfigStmt.in(tx).about(to).Exec(now.Unix(), now.Unix(), toId); err != nil {
+                        return nil, rollback(tx, errCloneConfig, err)
+                }
+        }
+
+        if len(batch.Ops) > 0 {
+                if event, err = store.applyOps(tx, batch.Ops, by, now); err != nil {
+                        return nil, rollback(tx, errCloneConfig, err)
+                }
+        }
+
+        if !opts.Reset {
+                if _, err = store.copySettingStatesStmt.in(tx).Exec(to, from); err != nil {
+                        return nil, rollback(tx, errCloneConfig, err)
+                }
+        }
+
+        // Deleted settings are not cloned, and neither are their rules
+        // and labels.
+        for _, query := range []string{
+                `INSERT INTO flag_rules (config_name, setting_name, position, attribute, operator, vals, percentage, bucket_by, value)
+                 SELECT ?, setting_name, position, attribute, operator, vals, percentage, bucket_by, value FROM flag_rules WHERE config_name = ? AND` + settingExists("flag_rules", "deleted_at = 0"),
+                "INSERT INTO config_labels (config_name, key, value) SELECT ?, key, value FROM config_labels WHERE config_name = ?",
+                "INSERT INTO setting_labels (config_name, setting_name, key, value) SELECT ?, setting_name, key, value FROM setting_labels WHERE config_name = ? AND" + settingExists("setting_labels", "deleted_at = 0"),
+        } {
+                if _, err = store.exec(tx, "cloneReferences", to, query, to, from); err != nil {
+                        return nil, rollback(tx, errCloneConfig, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errCloneConfig, err)
+        }
+
+        if event.Revision != 0 {
+                store.events.Publish(*event)
+        }
+
+        if config, err = store.GetConfig(to); err != nil {
+                return nil, errors.Join(errCloneConfig, err)
+        }
+
+        return config, nil
+}
+
+// RenameConfig implements configman.CloneStore. The namespace of to must
+// exist.
+func (store *SqlStore) RenameConfig(from, to, by string) (_ configman.Config, err error) {
+        var tx *sql.Tx
+        var id int64
+        var config configman.Config
+        var event *configman.ChangeEvent
+
+        defer store.observe("rename config", "config", from, "to", to, "by", by)(&err)
+
+        if err = store.checkNamespace(to); err != nil {
+                return nil, errors.Join(errRenameConfig, err)
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errRenameConfig, err)
+        }
+
+        if err = store.checkProtected(tx, from); err != nil {
+                return nil, rollback(tx, errRenameConfig, err)
+        }
+
+        if id, err = store.configIdIn(tx, from); err != nil {
+                return nil, rollback(tx, errRenameConfig, err)
+        }
+
+        if err = store.checkFreeName(tx, to); err != nil {
+                return nil, rollback(tx, errRenameConfig, err)
+        }
+
+        if _, err = store.purgeConfigs(tx, "name = ? AND deleted_at != 0", to); err != nil {
+                return nil, rollback(tx, errRenameConfig, err)
+        }
+
+        now := time.Now()
+
+        if _, err = store.renameConfigStmt.in(tx).Exec(to, now.Unix(), id); err != nil {
+                return nil, rollback(tx, errRenameConfig, err)
+        }
+
+        for _, table := range renamedTables {
+                if _, err = store.exec(tx, "renameReferences", to, "UPDATE "+table+" SET config_name = ? WHERE config_name = ?", to, from); err != nil {
+                        return nil, rollback(tx, errRenameConfig, err)
+                }
+        }
+
+        // recorded after the history moved so that it is under the new name
+        rename := configman.BatchOp{Kind: configman.OpRename, Config: to, Description: from}
+
+        if event, err = store.recordOps(tx, []configman.BatchOp{rename}, by, now); err != nil {
+                return nil, rollback(tx, errRenameConfig, err)
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errRenameConfig, err)
+        }
+
+        // watchers of either name learn of the rename and caches forget
+        // the settings of both
+        store.events.Publish(*event)
+
+        if config, err = store.GetConfig(to); err != nil {
+                return nil, errors.Join(errRenameConfig, err)
+        }
+
+        return config, nil
+}
+
+// configIdIn returns the id of config within tx, or ErrNotFound if it
+// does not exist.
+func (store *SqlStore) configIdIn(tx *sql.Tx, config string) (int64, error) {
+        var id int64
+
+        err := store.getConfigIdStmt.in(tx).QueryRow(config).Scan(&id)
+
+        if err == sql.ErrNoRows {
+                return 0, fmt.Errorf("sqlstore: config %s: %w", config, configman.ErrNotFound)
+        }
+
+        return id, err
+}
+
+// checkFreeName returns ErrExists if a config named config exists
+// within tx.
+func (store *SqlStore) checkFreeName(tx *sql.Tx, config string) error {
+        var id int64
+
+        err := store.getConfigIdStmt.in(tx).QueryRow(config).Scan(&id)
+
+        switch {
+        case err == sql.ErrNoRows:
+                return nil
+        case err != nil:
+                return err
+        default:
+                return fmt.Errorf("sqlstore: config %s: %w", config, configman.ErrExists)
+        }
+}
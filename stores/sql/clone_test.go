@@ -0,0 +1,138 @@
+package sqlstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+// mustCreateApp creates the config app, labelled team=payments, with a
+// setting timeout, labelled tier=critical and changed once so at
+// revision 2, and a deprecated setting retries.
+func mustCreateApp(t *testing.T, store *SqlStore) {
+        t.Helper()
+
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Create("app", "retries", "", int64(3)))
+        mustApply(t, store, new(configman.Batch).Update("app", "timeout", int64(60)).Deprecate("app", "retries", "use backoff"))
+
+        if err := store.SetConfigLabels("app", configman.Labels{"team": "payments"}); err != nil {
+                t.Fatalf("failed to label config: %v", err)
+        }
+
+        if err := store.SetSettingLabels("app", "timeout", configman.Labels{"tier": "critical"}); err != nil {
+                t.Fatalf("failed to label setting: %v", err)
+        }
+}
+
+func TestCloneConfig(t *testing.T) {
+        tests := []struct {
+                name       string
+                from, to   string
+                reset      bool
+                err        error
+                revision   int64 // of timeout in the clone
+                deprecated bool  // whether retries is deprecated in the clone
+        }{
+                {name: "kept", from: "app", to: "copy", revision: 2, deprecated: true},
+                {name: "reset", from: "app", to: "copy", reset: true, revision: 1},
+                {name: "taken name", from: "app", to: "web", err: configman.ErrExists},
+                {name: "missing config", from: "missing", to: "copy", err: configman.ErrNotFound},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateApp(t, store)
+                        mustCreateConfigs(t, store, "web")
+
+                        _, err := store.CloneConfig(test.from, test.to, configman.CloneOptions{Reset: test.reset}, "test")
+
+                        if !errors.Is(err, test.err) {
+                                t.Fatalf("CloneConfig returned %v, want %v", err, test.err)
+                        }
+
+                        if err != nil {
+                                return
+                        }
+
+                        for _, config := range []string{"app", test.to} {
+                                if value := valueOf(t, store, config, "timeout"); value != int64(60) {
+                                        t.Errorf("timeout of %s is %v, want 60", config, value)
+                                }
+                        }
+
+                        timeout, _ := store.GetSetting(test.to, "timeout")
+                        retries, _ := store.GetSetting(test.to, "retries")
+
+                        if timeout.Revision() != test.revision || retries.Deprecated() != test.deprecated {
+                                t.Errorf("got timeout at revision %d and retries deprecated %t, want %d and %t", timeout.Revision(), retries.Deprecated(), test.revision, test.deprecated)
+                        }
+
+                        if labels, _ := store.GetConfigLabels(test.to); labels["team"] != "payments" {
+                                t.Errorf("got labels %v of the clone, want team=payments", labels)
+                        }
+
+                        if labels, _ := store.GetSettingLabels(test.to, "timeout"); labels["tier"] != "critical" {
+                                t.Errorf("got labels %v of timeout in the clone, want tier=critical", labels)
+                        }
+                })
+        }
+}
+
+func TestRenameConfig(t *testing.T) {
+        tests := []struct {
+                name     string
+                from, to string
+                err      error
+        }{
+                {name: "free name", from: "app", to: "api"},
+                {name: "taken name", from: "app", to: "web", err: configman.ErrExists},
+                {name: "missing config", from: "missing", to: "api", err: configman.ErrNotFound},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateApp(t, store)
+                        mustCreateConfigs(t, store, "web")
+
+                        _, err := store.RenameConfig(test.from, test.to, "test")
+
+                        if !errors.Is(err, test.err) {
+                                t.Fatalf("RenameConfig returned %v, want %v", err, test.err)
+                        }
+
+                        if err != nil {
+                                if value := valueOf(t, store, "app", "timeout"); value != int64(60) {
+                                        t.Errorf("timeout of app is %v after the rename failed, want 60", value)
+                                }
+
+                                return
+                        }
+
+                        if config, _ := store.GetConfig("app"); config != nil && config.Name() != "" {
+                                t.Errorf("app still exists after it was renamed")
+                        }
+
+                        if value := valueOf(t, store, "api", "timeout"); value != int64(60) {
+                                t.Errorf("timeout of api is %v, want 60", value)
+                        }
+
+                        if labels, _ := store.GetSettingLabels("api", "timeout"); labels["tier"] != "critical" {
+                                t.Errorf("got labels %v of timeout after the rename, want tier=critical", labels)
+                        }
+
+                        history, err := store.GetHistory("api", 10)
+
+                        if err != nil {
+                                t.Fatalf("failed to get history: %v", err)
+                        }
+
+                        if len(history) != 3 || history[0].Ops[0].Kind != configman.OpRename || history[0].Ops[0].Description != "app" {
+                                t.Errorf("got history %v, want the rename from app after both batches", history)
+                        }
+                })
+        }
+}
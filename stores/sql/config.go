@@ -16,6 +16,9 @@ type SqlConfig struct {
         desc string
         createdAt time.Time
         updatedAt time.Time
+        revision int64
+        deprecated bool
+        deprecationReason string
         store *SqlStore
 }
 
@@ -36,29 +39,70 @@ func (config *SqlConfig) Desc() string {
         return config.desc
 }
 
+// Revision returns the revision of this config as of when it was read
+// or last changed through this value.
+func (config *SqlConfig) Revision() int64 {
+        return config.revision
+}
+
+// Deprecated returns true if this config was deprecated when it was
+// read.
+func (config *SqlConfig) Deprecated() bool {
+        return config.deprecated
+}
+
+// DeprecationReason returns why this config was deprecated.
+func (config *SqlConfig) DeprecationReason() string {
+        return config.deprecationReason
+}
+
 func (config *SqlConfig) SetDesc(desc string) (bool, error) {
+        return config.SetDescIf(desc, 0)
+}
+
+// SetDescIf is like SetDesc but fails with configman.ErrConflict unless
+// the config is at the given revision. A revision of zero matches any
+// revision.
+func (config *SqlConfig) SetDescIf(desc string, revision int64) (_ bool, err error) {
         gossert.Ok(config.id != configIdUnknown, "sqlstore: attempting to update description of config with unknown id")
 
-        var affected int64
-        var result sql.Result
-        var err error
+        var tx *sql.Tx
+        var updatedRevision int64
+
+        defer config.store.observe("set config description", "config", config.name)(&err)
+
+        if tx, err = config.store.db.Begin(); err != nil {
+                return false, err
+        }
+
+        if err = config.store.checkProtected(tx, config.name); err != nil {
+                return false, rollback(tx, err)
+        }
 
         now := time.Now()
-        result, err = config.store.setDescStmt.Exec(desc, now.Unix(), config.id)
+        err = config.store.setDescStmt.in(tx).about(config.name).QueryRow(desc, now.Unix(), config.id, revision, revision).Scan(&updatedRevision)
 
-        if err != nil {
-                return false, nil
+        if err == sql.ErrNoRows && revision != 0 {
+                return false, rollback(tx, configman.ErrConflict)
         }
 
-        affected, err = result.RowsAffected()
-        descUpdated := affected > 0
+        if err == sql.ErrNoRows {
+                return false, rollback(tx)
+        }
 
-        if descUpdated {
-                config.desc = desc
-                config.updatedAt = now
+        if err != nil {
+                return false, rollback(tx, err)
+        }
+
+        if err = tx.Commit(); err != nil {
+                return false, err
         }
 
-        return descUpdated, err
+        config.desc = desc
+        config.updatedAt = now
+        config.revision = updatedRevision
+
+        return true, nil
 }
 
 func (config *SqlConfig) NewSetting(name string, typ configman.Type, value any) (configman.Setting, error) {
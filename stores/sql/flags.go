@@ -0,0 +1,221 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vlence/configman"
+)
+
+var errFlagRulesTable = fmt.Errorf("sqlstore: failed to create flag rules table")
+var errGetFlagRules = fmt.Errorf("sqlstore: failed to get flag rules")
+var errSetFlagRules = fmt.Errorf("sqlstore: failed to set flag rules")
+
+// initFlagRulesTable creates the flag_rules table and its indices. The
+// values of a rule are stored as a JSON array.
+func (store *SqlStore) initFlagRulesTable() error {
+        var tx *sql.Tx
+        var txErr, commitErr, execErr error
+
+        if tx, txErr = store.db.Begin(); txErr != nil {
+                return errors.Join(errFlagRulesTable, txErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS flag_rules (
+                        id INTEGER PRIMARY KEY,
+                        config_name TEXT NOT NULL,
+                        setting_name TEXT NOT NULL,
+                        position INTEGER NOT NULL,
+                        attribute TEXT NOT NULL,
+                        operator TEXT NOT NULL,
+                        vals TEXT NOT NULL,
+                        percentage INTEGER NOT NULL,
+                        bucket_by TEXT NOT NULL,
+                        value BOOLEAN NOT NULL
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errFlagRulesTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE INDEX IF NOT EXISTS flag_rules_configname_settingname_position_index ON flag_rules (
+                        config_name,
+                        setting_name,
+                        position
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errFlagRulesTable, execErr)
+        }
+
+        if commitErr = tx.Commit(); commitErr != nil {
+                return errors.Join(errFlagRulesTable, commitErr)
+        }
+
+        return nil
+}
+
+// prepFlagStmts prepares the SQL statements used to manage flag rules.
+func (store *SqlStore) prepFlagStmts() error {
+        var err error
+
+        store.getFlagRulesStmt, err = store.prepare("getFlagRules", 0, `
+                SELECT attribute, operator, vals, percentage, bucket_by, value
+                FROM flag_rules
+                WHERE config_name = ? AND setting_name = ?
+                ORDER BY position
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.deleteFlagRulesStmt, err = store.prepare("deleteFlagRules", 0, `
+                DELETE FROM flag_rules WHERE config_name = ? AND setting_name = ?
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.insertFlagRuleStmt, err = store.prepare("insertFlagRule", 0, `
+                INSERT INTO flag_rules (
+                        config_name,
+                        setting_name,
+                        position,
+                        attribute,
+                        operator,
+                        vals,
+                        percentage,
+                        bucket_by,
+                        value
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `)
+
+        return err
+}
+
+// GetFlagRules returns the rules of the given feature flag setting in
+// the order they are evaluated.
+func (store *SqlStore) GetFlagRules(config, setting string) ([]configman.Rule, error) {
+        var rows *sql.Rows
+        var err error
+
+        rules := make([]configman.Rule, 0)
+
+        if rows, err = store.getFlagRulesStmt.Query(config, setting); err != nil {
+                return rules, errors.Join(errGetFlagRules, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var rule configman.Rule
+                var vals string
+
+                err = rows.Scan(
+                        &rule.Attribute,
+                        &rule.Operator,
+                        &vals,
+                        &rule.Percentage,
+                        &rule.BucketBy,
+                        &rule.Value,
+                )
+
+                if err != nil {
+                        return rules, errors.Join(errGetFlagRules, err)
+                }
+
+                if err = json.Unmarshal([]byte(vals), &rule.Values); err != nil {
+                        return rules, errors.Join(errGetFlagRules, err)
+                }
+
+                rules = append(rules, rule)
+        }
+
+        if err = rows.Err(); err != nil {
+                return rules, errors.Join(errGetFlagRules, err)
+        }
+
+        return rules, nil
+}
+
+// SetFlagRules replaces the rules of the given feature flag setting. The
+// setting must exist and be a configman.Bool setting.
+func (store *SqlStore) SetFlagRules(config, setting string, rules []configman.Rule) (err error) {
+        var tx *sql.Tx
+        var vals []byte
+        var flag *configman.Setting
+
+        defer store.observe("set flag rules", "config", config, "setting", setting, "rules", len(rules))(&err)
+
+        if flag, err = store.GetSetting(config, setting); err != nil {
+                return errors.Join(errSetFlagRules, err)
+        }
+
+        if flag == nil {
+                return errors.Join(errSetFlagRules, errSettingNotFound(config, setting))
+        }
+
+        if flag.Type() != configman.Bool {
+                return errors.Join(errSetFlagRules, configman.ErrTypeMismatch)
+        }
+
+        for _, rule := range rules {
+                if err = rule.Validate(); err != nil {
+                        return errors.Join(errSetFlagRules, err)
+                }
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errSetFlagRules, err)
+        }
+
+        if err = store.checkProtected(tx, config); err != nil {
+                return rollback(tx, errSetFlagRules, err)
+        }
+
+        if _, err = store.deleteFlagRulesStmt.in(tx).Exec(config, setting); err != nil {
+                return rollback(tx, errSetFlagRules, err)
+        }
+
+        insert := store.insertFlagRuleStmt.in(tx)
+
+        for i, rule := range rules {
+                if rule.Values == nil {
+                        rule.Values = []string{}
+                }
+
+                if vals, err = json.Marshal(rule.Values); err != nil {
+                        return rollback(tx, errSetFlagRules, err)
+                }
+
+                _, err = insert.Exec(
+                        config,
+                        setting,
+                        i,
+                        rule.Attribute,
+                        rule.Operator,
+                        string(vals),
+                        rule.Rollout(),
+                        rule.BucketBy,
+                        rule.Value,
+                )
+
+                if err != nil {
+                        return rollback(tx, errSetFlagRules, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errSetFlagRules, err)
+        }
+
+        return nil
+}
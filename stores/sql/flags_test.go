@@ -0,0 +1,57 @@
+package sqlstore
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestFlagRules(t *testing.T) {
+        half := uint8(50)
+
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).Create("app", "beta", "", false).Create("app", "timeout", "", int64(30)))
+
+        rules := []configman.Rule{
+                {Attribute: configman.AttrTenant, Operator: configman.OpIn, Values: []string{"acme"}, Value: true},
+                {Values: []string{}, Percentage: &half, BucketBy: configman.AttrTenant, Value: true},
+        }
+
+        if err := store.SetFlagRules("app", "beta", rules); err != nil {
+                t.Fatalf("SetFlagRules returned %v", err)
+        }
+
+        got, err := store.GetFlagRules("app", "beta")
+
+        if err != nil {
+                t.Fatalf("GetFlagRules returned %v", err)
+        }
+
+        if len(got) != len(rules) {
+                t.Fatalf("got %d rules, want %d", len(got), len(rules))
+        }
+
+        for i, rule := range got {
+                // omitted percentages are stored as 100
+                if rule.Rollout() != rules[i].Rollout() {
+                        t.Errorf("rule %d has rollout %d, want %d", i, rule.Rollout(), rules[i].Rollout())
+                }
+
+                rule.Percentage, rules[i].Percentage = nil, nil
+
+                if !reflect.DeepEqual(rule, rules[i]) {
+                        t.Errorf("rule %d is %+v, want %+v", i, rule, rules[i])
+                }
+        }
+
+        if err = store.SetFlagRules("app", "timeout", rules); !errors.Is(err, configman.ErrTypeMismatch) {
+                t.Errorf("setting rules of an int64 setting returned %v, want %v", err, configman.ErrTypeMismatch)
+        }
+
+        if err = store.SetFlagRules("app", "beta", []configman.Rule{{Attribute: configman.AttrTenant, Operator: "like"}}); !errors.Is(err, configman.ErrInvalidRule) {
+                t.Errorf("setting an invalid rule returned %v, want %v", err, configman.ErrInvalidRule)
+        }
+}
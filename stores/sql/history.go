@@ -0,0 +1,503 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/gossert"
+)
+
+var errHistoryTable = fmt.Errorf("sqlstore: failed to create history tables")
+var errApplyBatch = fmt.Errorf("sqlstore: failed to apply batch")
+var errGetHistory = fmt.Errorf("sqlstore: failed to get history")
+
+// historySeeder is who the settings that existed before history was kept
+// were created by in history, see seedHistory.
+const historySeeder = "configman"
+
+// initHistoryTables creates the history and history_ops tables. Every
+// change applied to settings is recorded in history as one revision and
+// its operations are recorded in history_ops, in the order they were
+// applied.
+func (store *SqlStore) initHistoryTables() error {
+        var tx *sql.Tx
+        var existed bool
+        var txErr, commitErr, execErr error
+
+        if tx, txErr = store.db.Begin(); txErr != nil {
+                return errors.Join(errHistoryTable, txErr)
+        }
+
+        execErr = tx.QueryRow("SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'history'").Scan(&existed)
+
+        if execErr != nil {
+                return rollback(tx, errHistoryTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS history (
+                        revision INTEGER PRIMARY KEY AUTOINCREMENT,
+                        created_at INTEGER NOT NULL,
+                        created_by TEXT NOT NULL
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errHistoryTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS history_ops (
+                        revision INTEGER NOT NULL,
+                        position INTEGER NOT NULL,
+                        kind TEXT NOT NULL,
+                        config_name TEXT NOT NULL,
+                        setting_name TEXT NOT NULL,
+                        value_type INTEGER NOT NULL,
+                        int32_value INTEGER,
+                        int64_value INTEGER,
+                        float32_value REAL,
+                        float64_value REAL,
+                        bool_value BOOLEAN,
+                        string_value TEXT,
+                        desc TEXT NOT NULL,
+                        PRIMARY KEY (revision, position)
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errHistoryTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE INDEX IF NOT EXISTS history_ops_configname_settingname_index ON history_ops (
+                        config_name,
+                        setting_name
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errHistoryTable, execErr)
+        }
+
+        if !existed {
+                if execErr = seedHistory(tx, time.Now()); execErr != nil {
+                        return rollback(tx, errHistoryTable, execErr)
+                }
+        }
+
+        if commitErr = tx.Commit(); commitErr != nil {
+                return errors.Join(errHistoryTable, commitErr)
+        }
+
+        return nil
+}
+
+// seedHistory records the settings that exist when history starts being
+// kept, by stores made before it was, as created and, if they are
+// deprecated, deprecated by one revision made at now. Reading settings at
+// a later revision then includes them.
+func seedHistory(tx *sql.Tx, now time.Time) error {
+        var err error
+        var settings int
+        var revision int64
+        var result sql.Result
+
+        if err = tx.QueryRow("SELECT count(*) FROM settings WHERE deleted_at = 0").Scan(&settings); err != nil || settings == 0 {
+                return err
+        }
+
+        if result, err = tx.Exec("INSERT INTO history (created_at, created_by) VALUES (?, ?)", now.Unix(), historySeeder); err != nil {
+                return err
+        }
+
+        if revision, err = result.LastInsertId(); err != nil {
+                return err
+        }
+
+        _, err = tx.Exec(`
+                INSERT INTO history_ops (revision, position, kind, config_name, setting_name,`+valueColumns+`, desc)
+                SELECT ?, row_number() OVER (ORDER BY config_name, name) - 1, ?, config_name, name,`+valueColumns+`, desc
+                FROM settings
+                WHERE deleted_at = 0
+        `, revision, configman.OpCreate)
+
+        if err != nil {
+                return err
+        }
+
+        _, err = tx.Exec(`
+                INSERT INTO history_ops (revision, position, kind, config_name, setting_name, value_type, desc)
+                SELECT ?, ? + row_number() OVER (ORDER BY config_name, name) - 1, ?, config_name, name, ?, deprecation_reason
+                FROM settings
+                WHERE deleted_at = 0 AND deprecated
+        `, revision, settings, configman.OpDeprecate, configman.Unsupported)
+
+        return err
+}
+
+// prepHistoryStmts prepares the SQL statements used to apply batches and
+// record them in history.
+func (store *SqlStore) prepHistoryStmts() error {
+        var err error
+
+        store.getConfigIdStmt, err = store.prepare("getConfigId", 0, "SELECT id FROM configs WHERE name = ? AND deleted_at = 0")
+
+        if err != nil {
+                return err
+        }
+
+        store.getSettingTypeStmt, err = store.prepare("getSettingType", 0, "SELECT value_type, revision FROM settings WHERE config_name = ? AND name = ? AND deleted_at = 0")
+
+        if err != nil {
+                return err
+        }
+
+        store.createSettingStmt, err = store.prepare("createSetting", 5, `
+                INSERT INTO settings (
+                        name,
+                        desc,
+                        created_at,
+                        updated_at,
+                        deprecated_at,
+                        config_id,
+                        config_name,` + valueColumns + `
+                ) VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        // Deleted settings keep their flag rules and labels in the trash,
+        // see trash.go.
+        store.deleteSettingStmt, err = store.prepare("deleteSetting", 1, "UPDATE settings SET deleted_at = ? WHERE config_name = ? AND name = ? AND deleted_at = 0")
+
+        if err != nil {
+                return err
+        }
+
+        // Deprecating an already deprecated setting only changes the
+        // reason; the time it was first deprecated is kept.
+        store.deprecateSettingStmt, err = store.prepare("deprecateSetting", 3, `
+                UPDATE settings
+                SET deprecated = TRUE,
+                    deprecation_reason = ?,
+                    deprecated_at = CASE WHEN deprecated THEN deprecated_at ELSE ? END,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE config_name = ? AND name = ? AND deleted_at = 0
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.insertRevisionStmt, err = store.prepare("insertRevision", noConfig, "INSERT INTO history (created_at, created_by) VALUES (?, ?)")
+
+        if err != nil {
+                return err
+        }
+
+        store.insertRevisionOpStmt, err = store.prepare("insertRevisionOp", 3, `
+                INSERT INTO history_ops (
+                        revision,
+                        position,
+                        kind,
+                        config_name,
+                        setting_name,` + valueColumns + `,
+                        desc
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getHistoryStmt, err = store.prepare("getHistory", 0, `
+                SELECT
+                        history.revision,
+                        history.created_at,
+                        history.created_by,
+                        kind,
+                        setting_name,` + valueColumns + `,
+                        desc
+                FROM history
+                JOIN history_ops ON history_ops.revision = history.revision
+                WHERE config_name = ? AND history.revision IN (
+                        SELECT DISTINCT revision
+                        FROM history_ops
+                        WHERE config_name = ?
+                        ORDER BY revision DESC
+                        LIMIT ?
+                )
+                ORDER BY history.revision DESC, position
+        `)
+
+        return err
+}
+
+// Watch implements configman.Watcher. Every batch applied through this
+// store, including scheduled and approved changes, is sent as one
+// change event. Changes made by other processes sharing the database
+// are not seen.
+func (store *SqlStore) Watch(ctx context.Context) <-chan configman.ChangeEvent {
+        return store.events.Watch(ctx)
+}
+
+// ApplyBatch applies every operation of batch in one transaction and
+// records them as a single revision. None of the configs changed by the
+// batch may be protected.
+func (store *SqlStore) ApplyBatch(batch *configman.Batch, by string) (_ *configman.ChangeEvent, err error) {
+        var tx *sql.Tx
+        var event *configman.ChangeEvent
+
+        defer store.observe("apply batch", "configs", batch.Configs(), "ops", len(batch.Ops), "by", by)(&err)
+
+        gossert.Ok(batch != nil, "sqlstore: cannot apply nil batch")
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errApplyBatch, err)
+        }
+
+        for _, config := range batch.Configs() {
+                if err = store.checkProtected(tx, config); err != nil {
+                        return nil, rollback(tx, errApplyBatch, err)
+                }
+        }
+
+        if event, err = store.applyOps(tx, batch.Ops, by, time.Now()); err != nil {
+                return nil, rollback(tx, errApplyBatch, err)
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errApplyBatch, err)
+        }
+
+        store.events.Publish(*event)
+
+        return event, nil
+}
+
+// applyOps applies ops within tx and records them in history as one
+// revision. The returned change event must only be published once tx
+// has been committed.
+func (store *SqlStore) applyOps(tx *sql.Tx, ops []configman.BatchOp, by string, now time.Time) (*configman.ChangeEvent, error) {
+        var err error
+
+        if len(ops) == 0 {
+                return nil, errors.New("sqlstore: batch has no operations")
+        }
+
+        for _, op := range ops {
+                if err = store.applyOp(tx, op, now); err != nil {
+                        return nil, err
+                }
+        }
+
+        return store.recordOps(tx, ops, by, now)
+}
+
+// recordOps records ops, which have already been applied within tx, in
+// history as one revision. The returned change event must only be
+// published once tx has been committed.
+func (store *SqlStore) recordOps(tx *sql.Tx, ops []configman.BatchOp, by string, now time.Time) (*configman.ChangeEvent, error) {
+        var err error
+        var result sql.Result
+
+        if result, err = store.insertRevisionStmt.in(tx).Exec(now.Unix(), by); err != nil {
+                return nil, err
+        }
+
+        event := &configman.ChangeEvent{
+                Ops: ops,
+                By:  by,
+                At:  time.Unix(now.Unix(), 0),
+        }
+
+        if event.Revision, err = result.LastInsertId(); err != nil {
+                return nil, err
+        }
+
+        insert := store.insertRevisionOpStmt.in(tx)
+
+        for i, op := range ops {
+                v := newSqlValue(op.Value)
+                args := []any{event.Revision, i, op.Kind, op.Config, op.Setting}
+                args = append(args, v.args()...)
+                args = append(args, op.Description)
+
+                if _, err = insert.Exec(args...); err != nil {
+                        return nil, err
+                }
+        }
+
+        return event, nil
+}
+
+// applyOp applies a single operation within tx.
+func (store *SqlStore) applyOp(tx *sql.Tx, op configman.BatchOp, now time.Time) error {
+        var err error
+        var configId int64
+        var affected int64
+        var revision int64
+        var typ configman.Type
+
+        if (op.Kind == configman.OpCreate || op.Kind == configman.OpUpdate) && configman.TypeOf(op.Value) == configman.Unsupported {
+                return configman.ErrUnsupportedType
+        }
+
+        err = store.getSettingTypeStmt.in(tx).QueryRow(op.Config, op.Setting).Scan(&typ, &revision)
+        exists := err == nil
+
+        if err != nil && err != sql.ErrNoRows {
+                return err
+        }
+
+        if exists && op.ExpectedRevision != 0 && op.ExpectedRevision != revision {
+                return fmt.Errorf("sqlstore: setting %s of config %s: %w", op.Setting, op.Config, configman.ErrConflict)
+        }
+
+        switch op.Kind {
+        case configman.OpCreate:
+                if exists {
+                        return fmt.Errorf("sqlstore: setting %s of config %s: %w", op.Setting, op.Config, configman.ErrExists)
+                }
+
+                err = store.getConfigIdStmt.in(tx).QueryRow(op.Config).Scan(&configId)
+
+                if err == sql.ErrNoRows {
+                        return fmt.Errorf("sqlstore: config %s: %w", op.Config, configman.ErrNotFound)
+                }
+
+                if err != nil {
+                        return err
+                }
+
+                // the name is taken again, so the deleted setting goes
+                if _, err = store.purgeSettings(tx, "config_name = ? AND name = ? AND deleted_at != 0", op.Config, op.Setting); err != nil {
+                        return err
+                }
+
+                v := newSqlValue(op.Value)
+                args := []any{op.Setting, op.Description, now.Unix(), now.Unix(), configId, op.Config}
+                args = append(args, v.args()...)
+
+                _, err = store.createSettingStmt.in(tx).Exec(args...)
+
+                return err
+
+        case configman.OpUpdate:
+                if !exists {
+                        return errSettingNotFound(op.Config, op.Setting)
+                }
+
+                if typ != configman.TypeOf(op.Value) {
+                        return fmt.Errorf("sqlstore: setting %s of config %s: %w", op.Setting, op.Config, configman.ErrTypeMismatch)
+                }
+
+                _, err = store.setSettingValue(tx, op.Config, op.Setting, op.Value, now)
+
+                return err
+
+        case configman.OpDelete:
+                if !exists {
+                        return errSettingNotFound(op.Config, op.Setting)
+                }
+
+                if affected, err = execAffected(store.deleteSettingStmt.in(tx), now.UnixNano(), op.Config, op.Setting); err != nil {
+                        return err
+                }
+
+                gossert.Ok(affected == 1, "sqlstore: deleted more or less than one setting")
+
+                return nil
+
+        case configman.OpDeprecate:
+                if !exists {
+                        return errSettingNotFound(op.Config, op.Setting)
+                }
+
+                if affected, err = execAffected(store.deprecateSettingStmt.in(tx), op.Description, now.Unix(), now.Unix(), op.Config, op.Setting); err != nil {
+                        return err
+                }
+
+                gossert.Ok(affected == 1, "sqlstore: deprecated more or less than one setting")
+
+                return nil
+
+        default:
+                return fmt.Errorf("sqlstore: unknown batch operation %q", op.Kind)
+        }
+}
+
+// GetHistory implements configman.HistoryStore.
+func (store *SqlStore) GetHistory(config string, limit int) (_ []configman.ChangeEvent, err error) {
+        var rows *sql.Rows
+
+        defer store.observe("get history", "config", config)(&err)
+
+        events := make([]configman.ChangeEvent, 0)
+
+        if rows, err = store.getHistoryStmt.Query(config, config, limit); err != nil {
+                return events, errors.Join(errGetHistory, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var v sqlValue
+                var op configman.BatchOp
+                var revision, createdAt int64
+                var createdBy string
+
+                dest := []any{&revision, &createdAt, &createdBy, &op.Kind, &op.Setting}
+                dest = append(dest, v.dest()...)
+                dest = append(dest, &op.Description)
+
+                if err = rows.Scan(dest...); err != nil {
+                        return events, errors.Join(errGetHistory, err)
+                }
+
+                op.Config = config
+
+                // deleted and deprecated settings have no value
+                if v.typ != configman.Unsupported {
+                        if op.Value, err = v.value(); err != nil {
+                                return events, errors.Join(errGetHistory, err)
+                        }
+                }
+
+                if n := len(events); n == 0 || events[n-1].Revision != revision {
+                        events = append(events, configman.ChangeEvent{
+                                Revision: revision,
+                                By:       createdBy,
+                                At:       time.Unix(createdAt, 0),
+                        })
+                }
+
+                events[len(events)-1].Ops = append(events[len(events)-1].Ops, op)
+        }
+
+        if err = rows.Err(); err != nil {
+                return events, errors.Join(errGetHistory, err)
+        }
+
+        return events, nil
+}
+
+// execAffected executes stmt with args and returns the number of rows
+// affected.
+func execAffected(stmt *stmt, args ...any) (int64, error) {
+        result, err := stmt.Exec(args...)
+
+        if err != nil {
+                return 0, err
+        }
+
+        return result.RowsAffected()
+}
@@ -0,0 +1,95 @@
+package sqlstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestApplyBatchIsAtomic(t *testing.T) {
+        tests := []struct {
+                name  string
+                batch *configman.Batch
+                err   error
+        }{
+                {
+                        name:  "missing config",
+                        batch: new(configman.Batch).Update("app", "timeout", int64(60)).Create("missing", "retries", "", int64(3)),
+                        err:   configman.ErrNotFound,
+                },
+                {
+                        name:  "existing setting",
+                        batch: new(configman.Batch).Update("app", "timeout", int64(60)).Create("app", "timeout", "", int64(3)),
+                        err:   configman.ErrExists,
+                },
+                {
+                        name:  "stale revision",
+                        batch: new(configman.Batch).Update("app", "timeout", int64(60)).DeleteIf("app", "timeout", 1),
+                        err:   configman.ErrConflict,
+                },
+                {
+                        name:  "type mismatch",
+                        batch: new(configman.Batch).Update("app", "timeout", int64(60)).Update("app", "timeout", "60s"),
+                        err:   configman.ErrTypeMismatch,
+                },
+                {
+                        name:  "protected config",
+                        batch: new(configman.Batch).Update("app", "timeout", int64(60)).Update("locked", "timeout", int64(60)),
+                        err:   configman.ErrProtectedConfig,
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateConfigs(t, store, "app", "locked")
+                        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Create("locked", "timeout", "", int64(30)))
+
+                        if err := store.SetProtected("locked", true); err != nil {
+                                t.Fatalf("failed to protect config: %v", err)
+                        }
+
+                        if _, err := store.ApplyBatch(test.batch, "test"); !errors.Is(err, test.err) {
+                                t.Fatalf("ApplyBatch returned %v, want %v", err, test.err)
+                        }
+
+                        if value := valueOf(t, store, "app", "timeout"); value != int64(30) {
+                                t.Errorf("timeout is %v after the batch failed, want 30", value)
+                        }
+
+                        history, err := store.GetHistory("app", 10)
+
+                        if err != nil {
+                                t.Fatalf("failed to get history: %v", err)
+                        }
+
+                        if len(history) != 1 {
+                                t.Errorf("got %d revisions after the batch failed, want 1", len(history))
+                        }
+                })
+        }
+}
+
+func TestApplyBatchRecordsOneRevision(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app", "web")
+
+        event := mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Create("web", "timeout", "", int64(10)))
+
+        if event.By != "test" || len(event.Ops) != 2 {
+                t.Fatalf("got event by %q with %d ops, want by test with 2", event.By, len(event.Ops))
+        }
+
+        for _, config := range []string{"app", "web"} {
+                history, err := store.GetHistory(config, 10)
+
+                if err != nil {
+                        t.Fatalf("failed to get history of %s: %v", config, err)
+                }
+
+                if len(history) != 1 || history[0].Revision != event.Revision {
+                        t.Errorf("history of %s is %+v, want only revision %d", config, history, event.Revision)
+                }
+        }
+}
@@ -0,0 +1,334 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+var errLabelsTables = fmt.Errorf("sqlstore: failed to create labels tables")
+var errSetLabels = fmt.Errorf("sqlstore: failed to set labels")
+var errGetLabels = fmt.Errorf("sqlstore: failed to get labels")
+var errQueryConfigs = fmt.Errorf("sqlstore: failed to query configs")
+var errQuerySettings = fmt.Errorf("sqlstore: failed to query settings")
+
+// initLabelsTables creates the config_labels and setting_labels tables.
+// Both are indexed by key and value so that selectors find the labeled
+// rows without scanning every label.
+func (store *SqlStore) initLabelsTables() error {
+        var tx *sql.Tx
+        var err error
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errLabelsTables, err)
+        }
+
+        for _, query := range []string{
+                `CREATE TABLE IF NOT EXISTS config_labels (
+                        config_name TEXT NOT NULL,
+                        key TEXT NOT NULL,
+                        value TEXT NOT NULL,
+                        PRIMARY KEY (config_name, key)
+                )`,
+                `CREATE INDEX IF NOT EXISTS config_labels_key_value_index ON config_labels (key, value)`,
+                `CREATE TABLE IF NOT EXISTS setting_labels (
+                        config_name TEXT NOT NULL,
+                        setting_name TEXT NOT NULL,
+                        key TEXT NOT NULL,
+                        value TEXT NOT NULL,
+                        PRIMARY KEY (config_name, setting_name, key)
+                )`,
+                `CREATE INDEX IF NOT EXISTS setting_labels_key_value_index ON setting_labels (config_name, key, value)`,
+        } {
+                if _, err = tx.Exec(query); err != nil {
+                        return rollback(tx, errLabelsTables, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errLabelsTables, err)
+        }
+
+        return nil
+}
+
+// prepLabelStmts prepares the SQL statements used for labels. Queries
+// by selector are built for each query instead, see selectorSQL.
+func (store *SqlStore) prepLabelStmts() error {
+        var err error
+
+        store.getConfigLabelsStmt, err = store.prepare("getConfigLabels", 0, "SELECT key, value FROM config_labels WHERE config_name = ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.insertConfigLabelStmt, err = store.prepare("insertConfigLabel", 0, "INSERT INTO config_labels (config_name, key, value) VALUES (?, ?, ?)")
+
+        if err != nil {
+                return err
+        }
+
+        store.getSettingLabelsStmt, err = store.prepare("getSettingLabels", 0, "SELECT key, value FROM setting_labels WHERE config_name = ? AND setting_name = ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.insertSettingLabelStmt, err = store.prepare("insertSettingLabel", 0, "INSERT INTO setting_labels (config_name, setting_name, key, value) VALUES (?, ?, ?, ?)")
+
+        if err != nil {
+                return err
+        }
+
+        store.deleteSettingLabelsStmt, err = store.prepare("deleteSettingLabels", 0, "DELETE FROM setting_labels WHERE config_name = ? AND setting_name = ?")
+
+        return err
+}
+
+// SetConfigLabels implements configman.LabelStore.
+func (store *SqlStore) SetConfigLabels(config string, labels configman.Labels) (err error) {
+        var tx *sql.Tx
+        var configId int64
+
+        defer store.observe("set config labels", "config", config)(&err)
+
+        if err = labels.Validate(); err != nil {
+                return errors.Join(errSetLabels, err)
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errSetLabels, err)
+        }
+
+        if err = store.getConfigIdStmt.in(tx).QueryRow(config).Scan(&configId); err == sql.ErrNoRows {
+                return rollback(tx, fmt.Errorf("sqlstore: config %s: %w", config, configman.ErrNotFound))
+        }
+
+        if err != nil {
+                return rollback(tx, errSetLabels, err)
+        }
+
+        if _, err = store.exec(tx, "deleteConfigLabels", config, "DELETE FROM config_labels WHERE config_name = ?", config); err != nil {
+                return rollback(tx, errSetLabels, err)
+        }
+
+        for key, value := range labels {
+                if _, err = store.insertConfigLabelStmt.in(tx).Exec(config, key, value); err != nil {
+                        return rollback(tx, errSetLabels, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errSetLabels, err)
+        }
+
+        return nil
+}
+
+// GetConfigLabels implements configman.LabelStore.
+func (store *SqlStore) GetConfigLabels(config string) (_ configman.Labels, err error) {
+        defer store.observe("get config labels", "config", config)(&err)
+
+        return scanLabels(store.getConfigLabelsStmt.Query(config))
+}
+
+// SetSettingLabels implements configman.LabelStore.
+func (store *SqlStore) SetSettingLabels(config, setting string, labels configman.Labels) (err error) {
+        var tx *sql.Tx
+        var typ, revision int64
+
+        defer store.observe("set setting labels", "config", config, "setting", setting)(&err)
+
+        if err = labels.Validate(); err != nil {
+                return errors.Join(errSetLabels, err)
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errSetLabels, err)
+        }
+
+        if err = store.getSettingTypeStmt.in(tx).QueryRow(config, setting).Scan(&typ, &revision); err == sql.ErrNoRows {
+                return rollback(tx, errSettingNotFound(config, setting))
+        }
+
+        if err != nil {
+                return rollback(tx, errSetLabels, err)
+        }
+
+        if _, err = store.deleteSettingLabelsStmt.in(tx).Exec(config, setting); err != nil {
+                return rollback(tx, errSetLabels, err)
+        }
+
+        for key, value := range labels {
+                if _, err = store.insertSettingLabelStmt.in(tx).Exec(config, setting, key, value); err != nil {
+                        return rollback(tx, errSetLabels, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errSetLabels, err)
+        }
+
+        return nil
+}
+
+// GetSettingLabels implements configman.LabelStore.
+func (store *SqlStore) GetSettingLabels(config, setting string) (_ configman.Labels, err error) {
+        defer store.observe("get setting labels", "config", config, "setting", setting)(&err)
+
+        return scanLabels(store.getSettingLabelsStmt.Query(config, setting))
+}
+
+// QueryConfigs implements configman.LabelStore.
+func (store *SqlStore) QueryConfigs(query configman.Query) (_ []configman.Config, err error) {
+        var rows *sql.Rows
+        var config configman.Config
+
+        defer store.observe("query configs", "selector", query.Selector.String(), "prefix", query.Prefix)(&err)
+
+        configs := make([]configman.Config, 0)
+        where, args := querySQL(query, "config_labels l", "l.config_name = configs.name")
+
+        if rows, err = store.query("queryConfigs", "", "SELECT"+configColumns+"FROM configs WHERE deleted_at = 0 AND "+where+" ORDER BY name", args...); err != nil {
+                return configs, errors.Join(errQueryConfigs, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if config, err = store.scanConfig(rows); err != nil {
+                        return configs, errors.Join(errQueryConfigs, err)
+                }
+
+                configs = append(configs, config)
+        }
+
+        if err = rows.Err(); err != nil {
+                return configs, errors.Join(errQueryConfigs, err)
+        }
+
+        return configs, nil
+}
+
+// QuerySettings implements configman.LabelStore.
+func (store *SqlStore) QuerySettings(config string, query configman.Query) (_ []*configman.Setting, err error) {
+        var rows *sql.Rows
+        var setting *configman.Setting
+
+        defer store.observe("query settings", "config", config, "selector", query.Selector.String(), "prefix", query.Prefix)(&err)
+
+        settings := make([]*configman.Setting, 0)
+        where, args := querySQL(query, "setting_labels l", "l.config_name = settings.config_name AND l.setting_name = settings.name")
+        args = append([]any{config}, args...)
+
+        if rows, err = store.query("querySettings", config, "SELECT"+settingColumns+"FROM settings WHERE config_name = ? AND deleted_at = 0 AND "+where+" ORDER BY name", args...); err != nil {
+                return settings, errors.Join(errQuerySettings, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if setting, err = store.scanSetting(rows); err != nil {
+                        return settings, errors.Join(errQuerySettings, err)
+                }
+
+                settings = append(settings, setting)
+        }
+
+        if err = rows.Err(); err != nil {
+                return settings, errors.Join(errQuerySettings, err)
+        }
+
+        return settings, nil
+}
+
+// querySQL returns the WHERE conditions, and their arguments, that
+// select the rows of a table matching query. Labels are looked up in
+// labels, aliased l, whose rows belong to the selected row if join is
+// true. The name prefix is matched with GLOB so that the index on name
+// can be used.
+func querySQL(query configman.Query, labels, join string) (string, []any) {
+        conds := []string{"TRUE"}
+        args := make([]any, 0)
+
+        if query.Prefix != "" {
+                conds = append(conds, "name GLOB ?")
+                args = append(args, globEscaper.Replace(query.Prefix)+"*")
+        }
+
+        if query.Deprecated != nil {
+                conds = append(conds, "deprecated = ?")
+                args = append(args, *query.Deprecated)
+        }
+
+        switch {
+        case query.Namespace == nil:
+        case *query.Namespace == "":
+                conds = append(conds, "name NOT GLOB ?")
+                args = append(args, "*"+configman.NamespaceSeparator+"*")
+        default:
+                conds = append(conds, "name GLOB ?")
+                args = append(args, globEscaper.Replace(*query.Namespace+configman.NamespaceSeparator)+"*")
+        }
+
+        for _, req := range query.Selector {
+                var exists string
+
+                cond := "SELECT 1 FROM " + labels + " WHERE " + join + " AND l.key = ?"
+                args = append(args, req.Key)
+
+                if len(req.Values) > 0 {
+                        cond += " AND l.value IN (?" + strings.Repeat(", ?", len(req.Values)-1) + ")"
+
+                        for _, value := range req.Values {
+                                args = append(args, value)
+                        }
+                }
+
+                switch req.Op {
+                case configman.SelectEquals, configman.SelectIn, configman.SelectExists:
+                        exists = "EXISTS"
+                default:
+                        exists = "NOT EXISTS"
+                }
+
+                conds = append(conds, exists+" ("+cond+")")
+        }
+
+        return strings.Join(conds, " AND "), args
+}
+
+// globEscaper escapes the characters that have a meaning in GLOB
+// patterns.
+var globEscaper = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+
+// scanLabels scans the key and value rows returned by query.
+func scanLabels(rows *sql.Rows, err error) (configman.Labels, error) {
+        var key, value string
+
+        labels := make(configman.Labels)
+
+        if err != nil {
+                return labels, errors.Join(errGetLabels, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if err = rows.Scan(&key, &value); err != nil {
+                        return labels, errors.Join(errGetLabels, err)
+                }
+
+                labels[key] = value
+        }
+
+        if err = rows.Err(); err != nil {
+                return labels, errors.Join(errGetLabels, err)
+        }
+
+        return labels, nil
+}
@@ -0,0 +1,191 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errNamespacesTable = fmt.Errorf("sqlstore: failed to create namespaces table")
+var errCreateNamespace = fmt.Errorf("sqlstore: failed to create namespace")
+var errGetNamespaces = fmt.Errorf("sqlstore: failed to get namespaces")
+var errDeleteNamespace = fmt.Errorf("sqlstore: failed to delete namespace")
+
+// initNamespacesTable creates the namespaces table. Configs are not
+// linked to it by a column: the namespace of a config is the prefix of
+// its qualified name, see configman.SplitName.
+func (store *SqlStore) initNamespacesTable() error {
+        _, err := store.db.Exec(`
+                CREATE TABLE IF NOT EXISTS namespaces (
+                        name TEXT PRIMARY KEY,
+                        desc TEXT NOT NULL,
+                        created_at INTEGER NOT NULL
+                )
+        `)
+
+        if err != nil {
+                return errors.Join(errNamespacesTable, err)
+        }
+
+        return nil
+}
+
+// prepNamespaceStmts prepares the SQL statements used for namespaces.
+func (store *SqlStore) prepNamespaceStmts() error {
+        var err error
+
+        store.createNamespaceStmt, err = store.prepare("createNamespace", noConfig, `
+                INSERT INTO namespaces (name, desc, created_at)
+                VALUES (?, ?, ?)
+                ON CONFLICT (name) DO NOTHING
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getNamespaceStmt, err = store.prepare("getNamespace", noConfig, "SELECT COUNT(*) FROM namespaces WHERE name = ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.getNamespacesStmt, err = store.prepare("getNamespaces", noConfig, "SELECT name, desc, created_at FROM namespaces ORDER BY name")
+
+        if err != nil {
+                return err
+        }
+
+        store.countNamespaceConfigsStmt, err = store.prepare("countNamespaceConfigs", noConfig, "SELECT COUNT(*) FROM configs WHERE substr(name, 1, length(?)) = ? AND deleted_at = 0")
+
+        if err != nil {
+                return err
+        }
+
+        store.deleteNamespaceStmt, err = store.prepare("deleteNamespace", noConfig, "DELETE FROM namespaces WHERE name = ?")
+
+        return err
+}
+
+// CreateNamespace implements configman.NamespaceStore.
+func (store *SqlStore) CreateNamespace(name, desc string) (_ *configman.Namespace, err error) {
+        var affected int64
+
+        defer store.observe("create namespace", "namespace", name)(&err)
+
+        if err = configman.ValidNamespace(name); err != nil {
+                return nil, errors.Join(errCreateNamespace, err)
+        }
+
+        now := time.Now()
+
+        if affected, err = execAffected(store.createNamespaceStmt, name, desc, now.Unix()); err != nil {
+                return nil, errors.Join(errCreateNamespace, err)
+        }
+
+        if affected == 0 {
+                return nil, fmt.Errorf("sqlstore: namespace %s: %w", name, configman.ErrExists)
+        }
+
+        return &configman.Namespace{Name: name, Description: desc, CreatedAt: time.Unix(now.Unix(), 0)}, nil
+}
+
+// GetNamespaces implements configman.NamespaceStore.
+func (store *SqlStore) GetNamespaces() (_ []configman.Namespace, err error) {
+        var rows *sql.Rows
+
+        defer store.observe("get namespaces")(&err)
+
+        namespaces := make([]configman.Namespace, 0)
+
+        if rows, err = store.getNamespacesStmt.Query(); err != nil {
+                return namespaces, errors.Join(errGetNamespaces, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var createdAt int64
+                var namespace configman.Namespace
+
+                if err = rows.Scan(&namespace.Name, &namespace.Description, &createdAt); err != nil {
+                        return namespaces, errors.Join(errGetNamespaces, err)
+                }
+
+                namespace.CreatedAt = time.Unix(createdAt, 0)
+                namespaces = append(namespaces, namespace)
+        }
+
+        if err = rows.Err(); err != nil {
+                return namespaces, errors.Join(errGetNamespaces, err)
+        }
+
+        return namespaces, nil
+}
+
+// DeleteNamespace implements configman.NamespaceStore. The namespace and
+// the grants on all of its configs are deleted in one transaction.
+func (store *SqlStore) DeleteNamespace(name string) (err error) {
+        var tx *sql.Tx
+        var configs, affected int64
+
+        defer store.observe("delete namespace", "namespace", name)(&err)
+
+        prefix := configman.QualifiedName(name, "")
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errDeleteNamespace, err)
+        }
+
+        if err = store.countNamespaceConfigsStmt.in(tx).QueryRow(prefix, prefix).Scan(&configs); err != nil {
+                return rollback(tx, errDeleteNamespace, err)
+        }
+
+        if configs > 0 {
+                return rollback(tx, fmt.Errorf("sqlstore: namespace %s: %w", name, configman.ErrNamespaceNotEmpty))
+        }
+
+        if _, err = store.exec(tx, "deleteNamespaceGrants", configman.AllConfigsIn(name), "DELETE FROM grants WHERE config_name = ?", configman.AllConfigsIn(name)); err != nil {
+                return rollback(tx, errDeleteNamespace, err)
+        }
+
+        if affected, err = execAffected(store.deleteNamespaceStmt.in(tx), name); err != nil {
+                return rollback(tx, errDeleteNamespace, err)
+        }
+
+        if affected == 0 {
+                return rollback(tx, fmt.Errorf("sqlstore: namespace %s: %w", name, configman.ErrNotFound))
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errDeleteNamespace, err)
+        }
+
+        return nil
+}
+
+// checkNamespace returns an error wrapping configman.ErrNotFound if the
+// namespace of the config with the qualified name config does not
+// exist. The default namespace always exists.
+func (store *SqlStore) checkNamespace(config string) error {
+        var count int64
+
+        namespace := configman.NamespaceOf(config)
+
+        if namespace == "" {
+                return nil
+        }
+
+        if err := store.getNamespaceStmt.QueryRow(namespace).Scan(&count); err != nil {
+                return err
+        }
+
+        if count == 0 {
+                return fmt.Errorf("sqlstore: namespace %s: %w", namespace, configman.ErrNotFound)
+        }
+
+        return nil
+}
@@ -0,0 +1,238 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/vlence/configman"
+)
+
+var errPageIndexes = fmt.Errorf("sqlstore: failed to create indexes for sorting")
+var errListConfigs = fmt.Errorf("sqlstore: failed to list configs")
+var errListSettings = fmt.Errorf("sqlstore: failed to list settings")
+
+// sortColumns maps the fields listings can be sorted by to their
+// columns, which are the same in configs and settings.
+var sortColumns = map[configman.SortField]string{
+        configman.SortByName:    "name",
+        configman.SortByCreated: "created_at",
+        configman.SortByUpdated: "updated_at",
+}
+
+// initPageIndexes creates the indexes that let listings sorted by
+// creation or update time seek to a page instead of sorting every row.
+// Sorting by name uses the indexes the tables already have.
+func (store *SqlStore) initPageIndexes() error {
+        var tx *sql.Tx
+        var err error
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errPageIndexes, err)
+        }
+
+        for _, query := range []string{
+                "CREATE INDEX IF NOT EXISTS configs_created_at_index ON configs (created_at, id)",
+                "CREATE INDEX IF NOT EXISTS configs_updated_at_index ON configs (updated_at, id)",
+                "CREATE INDEX IF NOT EXISTS settings_created_at_index ON settings (config_name, created_at, name)",
+                "CREATE INDEX IF NOT EXISTS settings_updated_at_index ON settings (config_name, updated_at, name)",
+        } {
+                if _, err = tx.Exec(query); err != nil {
+                        return rollback(tx, errPageIndexes, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errPageIndexes, err)
+        }
+
+        return nil
+}
+
+// ListConfigs implements configman.PagedStore. Configs with the same
+// sort value are ordered by id.
+func (store *SqlStore) ListConfigs(query configman.Query, page configman.PageRequest) (_ *configman.Page[configman.Config], err error) {
+        var rows *sql.Rows
+        var limit int
+        var after, order string
+        var afterArgs []any
+        var config *SqlConfig
+
+        defer store.observe("list configs", "sort", page.Sort, "limit", page.Limit)(&err)
+
+        result := &configman.Page[configman.Config]{Items: make([]configman.Config, 0), Total: -1}
+        where, args := querySQL(query, "config_labels l", "l.config_name = configs.name")
+        where = "deleted_at = 0 AND " + where
+
+        if limit, after, afterArgs, order, err = pageSQL(&page, "id", true); err != nil {
+                return nil, errors.Join(errListConfigs, err)
+        }
+
+        rows, err = store.query(
+                "listConfigs", "",
+                "SELECT"+configColumns+"FROM configs WHERE "+where+" AND "+after+" ORDER BY "+order+" LIMIT ?",
+                append(append(args, afterArgs...), limit+1)...,
+        )
+
+        if err != nil {
+                return nil, errors.Join(errListConfigs, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if config, err = store.scanConfig(rows); err != nil {
+                        return nil, errors.Join(errListConfigs, err)
+                }
+
+                if len(result.Items) == limit {
+                        last := result.Items[limit-1].(*SqlConfig)
+                        result.NextCursor = nextCursor(page, last.name, last.createdAt.Unix(), last.updatedAt.Unix(), strconv.FormatInt(last.id, 10))
+                        break
+                }
+
+                result.Items = append(result.Items, config)
+        }
+
+        if err = rows.Err(); err != nil {
+                return nil, errors.Join(errListConfigs, err)
+        }
+
+        if page.CountTotal {
+                if result.Total, err = store.count("countConfigs", "", "SELECT COUNT(*) FROM configs WHERE "+where, args...); err != nil {
+                        return nil, errors.Join(errListConfigs, err)
+                }
+        }
+
+        return result, nil
+}
+
+// ListSettings implements configman.PagedStore. Settings with the same
+// sort value are ordered by name.
+func (store *SqlStore) ListSettings(config string, query configman.Query, page configman.PageRequest) (_ *configman.Page[*configman.Setting], err error) {
+        var rows *sql.Rows
+        var limit int
+        var after, order string
+        var afterArgs []any
+        var setting *configman.Setting
+
+        defer store.observe("list settings", "config", config, "sort", page.Sort, "limit", page.Limit)(&err)
+
+        result := &configman.Page[*configman.Setting]{Items: make([]*configman.Setting, 0), Total: -1}
+        where, args := querySQL(query, "setting_labels l", "l.config_name = settings.config_name AND l.setting_name = settings.name")
+        where = "config_name = ? AND deleted_at = 0 AND " + where
+        args = append([]any{config}, args...)
+
+        if limit, after, afterArgs, order, err = pageSQL(&page, "name", false); err != nil {
+                return nil, errors.Join(errListSettings, err)
+        }
+
+        rows, err = store.query(
+                "listSettings", config,
+                "SELECT"+settingColumns+"FROM settings WHERE "+where+" AND "+after+" ORDER BY "+order+" LIMIT ?",
+                append(append(args, afterArgs...), limit+1)...,
+        )
+
+        if err != nil {
+                return nil, errors.Join(errListSettings, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if setting, err = store.scanSetting(rows); err != nil {
+                        return nil, errors.Join(errListSettings, err)
+                }
+
+                if len(result.Items) == limit {
+                        last := result.Items[limit-1]
+                        result.NextCursor = nextCursor(page, last.Name(), last.CreatedAt().Unix(), last.UpdatedAt().Unix(), last.Name())
+                        break
+                }
+
+                result.Items = append(result.Items, setting)
+        }
+
+        if err = rows.Err(); err != nil {
+                return nil, errors.Join(errListSettings, err)
+        }
+
+        if page.CountTotal {
+                if result.Total, err = store.count("countSettings", config, "SELECT COUNT(*) FROM settings WHERE "+where, args...); err != nil {
+                        return nil, errors.Join(errListSettings, err)
+                }
+        }
+
+        return result, nil
+}
+
+// pageSQL normalizes page and returns its limit, the condition, with its
+// arguments, that skips the rows up to its cursor, and its ORDER BY
+// clause. Rows with the same sort value are ordered by the column key,
+// which is an integer if numericKey is true. The condition compares row
+// values so that the index on the sort column and key is used to seek
+// to the cursor.
+func pageSQL(page *configman.PageRequest, key string, numericKey bool) (limit int, after string, args []any, order string, err error) {
+        var cursor configman.PageCursor
+
+        if page.Sort, err = configman.ParseSortField(string(page.Sort)); err != nil {
+                return 0, "", nil, "", err
+        }
+
+        switch {
+        case page.Limit < 0:
+                return 0, "", nil, "", configman.ErrInvalidPage
+        case page.Limit == 0:
+                limit = configman.DefaultPageSize
+        default:
+                limit = min(page.Limit, configman.MaxPageSize)
+        }
+
+        column, direction, comparison := sortColumns[page.Sort], "ASC", ">"
+
+        if page.Descending {
+                direction, comparison = "DESC", "<"
+        }
+
+        order = column + " " + direction + ", " + key + " " + direction
+
+        if page.Cursor == "" {
+                return limit, "TRUE", nil, order, nil
+        }
+
+        if cursor, err = configman.DecodeCursor(*page); err != nil {
+                return 0, "", nil, "", err
+        }
+
+        args = []any{cursor.Name, cursor.Key}
+
+        if page.Sort != configman.SortByName {
+                args[0] = cursor.Time
+        }
+
+        if numericKey {
+                if args[1], err = strconv.ParseInt(cursor.Key, 10, 64); err != nil {
+                        return 0, "", nil, "", configman.ErrInvalidPage
+                }
+        }
+
+        return limit, "(" + column + ", " + key + ") " + comparison + " (?, ?)", args, order, nil
+}
+
+// nextCursor returns the cursor of the page after the one requested by
+// page, whose last row has the given sort values and key.
+func nextCursor(page configman.PageRequest, name string, createdAt, updatedAt int64, key string) string {
+        cursor := configman.PageCursor{Sort: page.Sort, Descending: page.Descending, Key: key}
+
+        switch page.Sort {
+        case configman.SortByCreated:
+                cursor.Time = createdAt
+        case configman.SortByUpdated:
+                cursor.Time = updatedAt
+        default:
+                cursor.Name = name
+        }
+
+        return configman.EncodeCursor(cursor)
+}
@@ -0,0 +1,132 @@
+package sqlstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestListConfigsPagesAcrossTies(t *testing.T) {
+        store := newTestStore(t)
+        names := []string{"e", "b", "g", "a", "f", "c", "d"}
+        mustCreateConfigs(t, store, names...)
+
+        // every config is created and updated at the same time, so only
+        // the tiebreaker orders them
+        if _, err := store.db.Exec("UPDATE configs SET created_at = 1000, updated_at = 1000"); err != nil {
+                t.Fatalf("failed to set the times of configs: %v", err)
+        }
+
+        tests := []struct {
+                sort       configman.SortField
+                descending bool
+                want       []string
+        }{
+                {sort: configman.SortByName, want: []string{"a", "b", "c", "d", "e", "f", "g"}},
+                {sort: configman.SortByName, descending: true, want: []string{"g", "f", "e", "d", "c", "b", "a"}},
+                {sort: configman.SortByCreated, want: names},
+                {sort: configman.SortByCreated, descending: true, want: []string{"d", "c", "f", "a", "g", "b", "e"}},
+                {sort: configman.SortByUpdated, want: names},
+        }
+
+        for _, test := range tests {
+                t.Run(fmt.Sprintf("%s descending %t", test.sort, test.descending), func(t *testing.T) {
+                        var got []string
+
+                        request := configman.PageRequest{Sort: test.sort, Descending: test.descending, Limit: 2, CountTotal: true}
+
+                        for pages := 0; ; pages++ {
+                                if pages > len(names) {
+                                        t.Fatalf("still paging after %d pages, got %v", pages, got)
+                                }
+
+                                page, err := store.ListConfigs(configman.Query{}, request)
+
+                                if err != nil {
+                                        t.Fatalf("ListConfigs returned %v", err)
+                                }
+
+                                if page.Total != len(names) {
+                                        t.Errorf("got total %d, want %d", page.Total, len(names))
+                                }
+
+                                for _, config := range page.Items {
+                                        got = append(got, config.Name())
+                                }
+
+                                if page.NextCursor == "" {
+                                        break
+                                }
+
+                                request.Cursor = page.NextCursor
+                        }
+
+                        if !slices.Equal(got, test.want) {
+                                t.Errorf("got configs %v, want %v", got, test.want)
+                        }
+                })
+        }
+}
+
+func TestListSettingsPagesAcrossTies(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).
+                Create("app", "timeout", "", int64(30)).
+                Create("app", "retries", "", int64(3)).
+                Create("app", "limit", "", int64(5)))
+
+        if _, err := store.db.Exec("UPDATE settings SET created_at = 1000, updated_at = 1000"); err != nil {
+                t.Fatalf("failed to set the times of settings: %v", err)
+        }
+
+        var got []string
+
+        request := configman.PageRequest{Sort: configman.SortByUpdated, Descending: true, Limit: 1}
+
+        for pages := 0; ; pages++ {
+                if pages > 3 {
+                        t.Fatalf("still paging after %d pages, got %v", pages, got)
+                }
+
+                page, err := store.ListSettings("app", configman.Query{}, request)
+
+                if err != nil {
+                        t.Fatalf("ListSettings returned %v", err)
+                }
+
+                for _, setting := range page.Items {
+                        got = append(got, setting.Name())
+                }
+
+                if page.NextCursor == "" {
+                        break
+                }
+
+                request.Cursor = page.NextCursor
+        }
+
+        if want := []string{"timeout", "retries", "limit"}; !slices.Equal(got, want) {
+                t.Errorf("got settings %v, want %v", got, want)
+        }
+}
+
+func TestListConfigsRejectsCursorOfAnotherOrder(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "a", "b")
+
+        page, err := store.ListConfigs(configman.Query{}, configman.PageRequest{Sort: configman.SortByCreated, Limit: 1})
+
+        if err != nil {
+                t.Fatalf("ListConfigs returned %v", err)
+        }
+
+        request := configman.PageRequest{Sort: configman.SortByName, Limit: 1, Cursor: page.NextCursor}
+
+        if _, err = store.ListConfigs(configman.Query{}, request); !errors.Is(err, configman.ErrInvalidPage) {
+                t.Errorf("ListConfigs returned %v for a cursor of another order, want %v", err, configman.ErrInvalidPage)
+        }
+}
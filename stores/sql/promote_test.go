@@ -0,0 +1,120 @@
+package sqlstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestPromote(t *testing.T) {
+        tests := []struct {
+                name      string
+                promotion configman.Promotion
+                err       error
+                want      map[string]any // values of settings of prod after the promotion, nil if missing
+        }{
+                {
+                        name:      "incompatible setting",
+                        promotion: configman.Promotion{From: "staging", To: "prod"},
+                        err:       configman.ErrTypeMismatch,
+                        want:      map[string]any{"timeout": int64(30), "retries": nil, "mode": int64(1)},
+                },
+                {
+                        name:      "named settings",
+                        promotion: configman.Promotion{From: "staging", To: "prod", Settings: []string{"timeout", "retries"}},
+                        want:      map[string]any{"timeout": int64(60), "retries": int64(5), "mode": int64(1)},
+                },
+                {
+                        name:      "selected settings",
+                        promotion: configman.Promotion{From: "staging", To: "prod", Selector: configman.Selector{{Key: "team", Op: configman.SelectEquals, Values: []string{"payments"}}}},
+                        want:      map[string]any{"timeout": int64(30), "retries": int64(5)},
+                },
+                {
+                        name:      "secrets skipped",
+                        promotion: configman.Promotion{From: "staging", To: "prod", Settings: []string{"timeout", "password"}, SkipSecrets: true},
+                        want:      map[string]any{"timeout": int64(60), "password": nil},
+                },
+                {
+                        name:      "secrets copied",
+                        promotion: configman.Promotion{From: "staging", To: "prod", Settings: []string{"password"}},
+                        want:      map[string]any{"timeout": int64(30), "password": "s3cret"},
+                },
+                {
+                        name:      "missing setting",
+                        promotion: configman.Promotion{From: "staging", To: "prod", Settings: []string{"limit"}},
+                        err:       configman.ErrNotFound,
+                        want:      map[string]any{"timeout": int64(30)},
+                },
+                {
+                        name:      "missing target",
+                        promotion: configman.Promotion{From: "staging", To: "dev"},
+                        err:       configman.ErrNotFound,
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateConfigs(t, store, "staging", "prod")
+                        mustApply(t, store, new(configman.Batch).
+                                Create("staging", "timeout", "", int64(60)).
+                                Create("staging", "retries", "", int64(5)).
+                                Create("staging", "password", "", "s3cret").
+                                Create("staging", "mode", "", "fast").
+                                Create("prod", "timeout", "", int64(30)).
+                                Create("prod", "mode", "", int64(1)))
+
+                        if err := store.SetSettingLabels("staging", "password", configman.Labels{configman.SecretLabel: "true"}); err != nil {
+                                t.Fatalf("failed to label setting: %v", err)
+                        }
+
+                        if err := store.SetSettingLabels("staging", "retries", configman.Labels{"team": "payments"}); err != nil {
+                                t.Fatalf("failed to label setting: %v", err)
+                        }
+
+                        if _, _, err := configman.Promote(store, test.promotion, "test"); !errors.Is(err, test.err) {
+                                t.Fatalf("Promote returned %v, want %v", err, test.err)
+                        }
+
+                        for setting, want := range test.want {
+                                if value := valueOf(t, store, "prod", setting); value != want {
+                                        t.Errorf("%s of prod is %v after the promotion, want %v", setting, value, want)
+                                }
+                        }
+                })
+        }
+}
+
+func TestPromoteIsOneRevision(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "staging", "prod")
+        mustApply(t, store, new(configman.Batch).
+                Create("staging", "timeout", "", int64(60)).
+                Create("staging", "retries", "", int64(5)).
+                Create("prod", "timeout", "", int64(30)))
+
+        plan, event, err := configman.Promote(store, configman.Promotion{From: "staging", To: "prod"}, "test")
+
+        if err != nil {
+                t.Fatalf("Promote returned %v", err)
+        }
+
+        if len(plan.Changes) != 2 || event == nil || len(event.Ops) != 2 {
+                t.Fatalf("got %d changes in one event %+v, want 2", len(plan.Changes), event)
+        }
+
+        history, err := store.GetHistory("prod", 10)
+
+        if err != nil {
+                t.Fatalf("failed to get history: %v", err)
+        }
+
+        if len(history) != 2 || history[0].Revision != event.Revision {
+                t.Errorf("got history %v, want the promotion as its last of 2 revisions", history)
+        }
+
+        if _, event, err = configman.Promote(store, configman.Promotion{From: "staging", To: "prod"}, "test"); err != nil || event != nil {
+                t.Errorf("promoting again returned %v and event %+v, want nothing to change", err, event)
+        }
+}
@@ -0,0 +1,433 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errScheduledChangesTable = fmt.Errorf("sqlstore: failed to create scheduled changes table")
+var errScheduleChange = fmt.Errorf("sqlstore: failed to schedule change")
+var errCancelScheduledChange = fmt.Errorf("sqlstore: failed to cancel scheduled change")
+var errGetScheduledChanges = fmt.Errorf("sqlstore: failed to get scheduled changes")
+var errApplyScheduledChanges = fmt.Errorf("sqlstore: failed to apply scheduled changes")
+
+// scheduledChangeColumns are the columns selected by every query that
+// reads scheduled changes. Use scanScheduledChange to scan rows selected
+// with these columns.
+const scheduledChangeColumns = `
+        id,
+        config_name,
+        setting_name,` + valueColumns + `,
+        effective_at,
+        created_at,
+        created_by,
+        applied_at,
+        error,
+        cancelled
+`
+
+// initScheduledChangesTable creates the scheduled_changes table and its
+// indices. applied_at is NULL until the change has been applied or
+// failed to, and error is empty unless it failed.
+func (store *SqlStore) initScheduledChangesTable() error {
+        var tx *sql.Tx
+        var txErr, commitErr, execErr error
+
+        if tx, txErr = store.db.Begin(); txErr != nil {
+                return errors.Join(errScheduledChangesTable, txErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE TABLE IF NOT EXISTS scheduled_changes (
+                        id INTEGER PRIMARY KEY,
+                        config_name TEXT NOT NULL,
+                        setting_name TEXT NOT NULL,
+                        value_type INTEGER NOT NULL,
+                        int32_value INTEGER,
+                        int64_value INTEGER,
+                        float32_value REAL,
+                        float64_value REAL,
+                        bool_value BOOLEAN,
+                        string_value TEXT,
+                        effective_at INTEGER NOT NULL,
+                        created_at INTEGER NOT NULL,
+                        created_by TEXT NOT NULL,
+                        applied_at INTEGER,
+                        error TEXT NOT NULL DEFAULT '',
+                        cancelled BOOLEAN NOT NULL DEFAULT FALSE
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errScheduledChangesTable, execErr)
+        }
+
+        if execErr = addColumn(tx, "scheduled_changes", "error", "TEXT NOT NULL DEFAULT ''"); execErr != nil {
+                return rollback(tx, errScheduledChangesTable, execErr)
+        }
+
+        // Changes cancelled because their config was deleted record when,
+        // so that restoring the config makes them pending again.
+        if execErr = addColumn(tx, "scheduled_changes", "deleted_at", "INTEGER NOT NULL DEFAULT 0"); execErr != nil {
+                return rollback(tx, errScheduledChangesTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE INDEX IF NOT EXISTS scheduled_changes_effectiveat_index ON scheduled_changes (
+                        effective_at
+                ) WHERE applied_at IS NULL AND cancelled = FALSE
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errScheduledChangesTable, execErr)
+        }
+
+        _, execErr = tx.Exec(`
+                CREATE INDEX IF NOT EXISTS scheduled_changes_configname_index ON scheduled_changes (
+                        config_name
+                )
+        `)
+
+        if execErr != nil {
+                return rollback(tx, errScheduledChangesTable, execErr)
+        }
+
+        if commitErr = tx.Commit(); commitErr != nil {
+                return errors.Join(errScheduledChangesTable, commitErr)
+        }
+
+        return nil
+}
+
+// prepScheduleStmts prepares the SQL statements used to manage scheduled
+// changes.
+func (store *SqlStore) prepScheduleStmts() error {
+        var err error
+
+        store.scheduleChangeStmt, err = store.prepare("scheduleChange", 0, `
+                INSERT INTO scheduled_changes (
+                        config_name,
+                        setting_name,` + valueColumns + `,
+                        effective_at,
+                        created_at,
+                        created_by
+                ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.cancelScheduledChangeStmt, err = store.prepare("cancelScheduledChange", noConfig, `
+                UPDATE scheduled_changes
+                SET cancelled = TRUE
+                WHERE id = ? AND (applied_at IS NULL OR error != '') AND cancelled = FALSE
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getScheduledChangesStmt, err = store.prepare("getScheduledChanges", 0, `
+                SELECT` + scheduledChangeColumns + `
+                FROM scheduled_changes
+                WHERE config_name = ? AND (applied_at IS NULL OR error != '') AND cancelled = FALSE
+                ORDER BY effective_at, id
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getDueChangesStmt, err = store.prepare("getDueChanges", noConfig, `
+                SELECT` + scheduledChangeColumns + `
+                FROM scheduled_changes
+                WHERE effective_at <= ? AND applied_at IS NULL AND cancelled = FALSE
+                ORDER BY effective_at, id
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        // Claiming a change and setting its value happen in the same
+        // transaction. Only one process can claim a change because the
+        // update only matches changes that have not been applied yet.
+        store.claimScheduledChangeStmt, err = store.prepare("claimScheduledChange", noConfig, `
+                UPDATE scheduled_changes
+                SET applied_at = ?
+                WHERE id = ? AND applied_at IS NULL AND cancelled = FALSE
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.failScheduledChangeStmt, err = store.prepare("failScheduledChange", noConfig, `
+                UPDATE scheduled_changes
+                SET error = ?
+                WHERE id = ?
+        `)
+
+        return err
+}
+
+// ScheduleChange schedules value to be set on the given setting at the
+// given time. The setting must exist and value must be of the same type
+// as the setting.
+func (store *SqlStore) ScheduleChange(config, setting string, value any, at time.Time, by string) (_ *configman.ScheduledChange, err error) {
+        var tx *sql.Tx
+        var result sql.Result
+        var target *configman.Setting
+
+        defer store.observe("schedule change", "config", config, "setting", setting, "at", at, "by", by)(&err)
+
+        if target, err = store.GetSetting(config, setting); err != nil {
+                return nil, errors.Join(errScheduleChange, err)
+        }
+
+        if target == nil {
+                return nil, errors.Join(errScheduleChange, errSettingNotFound(config, setting))
+        }
+
+        if configman.TypeOf(value) != target.Type() {
+                return nil, errors.Join(errScheduleChange, configman.ErrTypeMismatch)
+        }
+
+        v := newSqlValue(value)
+        now := time.Now()
+
+        args := []any{config, setting}
+        args = append(args, v.args()...)
+        args = append(args, at.Unix(), now.Unix(), by)
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errScheduleChange, err)
+        }
+
+        if err = store.checkProtected(tx, config); err != nil {
+                return nil, rollback(tx, errScheduleChange, err)
+        }
+
+        if result, err = store.scheduleChangeStmt.in(tx).Exec(args...); err != nil {
+                return nil, rollback(tx, errScheduleChange, err)
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errScheduleChange, err)
+        }
+
+        change := &configman.ScheduledChange{
+                Config:      config,
+                Setting:     setting,
+                Value:       value,
+                EffectiveAt: time.Unix(at.Unix(), 0),
+                CreatedAt:   time.Unix(now.Unix(), 0),
+                CreatedBy:   by,
+        }
+
+        if change.ID, err = result.LastInsertId(); err != nil {
+                return change, errors.Join(errScheduleChange, err)
+        }
+
+        return change, nil
+}
+
+// CancelScheduledChange cancels the scheduled change with the given id,
+// or dismisses it if it failed. configman.ErrNotPending is returned if
+// the change does not exist, has already been applied or has already
+// been cancelled.
+func (store *SqlStore) CancelScheduledChange(id int64) (err error) {
+        var affected int64
+        var result sql.Result
+
+        defer store.observe("cancel scheduled change", "id", id)(&err)
+
+        if result, err = store.cancelScheduledChangeStmt.Exec(id); err != nil {
+                return errors.Join(errCancelScheduledChange, err)
+        }
+
+        if affected, err = result.RowsAffected(); err != nil {
+                return errors.Join(errCancelScheduledChange, err)
+        }
+
+        if affected == 0 {
+                return configman.ErrNotPending
+        }
+
+        return nil
+}
+
+// GetScheduledChanges returns the pending and failed changes of the
+// given config, earliest first.
+func (store *SqlStore) GetScheduledChanges(config string) ([]*configman.ScheduledChange, error) {
+        changes, err := store.queryScheduledChanges(store.getScheduledChangesStmt, config)
+
+        if err != nil {
+                return changes, errors.Join(errGetScheduledChanges, err)
+        }
+
+        return changes, nil
+}
+
+// ApplyScheduledChanges applies every pending change that is due at now.
+// Each change is applied in its own transaction together with marking
+// it as applied, so a change claimed by another process sharing the
+// database is skipped rather than applied twice.
+func (store *SqlStore) ApplyScheduledChanges(now time.Time) (_ int, err error) {
+        var ok bool
+        var changes []*configman.ScheduledChange
+
+        defer store.observe("apply scheduled changes")(&err)
+
+        if changes, err = store.queryScheduledChanges(store.getDueChangesStmt, now.Unix()); err != nil {
+                return 0, errors.Join(errApplyScheduledChanges, err)
+        }
+
+        applied := 0
+
+        for _, change := range changes {
+                if ok, err = store.applyScheduledChange(change, now); err != nil {
+                        return applied, errors.Join(errApplyScheduledChanges, err)
+                }
+
+                if ok {
+                        applied++
+                }
+        }
+
+        return applied, nil
+}
+
+// applyScheduledChange claims change and sets the value of its setting.
+// It returns false if the change had already been claimed or failed.
+func (store *SqlStore) applyScheduledChange(change *configman.ScheduledChange, now time.Time) (bool, error) {
+        var tx *sql.Tx
+        var err error
+        var affected int64
+        var result sql.Result
+        var event *configman.ChangeEvent
+
+        if tx, err = store.db.Begin(); err != nil {
+                return false, err
+        }
+
+        if result, err = store.claimScheduledChangeStmt.in(tx).about(change.Config).Exec(now.Unix(), change.ID); err != nil {
+                return false, rollback(tx, err)
+        }
+
+        if affected, err = result.RowsAffected(); err != nil {
+                return false, rollback(tx, err)
+        }
+
+        if affected == 0 {
+                return false, rollback(tx)
+        }
+
+        // Changes scheduled before their config was protected must be
+        // approved like any other change instead of being applied.
+        if err = store.checkProtected(tx, change.Config); err == nil {
+                ops := []configman.BatchOp{{Kind: configman.OpUpdate, Config: change.Config, Setting: change.Setting, Value: change.Value}}
+                event, err = store.applyOps(tx, ops, change.CreatedBy, now)
+        }
+
+        // The change stays claimed but is marked as failed if its config
+        // has since been protected, or its setting deleted or changed
+        // type; there is nothing left it can be applied to.
+        if err != nil && !errors.Is(err, configman.ErrProtectedConfig) && !errors.Is(err, configman.ErrNotFound) && !errors.Is(err, configman.ErrTypeMismatch) {
+                return false, rollback(tx, err)
+        }
+
+        failed := err != nil
+
+        if failed {
+                store.logger.Warn("sqlstore: scheduled change failed", "id", change.ID, "config", change.Config, "setting", change.Setting, "err", err)
+
+                if _, err = store.failScheduledChangeStmt.in(tx).about(change.Config).Exec(failure(err), change.ID); err != nil {
+                        return false, rollback(tx, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return false, err
+        }
+
+        if event != nil {
+                store.events.Publish(*event)
+        }
+
+        return !failed, nil
+}
+
+// failure returns the reason a scheduled change failed with err.
+func failure(err error) string {
+        switch {
+        case errors.Is(err, configman.ErrProtectedConfig):
+                return "the config has been protected, propose the change for review instead"
+        case errors.Is(err, configman.ErrTypeMismatch):
+                return "the setting has changed type"
+        default:
+                return "the setting has been deleted"
+        }
+}
+
+// queryScheduledChanges runs stmt with args and scans the scheduled
+// changes it returns.
+func (store *SqlStore) queryScheduledChanges(stmt *stmt, args ...any) ([]*configman.ScheduledChange, error) {
+        var rows *sql.Rows
+        var err error
+        var change *configman.ScheduledChange
+
+        changes := make([]*configman.ScheduledChange, 0)
+
+        if rows, err = stmt.Query(args...); err != nil {
+                return changes, err
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if change, err = scanScheduledChange(rows); err != nil {
+                        return changes, err
+                }
+
+                changes = append(changes, change)
+        }
+
+        return changes, rows.Err()
+}
+
+// scanScheduledChange scans a row selected with scheduledChangeColumns.
+func scanScheduledChange(row RowScanner) (*configman.ScheduledChange, error) {
+        var v sqlValue
+        var err error
+        var effectiveAt, createdAt int64
+        var appliedAt sql.NullInt64
+
+        change := new(configman.ScheduledChange)
+
+        dest := []any{&change.ID, &change.Config, &change.Setting}
+        dest = append(dest, v.dest()...)
+        dest = append(dest, &effectiveAt, &createdAt, &change.CreatedBy, &appliedAt, &change.Error, &change.Cancelled)
+
+        if err = row.Scan(dest...); err != nil {
+                return nil, err
+        }
+
+        if change.Value, err = v.value(); err != nil {
+                return nil, err
+        }
+
+        change.EffectiveAt = time.Unix(effectiveAt, 0)
+        change.CreatedAt = time.Unix(createdAt, 0)
+
+        if appliedAt.Valid {
+                change.AppliedAt = time.Unix(appliedAt.Int64, 0)
+        }
+
+        return change, nil
+}
@@ -0,0 +1,137 @@
+package sqlstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+func TestApplyScheduledChanges(t *testing.T) {
+        now := time.Now()
+
+        tests := []struct {
+                name    string
+                at      time.Time
+                before  func(t *testing.T, store *SqlStore, change *configman.ScheduledChange)
+                applied int
+                value   any
+                error   string // of the change once applied, "" if it is still pending or was applied
+                listed  bool
+        }{
+                {
+                        name:    "due",
+                        at:      now.Add(-time.Minute),
+                        applied: 1,
+                        value:   int64(60),
+                },
+                {
+                        name:   "not due",
+                        at:     now.Add(time.Minute),
+                        value:  int64(30),
+                        listed: true,
+                },
+                {
+                        name: "cancelled",
+                        at:   now.Add(-time.Minute),
+                        before: func(t *testing.T, store *SqlStore, change *configman.ScheduledChange) {
+                                if err := store.CancelScheduledChange(change.ID); err != nil {
+                                        t.Fatalf("failed to cancel change: %v", err)
+                                }
+                        },
+                        value: int64(30),
+                },
+                {
+                        name: "claimed by another process",
+                        at:   now.Add(-time.Minute),
+                        before: func(t *testing.T, store *SqlStore, change *configman.ScheduledChange) {
+                                if _, err := store.db.Exec("UPDATE scheduled_changes SET applied_at = ? WHERE id = ?", now.Unix(), change.ID); err != nil {
+                                        t.Fatalf("failed to claim change: %v", err)
+                                }
+                        },
+                        value: int64(30),
+                },
+                {
+                        name: "setting deleted",
+                        at:   now.Add(-time.Minute),
+                        before: func(t *testing.T, store *SqlStore, change *configman.ScheduledChange) {
+                                mustApply(t, store, new(configman.Batch).Delete("app", "timeout"))
+                        },
+                        error:  "the setting has been deleted",
+                        listed: true,
+                },
+                {
+                        name: "setting changed type",
+                        at:   now.Add(-time.Minute),
+                        before: func(t *testing.T, store *SqlStore, change *configman.ScheduledChange) {
+                                mustApply(t, store, new(configman.Batch).Delete("app", "timeout").Create("app", "timeout", "", "30s"))
+                        },
+                        value:  "30s",
+                        error:  "the setting has changed type",
+                        listed: true,
+                },
+                {
+                        name: "config protected",
+                        at:   now.Add(-time.Minute),
+                        before: func(t *testing.T, store *SqlStore, change *configman.ScheduledChange) {
+                                if err := store.SetProtected("app", true); err != nil {
+                                        t.Fatalf("failed to protect config: %v", err)
+                                }
+                        },
+                        value:  int64(30),
+                        error:  "the config has been protected, propose the change for review instead",
+                        listed: true,
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateConfigs(t, store, "app")
+                        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)))
+
+                        change, err := store.ScheduleChange("app", "timeout", int64(60), test.at, "test")
+
+                        if err != nil {
+                                t.Fatalf("failed to schedule change: %v", err)
+                        }
+
+                        if test.before != nil {
+                                test.before(t, store, change)
+                        }
+
+                        applied, err := store.ApplyScheduledChanges(now)
+
+                        if err != nil {
+                                t.Fatalf("ApplyScheduledChanges returned %v", err)
+                        }
+
+                        if applied != test.applied {
+                                t.Errorf("applied %d changes, want %d", applied, test.applied)
+                        }
+
+                        if value := valueOf(t, store, "app", "timeout"); value != test.value {
+                                t.Errorf("timeout is %v, want %v", value, test.value)
+                        }
+
+                        changes, err := store.GetScheduledChanges("app")
+
+                        if err != nil {
+                                t.Fatalf("failed to get scheduled changes: %v", err)
+                        }
+
+                        if listed := len(changes) == 1; listed != test.listed {
+                                t.Fatalf("change listed is %t, want %t", listed, test.listed)
+                        }
+
+                        if test.listed && changes[0].Error != test.error {
+                                t.Errorf("change failed with %q, want %q", changes[0].Error, test.error)
+                        }
+
+                        // claimed changes are never applied twice
+                        if applied, err = store.ApplyScheduledChanges(now); err != nil || applied != 0 {
+                                t.Errorf("applying again applied %d changes with error %v, want none", applied, err)
+                        }
+                })
+        }
+}
@@ -0,0 +1,190 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/vlence/configman"
+)
+
+var errSearchTables = fmt.Errorf("sqlstore: failed to create search tables")
+var errSearch = fmt.Errorf("sqlstore: failed to search")
+
+// Snippets mark the matches between these characters, which do not
+// appear in names, descriptions or values people type.
+const (
+        matchStart = "\x02"
+        matchEnd   = "\x03"
+)
+
+// initSearchTables creates the config_search and setting_search FTS5
+// tables. They index the name and description of configs and settings
+// and the string values of settings, and read their content from the
+// configs and settings tables, which triggers keep them in sync with.
+// The tables are filled from the existing rows when they are created.
+func (store *SqlStore) initSearchTables() error {
+        var tx *sql.Tx
+        var err error
+        var exists int
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errSearchTables, err)
+        }
+
+        if err = tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'config_search'").Scan(&exists); err != nil {
+                return rollback(tx, errSearchTables, err)
+        }
+
+        for _, query := range []string{
+                `CREATE VIRTUAL TABLE IF NOT EXISTS config_search USING fts5 (
+                        name, desc,
+                        content = 'configs', content_rowid = 'id'
+                )`,
+                `CREATE TRIGGER IF NOT EXISTS config_search_insert AFTER INSERT ON configs BEGIN
+                        INSERT INTO config_search (rowid, name, desc) VALUES (new.id, new.name, new.desc);
+                END`,
+                `CREATE TRIGGER IF NOT EXISTS config_search_delete AFTER DELETE ON configs BEGIN
+                        INSERT INTO config_search (config_search, rowid, name, desc) VALUES ('delete', old.id, old.name, old.desc);
+                END`,
+                `CREATE TRIGGER IF NOT EXISTS config_search_update AFTER UPDATE OF name, desc ON configs BEGIN
+                        INSERT INTO config_search (config_search, rowid, name, desc) VALUES ('delete', old.id, old.name, old.desc);
+                        INSERT INTO config_search (rowid, name, desc) VALUES (new.id, new.name, new.desc);
+                END`,
+                `CREATE VIRTUAL TABLE IF NOT EXISTS setting_search USING fts5 (
+                        name, desc, string_value,
+                        content = 'settings', content_rowid = 'id'
+                )`,
+                `CREATE TRIGGER IF NOT EXISTS setting_search_insert AFTER INSERT ON settings BEGIN
+                        INSERT INTO setting_search (rowid, name, desc, string_value) VALUES (new.id, new.name, new.desc, new.string_value);
+                END`,
+                `CREATE TRIGGER IF NOT EXISTS setting_search_delete AFTER DELETE ON settings BEGIN
+                        INSERT INTO setting_search (setting_search, rowid, name, desc, string_value) VALUES ('delete', old.id, old.name, old.desc, old.string_value);
+                END`,
+                `CREATE TRIGGER IF NOT EXISTS setting_search_update AFTER UPDATE OF name, desc, string_value ON settings BEGIN
+                        INSERT INTO setting_search (setting_search, rowid, name, desc, string_value) VALUES ('delete', old.id, old.name, old.desc, old.string_value);
+                        INSERT INTO setting_search (rowid, name, desc, string_value) VALUES (new.id, new.name, new.desc, new.string_value);
+                END`,
+        } {
+                if _, err = tx.Exec(query); err != nil {
+                        return rollback(tx, errSearchTables, err)
+                }
+        }
+
+        if exists == 0 {
+                for _, query := range []string{
+                        "INSERT INTO config_search (config_search) VALUES ('rebuild')",
+                        "INSERT INTO setting_search (setting_search) VALUES ('rebuild')",
+                } {
+                        if _, err = tx.Exec(query); err != nil {
+                                return rollback(tx, errSearchTables, err)
+                        }
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errSearchTables, err)
+        }
+
+        return nil
+}
+
+// prepSearchStmts prepares the SQL statements used to search.
+func (store *SqlStore) prepSearchStmts() error {
+        var err error
+
+        store.searchStmt, err = store.prepare("search", noConfig, `
+                SELECT configs.name, '', snippet(config_search, -1, ?, ?, '…', 16), bm25(config_search) AS rank
+                FROM config_search JOIN configs ON configs.id = config_search.rowid
+                WHERE config_search MATCH ? AND configs.deleted_at = 0
+                UNION ALL
+                SELECT settings.config_name, settings.name, snippet(setting_search, -1, ?, ?, '…', 16), bm25(setting_search) AS rank
+                FROM setting_search JOIN settings ON settings.id = setting_search.rowid
+                WHERE setting_search MATCH ? AND settings.deleted_at = 0
+                ORDER BY rank
+                LIMIT ?
+        `)
+
+        return err
+}
+
+// Search implements configman.SearchStore.
+func (store *SqlStore) Search(query string, limit int) (_ []configman.SearchResult, err error) {
+        var rows *sql.Rows
+        var snippet string
+
+        defer store.observe("search", "limit", limit)(&err)
+
+        if limit <= 0 {
+                return nil, configman.ErrInvalidLimit
+        }
+
+        results := make([]configman.SearchResult, 0)
+        match := ftsQuery(query)
+
+        if match == "" {
+                return results, nil
+        }
+
+        if rows, err = store.searchStmt.Query(matchStart, matchEnd, match, matchStart, matchEnd, match, limit); err != nil {
+                return results, errors.Join(errSearch, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var result configman.SearchResult
+                var rank float64
+
+                if err = rows.Scan(&result.Config, &result.Setting, &snippet, &rank); err != nil {
+                        return results, errors.Join(errSearch, err)
+                }
+
+                result.Snippet = fragments(snippet)
+                results = append(results, result)
+        }
+
+        if err = rows.Err(); err != nil {
+                return results, errors.Join(errSearch, err)
+        }
+
+        return results, nil
+}
+
+// ftsQuery returns the FTS5 query matching rows that contain words
+// starting with every term of query. Terms are quoted so that the FTS5
+// query syntax has no meaning in them.
+func ftsQuery(query string) string {
+        terms := strings.Fields(query)
+
+        for i, term := range terms {
+                terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+        }
+
+        return strings.Join(terms, " ")
+}
+
+// fragments splits a snippet whose matches are marked with matchStart
+// and matchEnd into fragments.
+func fragments(snippet string) []configman.Fragment {
+        result := make([]configman.Fragment, 0)
+
+        for snippet != "" {
+                before, rest, found := strings.Cut(snippet, matchStart)
+
+                if before != "" {
+                        result = append(result, configman.Fragment{Text: before})
+                }
+
+                if !found {
+                        break
+                }
+
+                matched, after, _ := strings.Cut(rest, matchEnd)
+                result = append(result, configman.Fragment{Text: matched, Match: true})
+                snippet = after
+        }
+
+        return result
+}
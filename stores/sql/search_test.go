@@ -0,0 +1,48 @@
+package sqlstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vlence/configman"
+)
+
+func TestSearchLimit(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", "slow").Create("app", "retries", "", "slow"))
+
+        searchers := map[string]configman.Store{
+                "store":    store,
+                "fallback": struct{ configman.Store }{store}, // hides SearchStore
+        }
+
+        tests := []struct {
+                limit   int
+                results int
+                err     error
+        }{
+                {limit: -1, err: configman.ErrInvalidLimit},
+                {limit: 0, err: configman.ErrInvalidLimit},
+                {limit: 1, results: 1},
+                {limit: 10, results: 2},
+        }
+
+        for name, searcher := range searchers {
+                for _, test := range tests {
+                        results, err := configman.Search(searcher, "slow", test.limit)
+
+                        if !errors.Is(err, test.err) {
+                                t.Errorf("%s: searching with limit %d returned %v, want %v", name, test.limit, err, test.err)
+                        }
+
+                        if len(results) != test.results {
+                                t.Errorf("%s: searching with limit %d found %d results, want %d", name, test.limit, len(results), test.results)
+                        }
+                }
+        }
+
+        if _, err := store.Search("slow", 0); !errors.Is(err, configman.ErrInvalidLimit) {
+                t.Errorf("SqlStore.Search with limit 0 returned %v, want %v", err, configman.ErrInvalidLimit)
+        }
+}
@@ -1,6 +1,13 @@
 package sqlstore
 
-import "github.com/vlence/configman"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
 
 type SqlSetting struct {
         typ configman.Type
@@ -23,3 +30,134 @@ func NewSqlSetting(name string, typ configman.Type, value any) *SqlSetting {
 
         return setting
 }
+
+// settingColumns are the columns selected by every query that reads
+// settings. Use scanSetting to scan rows selected with these columns.
+const settingColumns = `
+        name,
+        desc,` + valueColumns + `,
+        deprecated,
+        deprecation_reason,
+        deprecated_at,
+        created_at,
+        updated_at,
+        revision
+`
+
+// GetSetting returns the setting with the given name in the given config.
+// If the setting does not exist then nil is returned.
+func (store *SqlStore) GetSetting(config, name string) (_ *configman.Setting, err error) {
+        defer store.observe("get setting", "config", config, "setting", name)(&err)
+
+        setting, err := store.scanSetting(store.getSettingStmt.QueryRow(config, name))
+
+        if err != nil {
+                return nil, errors.Join(errGetSetting, err)
+        }
+
+        return setting, nil
+}
+
+// GetSettings returns all the settings of the given config.
+func (store *SqlStore) GetSettings(config string) (_ []*configman.Setting, err error) {
+        var rows *sql.Rows
+        var setting *configman.Setting
+
+        defer store.observe("get settings", "config", config)(&err)
+
+        settings := make([]*configman.Setting, 0)
+
+        if rows, err = store.getSettingsStmt.Query(config); err != nil {
+                return settings, errors.Join(errGetSettings, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if setting, err = store.scanSetting(rows); err != nil {
+                        return settings, errors.Join(errGetSettings, err)
+                }
+
+                if setting == nil {
+                        continue
+                }
+
+                settings = append(settings, setting)
+        }
+
+        if err = rows.Err(); err != nil {
+                return settings, errors.Join(errGetSettings, err)
+        }
+
+        return settings, nil
+}
+
+// scanSetting scans the given row and returns a *configman.Setting. The
+// row must have been selected using settingColumns. If no rows were
+// returned then nil is returned.
+func (store *SqlStore) scanSetting(row RowScanner) (*configman.Setting, error) {
+        var v sqlValue
+        var name, desc, deprecationReason string
+        var deprecated bool
+        var deprecatedAt, createdAt, updatedAt, revision int64
+        var value any
+
+        dest := []any{&name, &desc}
+        dest = append(dest, v.dest()...)
+        dest = append(dest, &deprecated, &deprecationReason, &deprecatedAt, &createdAt, &updatedAt, &revision)
+
+        err := row.Scan(dest...)
+
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+
+        if err != nil {
+                return nil, errors.Join(errScanSetting, err)
+        }
+
+        if value, err = v.value(); err != nil {
+                return nil, errors.Join(errScanSetting, err)
+        }
+
+        setting, err := configman.NewSetting(configman.SettingFields{
+                Name:              name,
+                Description:       desc,
+                Value:             value,
+                Revision:          revision,
+                Deprecated:        deprecated,
+                DeprecatedAt:      time.Unix(deprecatedAt, 0),
+                DeprecationReason: deprecationReason,
+                CreatedAt:         time.Unix(createdAt, 0),
+                UpdatedAt:         time.Unix(updatedAt, 0),
+        })
+
+        if err != nil {
+                return nil, errors.Join(errScanSetting, err)
+        }
+
+        return setting, nil
+}
+
+// setSettingValue sets the value of the given setting within tx and
+// returns the number of settings updated.
+func (store *SqlStore) setSettingValue(tx *sql.Tx, config, setting string, value any, now time.Time) (int64, error) {
+        var err error
+        var result sql.Result
+
+        v := newSqlValue(value)
+        args := v.args()
+        args = append(args, now.Unix(), config, setting)
+
+        if result, err = store.setSettingValueStmt.in(tx).Exec(args...); err != nil {
+                return 0, err
+        }
+
+        return result.RowsAffected()
+}
+
+// errSettingNotFound returns an error that wraps configman.ErrNotFound
+// for the given setting.
+func errSettingNotFound(config, setting string) error {
+        return fmt.Errorf("sqlstore: setting %s of config %s: %w", setting, config, configman.ErrNotFound)
+}
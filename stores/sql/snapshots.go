@@ -0,0 +1,313 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errSnapshotsTable = fmt.Errorf("sqlstore: failed to create snapshots table")
+var errCreateSnapshot = fmt.Errorf("sqlstore: failed to create snapshot")
+var errGetSnapshots = fmt.Errorf("sqlstore: failed to get snapshots")
+var errGetSettingsAt = fmt.Errorf("sqlstore: failed to get settings at revision")
+
+// initSnapshotsTable creates the snapshots table. A snapshot only holds
+// the revision of history it was taken at.
+func (store *SqlStore) initSnapshotsTable() error {
+        _, err := store.db.Exec(`
+                CREATE TABLE IF NOT EXISTS snapshots (
+                        name TEXT PRIMARY KEY,
+                        desc TEXT NOT NULL,
+                        config_name TEXT NOT NULL,
+                        revision INTEGER NOT NULL,
+                        created_at INTEGER NOT NULL,
+                        created_by TEXT NOT NULL
+                )
+        `)
+
+        if err != nil {
+                return errors.Join(errSnapshotsTable, err)
+        }
+
+        return nil
+}
+
+// prepSnapshotStmts prepares the SQL statements used for snapshots and
+// to read settings as they were at a revision.
+func (store *SqlStore) prepSnapshotStmts() error {
+        var err error
+
+        store.createSnapshotStmt, err = store.prepare("createSnapshot", 2, `
+                INSERT INTO snapshots (name, desc, config_name, revision, created_at, created_by)
+                VALUES (?, ?, ?, ?, ?, ?)
+                ON CONFLICT (name) DO NOTHING
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getSnapshotStmt, err = store.prepare("getSnapshot", noConfig, "SELECT name, desc, config_name, revision, created_at, created_by FROM snapshots WHERE name = ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.getSnapshotsStmt, err = store.prepare("getSnapshots", noConfig, "SELECT name, desc, config_name, revision, created_at, created_by FROM snapshots ORDER BY revision DESC, created_at DESC, name")
+
+        if err != nil {
+                return err
+        }
+
+        store.latestRevisionStmt, err = store.prepare("latestRevision", noConfig, "SELECT COALESCE(MAX(revision), 0) FROM history")
+
+        if err != nil {
+                return err
+        }
+
+        store.revisionAtStmt, err = store.prepare("revisionAt", noConfig, "SELECT COALESCE(MAX(revision), 0) FROM history WHERE created_at <= ?")
+
+        if err != nil {
+                return err
+        }
+
+        store.getOpsUntilStmt, err = store.prepare("getOpsUntil", 0, `
+                SELECT
+                        history.revision,
+                        history.created_at,
+                        history.created_by,
+                        kind,
+                        setting_name,` + valueColumns + `,
+                        desc
+                FROM history_ops
+                JOIN history ON history.revision = history_ops.revision
+                WHERE config_name = ? AND history_ops.revision <= ?
+                ORDER BY history_ops.revision, position
+        `)
+
+        return err
+}
+
+// CreateSnapshot implements configman.SnapshotStore. The snapshot is
+// taken at the latest revision of history when it is created.
+func (store *SqlStore) CreateSnapshot(name, desc, config, by string) (_ *configman.Snapshot, err error) {
+        var tx *sql.Tx
+        var configId, affected int64
+
+        defer store.observe("create snapshot", "snapshot", name, "config", config, "by", by)(&err)
+
+        if err = configman.ValidSnapshotName(name); err != nil {
+                return nil, errors.Join(errCreateSnapshot, err)
+        }
+
+        snapshot := &configman.Snapshot{
+                Name:        name,
+                Description: desc,
+                Config:      config,
+                CreatedAt:   time.Unix(time.Now().Unix(), 0),
+                CreatedBy:   by,
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errCreateSnapshot, err)
+        }
+
+        if config != "" {
+                if err = store.getConfigIdStmt.in(tx).QueryRow(config).Scan(&configId); err == sql.ErrNoRows {
+                        return nil, rollback(tx, fmt.Errorf("sqlstore: config %s: %w", config, configman.ErrNotFound))
+                }
+
+                if err != nil {
+                        return nil, rollback(tx, errCreateSnapshot, err)
+                }
+        }
+
+        if err = store.latestRevisionStmt.in(tx).QueryRow().Scan(&snapshot.Revision); err != nil {
+                return nil, rollback(tx, errCreateSnapshot, err)
+        }
+
+        args := []any{name, desc, config, snapshot.Revision, snapshot.CreatedAt.Unix(), by}
+
+        if affected, err = execAffected(store.createSnapshotStmt.in(tx), args...); err != nil {
+                return nil, rollback(tx, errCreateSnapshot, err)
+        }
+
+        if affected == 0 {
+                return nil, rollback(tx, fmt.Errorf("sqlstore: snapshot %s: %w", name, configman.ErrExists))
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errCreateSnapshot, err)
+        }
+
+        return snapshot, nil
+}
+
+// GetSnapshot implements configman.SnapshotStore.
+func (store *SqlStore) GetSnapshot(name string) (_ *configman.Snapshot, err error) {
+        var snapshot *configman.Snapshot
+
+        defer store.observe("get snapshot", "snapshot", name)(&err)
+
+        snapshot, err = scanSnapshot(store.getSnapshotStmt.QueryRow(name))
+
+        if err == sql.ErrNoRows {
+                return nil, nil
+        }
+
+        if err != nil {
+                return nil, errors.Join(errGetSnapshots, err)
+        }
+
+        return snapshot, nil
+}
+
+// GetSnapshots implements configman.SnapshotStore.
+func (store *SqlStore) GetSnapshots() (_ []configman.Snapshot, err error) {
+        var rows *sql.Rows
+        var snapshot *configman.Snapshot
+
+        defer store.observe("get snapshots")(&err)
+
+        snapshots := make([]configman.Snapshot, 0)
+
+        if rows, err = store.getSnapshotsStmt.Query(); err != nil {
+                return snapshots, errors.Join(errGetSnapshots, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                if snapshot, err = scanSnapshot(rows); err != nil {
+                        return snapshots, errors.Join(errGetSnapshots, err)
+                }
+
+                snapshots = append(snapshots, *snapshot)
+        }
+
+        if err = rows.Err(); err != nil {
+                return snapshots, errors.Join(errGetSnapshots, err)
+        }
+
+        return snapshots, nil
+}
+
+// RevisionAt implements configman.SnapshotStore.
+func (store *SqlStore) RevisionAt(t time.Time) (_ int64, err error) {
+        var revision int64
+
+        defer store.observe("revision at")(&err)
+
+        if err = store.revisionAtStmt.QueryRow(t.Unix()).Scan(&revision); err != nil {
+                return 0, errors.Join(errGetSettingsAt, err)
+        }
+
+        return revision, nil
+}
+
+// GetSettingsAt implements configman.SnapshotStore. The settings are
+// rebuilt by replaying the operations recorded in history on config up
+// to revision. Settings that existed before history was kept are created
+// by its first revision, see seedHistory, so every other operation
+// follows the creation of its setting.
+func (store *SqlStore) GetSettingsAt(config string, revision int64) (_ []*configman.Setting, err error) {
+        var rows *sql.Rows
+        var setting *configman.Setting
+
+        defer store.observe("get settings at", "config", config, "revision", revision)(&err)
+
+        fields := make(map[string]*configman.SettingFields)
+        settings := make([]*configman.Setting, 0)
+
+        if rows, err = store.getOpsUntilStmt.Query(config, revision); err != nil {
+                return settings, errors.Join(errGetSettingsAt, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var v sqlValue
+                var op configman.BatchOp
+                var opRevision, createdAt int64
+                var createdBy string
+
+                dest := []any{&opRevision, &createdAt, &createdBy, &op.Kind, &op.Setting}
+                dest = append(dest, v.dest()...)
+                dest = append(dest, &op.Description)
+
+                if err = rows.Scan(dest...); err != nil {
+                        return settings, errors.Join(errGetSettingsAt, err)
+                }
+
+                if v.typ != configman.Unsupported {
+                        if op.Value, err = v.value(); err != nil {
+                                return settings, errors.Join(errGetSettingsAt, err)
+                        }
+                }
+
+                at := time.Unix(createdAt, 0)
+                f := fields[op.Setting]
+
+                switch {
+                case op.Kind == configman.OpCreate:
+                        fields[op.Setting] = &configman.SettingFields{
+                                Name:        op.Setting,
+                                Description: op.Description,
+                                Value:       op.Value,
+                                Revision:    1,
+                                CreatedAt:   at,
+                                CreatedBy:   createdBy,
+                                UpdatedAt:   at,
+                                UpdatedBy:   createdBy,
+                        }
+                case op.Kind == configman.OpRename:
+                        // renaming the config changes none of its settings
+                case f == nil:
+                        return settings, fmt.Errorf("%w: setting %s of config %s was changed at revision %d but never created", errGetSettingsAt, op.Setting, config, opRevision)
+                case op.Kind == configman.OpUpdate:
+                        f.Value, f.Revision, f.UpdatedAt, f.UpdatedBy = op.Value, f.Revision+1, at, createdBy
+                case op.Kind == configman.OpDeprecate:
+                        if !f.Deprecated {
+                                f.Deprecated, f.DeprecatedAt = true, at
+                        }
+
+                        f.DeprecationReason, f.Revision, f.UpdatedAt, f.UpdatedBy = op.Description, f.Revision+1, at, createdBy
+                case op.Kind == configman.OpDelete:
+                        delete(fields, op.Setting)
+                }
+        }
+
+        if err = rows.Err(); err != nil {
+                return settings, errors.Join(errGetSettingsAt, err)
+        }
+
+        for _, name := range slices.Sorted(maps.Keys(fields)) {
+                if setting, err = configman.NewSetting(*fields[name]); err != nil {
+                        return settings, errors.Join(errGetSettingsAt, err)
+                }
+
+                settings = append(settings, setting)
+        }
+
+        return settings, nil
+}
+
+// scanSnapshot scans a row of the snapshots table.
+func scanSnapshot(row RowScanner) (*configman.Snapshot, error) {
+        var createdAt int64
+
+        snapshot := new(configman.Snapshot)
+
+        if err := row.Scan(&snapshot.Name, &snapshot.Description, &snapshot.Config, &snapshot.Revision, &createdAt, &snapshot.CreatedBy); err != nil {
+                return nil, err
+        }
+
+        snapshot.CreatedAt = time.Unix(createdAt, 0)
+
+        return snapshot, nil
+}
@@ -0,0 +1,109 @@
+package sqlstore
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+// describeSettings returns name=value for each of settings, marked with
+// a ! if the setting is deprecated.
+func describeSettings(settings []*configman.Setting) []string {
+        described := make([]string, 0, len(settings))
+
+        for _, setting := range settings {
+                description := fmt.Sprintf("%s=%v", setting.Name(), setting.Value())
+
+                if setting.Deprecated() {
+                        description += "!"
+                }
+
+                described = append(described, description)
+        }
+
+        return described
+}
+
+func TestGetSettingsAtReplaysHistory(t *testing.T) {
+        file := filepath.Join(t.TempDir(), "configman.db")
+        store := openTestStore(t, file)
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Create("app", "retries", "", int64(3)))
+        mustApply(t, store, new(configman.Batch).Deprecate("app", "retries", "use backoff"))
+
+        // forget history, as if the settings were made before it was kept
+        if _, err := store.db.Exec("DROP TABLE history_ops"); err != nil {
+                t.Fatalf("failed to drop history_ops: %v", err)
+        }
+
+        if _, err := store.db.Exec("DROP TABLE history"); err != nil {
+                t.Fatalf("failed to drop history: %v", err)
+        }
+
+        store = openTestStore(t, file)
+        seeded, err := store.RevisionAt(time.Now())
+
+        if err != nil {
+                t.Fatalf("failed to get revision: %v", err)
+        }
+
+        updated := mustApply(t, store, new(configman.Batch).Update("app", "timeout", int64(60))).Revision
+
+        if _, err = store.RenameConfig("app", "api", "test"); err != nil {
+                t.Fatalf("failed to rename config: %v", err)
+        }
+
+        created := mustApply(t, store, new(configman.Batch).Create("api", "limit", "", int64(5))).Revision
+        deleted := mustApply(t, store, new(configman.Batch).Delete("api", "timeout")).Revision
+
+        snapshot, err := store.CreateSnapshot("latest", "", "api", "test")
+
+        if err != nil {
+                t.Fatalf("failed to create snapshot: %v", err)
+        }
+
+        tests := []struct {
+                name     string
+                revision int64
+                want     []string
+        }{
+                {name: "seeded", revision: seeded, want: []string{"retries=3!", "timeout=30"}},
+                {name: "updated", revision: updated, want: []string{"retries=3!", "timeout=60"}},
+                {name: "renamed", revision: updated + 1, want: []string{"retries=3!", "timeout=60"}},
+                {name: "created", revision: created, want: []string{"limit=5", "retries=3!", "timeout=60"}},
+                {name: "deleted", revision: deleted, want: []string{"limit=5", "retries=3!"}},
+                {name: "snapshot", revision: snapshot.Revision, want: []string{"limit=5", "retries=3!"}},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        settings, err := store.GetSettingsAt("api", test.revision)
+
+                        if err != nil {
+                                t.Fatalf("GetSettingsAt returned %v", err)
+                        }
+
+                        if got := describeSettings(settings); !slices.Equal(got, test.want) {
+                                t.Errorf("got settings %v at revision %d, want %v", got, test.revision, test.want)
+                        }
+                })
+        }
+}
+
+func TestGetSettingsAtRejectsChangesBeforeCreation(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app")
+        event := mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Update("app", "timeout", int64(60)))
+
+        if _, err := store.db.Exec("DELETE FROM history_ops WHERE revision = ? AND kind = ?", event.Revision, configman.OpCreate); err != nil {
+                t.Fatalf("failed to delete create op: %v", err)
+        }
+
+        if _, err := store.GetSettingsAt("app", event.Revision); err == nil {
+                t.Errorf("GetSettingsAt returned no error for a setting updated but never created")
+        }
+}
@@ -1,13 +1,16 @@
 package sqlstore
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/vlence/configman"
+	"github.com/vlence/configman/tracing"
 	"github.com/vlence/gossert"
 )
 
@@ -17,7 +20,25 @@ var errGetConfigs = fmt.Errorf("sqlstore: failed to get configs")
 var errScanConfig = fmt.Errorf("sqlstore: failed to scan config")
 var errConfigsTable = fmt.Errorf("sqlstore: failed to create configs table")
 var errCreateConfig = fmt.Errorf("sqlstore: failed to create config")
+var errDeleteConfig = fmt.Errorf("sqlstore: failed to delete config")
+var errDeprecateConfig = fmt.Errorf("sqlstore: failed to deprecate config")
 var errSettingsTable = fmt.Errorf("sqlstore: failed to create settings table")
+var errGetSetting = fmt.Errorf("sqlstore: failed to get setting")
+var errGetSettings = fmt.Errorf("sqlstore: failed to get settings")
+var errScanSetting = fmt.Errorf("sqlstore: failed to scan setting")
+
+// configColumns are the columns selected by every query that reads
+// configs. Use scanConfig to scan rows selected with these columns.
+const configColumns = `
+        id,
+        name,
+        desc,
+        created_at,
+        updated_at,
+        revision,
+        deprecated,
+        deprecation_reason
+`
 
 type RowScanner interface {
         Scan(dest ...any) error
@@ -30,20 +51,157 @@ type SqlStore struct {
         db *sql.DB
 
         // Prepared statement. Execute it to get a config by name.
-        getConfigStmt    *sql.Stmt
-        getConfigsStmt   *sql.Stmt
-        setDescStmt      *sql.Stmt
-        createConfigStmt *sql.Stmt
+        getConfigStmt       *stmt
+        getConfigsStmt      *stmt
+        setDescStmt         *stmt
+        createConfigStmt    *stmt
+        deleteConfigStmt    *stmt
+        deprecateConfigStmt *stmt
+        getSettingStmt      *stmt
+        getSettingsStmt     *stmt
+
+        setSettingValueStmt *stmt
+
+        getFlagRulesStmt    *stmt
+        deleteFlagRulesStmt *stmt
+        insertFlagRuleStmt  *stmt
+
+        scheduleChangeStmt        *stmt
+        cancelScheduledChangeStmt *stmt
+        getScheduledChangesStmt   *stmt
+        getDueChangesStmt         *stmt
+        claimScheduledChangeStmt  *stmt
+        failScheduledChangeStmt   *stmt
+
+        getProtectedStmt        *stmt
+        setProtectedStmt        *stmt
+        proposeChangeStmt       *stmt
+        getChangeRequestStmt    *stmt
+        getChangeRequestsStmt   *stmt
+        reviewChangeRequestStmt *stmt
+
+        getConfigIdStmt      *stmt
+        getSettingTypeStmt   *stmt
+        createSettingStmt    *stmt
+        deleteSettingStmt    *stmt
+        deprecateSettingStmt *stmt
+        insertRevisionStmt   *stmt
+        insertRevisionOpStmt *stmt
+        getHistoryStmt       *stmt
+
+        grantRoleStmt    *stmt
+        revokeRoleStmt   *stmt
+        getGrantsStmt    *stmt
+        recordDenialStmt *stmt
+        getDenialsStmt   *stmt
+
+        getLastAuditStmt *stmt
+        insertAuditStmt  *stmt
+        queryAuditStmt   *stmt
+        getAuditStmt     *stmt
+
+        createNamespaceStmt       *stmt
+        getNamespaceStmt          *stmt
+        getNamespacesStmt         *stmt
+        countNamespaceConfigsStmt *stmt
+        deleteNamespaceStmt       *stmt
+
+        getConfigLabelsStmt     *stmt
+        insertConfigLabelStmt   *stmt
+        getSettingLabelsStmt    *stmt
+        insertSettingLabelStmt  *stmt
+        deleteSettingLabelsStmt *stmt
+
+        searchStmt *stmt
+
+        createSnapshotStmt *stmt
+        getSnapshotStmt    *stmt
+        getSnapshotsStmt   *stmt
+        latestRevisionStmt *stmt
+        revisionAtStmt     *stmt
+        getOpsUntilStmt    *stmt
+
+        cloneConfigStmt       *stmt
+        resetConfigStmt       *stmt
+        copySettingStatesStmt *stmt
+        renameConfigStmt      *stmt
+
+        getTrashStmt          *stmt
+        getDeletedConfigStmt  *stmt
+        getDeletedSettingStmt *stmt
+        restoreConfigStmt     *stmt
+        restoreSettingsStmt   *stmt
+        restoreSettingStmt    *stmt
+
+        // Serializes appending to the audit log within this process.
+        auditMu *sync.Mutex
+
+        // Publishes a change event whenever a batch is applied.
+        events *configman.Broadcaster
+
+        // Receives a record of every operation, see logOp.
+        logger *slog.Logger
+
+        // Starts a span for every operation if not nil, see observe.
+        tracer tracing.Tracer
+
+        // How long deleted configs and settings can be restored.
+        retention time.Duration
+
+        // Spans are started as children of the span in ctx, see Bind.
+        ctx context.Context
+}
+
+// An Option configures a SqlStore made by NewSqlStore.
+type Option func(store *SqlStore)
+
+// WithLogger makes the store log to logger instead of slog.Default().
+// Operations are logged at debug level with how long they took and
+// failures at error level.
+func WithLogger(logger *slog.Logger) Option {
+        return func(store *SqlStore) {
+                store.logger = logger
+        }
+}
+
+// WithTracer makes the store start a span with tracer for every
+// operation and for every statement it runs, named after the statement
+// and about the config it names. Since configman.Store has no context,
+// the spans start new traces.
+func WithTracer(tracer tracing.Tracer) Option {
+        return func(store *SqlStore) {
+                store.tracer = tracer
+        }
+}
+
+// WithRetention makes the store keep deleted configs and settings in
+// the trash for retention instead of configman.DefaultRetention.
+func WithRetention(retention time.Duration) Option {
+        return func(store *SqlStore) {
+                store.retention = retention
+        }
 }
 
 // NewSqlStore creates a new SqlStore using the given *sql.DB.
-func NewSqlStore(db *sql.DB) (*SqlStore, error) {
+func NewSqlStore(db *sql.DB, opts ...Option) (*SqlStore, error) {
         var err error
 
         gossert.Ok(db != nil, "sqlstore: received nil instead of *sql.DB")
 
         store := new(SqlStore)
         store.db = db
+        store.auditMu = new(sync.Mutex)
+        store.events = new(configman.Broadcaster)
+        store.ctx = context.Background()
+        store.logger = slog.Default()
+        store.retention = configman.DefaultRetention
+
+        for _, opt := range opts {
+                opt(store)
+        }
+
+        gossert.Ok(store.logger != nil, "sqlstore: received nil instead of logger")
+        gossert.Ok(store.retention > 0, "sqlstore: retention must be positive")
 
         if err = store.init(); err != nil {
                 return nil, err
@@ -56,6 +214,103 @@ func NewSqlStore(db *sql.DB) (*SqlStore, error) {
         return store, nil
 }
 
+// Bind implements configman.Binder. The spans of the operations of the
+// returned store, and of the statements they run, are children of the
+// span in ctx, e.g. the span of the request being served. Stores without
+// a tracer are returned as they are.
+func (store *SqlStore) Bind(ctx context.Context) configman.Store {
+        gossert.Ok(ctx != nil, "sqlstore: received nil instead of context")
+
+        // nothing is traced
+        if store.tracer == nil {
+                return store
+        }
+
+        bound := *store
+        bound.ctx = ctx
+
+        for _, s := range bound.stmts() {
+                *s = (*s).of(&bound)
+        }
+
+        return &bound
+}
+
+// stmts returns pointers to every prepared statement of the store, so
+// that Bind can bind them to the bound store.
+func (store *SqlStore) stmts() []**stmt {
+        return []**stmt{
+                &store.getConfigStmt,
+                &store.getConfigsStmt,
+                &store.setDescStmt,
+                &store.createConfigStmt,
+                &store.deleteConfigStmt,
+                &store.deprecateConfigStmt,
+                &store.getSettingStmt,
+                &store.getSettingsStmt,
+                &store.setSettingValueStmt,
+                &store.getFlagRulesStmt,
+                &store.deleteFlagRulesStmt,
+                &store.insertFlagRuleStmt,
+                &store.scheduleChangeStmt,
+                &store.cancelScheduledChangeStmt,
+                &store.getScheduledChangesStmt,
+                &store.getDueChangesStmt,
+                &store.claimScheduledChangeStmt,
+                &store.failScheduledChangeStmt,
+                &store.getProtectedStmt,
+                &store.setProtectedStmt,
+                &store.proposeChangeStmt,
+                &store.getChangeRequestStmt,
+                &store.getChangeRequestsStmt,
+                &store.reviewChangeRequestStmt,
+                &store.getConfigIdStmt,
+                &store.getSettingTypeStmt,
+                &store.createSettingStmt,
+                &store.deleteSettingStmt,
+                &store.deprecateSettingStmt,
+                &store.insertRevisionStmt,
+                &store.insertRevisionOpStmt,
+                &store.getHistoryStmt,
+                &store.grantRoleStmt,
+                &store.revokeRoleStmt,
+                &store.getGrantsStmt,
+                &store.recordDenialStmt,
+                &store.getDenialsStmt,
+                &store.getLastAuditStmt,
+                &store.insertAuditStmt,
+                &store.queryAuditStmt,
+                &store.getAuditStmt,
+                &store.createNamespaceStmt,
+                &store.getNamespaceStmt,
+                &store.getNamespacesStmt,
+                &store.countNamespaceConfigsStmt,
+                &store.deleteNamespaceStmt,
+                &store.getConfigLabelsStmt,
+                &store.insertConfigLabelStmt,
+                &store.getSettingLabelsStmt,
+                &store.insertSettingLabelStmt,
+                &store.deleteSettingLabelsStmt,
+                &store.searchStmt,
+                &store.createSnapshotStmt,
+                &store.getSnapshotStmt,
+                &store.getSnapshotsStmt,
+                &store.latestRevisionStmt,
+                &store.revisionAtStmt,
+                &store.getOpsUntilStmt,
+                &store.cloneConfigStmt,
+                &store.resetConfigStmt,
+                &store.copySettingStatesStmt,
+                &store.renameConfigStmt,
+                &store.getTrashStmt,
+                &store.getDeletedConfigStmt,
+                &store.getDeletedSettingStmt,
+                &store.restoreConfigStmt,
+                &store.restoreSettingsStmt,
+                &store.restoreSettingStmt,
+        }
+}
+
 // init creates all the tables and indices required.
 func (store *SqlStore) init() error {
         var err error
@@ -68,6 +323,50 @@ func (store *SqlStore) init() error {
                 return err
         }
 
+        if err = store.initFlagRulesTable(); err != nil {
+                return err
+        }
+
+        if err = store.initScheduledChangesTable(); err != nil {
+                return err
+        }
+
+        if err = store.initChangeRequestsTable(); err != nil {
+                return err
+        }
+
+        if err = store.initHistoryTables(); err != nil {
+                return err
+        }
+
+        if err = store.initAccessTables(); err != nil {
+                return err
+        }
+
+        if err = store.initAuditTable(); err != nil {
+                return err
+        }
+
+        if err = store.initNamespacesTable(); err != nil {
+                return err
+        }
+
+        if err = store.initLabelsTables(); err != nil {
+                return err
+        }
+
+        if err = store.initPageIndexes(); err != nil {
+                return err
+        }
+
+        if err = store.initSearchTables(); err != nil {
+                return err
+        }
+
+        if err = store.initSnapshotsTable(); err != nil {
+                return err
+        }
+
         return nil
 }
 
@@ -112,6 +411,31 @@ func (store *SqlStore) initConfigsTable() error {
                 return errors.Join(errConfigsTable, execErr)
         }
 
+        if execErr = addColumn(tx, "configs", "protected", "BOOLEAN NOT NULL DEFAULT FALSE"); execErr != nil {
+                return rollback(tx, errConfigsTable, execErr)
+        }
+
+        if execErr = addColumn(tx, "configs", "revision", "INTEGER NOT NULL DEFAULT 1"); execErr != nil {
+                return rollback(tx, errConfigsTable, execErr)
+        }
+
+        if execErr = addColumn(tx, "configs", "deprecated", "BOOLEAN NOT NULL DEFAULT FALSE"); execErr != nil {
+                return rollback(tx, errConfigsTable, execErr)
+        }
+
+        if execErr = addColumn(tx, "configs", "deprecation_reason", "TEXT NOT NULL DEFAULT ''"); execErr != nil {
+                return rollback(tx, errConfigsTable, execErr)
+        }
+
+        if execErr = addColumn(tx, "configs", "deprecated_at", "INTEGER NOT NULL DEFAULT 0"); execErr != nil {
+                return rollback(tx, errConfigsTable, execErr)
+        }
+
+        // Deleted configs stay in the trash until purged, see trash.go.
+        if execErr = addColumn(tx, "configs", "deleted_at", "INTEGER NOT NULL DEFAULT 0"); execErr != nil {
+                return rollback(tx, errConfigsTable, execErr)
+        }
+
         commitErr = tx.Commit()
 
         if commitErr != nil {
@@ -176,6 +500,14 @@ func (store *SqlStore) initSettingsTable() error {
                 return errors.Join(errSettingsTable, execErr)
         }
 
+        if execErr = addColumn(tx, "settings", "revision", "INTEGER NOT NULL DEFAULT 1"); execErr != nil {
+                return rollback(tx, errSettingsTable, execErr)
+        }
+
+        if execErr = addColumn(tx, "settings", "deleted_at", "INTEGER NOT NULL DEFAULT 0"); execErr != nil {
+                return rollback(tx, errSettingsTable, execErr)
+        }
+
         if commitErr = tx.Commit(); commitErr != nil {
                 return errors.Join(errSettingsTable, commitErr)
         }
@@ -188,30 +520,32 @@ func (store *SqlStore) initSettingsTable() error {
 func (store *SqlStore) prepStmts() error {
         var err error
 
-        store.getConfigStmt, err = store.db.Prepare("SELECT * FROM configs WHERE name = ?")
+        store.getConfigStmt, err = store.prepare("getConfig", 0, "SELECT" + configColumns + "FROM configs WHERE name = ? AND deleted_at = 0")
 
         if err != nil {
                 return errors.Join(errPrepStmts, err)
         }
 
-        store.getConfigsStmt, err = store.db.Prepare("SELECT * FROM configs")
+        store.getConfigsStmt, err = store.prepare("getConfigs", noConfig, "SELECT" + configColumns + "FROM configs WHERE deleted_at = 0")
 
         if err != nil {
                 return errors.Join(errPrepStmts, err)
         }
 
-        store.setDescStmt, err = store.db.Prepare(`
+        store.setDescStmt, err = store.prepare("setDesc", noConfig, `
                 UPDATE configs
                 SET desc = ?,
-                    updated_at = ?
-                WHERE id = ?
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE id = ? AND (? = 0 OR revision = ?)
+                RETURNING revision
         `)
 
         if err != nil {
                 return errors.Join(errPrepStmts, err)
         }
 
-        store.createConfigStmt, err = store.db.Prepare(`
+        store.createConfigStmt, err = store.prepare("createConfig", 0, `
                 INSERT INTO configs (
                         name,
                         desc,
@@ -224,12 +558,114 @@ func (store *SqlStore) prepStmts() error {
                 return errors.Join(errPrepStmts, err)
         }
 
+        store.deleteConfigStmt, err = store.prepare("deleteConfig", 1, "UPDATE configs SET deleted_at = ? WHERE name = ? AND deleted_at = 0")
+
+        if err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        // Like settings, a config deprecated again keeps the time it was
+        // first deprecated.
+        store.deprecateConfigStmt, err = store.prepare("deprecateConfig", 3, `
+                UPDATE configs
+                SET deprecated = TRUE,
+                    deprecation_reason = ?,
+                    deprecated_at = CASE WHEN deprecated THEN deprecated_at ELSE ? END,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE name = ? AND deleted_at = 0 AND (? = 0 OR revision = ?)
+        `)
+
+        if err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        store.getSettingStmt, err = store.prepare("getSetting", 0, "SELECT" + settingColumns + "FROM settings WHERE config_name = ? AND name = ? AND deleted_at = 0")
+
+        if err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        store.getSettingsStmt, err = store.prepare("getSettings", 0, "SELECT" + settingColumns + "FROM settings WHERE config_name = ? AND deleted_at = 0 ORDER BY name")
+
+        if err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        store.setSettingValueStmt, err = store.prepare("setSettingValue", 8, `
+                UPDATE settings
+                SET value_type = ?,
+                    int32_value = ?,
+                    int64_value = ?,
+                    float32_value = ?,
+                    float64_value = ?,
+                    bool_value = ?,
+                    string_value = ?,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE config_name = ? AND name = ? AND deleted_at = 0
+        `)
+
+        if err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepFlagStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepScheduleStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepChangeRequestStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepHistoryStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepAccessStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepAuditStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepNamespaceStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepLabelStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepSearchStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepSnapshotStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepCloneStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
+        if err = store.prepTrashStmts(); err != nil {
+                return errors.Join(errPrepStmts, err)
+        }
+
         return nil
 }
 
 // GetConfig finds the config with the given name and returns it.
 // If a config with the given name does not exist then nil is returned.
-func (store *SqlStore) GetConfig(name string) (configman.Config, error) {
+func (store *SqlStore) GetConfig(name string) (_ configman.Config, err error) {
+        defer store.observe("get config", "config", name)(&err)
+
         config, err := store.scanConfig(store.getConfigStmt.QueryRow(name))
 
         if err != nil {
@@ -243,11 +679,12 @@ func (store *SqlStore) GetConfig(name string) (configman.Config, error) {
         return config, nil
 }
 
-func (store *SqlStore) GetConfigs() ([]configman.Config, error) {
+func (store *SqlStore) GetConfigs() (_ []configman.Config, err error) {
         var rows *sql.Rows
-        var err error
         var config configman.Config
 
+        defer store.observe("get configs")(&err)
+
         configs := make([]configman.Config, 0)
 
         if rows, err = store.getConfigsStmt.Query(); err != nil {
@@ -276,25 +713,44 @@ func (store *SqlStore) GetConfigs() ([]configman.Config, error) {
 }
 
 // CreateConfig creates a new config using the given name and description
-// and returns it.
-func (store *SqlStore) CreateConfig(name, desc string) (configman.Config, error) {
-        var err error
+// and returns it. The namespace of the name must exist. A deleted config
+// with the same name is purged from the trash.
+func (store *SqlStore) CreateConfig(name, desc string) (_ configman.Config, err error) {
+        var tx *sql.Tx
         var rows int64
         var result sql.Result
 
+        defer store.observe("create config", "config", name)(&err)
+
+        if err = store.checkNamespace(name); err != nil {
+                return nil, errors.Join(errCreateConfig, err)
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errCreateConfig, err)
+        }
+
+        if _, err = store.purgeConfigs(tx, "name = ? AND deleted_at != 0", name); err != nil {
+                return nil, rollback(tx, errCreateConfig, err)
+        }
+
+        if err = store.checkFreeName(tx, name); err != nil {
+                return nil, rollback(tx, errCreateConfig, err)
+        }
+
         now := time.Now()
-        result, err = store.createConfigStmt.Exec(name, desc, now.Unix(), now.Unix())
+        result, err = store.createConfigStmt.in(tx).Exec(name, desc, now.Unix(), now.Unix())
 
         if err != nil {
-                return nil, errors.Join(errCreateConfig, err)
+                return nil, rollback(tx, errCreateConfig, err)
         }
 
         if rows, err = result.RowsAffected(); err != nil {
-                return nil, errors.Join(errCreateConfig, err)
+                return nil, rollback(tx, errCreateConfig, err)
         }
 
         if rows == 0 {
-                log.Println("warn: no rows affected when creating config")
+                store.logger.Warn("sqlstore: no rows affected when creating config", "config", name)
         }
 
         config := newSqlConfig(store)
@@ -302,13 +758,18 @@ func (store *SqlStore) CreateConfig(name, desc string) (configman.Config, error)
         config.desc = desc
         config.createdAt = now
         config.updatedAt = now
+        config.revision = 1
 
         if config.id, err = result.LastInsertId(); err != nil {
-                return config, errors.Join(errCreateConfig, err)
+                return nil, rollback(tx, errCreateConfig, err)
         }
 
         gossert.Ok(config.id != configIdUnknown, "sqlstore: created config with unknown id")
 
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errCreateConfig, err)
+        }
+
         return config, nil
 }
 
@@ -325,12 +786,134 @@ func (store *SqlStore) CreateSetting(name string, typ configman.Type, value any)
 func (store *SqlStore) createInt32Setting(name string, value int32) (configman.Setting, error) {
 }
 
+// DeleteConfig moves the config with the given name and all of its
+// settings to the trash in one transaction. The deleted settings are
+// recorded in history as one revision made by by. Pending scheduled
+// changes and change requests of the config are cancelled, and pending
+// again if it is restored; its grants and labels are kept until it is
+// purged, see PurgeTrash.
+func (store *SqlStore) DeleteConfig(name, by string) (err error) {
+        var tx *sql.Tx
+        var affected int64
+        var settings []*configman.Setting
+        var event *configman.ChangeEvent
+
+        defer store.observe("delete config", "config", name, "by", by)(&err)
+
+        if settings, err = store.GetSettings(name); err != nil {
+                return errors.Join(errDeleteConfig, err)
+        }
+
+        batch := new(configman.Batch)
+
+        for _, setting := range settings {
+                batch.DeleteIf(name, setting.Name(), setting.Revision())
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errDeleteConfig, err)
+        }
+
+        if err = store.checkProtected(tx, name); err != nil {
+                return rollback(tx, errDeleteConfig, err)
+        }
+
+        // The settings are deleted at the same time as the config, which
+        // is how RestoreConfig tells them from those deleted before.
+        now := time.Now()
+
+        if len(batch.Ops) > 0 {
+                if event, err = store.applyOps(tx, batch.Ops, by, now); err != nil {
+                        return rollback(tx, errDeleteConfig, err)
+                }
+        }
+
+        for _, query := range []string{
+                "UPDATE scheduled_changes SET cancelled = TRUE, deleted_at = ? WHERE config_name = ? AND applied_at IS NULL AND cancelled = FALSE",
+                "UPDATE change_requests SET status = 'cancelled', deleted_at = ? WHERE config_name = ? AND status = 'pending'",
+        } {
+                if _, err = store.exec(tx, "cancelPending", name, query, now.UnixNano(), name); err != nil {
+                        return rollback(tx, errDeleteConfig, err)
+                }
+        }
+
+        if affected, err = execAffected(store.deleteConfigStmt.in(tx), now.UnixNano(), name); err != nil {
+                return rollback(tx, errDeleteConfig, err)
+        }
+
+        if affected == 0 {
+                return rollback(tx, errDeleteConfig, fmt.Errorf("sqlstore: config %s: %w", name, configman.ErrNotFound))
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errDeleteConfig, err)
+        }
+
+        if event != nil {
+                store.events.Publish(*event)
+        }
+
+        return nil
+}
+
+// DeprecateConfig marks the config with the given name as deprecated
+// for the given reason.
+func (store *SqlStore) DeprecateConfig(name, reason string) error {
+        return store.DeprecateConfigIf(name, reason, 0)
+}
+
+// DeprecateConfigIf is like DeprecateConfig but fails with
+// configman.ErrConflict unless the config is at the given revision. A
+// revision of zero matches any revision.
+func (store *SqlStore) DeprecateConfigIf(name, reason string, revision int64) (err error) {
+        var tx *sql.Tx
+        var id int64
+        var affected int64
+
+        defer store.observe("deprecate config", "config", name)(&err)
+
+        if tx, err = store.db.Begin(); err != nil {
+                return errors.Join(errDeprecateConfig, err)
+        }
+
+        if err = store.checkProtected(tx, name); err != nil {
+                return rollback(tx, errDeprecateConfig, err)
+        }
+
+        now := time.Now().Unix()
+
+        if affected, err = execAffected(store.deprecateConfigStmt.in(tx), reason, now, now, name, revision, revision); err != nil {
+                return rollback(tx, errDeprecateConfig, err)
+        }
+
+        if affected == 0 {
+                // nothing matched, either the config or the revision
+                err = store.getConfigIdStmt.in(tx).QueryRow(name).Scan(&id)
+
+                switch {
+                case err == sql.ErrNoRows:
+                        return rollback(tx, fmt.Errorf("sqlstore: config %s: %w", name, configman.ErrNotFound))
+                case err != nil:
+                        return rollback(tx, errDeprecateConfig, err)
+                default:
+                        return rollback(tx, fmt.Errorf("sqlstore: config %s: %w", name, configman.ErrConflict))
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return errors.Join(errDeprecateConfig, err)
+        }
+
+        return nil
+}
+
 // scanConfig scans the given row and returns a *SqlConfig. If no
 // rows were returned then nil is returned.
 func (store *SqlStore) scanConfig(row RowScanner) (*SqlConfig, error) {
-        var id int64
-        var name, desc string
+        var id, revision int64
+        var name, desc, deprecationReason string
         var createdAt, updatedAt int64
+        var deprecated bool
 
         err := row.Scan(
                 &id,
@@ -338,6 +921,9 @@ func (store *SqlStore) scanConfig(row RowScanner) (*SqlConfig, error) {
                 &desc,
                 &createdAt,
                 &updatedAt,
+                &revision,
+                &deprecated,
+                &deprecationReason,
         )
 
         if err == sql.ErrNoRows {
@@ -354,6 +940,130 @@ func (store *SqlStore) scanConfig(row RowScanner) (*SqlConfig, error) {
         config.desc = desc
         config.createdAt = time.Unix(createdAt, 0)
         config.updatedAt = time.Unix(updatedAt, 0)
+        config.revision = revision
+        config.deprecated = deprecated
+        config.deprecationReason = deprecationReason
 
         return config, nil
 }
+
+// observe starts op, which is about what attrs describe, and returns
+// the function to call deferred with a pointer to its error once it is
+// done. Done operations are logged with logOp and, if the store has a
+// tracer, traced as children of the span the store is bound to.
+func (store *SqlStore) observe(op string, attrs ...any) func(err *error) {
+        var span tracing.Span
+
+        start := time.Now()
+
+        if store.tracer != nil {
+                _, span = store.tracer.Start(store.ctx, "sqlstore: "+op)
+                span.SetAttributes(append([]any{"db.system", "sqlite", "db.operation", op}, attrs...)...)
+        }
+
+        return func(err *error) {
+                if span != nil {
+                        if *err != nil {
+                                span.RecordError(*err)
+                        }
+
+                        span.End()
+                }
+
+                store.logOp(op, start, err, attrs...)
+        }
+}
+
+// logOp logs op, which started at start and failed if *err is not nil,
+// with attrs describing what it was done to. Errors callers are expected
+// to handle, like configman.ErrNotFound, are not failures of the store
+// and are only logged at debug level.
+func (store *SqlStore) logOp(op string, start time.Time, err *error, attrs ...any) {
+        attrs = append(attrs, "op", op, "duration", time.Since(start))
+
+        switch {
+        case *err == nil:
+                store.logger.Debug("sqlstore: "+op, attrs...)
+        case expectedError(*err):
+                store.logger.Debug("sqlstore: "+op, append(attrs, "err", *err)...)
+        default:
+                store.logger.Error("sqlstore: "+op+" failed", append(attrs, "err", *err)...)
+        }
+}
+
+// expectedError reports whether err is one of the errors of configman
+// that are caused by the caller rather than the store.
+func expectedError(err error) bool {
+        for _, target := range []error{
+                configman.ErrNotFound,
+                configman.ErrExists,
+                configman.ErrConflict,
+                configman.ErrProtectedConfig,
+                configman.ErrTypeMismatch,
+                configman.ErrUnsupportedType,
+                configman.ErrUnknownRole,
+                configman.ErrNotPending,
+                configman.ErrSelfReview,
+                configman.ErrInvalidRule,
+                configman.ErrInvalidNamespace,
+                configman.ErrNamespaceNotEmpty,
+                configman.ErrInvalidLabel,
+                configman.ErrInvalidSelector,
+                configman.ErrInvalidPage,
+                configman.ErrInvalidSnapshot,
+                configman.ErrNotInSnapshot,
+        } {
+                if errors.Is(err, target) {
+                        return true
+                }
+        }
+
+        return false
+}
+
+// rollback rolls back tx and returns errs joined together. If the
+// rollback itself fails we panic, there is no telling what state the
+// database has been left in.
+func rollback(tx *sql.Tx, errs ...error) error {
+        if rollbackErr := tx.Rollback(); rollbackErr != nil {
+                panic(errors.Join(append(errs, rollbackErr)...))
+        }
+
+        return errors.Join(errs...)
+}
+
+// addColumn adds column to table within tx unless the table already has
+// it. It is used to migrate tables created by earlier versions of
+// SqlStore.
+func addColumn(tx *sql.Tx, table, column, definition string) error {
+        var rows *sql.Rows
+        var err error
+        var name string
+
+        exists := false
+
+        if rows, err = tx.Query("SELECT name FROM pragma_table_info(?)", table); err != nil {
+                return err
+        }
+
+        for rows.Next() && !exists {
+                if err = rows.Scan(&name); err != nil {
+                        rows.Close()
+                        return err
+                }
+
+                exists = name == column
+        }
+
+        if err = errors.Join(rows.Err(), rows.Close()); err != nil {
+                return err
+        }
+
+        if exists {
+                return nil
+        }
+
+        _, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+
+        return err
+}
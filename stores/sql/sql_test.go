@@ -0,0 +1,85 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/tursodatabase/go-libsql"
+	"github.com/vlence/configman"
+)
+
+// newTestStore returns a store backed by a new database in a temporary
+// directory of t.
+func newTestStore(t *testing.T, opts ...Option) *SqlStore {
+        t.Helper()
+
+        return openTestStore(t, filepath.Join(t.TempDir(), "configman.db"), opts...)
+}
+
+// openTestStore returns a store backed by the database in file, like
+// another process using it would.
+func openTestStore(t *testing.T, file string, opts ...Option) *SqlStore {
+        t.Helper()
+
+        db, err := sql.Open("libsql", "file:"+file)
+
+        if err != nil {
+                t.Fatalf("failed to open database: %v", err)
+        }
+
+        t.Cleanup(func() { db.Close() })
+
+        opts = append([]Option{WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))}, opts...)
+        store, err := NewSqlStore(db, opts...)
+
+        if err != nil {
+                t.Fatalf("failed to create store: %v", err)
+        }
+
+        return store
+}
+
+// mustCreateConfigs creates the given configs in store.
+func mustCreateConfigs(t *testing.T, store *SqlStore, names ...string) {
+        t.Helper()
+
+        for _, name := range names {
+                if _, err := store.CreateConfig(name, ""); err != nil {
+                        t.Fatalf("failed to create config %s: %v", name, err)
+                }
+        }
+}
+
+// mustApply applies batch to store as the user test.
+func mustApply(t *testing.T, store *SqlStore, batch *configman.Batch) *configman.ChangeEvent {
+        t.Helper()
+
+        event, err := store.ApplyBatch(batch, "test")
+
+        if err != nil {
+                t.Fatalf("failed to apply batch: %v", err)
+        }
+
+        return event
+}
+
+// valueOf returns the value of the setting of config in store, or nil
+// if there is no such setting.
+func valueOf(t *testing.T, store *SqlStore, config, setting string) any {
+        t.Helper()
+
+        found, err := store.GetSetting(config, setting)
+
+        if err != nil {
+                t.Fatalf("failed to get setting %s of config %s: %v", setting, config, err)
+        }
+
+        if found == nil {
+                return nil
+        }
+
+        return found.Value()
+}
@@ -0,0 +1,158 @@
+package sqlstore
+
+import (
+	"database/sql"
+)
+
+// noConfig is the config argument of statements whose arguments do not
+// name a config.
+const noConfig = -1
+
+// A stmt is a prepared statement of a SqlStore. Every time it runs it
+// starts a span named after it if the store has a tracer, with the name
+// of the statement and of the config it is about as attributes.
+type stmt struct {
+        *sql.Stmt
+
+        store *SqlStore
+        name  string
+
+        // Index of the argument naming the config, or noConfig.
+        configArg int
+
+        // Config of statements whose arguments do not name it, see about.
+        config string
+}
+
+// prepare prepares query as the statement name. configArg is the index
+// of the argument naming the config the statement is about, or noConfig.
+func (store *SqlStore) prepare(name string, configArg int, query string) (*stmt, error) {
+        prepared, err := store.db.Prepare(query)
+
+        if err != nil {
+                return nil, err
+        }
+
+        return &stmt{Stmt: prepared, store: store, name: name, configArg: configArg}, nil
+}
+
+// in returns the statement bound to tx.
+func (s *stmt) in(tx *sql.Tx) *stmt {
+        bound := *s
+        bound.Stmt = tx.Stmt(s.Stmt)
+
+        return &bound
+}
+
+// of returns the statement run on behalf of store, a bound copy of the
+// store that prepared it, see SqlStore.Bind.
+func (s *stmt) of(store *SqlStore) *stmt {
+        bound := *s
+        bound.store = store
+
+        return &bound
+}
+
+// about returns the statement with config as the config it is about, for
+// statements that find rows by id instead of by config.
+func (s *stmt) about(config string) *stmt {
+        bound := *s
+        bound.config = config
+
+        return &bound
+}
+
+// Exec runs the statement like sql.Stmt.Exec within a span.
+func (s *stmt) Exec(args ...any) (sql.Result, error) {
+        end := s.start(args)
+        result, err := s.Stmt.Exec(args...)
+        end(err)
+
+        return result, err
+}
+
+// Query runs the statement like sql.Stmt.Query within a span, which ends
+// before the rows are read.
+func (s *stmt) Query(args ...any) (*sql.Rows, error) {
+        end := s.start(args)
+        rows, err := s.Stmt.Query(args...)
+        end(err)
+
+        return rows, err
+}
+
+// QueryRow runs the statement like sql.Stmt.QueryRow within a span. Its
+// errors are only known once the row is scanned and are not recorded.
+func (s *stmt) QueryRow(args ...any) *sql.Row {
+        defer s.start(args)(nil)
+        return s.Stmt.QueryRow(args...)
+}
+
+// start starts the span of running the statement with args.
+func (s *stmt) start(args []any) func(err error) {
+        config := s.config
+
+        if s.configArg != noConfig && s.configArg < len(args) {
+                config, _ = args[s.configArg].(string)
+        }
+
+        return s.store.statement(s.name, config)
+}
+
+// statement starts the span of running the statement name about config,
+// if the store has a tracer, as a child of the span the store is bound
+// to, and returns the function to call with its
+// error once it ran. Statements that are not prepared, because they are
+// built at run time, call it themselves.
+func (store *SqlStore) statement(name, config string) func(err error) {
+        if store.tracer == nil {
+                return func(error) {}
+        }
+
+        _, span := store.tracer.Start(store.ctx, "sqlstore: "+name)
+        span.SetAttributes("db.system", "sqlite", "db.statement.name", name)
+
+        if config != "" {
+                span.SetAttributes("config", config)
+        }
+
+        return func(err error) {
+                if err != nil {
+                        span.RecordError(err)
+                }
+
+                span.End()
+        }
+}
+
+// exec runs query, a statement built at run time, within tx and traces
+// it like a prepared statement named name about config.
+func (store *SqlStore) exec(tx *sql.Tx, name, config, query string, args ...any) (sql.Result, error) {
+        end := store.statement(name, config)
+        result, err := tx.Exec(query, args...)
+        end(err)
+
+        return result, err
+}
+
+// query runs query, a statement built at run time, and traces it like a
+// prepared statement named name about config.
+func (store *SqlStore) query(name, config, query string, args ...any) (*sql.Rows, error) {
+        end := store.statement(name, config)
+        rows, err := store.db.Query(query, args...)
+        end(err)
+
+        return rows, err
+}
+
+// count runs query, a statement built at run time that counts rows, and
+// traces it like a prepared statement named name about config.
+func (store *SqlStore) count(name, config, query string, args ...any) (int, error) {
+        var count int
+
+        end := store.statement(name, config)
+        err := store.db.QueryRow(query, args...).Scan(&count)
+        end(err)
+
+        return count, err
+}
@@ -0,0 +1,408 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+var errGetTrash = fmt.Errorf("sqlstore: failed to get trash")
+var errRestoreConfig = fmt.Errorf("sqlstore: failed to restore config")
+var errRestoreSetting = fmt.Errorf("sqlstore: failed to restore setting")
+var errPurgeTrash = fmt.Errorf("sqlstore: failed to purge trash")
+
+// Deleted configs and settings are kept in their tables with the time
+// they were deleted in deleted_at, which is 0 for the others, and every
+// other read leaves them out. A config and the settings deleted along
+// with it share the time, in nanoseconds so that a setting deleted just
+// before its config is not taken for one deleted with it. Their flag
+// rules, labels and grants, and the changes cancelled along with a
+// config, are kept until they are purged, which happens once they expire
+// or when their name is taken again, so that no config or setting ever
+// shares its name with a deleted one.
+
+// prepTrashStmts prepares the SQL statements used to list and restore
+// deleted configs and settings.
+func (store *SqlStore) prepTrashStmts() error {
+        var err error
+
+        // Settings deleted along with their config are counted by it
+        // rather than listed.
+        store.getTrashStmt, err = store.prepare("getTrash", noConfig, `
+                SELECT name, '', COALESCE(desc, ''), deleted_at, (
+                        SELECT COUNT(*) FROM settings
+                        WHERE settings.config_name = configs.name AND settings.deleted_at = configs.deleted_at
+                )
+                FROM configs
+                WHERE deleted_at != 0 AND deleted_at >= ?
+                UNION ALL
+                SELECT settings.config_name, settings.name, settings.desc, settings.deleted_at, 0
+                FROM settings JOIN configs ON configs.name = settings.config_name AND configs.deleted_at = 0
+                WHERE settings.deleted_at != 0 AND settings.deleted_at >= ?
+                ORDER BY 4 DESC, 1, 2
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.getDeletedConfigStmt, err = store.prepare("getDeletedConfig", 0, "SELECT id, deleted_at FROM configs WHERE name = ? AND deleted_at != 0")
+
+        if err != nil {
+                return err
+        }
+
+        store.getDeletedSettingStmt, err = store.prepare("getDeletedSetting", 0, "SELECT id, deleted_at FROM settings WHERE config_name = ? AND name = ? AND deleted_at != 0")
+
+        if err != nil {
+                return err
+        }
+
+        store.restoreConfigStmt, err = store.prepare("restoreConfig", noConfig, `
+                UPDATE configs
+                SET deleted_at = 0,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE id = ?
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.restoreSettingsStmt, err = store.prepare("restoreSettings", 1, `
+                UPDATE settings
+                SET deleted_at = 0,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE config_name = ? AND deleted_at = ?
+        `)
+
+        if err != nil {
+                return err
+        }
+
+        store.restoreSettingStmt, err = store.prepare("restoreSetting", noConfig, `
+                UPDATE settings
+                SET deleted_at = 0,
+                    updated_at = ?,
+                    revision = revision + 1
+                WHERE id = ?
+        `)
+
+        return err
+}
+
+// GetTrash implements configman.TrashStore.
+func (store *SqlStore) GetTrash() (_ []configman.TrashedItem, err error) {
+        var rows *sql.Rows
+        var deletedAt int64
+
+        defer store.observe("get trash")(&err)
+
+        items := make([]configman.TrashedItem, 0)
+        cutoff := store.cutoff()
+
+        if rows, err = store.getTrashStmt.Query(cutoff, cutoff); err != nil {
+                return items, errors.Join(errGetTrash, err)
+        }
+
+        defer rows.Close()
+
+        for rows.Next() {
+                var item configman.TrashedItem
+
+                if err = rows.Scan(&item.Config, &item.Setting, &item.Description, &deletedAt, &item.Settings); err != nil {
+                        return items, errors.Join(errGetTrash, err)
+                }
+
+                item.DeletedAt = time.Unix(0, deletedAt)
+                item.ExpiresAt = item.DeletedAt.Add(store.retention)
+                items = append(items, item)
+        }
+
+        if err = rows.Err(); err != nil {
+                return items, errors.Join(errGetTrash, err)
+        }
+
+        return items, nil
+}
+
+// RestoreConfig implements configman.TrashStore. The restored settings
+// are recorded in history as created, and deprecated if they were, and
+// the scheduled changes and change requests cancelled by DeleteConfig
+// are pending again.
+func (store *SqlStore) RestoreConfig(name, by string) (_ configman.Config, err error) {
+        var tx *sql.Tx
+        var rows *sql.Rows
+        var id, deletedAt int64
+        var setting *configman.Setting
+        var config configman.Config
+
+        event := new(configman.ChangeEvent)
+
+        defer store.observe("restore config", "config", name, "by", by)(&err)
+
+        if err = store.checkNamespace(name); err != nil {
+                return nil, errors.Join(errRestoreConfig, err)
+        }
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errRestoreConfig, err)
+        }
+
+        err = store.getDeletedConfigStmt.in(tx).QueryRow(name).Scan(&id, &deletedAt)
+
+        if err == sql.ErrNoRows || err == nil && deletedAt < store.cutoff() {
+                return nil, rollback(tx, errRestoreConfig, fmt.Errorf("sqlstore: config %s: %w", name, configman.ErrNotFound))
+        }
+
+        if err != nil {
+                return nil, rollback(tx, errRestoreConfig, err)
+        }
+
+        if err = store.checkFreeName(tx, name); err != nil {
+                return nil, rollback(tx, errRestoreConfig, err)
+        }
+
+        now := time.Now()
+
+        if _, err = store.restoreConfigStmt.in(tx).about(name).Exec(now.Unix(), id); err != nil {
+                return nil, rollback(tx, errRestoreConfig, err)
+        }
+
+        if _, err = store.restoreSettingsStmt.in(tx).Exec(now.Unix(), name, deletedAt); err != nil {
+                return nil, rollback(tx, errRestoreConfig, err)
+        }
+
+        // as are the changes that were pending when it was deleted
+        for _, query := range []string{
+                "UPDATE scheduled_changes SET cancelled = FALSE, deleted_at = 0 WHERE config_name = ? AND deleted_at = ?",
+                "UPDATE change_requests SET status = 'pending', deleted_at = 0 WHERE config_name = ? AND deleted_at = ?",
+        } {
+                if _, err = store.exec(tx, "restorePending", name, query, name, deletedAt); err != nil {
+                        return nil, rollback(tx, errRestoreConfig, err)
+                }
+        }
+
+        // the config was deleted, so every setting it has now was restored
+        if rows, err = store.getSettingsStmt.in(tx).Query(name); err != nil {
+                return nil, rollback(tx, errRestoreConfig, err)
+        }
+
+        batch := new(configman.Batch)
+
+        for rows.Next() {
+                if setting, err = store.scanSetting(rows); err != nil {
+                        rows.Close()
+                        return nil, rollback(tx, errRestoreConfig, err)
+                }
+
+                restored(batch, name, setting)
+        }
+
+        if err = errors.Join(rows.Err(), rows.Close()); err != nil {
+                return nil, rollback(tx, errRestoreConfig, err)
+        }
+
+        if len(batch.Ops) > 0 {
+                if event, err = store.recordOps(tx, batch.Ops, by, now); err != nil {
+                        return nil, rollback(tx, errRestoreConfig, err)
+                }
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errRestoreConfig, err)
+        }
+
+        if event.Revision != 0 {
+                store.events.Publish(*event)
+        }
+
+        if config, err = store.GetConfig(name); err != nil {
+                return nil, errors.Join(errRestoreConfig, err)
+        }
+
+        return config, nil
+}
+
+// RestoreSetting implements configman.TrashStore. The restored setting
+// is recorded in history as created, and deprecated if it was. The
+// config must not be protected.
+func (store *SqlStore) RestoreSetting(config, name, by string) (_ *configman.Setting, err error) {
+        var tx *sql.Tx
+        var id, deletedAt, revision int64
+        var typ configman.Type
+        var setting *configman.Setting
+        var event *configman.ChangeEvent
+
+        defer store.observe("restore setting", "config", config, "setting", name, "by", by)(&err)
+
+        if tx, err = store.db.Begin(); err != nil {
+                return nil, errors.Join(errRestoreSetting, err)
+        }
+
+        if err = store.checkProtected(tx, config); err != nil {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        if _, err = store.configIdIn(tx, config); err != nil {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        err = store.getSettingTypeStmt.in(tx).QueryRow(config, name).Scan(&typ, &revision)
+
+        if err == nil {
+                return nil, rollback(tx, errRestoreSetting, fmt.Errorf("sqlstore: setting %s of config %s: %w", name, config, configman.ErrExists))
+        }
+
+        if err != sql.ErrNoRows {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        err = store.getDeletedSettingStmt.in(tx).QueryRow(config, name).Scan(&id, &deletedAt)
+
+        if err == sql.ErrNoRows || err == nil && deletedAt < store.cutoff() {
+                return nil, rollback(tx, errRestoreSetting, errSettingNotFound(config, name))
+        }
+
+        if err != nil {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        now := time.Now()
+
+        if _, err = store.restoreSettingStmt.in(tx).about(config).Exec(now.Unix(), id); err != nil {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        if setting, err = store.scanSetting(store.getSettingStmt.in(tx).QueryRow(config, name)); err != nil {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        batch := new(configman.Batch)
+        restored(batch, config, setting)
+
+        if event, err = store.recordOps(tx, batch.Ops, by, now); err != nil {
+                return nil, rollback(tx, errRestoreSetting, err)
+        }
+
+        if err = tx.Commit(); err != nil {
+                return nil, errors.Join(errRestoreSetting, err)
+        }
+
+        store.events.Publish(*event)
+
+        return setting, nil
+}
+
+// PurgeTrash implements configman.TrashStore. Configs and settings
+// expire once they have been deleted for longer than the retention of
+// the store, see WithRetention.
+func (store *SqlStore) PurgeTrash() (_ int, err error) {
+        var tx *sql.Tx
+        var configs, settings int64
+
+        defer store.observe("purge trash")(&err)
+
+        cutoff := store.cutoff()
+
+        if tx, err = store.db.Begin(); err != nil {
+                return 0, errors.Join(errPurgeTrash, err)
+        }
+
+        if configs, err = store.purgeConfigs(tx, "deleted_at != 0 AND deleted_at < ?", cutoff); err != nil {
+                return 0, rollback(tx, errPurgeTrash, err)
+        }
+
+        if settings, err = store.purgeSettings(tx, "deleted_at != 0 AND deleted_at < ?", cutoff); err != nil {
+                return 0, rollback(tx, errPurgeTrash, err)
+        }
+
+        if err = tx.Commit(); err != nil {
+                return 0, errors.Join(errPurgeTrash, err)
+        }
+
+        if configs+settings > 0 {
+                store.logger.Info("sqlstore: purged trash", "configs", configs, "settings", settings)
+        }
+
+        return int(configs + settings), nil
+}
+
+// purgeConfigs permanently deletes the configs matching where, with
+// args, within tx, along with their settings and everything that refers
+// to them by name except history. It returns how many configs it
+// deleted. where must only match deleted configs.
+func (store *SqlStore) purgeConfigs(tx *sql.Tx, where string, args ...any) (int64, error) {
+        names := "config_name IN (SELECT name FROM configs WHERE " + where + ")"
+
+        for _, query := range []string{
+                "DELETE FROM flag_rules WHERE " + names,
+                "DELETE FROM setting_labels WHERE " + names,
+                "DELETE FROM config_labels WHERE " + names,
+                "DELETE FROM grants WHERE " + names,
+                "DELETE FROM scheduled_changes WHERE deleted_at != 0 AND " + names,
+                "DELETE FROM change_requests WHERE deleted_at != 0 AND " + names,
+                "DELETE FROM settings WHERE " + names,
+        } {
+                if _, err := store.exec(tx, "purgeReferences", "", query, args...); err != nil {
+                        return 0, err
+                }
+        }
+
+        result, err := store.exec(tx, "purgeConfigs", "", "DELETE FROM configs WHERE "+where, args...)
+
+        if err != nil {
+                return 0, err
+        }
+
+        return result.RowsAffected()
+}
+
+// purgeSettings permanently deletes the settings matching where, with
+// args, within tx, along with their flag rules and labels. It returns
+// how many settings it deleted. where must only match deleted settings.
+func (store *SqlStore) purgeSettings(tx *sql.Tx, where string, args ...any) (int64, error) {
+        for _, query := range []string{
+                "DELETE FROM flag_rules WHERE" + settingExists("flag_rules", where),
+                "DELETE FROM setting_labels WHERE" + settingExists("setting_labels", where),
+        } {
+                if _, err := store.exec(tx, "purgeReferences", "", query, args...); err != nil {
+                        return 0, err
+                }
+        }
+
+        result, err := store.exec(tx, "purgeSettings", "", "DELETE FROM settings WHERE "+where, args...)
+
+        if err != nil {
+                return 0, err
+        }
+
+        return result.RowsAffected()
+}
+
+// settingExists returns the condition that the setting a row of table
+// refers to, by its config_name and setting_name, matches where.
+func settingExists(table, where string) string {
+        return " EXISTS (SELECT 1 FROM settings WHERE settings.config_name = " + table + ".config_name AND settings.name = " + table + ".setting_name AND " + where + ")"
+}
+
+// cutoff returns the time, in nanoseconds, before which deleted configs
+// and settings have expired.
+func (store *SqlStore) cutoff() int64 {
+        return time.Now().Add(-store.retention).UnixNano()
+}
+
+// restored adds to batch the operations that record setting of config
+// as restored: created, and deprecated if it is.
+func restored(batch *configman.Batch, config string, setting *configman.Setting) {
+        batch.Create(config, setting.Name(), setting.Description(), setting.Value())
+
+        if setting.Deprecated() {
+                batch.Deprecate(config, setting.Name(), setting.DeprecationReason())
+        }
+}
@@ -0,0 +1,271 @@
+package sqlstore
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/vlence/configman"
+)
+
+func TestDeleteConfigCancelsPendingChanges(t *testing.T) {
+        store := newTestStore(t)
+        mustCreateConfigs(t, store, "app")
+        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)))
+
+        scheduled, err := store.ScheduleChange("app", "timeout", int64(60), time.Now().Add(time.Hour), "test")
+
+        if err != nil {
+                t.Fatalf("failed to schedule change: %v", err)
+        }
+
+        cancelled, err := store.ScheduleChange("app", "timeout", int64(90), time.Now().Add(time.Hour), "test")
+
+        if err != nil {
+                t.Fatalf("failed to schedule change: %v", err)
+        }
+
+        if err = store.CancelScheduledChange(cancelled.ID); err != nil {
+                t.Fatalf("failed to cancel scheduled change: %v", err)
+        }
+
+        proposed, err := store.ProposeChange("app", "timeout", int64(45), "test")
+
+        if err != nil {
+                t.Fatalf("failed to propose change: %v", err)
+        }
+
+        if err = store.DeleteConfig("app", "alice"); err != nil {
+                t.Fatalf("failed to delete config: %v", err)
+        }
+
+        if changes, _ := store.GetScheduledChanges("app"); len(changes) != 0 {
+                t.Errorf("got %d scheduled changes of the deleted config, want 0", len(changes))
+        }
+
+        if requests, _ := store.GetChangeRequests("app"); len(requests) != 0 {
+                t.Errorf("got %d change requests of the deleted config, want 0", len(requests))
+        }
+
+        if _, err = store.RestoreConfig("app", "bob"); err != nil {
+                t.Fatalf("failed to restore config: %v", err)
+        }
+
+        history, err := store.GetHistory("app", 10)
+
+        if err != nil {
+                t.Fatalf("failed to get history: %v", err)
+        }
+
+        deleted := slices.IndexFunc(history, func(event configman.ChangeEvent) bool {
+                return len(event.Ops) == 1 && event.Ops[0].Kind == configman.OpDelete
+        })
+
+        if deleted == -1 || history[deleted].By != "alice" {
+                t.Errorf("deleting the config is not recorded as made by alice in %v", history)
+        }
+
+        changes, err := store.GetScheduledChanges("app")
+
+        if err != nil {
+                t.Fatalf("failed to get scheduled changes: %v", err)
+        }
+
+        if len(changes) != 1 || changes[0].ID != scheduled.ID {
+                t.Errorf("got scheduled changes %v after restoring the config, want only %d", changes, scheduled.ID)
+        }
+
+        requests, err := store.GetChangeRequests("app")
+
+        if err != nil {
+                t.Fatalf("failed to get change requests: %v", err)
+        }
+
+        if len(requests) != 1 || requests[0].ID != proposed.ID || !requests[0].Pending() {
+                t.Errorf("got change requests %v after restoring the config, want only %d pending", requests, proposed.ID)
+        }
+}
+
+func TestRestoreConfig(t *testing.T) {
+        tests := []struct {
+                name   string
+                before func(t *testing.T, store *SqlStore)
+                err    error
+        }{
+                {
+                        name: "deleted",
+                },
+                {
+                        name: "not deleted",
+                        before: func(t *testing.T, store *SqlStore) {
+                                if _, err := store.RestoreConfig("app", "test"); err != nil {
+                                        t.Fatalf("failed to restore config: %v", err)
+                                }
+                        },
+                        err: configman.ErrNotFound,
+                },
+                {
+                        name: "name taken again",
+                        before: func(t *testing.T, store *SqlStore) {
+                                mustCreateConfigs(t, store, "app")
+                        },
+                        err: configman.ErrNotFound,
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateConfigs(t, store, "app")
+                        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Create("app", "retries", "", int64(3)))
+                        mustApply(t, store, new(configman.Batch).Deprecate("app", "timeout", "use deadline").Delete("app", "retries"))
+
+                        if err := store.DeleteConfig("app", "test"); err != nil {
+                                t.Fatalf("failed to delete config: %v", err)
+                        }
+
+                        if test.before != nil {
+                                test.before(t, store)
+                        }
+
+                        if _, err := store.RestoreConfig("app", "test"); !errors.Is(err, test.err) {
+                                t.Fatalf("RestoreConfig returned %v, want %v", err, test.err)
+                        }
+
+                        if test.err != nil {
+                                return
+                        }
+
+                        timeout, _ := store.GetSetting("app", "timeout")
+
+                        if timeout == nil || timeout.Value() != int64(30) || !timeout.Deprecated() {
+                                t.Errorf("got timeout %v after restoring its config, want 30 and deprecated", timeout)
+                        }
+
+                        // deleted before its config, so not along with it
+                        if value := valueOf(t, store, "app", "retries"); value != nil {
+                                t.Errorf("retries is %v after restoring its config, want it to stay deleted", value)
+                        }
+                })
+        }
+}
+
+func TestRestoreSetting(t *testing.T) {
+        tests := []struct {
+                name   string
+                before func(t *testing.T, store *SqlStore)
+                err    error
+        }{
+                {
+                        name: "deleted",
+                },
+                {
+                        name: "name taken again",
+                        before: func(t *testing.T, store *SqlStore) {
+                                mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(90)))
+                        },
+                        err: configman.ErrExists,
+                },
+                {
+                        name: "protected config",
+                        before: func(t *testing.T, store *SqlStore) {
+                                if err := store.SetProtected("app", true); err != nil {
+                                        t.Fatalf("failed to protect config: %v", err)
+                                }
+                        },
+                        err: configman.ErrProtectedConfig,
+                },
+                {
+                        name: "deleted config",
+                        before: func(t *testing.T, store *SqlStore) {
+                                if err := store.DeleteConfig("app", "test"); err != nil {
+                                        t.Fatalf("failed to delete config: %v", err)
+                                }
+                        },
+                        err: configman.ErrNotFound,
+                },
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t)
+                        mustCreateConfigs(t, store, "app")
+                        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)))
+                        mustApply(t, store, new(configman.Batch).Delete("app", "timeout"))
+
+                        if test.before != nil {
+                                test.before(t, store)
+                        }
+
+                        if _, err := store.RestoreSetting("app", "timeout", "test"); !errors.Is(err, test.err) {
+                                t.Fatalf("RestoreSetting returned %v, want %v", err, test.err)
+                        }
+
+                        if test.err == nil && valueOf(t, store, "app", "timeout") != int64(30) {
+                                t.Errorf("timeout is %v after it was restored, want 30", valueOf(t, store, "app", "timeout"))
+                        }
+                })
+        }
+}
+
+func TestPurgeTrash(t *testing.T) {
+        tests := []struct {
+                name      string
+                retention time.Duration
+                purged    int
+        }{
+                {name: "not expired", retention: time.Hour, purged: 0},
+                {name: "expired", retention: time.Nanosecond, purged: 2},
+        }
+
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        store := newTestStore(t, WithRetention(test.retention))
+                        mustCreateConfigs(t, store, "app", "web")
+                        mustApply(t, store, new(configman.Batch).Create("app", "timeout", "", int64(30)).Create("web", "timeout", "", int64(10)))
+                        mustApply(t, store, new(configman.Batch).Delete("web", "timeout"))
+
+                        if err := store.SetConfigLabels("app", configman.Labels{"team": "payments"}); err != nil {
+                                t.Fatalf("failed to label config: %v", err)
+                        }
+
+                        if err := store.DeleteConfig("app", "test"); err != nil {
+                                t.Fatalf("failed to delete config: %v", err)
+                        }
+
+                        time.Sleep(time.Millisecond)
+
+                        purged, err := store.PurgeTrash()
+
+                        if err != nil {
+                                t.Fatalf("PurgeTrash returned %v", err)
+                        }
+
+                        // the config and the setting deleted on its own
+                        if purged != test.purged {
+                                t.Errorf("purged %d items, want %d", purged, test.purged)
+                        }
+
+                        trash, err := store.GetTrash()
+
+                        if err != nil {
+                                t.Fatalf("failed to get trash: %v", err)
+                        }
+
+                        if want := 2 - test.purged; len(trash) != want {
+                                t.Errorf("got %d items in the trash, want %d", len(trash), want)
+                        }
+
+                        if test.purged == 0 {
+                                return
+                        }
+
+                        var labels int
+
+                        if err = store.db.QueryRow("SELECT count(*) FROM config_labels WHERE config_name = 'app'").Scan(&labels); err != nil || labels != 0 {
+                                t.Errorf("got %d labels of the purged config (%v), want 0", labels, err)
+                        }
+                })
+        }
+}
@@ -0,0 +1,102 @@
+package sqlstore
+
+import (
+	"database/sql"
+
+	"github.com/vlence/configman"
+)
+
+// valueColumns are the columns a setting value is stored in. Only the
+// column matching value_type is set, the others are NULL. Tables that
+// store setting values use the same column names.
+const valueColumns = `
+        value_type,
+        int32_value,
+        int64_value,
+        float32_value,
+        float64_value,
+        bool_value,
+        string_value
+`
+
+// sqlValue is a setting value as it is stored in valueColumns.
+type sqlValue struct {
+        typ          configman.Type
+        int32Value   sql.NullInt64
+        int64Value   sql.NullInt64
+        float32Value sql.NullFloat64
+        float64Value sql.NullFloat64
+        boolValue    sql.NullBool
+        stringValue  sql.NullString
+}
+
+// newSqlValue returns value as it should be stored in valueColumns.
+func newSqlValue(value any) sqlValue {
+        var v sqlValue
+
+        v.typ = configman.TypeOf(value)
+
+        switch value := value.(type) {
+        case int32:
+                v.int32Value = sql.NullInt64{Int64: int64(value), Valid: true}
+        case int64:
+                v.int64Value = sql.NullInt64{Int64: value, Valid: true}
+        case float32:
+                v.float32Value = sql.NullFloat64{Float64: float64(value), Valid: true}
+        case float64:
+                v.float64Value = sql.NullFloat64{Float64: value, Valid: true}
+        case bool:
+                v.boolValue = sql.NullBool{Bool: value, Valid: true}
+        case string:
+                v.stringValue = sql.NullString{String: value, Valid: true}
+        }
+
+        return v
+}
+
+// args returns the arguments to pass to a statement for valueColumns.
+func (v *sqlValue) args() []any {
+        return []any{
+                v.typ,
+                v.int32Value,
+                v.int64Value,
+                v.float32Value,
+                v.float64Value,
+                v.boolValue,
+                v.stringValue,
+        }
+}
+
+// dest returns the destinations to pass to Scan for valueColumns.
+func (v *sqlValue) dest() []any {
+        return []any{
+                &v.typ,
+                &v.int32Value,
+                &v.int64Value,
+                &v.float32Value,
+                &v.float64Value,
+                &v.boolValue,
+                &v.stringValue,
+        }
+}
+
+// value returns the value stored in v. configman.ErrUnsupportedType is
+// returned if the stored type is not supported.
+func (v *sqlValue) value() (any, error) {
+        switch v.typ {
+        case configman.Int32:
+                return int32(v.int32Value.Int64), nil
+        case configman.Int64:
+                return v.int64Value.Int64, nil
+        case configman.Float32:
+                return float32(v.float32Value.Float64), nil
+        case configman.Float64:
+                return v.float64Value.Float64, nil
+        case configman.Bool:
+                return v.boolValue.Bool, nil
+        case configman.String:
+                return v.stringValue.String, nil
+        default:
+                return nil, configman.ErrUnsupportedType
+        }
+}
@@ -0,0 +1,150 @@
+// Package traced traces the operations of any configman.Store.
+package traced
+
+import (
+	"context"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/tracing"
+	"github.com/vlence/gossert"
+)
+
+// TracedStore starts a span around every operation of the store it
+// wraps, with the names of the config and setting involved as
+// attributes. Only the methods of configman.Store are traced;
+// extensions, which configman.Extension finds through Unwrap, are not.
+// If the wrapped store is a configman.Binder, it is bound to the span of
+// each operation, so that its own spans are children of it, and
+// extensions are bound to the context of the store.
+type TracedStore struct {
+        configman.Store
+
+        tracer tracing.Tracer
+
+        // Spans are started as children of the span in ctx.
+        ctx context.Context
+}
+
+// NewTracedStore returns a TracedStore that wraps store and starts its
+// spans with tracer. They start new traces unless the store is bound to
+// a context with WithContext.
+func NewTracedStore(store configman.Store, tracer tracing.Tracer) *TracedStore {
+        gossert.Ok(store != nil, "traced: received nil instead of store")
+        gossert.Ok(tracer != nil, "traced: received nil instead of tracer")
+
+        return &TracedStore{
+                Store:  store,
+                tracer: tracer,
+                ctx:    context.Background(),
+        }
+}
+
+// WithContext returns a copy of the store whose spans are children of
+// the span in ctx, e.g. the span of the request being served.
+func (store *TracedStore) WithContext(ctx context.Context) *TracedStore {
+        gossert.Ok(ctx != nil, "traced: received nil instead of context")
+
+        bound := *store
+        bound.ctx = ctx
+
+        return &bound
+}
+
+// Bind implements configman.Binder, see WithContext.
+func (store *TracedStore) Bind(ctx context.Context) configman.Store {
+        return store.WithContext(ctx)
+}
+
+// Unwrap returns the wrapped store bound to the context of the store.
+// See configman.Extension.
+func (store *TracedStore) Unwrap() configman.Store {
+        return configman.Bind(store.ctx, store.Store)
+}
+
+// start starts the span of operation and returns the wrapped store bound
+// to it, along with the function that ends it, which must be called
+// deferred with a pointer to the named error result.
+func (store *TracedStore) start(operation string, attrs ...any) (configman.Store, func(err *error)) {
+        ctx, span := store.tracer.Start(store.ctx, "configman.Store/"+operation)
+        span.SetAttributes(append([]any{"configman.operation", operation}, attrs...)...)
+
+        return configman.Bind(ctx, store.Store), func(err *error) {
+                if *err != nil {
+                        span.RecordError(*err)
+                }
+
+                span.End()
+        }
+}
+
+// CreateConfig implements configman.Store.
+func (store *TracedStore) CreateConfig(name, desc string) (_ configman.Config, err error) {
+        inner, end := store.start("CreateConfig", "configman.config", name)
+        defer end(&err)
+
+        return inner.CreateConfig(name, desc)
+}
+
+// GetConfig implements configman.Store.
+func (store *TracedStore) GetConfig(name string) (_ configman.Config, err error) {
+        inner, end := store.start("GetConfig", "configman.config", name)
+        defer end(&err)
+
+        return inner.GetConfig(name)
+}
+
+// GetConfigs implements configman.Store.
+func (store *TracedStore) GetConfigs() (_ []configman.Config, err error) {
+        inner, end := store.start("GetConfigs")
+        defer end(&err)
+
+        return inner.GetConfigs()
+}
+
+// DeleteConfig implements configman.Store.
+func (store *TracedStore) DeleteConfig(name, by string) (err error) {
+        inner, end := store.start("DeleteConfig", "configman.config", name)
+        defer end(&err)
+
+        return inner.DeleteConfig(name, by)
+}
+
+// DeprecateConfig implements configman.Store.
+func (store *TracedStore) DeprecateConfig(name, reason string) (err error) {
+        inner, end := store.start("DeprecateConfig", "configman.config", name)
+        defer end(&err)
+
+        return inner.DeprecateConfig(name, reason)
+}
+
+// DeprecateConfigIf implements configman.Store.
+func (store *TracedStore) DeprecateConfigIf(name, reason string, revision int64) (err error) {
+        inner, end := store.start("DeprecateConfigIf", "configman.config", name)
+        defer end(&err)
+
+        return inner.DeprecateConfigIf(name, reason, revision)
+}
+
+// GetSetting implements configman.Store.
+func (store *TracedStore) GetSetting(config, name string) (_ *configman.Setting, err error) {
+        inner, end := store.start("GetSetting", "configman.config", config, "configman.setting", name)
+        defer end(&err)
+
+        return inner.GetSetting(config, name)
+}
+
+// GetSettings implements configman.Store.
+func (store *TracedStore) GetSettings(config string) (_ []*configman.Setting, err error) {
+        inner, end := store.start("GetSettings", "configman.config", config)
+        defer end(&err)
+
+        return inner.GetSettings(config)
+}
+
+// ApplyBatch implements configman.Store.
+func (store *TracedStore) ApplyBatch(batch *configman.Batch, by string) (_ *configman.ChangeEvent, err error) {
+        inner, end := store.start("ApplyBatch", "configman.configs", batch.Configs(), "configman.ops", len(batch.Ops))
+        defer end(&err)
+
+        return inner.ApplyBatch(batch, by)
+}
@@ -0,0 +1,111 @@
+package traced
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/vlence/configman"
+	"github.com/vlence/configman/tracing"
+)
+
+var errFake = errors.New("fake store failed")
+
+// fakeStore only implements the operations the tests call.
+type fakeStore struct {
+        configman.Store
+}
+
+func (fakeStore) GetSetting(config, name string) (*configman.Setting, error) {
+        return nil, nil
+}
+
+func (fakeStore) DeleteConfig(name, by string) error {
+        return errFake
+}
+
+func TestTracedStoreStartsSpan(t *testing.T) {
+        exporter := new(tracing.InMemoryExporter)
+        store := NewTracedStore(fakeStore{}, tracing.NewTracer(exporter))
+
+        if _, err := store.GetSetting("app", "timeout"); err != nil {
+                t.Fatalf("GetSetting returned %v", err)
+        }
+
+        spans := exporter.Spans()
+
+        if len(spans) != 1 {
+                t.Fatalf("got %d spans, want 1", len(spans))
+        }
+
+        span := spans[0]
+
+        if span.Name != "configman.Store/GetSetting" {
+                t.Errorf("span is named %q, want %q", span.Name, "configman.Store/GetSetting")
+        }
+
+        for key, want := range map[string]any{
+                "configman.operation": "GetSetting",
+                "configman.config":    "app",
+                "configman.setting":   "timeout",
+        } {
+                if got := span.Attributes[key]; got != want {
+                        t.Errorf("attribute %s is %v, want %v", key, got, want)
+                }
+        }
+
+        if span.Parent.IsValid() {
+                t.Errorf("span has parent %s, want none", span.Parent.Traceparent())
+        }
+
+        if span.Err != nil {
+                t.Errorf("span recorded error %v, want none", span.Err)
+        }
+}
+
+func TestTracedStoreRecordsError(t *testing.T) {
+        exporter := new(tracing.InMemoryExporter)
+        store := NewTracedStore(fakeStore{}, tracing.NewTracer(exporter))
+
+        if err := store.DeleteConfig("app", "test"); !errors.Is(err, errFake) {
+                t.Fatalf("DeleteConfig returned %v, want %v", err, errFake)
+        }
+
+        spans := exporter.Spans()
+
+        if len(spans) != 1 {
+                t.Fatalf("got %d spans, want 1", len(spans))
+        }
+
+        if !errors.Is(spans[0].Err, errFake) {
+                t.Errorf("span recorded error %v, want %v", spans[0].Err, errFake)
+        }
+}
+
+func TestTracedStoreWithContext(t *testing.T) {
+        exporter := new(tracing.InMemoryExporter)
+        tracer := tracing.NewTracer(exporter)
+        store := NewTracedStore(fakeStore{}, tracer)
+
+        ctx, parent := tracer.Start(context.Background(), "request")
+
+        if _, err := store.WithContext(ctx).GetSetting("app", "timeout"); err != nil {
+                t.Fatalf("GetSetting returned %v", err)
+        }
+
+        parent.End()
+
+        spans := exporter.Spans()
+
+        if len(spans) != 2 {
+                t.Fatalf("got %d spans, want 2", len(spans))
+        }
+
+        if spans[0].Parent != parent.SpanContext() {
+                t.Errorf("span has parent %s, want %s", spans[0].Parent.Traceparent(), parent.SpanContext().Traceparent())
+        }
+
+        if spans[0].Context.TraceID != parent.SpanContext().TraceID {
+                t.Error("span is not in the trace of its parent")
+        }
+}
@@ -0,0 +1,306 @@
+// Package tracing provides the hooks configman uses to trace requests
+// and store operations, without depending on a tracing library.
+//
+// A Tracer starts spans. NewTracer returns one that hands finished spans
+// to an Exporter, like InMemoryExporter in tests; an adapter
+// implementing Tracer can forward them to OpenTelemetry instead. Trace
+// context is propagated between processes with the W3C traceparent
+// header.
+//
+// configman.Store has no context, so spans of store operations are only
+// children of a request span when the caller binds the store to the
+// context of the request, see configman.Bind.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Tracer starts spans.
+type Tracer interface {
+        // Start starts a span named name as a child of the span in ctx,
+        // if any, and returns a context carrying the new span.
+        Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// A Span is a traced operation. It is finished by End; attributes and
+// errors recorded after that are ignored.
+type Span interface {
+        // SpanContext returns the identity of the span.
+        SpanContext() SpanContext
+
+        // SetAttributes adds attributes to the span given as
+        // alternating keys and values, like the arguments of slog.
+        SetAttributes(attrs ...any)
+
+        // RecordError marks the span as failed with err.
+        RecordError(err error)
+
+        // End finishes the span.
+        End()
+}
+
+// SpanContext identifies a span and the trace it belongs to.
+type SpanContext struct {
+        TraceID [16]byte
+        SpanID  [8]byte
+        Sampled bool
+}
+
+// IsValid reports whether sc identifies a span.
+func (sc SpanContext) IsValid() bool {
+        return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns sc in the format of the W3C traceparent header.
+func (sc SpanContext) Traceparent() string {
+        flags := "00"
+
+        if sc.Sampled {
+                flags = "01"
+        }
+
+        return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), flags)
+}
+
+// ParseTraceparent parses the value of a W3C traceparent header. It
+// returns false if the value is not valid.
+func ParseTraceparent(value string) (SpanContext, bool) {
+        var sc SpanContext
+
+        parts := strings.Split(strings.TrimSpace(value), "-")
+
+        if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+                return sc, false
+        }
+
+        // only version 00 is known, later versions may add fields
+        if parts[0] == "00" && len(parts) != 4 {
+                return sc, false
+        }
+
+        traceID, traceErr := hex.DecodeString(parts[1])
+        spanID, spanErr := hex.DecodeString(parts[2])
+        flags, flagsErr := hex.DecodeString(parts[3])
+
+        if traceErr != nil || spanErr != nil || flagsErr != nil {
+                return sc, false
+        }
+
+        copy(sc.TraceID[:], traceID)
+        copy(sc.SpanID[:], spanID)
+        sc.Sampled = flags[0]&1 == 1
+
+        return sc, sc.IsValid()
+}
+
+// spanKey is the context key of the current span.
+type spanKey struct{}
+
+// remoteKey is the context key of a span context received from another
+// process.
+type remoteKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span.
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+        return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span in ctx or nil if there is none.
+func SpanFromContext(ctx context.Context) Span {
+        span, _ := ctx.Value(spanKey{}).(Span)
+        return span
+}
+
+// ContextWithRemoteParent returns a copy of ctx whose spans are started
+// as children of sc, the span of another process.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+        return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// parent returns the span context spans started with ctx are children
+// of. It is not valid if they start a new trace.
+func parent(ctx context.Context) SpanContext {
+        if span := SpanFromContext(ctx); span != nil {
+                return span.SpanContext()
+        }
+
+        sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+
+        return sc
+}
+
+// SpanData is a finished span as handed to an Exporter.
+type SpanData struct {
+        Name       string
+        Context    SpanContext
+        Parent     SpanContext
+        Start      time.Time
+        End        time.Time
+        Attributes map[string]any
+        Err        error
+}
+
+// Duration returns how long the span took.
+func (data *SpanData) Duration() time.Duration {
+        return data.End.Sub(data.Start)
+}
+
+// An Exporter receives the spans of a tracer made by NewTracer as they
+// finish. It must be safe to call from several goroutines.
+type Exporter interface {
+        Export(span *SpanData)
+}
+
+// NewTracer returns a Tracer that hands every finished span to exporter.
+func NewTracer(exporter Exporter) Tracer {
+        return &tracer{exporter}
+}
+
+// tracer is the Tracer returned by NewTracer.
+type tracer struct {
+        exporter Exporter
+}
+
+// Start implements Tracer.
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, Span) {
+        s := &span{exporter: t.exporter}
+        s.data.Name = name
+        s.data.Start = time.Now()
+        s.data.Attributes = make(map[string]any)
+        s.data.Parent = parent(ctx)
+
+        if s.data.Parent.IsValid() {
+                s.data.Context.TraceID = s.data.Parent.TraceID
+        } else {
+                rand.Read(s.data.Context.TraceID[:])
+        }
+
+        rand.Read(s.data.Context.SpanID[:])
+        s.data.Context.Sampled = true
+
+        return ContextWithSpan(ctx, s), s
+}
+
+// span is the Span started by tracer.
+type span struct {
+        exporter Exporter
+
+        mu    sync.Mutex
+        data  SpanData
+        ended bool
+}
+
+// SpanContext implements Span.
+func (s *span) SpanContext() SpanContext {
+        return s.data.Context
+}
+
+// SetAttributes implements Span.
+func (s *span) SetAttributes(attrs ...any) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        if s.ended {
+                return
+        }
+
+        for i := 0; i+1 < len(attrs); i += 2 {
+                s.data.Attributes[fmt.Sprint(attrs[i])] = attrs[i+1]
+        }
+}
+
+// RecordError implements Span.
+func (s *span) RecordError(err error) {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+
+        if !s.ended {
+                s.data.Err = err
+        }
+}
+
+// End implements Span.
+func (s *span) End() {
+        s.mu.Lock()
+
+        if s.ended {
+                s.mu.Unlock()
+                return
+        }
+
+        s.ended = true
+        s.data.End = time.Now()
+        data := s.data
+        s.mu.Unlock()
+
+        s.exporter.Export(&data)
+}
+
+// InMemoryExporter keeps the spans it is given so that tests can check
+// them without a collector.
+type InMemoryExporter struct {
+        mu    sync.Mutex
+        spans []*SpanData
+}
+
+// Export implements Exporter.
+func (exporter *InMemoryExporter) Export(span *SpanData) {
+        exporter.mu.Lock()
+        defer exporter.mu.Unlock()
+
+        exporter.spans = append(exporter.spans, span)
+}
+
+// Spans returns the spans exported so far in the order they finished.
+func (exporter *InMemoryExporter) Spans() []*SpanData {
+        exporter.mu.Lock()
+        defer exporter.mu.Unlock()
+
+        return append([]*SpanData(nil), exporter.spans...)
+}
+
+// Reset forgets every span exported so far.
+func (exporter *InMemoryExporter) Reset() {
+        exporter.mu.Lock()
+        defer exporter.mu.Unlock()
+
+        exporter.spans = nil
+}
+
+// LogExporter logs every span it is given at debug level.
+type LogExporter struct {
+        Logger *slog.Logger
+}
+
+// Export implements Exporter.
+func (exporter LogExporter) Export(span *SpanData) {
+        attrs := []any{
+                "trace_id", hex.EncodeToString(span.Context.TraceID[:]),
+                "span_id", hex.EncodeToString(span.Context.SpanID[:]),
+                "duration", span.Duration(),
+        }
+
+        if span.Parent.IsValid() {
+                attrs = append(attrs, "parent_id", hex.EncodeToString(span.Parent.SpanID[:]))
+        }
+
+        for _, key := range slices.Sorted(maps.Keys(span.Attributes)) {
+                attrs = append(attrs, key, span.Attributes[key])
+        }
+
+        if span.Err != nil {
+                attrs = append(attrs, "err", span.Err)
+        }
+
+        exporter.Logger.Debug("span: "+span.Name, attrs...)
+}
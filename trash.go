@@ -0,0 +1,92 @@
+package configman
+
+import (
+        "context"
+        "log/slog"
+        "time"
+
+        "github.com/vlence/gossert"
+)
+
+// DefaultRetention is how long deleted configs and settings are kept in
+// the trash unless a store is told otherwise.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// A TrashedItem is a deleted config or setting that can still be
+// restored. Settings deleted along with their config are restored with
+// it and are only counted by the config.
+type TrashedItem struct {
+        Config      string
+        Setting     string // empty if the item is a config
+        Description string
+        Settings    int // settings deleted along with the config
+        DeletedAt   time.Time
+        ExpiresAt   time.Time // when the item is purged
+}
+
+// TrashStore is implemented by stores that keep deleted configs and
+// settings in a trash for a retention period before purging them. Items
+// in the trash are left out of every other read of the store. Creating a
+// config or setting with the name of one in the trash purges it.
+type TrashStore interface {
+        // GetTrash returns the configs and settings in the trash that
+        // have not expired yet, most recently deleted first.
+        GetTrash() ([]TrashedItem, error)
+
+        // RestoreConfig restores the deleted config name along with the
+        // settings deleted with it. Restoring the settings is recorded in
+        // history as one revision made by by. ErrNotFound is returned if
+        // the config is not in the trash or has expired, or if its
+        // namespace no longer exists, and ErrExists if a config with the
+        // same name exists.
+        RestoreConfig(name, by string) (Config, error)
+
+        // RestoreSetting restores the deleted setting name of config,
+        // recorded in history as a revision made by by. ErrNotFound is
+        // returned if the setting is not in the trash or has expired, or
+        // if config does not exist, and ErrExists if a setting with the
+        // same name exists.
+        RestoreSetting(config, name, by string) (*Setting, error)
+
+        // PurgeTrash permanently deletes the configs and settings that
+        // have expired, with their flag rules, labels and grants, and
+        // returns how many were purged.
+        PurgeTrash() (int, error)
+}
+
+// A Purger periodically purges the expired items of a TrashStore.
+type Purger struct {
+        store    TrashStore
+        interval time.Duration
+        logger   *slog.Logger
+}
+
+// NewPurger returns a purger that purges expired items from store every
+// interval and logs its failures to logger.
+func NewPurger(store TrashStore, interval time.Duration, logger *slog.Logger) *Purger {
+        gossert.Ok(store != nil, "configman: cannot create purger for nil store")
+        gossert.Ok(interval > 0, "configman: purger interval must be positive")
+        gossert.Ok(logger != nil, "configman: cannot create purger for nil logger")
+
+        return &Purger{store, interval, logger}
+}
+
+// Run purges expired items every interval until ctx is done. Failures
+// are logged and retried on the next tick. Run is meant to be run in its
+// own goroutine.
+func (purger *Purger) Run(ctx context.Context) {
+        ticker := time.NewTicker(purger.interval)
+        defer ticker.Stop()
+
+        for {
+                if _, err := purger.store.PurgeTrash(); err != nil {
+                        purger.logger.Warn("configman: failed to purge trash", "err", err)
+                }
+
+                select {
+                case <-ctx.Done():
+                        return
+                case <-ticker.C:
+                }
+        }
+}
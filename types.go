@@ -1,6 +1,10 @@
 package configman
 
-import "errors"
+import (
+        "encoding/json"
+        "errors"
+        "strconv"
+)
 
 // Represents a valid data type of value that can be stored in a setting.
 type Type uint8
@@ -57,3 +61,96 @@ func (t Type) String() string {
                 return "unsupported"
         }
 }
+
+// ParseValue parses s as a value of type t. ErrTypeMismatch is returned
+// if s is not a valid value of type t.
+func ParseValue(t Type, s string) (any, error) {
+        var v any
+        var err error
+
+        switch t {
+        case Int32:
+                var i int64
+                i, err = strconv.ParseInt(s, 10, 32)
+                v = int32(i)
+        case Int64:
+                v, err = strconv.ParseInt(s, 10, 64)
+        case Float32:
+                var f float64
+                f, err = strconv.ParseFloat(s, 32)
+                v = float32(f)
+        case Float64:
+                v, err = strconv.ParseFloat(s, 64)
+        case Bool:
+                v, err = strconv.ParseBool(s)
+        case String:
+                v = s
+        default:
+                return nil, ErrUnsupportedType
+        }
+
+        if err != nil {
+                return nil, ErrTypeMismatch
+        }
+
+        return v, nil
+}
+
+// UnmarshalValue decodes the JSON value data as a value of type t.
+// Numbers are decoded without losing precision. ErrTypeMismatch is
+// returned if data is not a valid value of type t.
+func UnmarshalValue(t Type, data []byte) (any, error) {
+        var n json.Number
+
+        switch t {
+        case Bool:
+                var v bool
+
+                if err := json.Unmarshal(data, &v); err != nil {
+                        return nil, ErrTypeMismatch
+                }
+
+                return v, nil
+        case String:
+                var v string
+
+                if err := json.Unmarshal(data, &v); err != nil {
+                        return nil, ErrTypeMismatch
+                }
+
+                return v, nil
+        case Unsupported:
+                return nil, ErrUnsupportedType
+        }
+
+        if err := json.Unmarshal(data, &n); err != nil {
+                return nil, ErrTypeMismatch
+        }
+
+        return ParseValue(t, n.String())
+}
+
+// ParseType returns the Type whose name is s. ErrUnsupportedType is
+// returned if s is not the name of a supported type.
+func ParseType(s string) (Type, error) {
+        for t := Int32; t <= String; t++ {
+                if t.String() == s {
+                        return t, nil
+                }
+        }
+
+        return Unsupported, ErrUnsupportedType
+}
+
+// MarshalText implements encoding.TextMarshaler. Types are marshalled
+// as their name.
+func (t Type) MarshalText() ([]byte, error) {
+        return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (t *Type) UnmarshalText(text []byte) error {
+        var err error
+        *t, err = ParseType(string(text))
+        return err
+}
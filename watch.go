@@ -0,0 +1,75 @@
+package configman
+
+import (
+        "context"
+        "sync"
+)
+
+// watchBuffer is the number of change events a watcher can fall behind
+// by before it is dropped.
+const watchBuffer = 64
+
+// A Watcher notifies its subscribers of the changes made to a store.
+type Watcher interface {
+        // Watch returns a channel that receives every change event until
+        // ctx is done, after which the channel is closed. The channel is
+        // also closed if the subscriber falls too far behind; it should
+        // then reload whatever it caches and watch again.
+        Watch(ctx context.Context) <-chan ChangeEvent
+}
+
+// A Broadcaster publishes change events to watchers. Stores use it to
+// implement Watcher. The zero value is ready to use.
+type Broadcaster struct {
+        mu       sync.Mutex
+        watchers map[chan ChangeEvent]struct{}
+}
+
+// Watch implements Watcher.
+func (broadcaster *Broadcaster) Watch(ctx context.Context) <-chan ChangeEvent {
+        ch := make(chan ChangeEvent, watchBuffer)
+
+        broadcaster.mu.Lock()
+
+        if broadcaster.watchers == nil {
+                broadcaster.watchers = make(map[chan ChangeEvent]struct{})
+        }
+
+        broadcaster.watchers[ch] = struct{}{}
+        broadcaster.mu.Unlock()
+
+        go func() {
+                <-ctx.Done()
+                broadcaster.drop(ch)
+        }()
+
+        return ch
+}
+
+// Publish sends event to every watcher. Watchers whose buffer is full
+// are dropped instead of blocking the publisher.
+func (broadcaster *Broadcaster) Publish(event ChangeEvent) {
+        broadcaster.mu.Lock()
+        defer broadcaster.mu.Unlock()
+
+        for ch := range broadcaster.watchers {
+                select {
+                case ch <- event:
+                default:
+                        delete(broadcaster.watchers, ch)
+                        close(ch)
+                }
+        }
+}
+
+// drop closes ch and stops sending events to it, unless that already
+// happened.
+func (broadcaster *Broadcaster) drop(ch chan ChangeEvent) {
+        broadcaster.mu.Lock()
+        defer broadcaster.mu.Unlock()
+
+        if _, ok := broadcaster.watchers[ch]; ok {
+                delete(broadcaster.watchers, ch)
+                close(ch)
+        }
+}